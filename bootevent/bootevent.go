@@ -0,0 +1,128 @@
+// Package bootevent recognizes common bootloader and kernel console output, such as the U-Boot
+// autoboot prompt, a kernel panic or a login prompt, turning it into structured events.
+package bootevent
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+)
+
+// Kind is the kind of an event.
+type Kind string
+
+const (
+	// The bootloader started, Detail is its version.
+	BootloaderStart Kind = "bootloader-start"
+	// The bootloader is counting down to boot, and can be interrupted by sending a key.
+	AutobootPrompt Kind = "autoboot-prompt"
+	// The kernel started, Detail is its version.
+	KernelStart Kind = "kernel-start"
+	// The kernel panicked, Detail is the reason.
+	KernelPanic Kind = "kernel-panic"
+	// The kernel hit an oops or a bug, Detail is the description.
+	KernelOops Kind = "kernel-oops"
+	// A login prompt is waiting for a user name, Detail is the prompt.
+	LoginPrompt Kind = "login-prompt"
+)
+
+// Event is a recognized console event.
+type Event struct {
+	Time time.Time `json:"time"`
+	Kind Kind      `json:"kind"`
+	// Detail extracted from the line, depending on Kind.
+	Detail string `json:"detail,omitempty"`
+	// Line the event was recognized in, without line ending.
+	Line string `json:"line"`
+}
+
+// rule recognizes an event from a line. The first subexpression of pattern, if any, is the
+// event detail.
+type rule struct {
+	kind    Kind
+	pattern *regexp.Regexp
+	// Prompts are not followed by a line ending, so are also matched against incomplete lines.
+	prompt bool
+}
+
+var rules = []rule{
+	{kind: BootloaderStart, pattern: regexp.MustCompile(`^U-Boot (?:SPL )?(\d{4}\.\d{2}\S*)`)},
+	{kind: AutobootPrompt, pattern: regexp.MustCompile(`(Hit any key to stop autoboot|Autobooting in \d+ seconds|autoboot in \d+ seconds)`), prompt: true},
+	{kind: KernelStart, pattern: regexp.MustCompile(`Linux version (\S+)`)},
+	{kind: KernelPanic, pattern: regexp.MustCompile(`Kernel panic - not syncing:\s*(.*)`)},
+	{kind: KernelOops, pattern: regexp.MustCompile(`(?:^|\]\s)((?:Internal error: )?Oops\b.*|BUG: .*)`)},
+	{kind: LoginPrompt, pattern: regexp.MustCompile(`^((?:\S.*\s)?login:)\s*$`), prompt: true},
+}
+
+// ansiEscape matches terminal escape sequences, which consoles commonly color output with.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// Decoder is an io.Writer recognizing events in console output written to it.
+type Decoder struct {
+	maxLineLength int
+	emit          func(Event)
+
+	line []byte
+	// Prompt kinds already emitted for the current, incomplete, line.
+	prompted map[Kind]bool
+}
+
+// NewDecoder returns a Decoder calling emit for each event. Lines longer than maxLineLength are
+// split.
+func NewDecoder(maxLineLength int, emit func(Event)) *Decoder {
+	return &Decoder{
+		maxLineLength: maxLineLength,
+		emit:          emit,
+		prompted:      map[Kind]bool{},
+	}
+}
+
+func (d *Decoder) match(line []byte, complete bool) {
+	line = ansiEscape.ReplaceAll(bytes.TrimRight(line, "\r"), nil)
+	for _, rule := range rules {
+		if !complete && !rule.prompt {
+			continue
+		}
+		if d.prompted[rule.kind] {
+			continue
+		}
+		match := rule.pattern.FindSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if !complete {
+			d.prompted[rule.kind] = true
+		}
+		event := Event{Time: time.Now(), Kind: rule.kind, Line: string(line)}
+		if len(match) > 1 {
+			event.Detail = string(match[1])
+		}
+		d.emit(event)
+	}
+}
+
+// Write recognizes events in p. It never fails.
+func (d *Decoder) Write(p []byte) (int, error) {
+	data := p
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			d.line = append(d.line, data...)
+			break
+		}
+		d.line = append(d.line, data[:i]...)
+		data = data[i+1:]
+		d.match(d.line, true)
+		d.line = d.line[:0]
+		clear(d.prompted)
+	}
+	if len(d.line) > d.maxLineLength {
+		d.match(d.line, true)
+		d.line = d.line[:0]
+		clear(d.prompted)
+	}
+	if len(d.line) > 0 {
+		d.match(d.line, false)
+	}
+	return len(p), nil
+}
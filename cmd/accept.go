@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// Bounds of the delay between failed accepts.
+const (
+	acceptMinDelay = 5 * time.Millisecond
+	acceptMaxDelay = time.Second
+)
+
+// isTemporaryAcceptError returns whether err is an Accept error which is expected to go away on
+// its own, such as running out of file descriptors or a client aborting before being accepted,
+// as opposed to a broken listener.
+func isTemporaryAcceptError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{
+		syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM,
+		syscall.ECONNABORTED, syscall.ECONNRESET, syscall.EINTR, syscall.EAGAIN,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// baseConn returns the connection conn wraps, such as for PROXY protocol or per address limits,
+// if any.
+func baseConn(conn net.Conn) net.Conn {
+	for {
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return conn
+		}
+		conn = wrapper.NetConn()
+	}
+}
+
+// acceptor accepts connections from a listener, backing off exponentially on errors and
+// rebinding broken listeners, so a failing listener does not spin.
+type acceptor struct {
+	// How long accepting may keep failing before giving up.
+	failureTimeout time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	// rebind returns a new listener, or is nil when the listener can not be rebound, such as when
+	// passed by systemd.
+	rebind func() (net.Listener, error)
+}
+
+// newListenerAcceptor returns an acceptor for listener, which is not rebound on failures.
+func newListenerAcceptor(listener net.Listener) *acceptor {
+	return &acceptor{listener: listener, failureTimeout: acceptFailureTimeout}
+}
+
+// sleep waits for delay or for ctx to be done.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Accept waits for the next connection. It returns an error when ctx is done, or when accepting
+// has been failing for longer than failureTimeout.
+func (a *acceptor) Accept(ctx context.Context) (net.Conn, error) {
+	logger := log.MustLogger(ctx)
+	var failingSince time.Time
+	delay := acceptMinDelay
+	for {
+		listener, rebind := a.current()
+		conn, err := listener.Accept()
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if next, _ := a.current(); next != listener {
+			// Replaced by replace, which closed it.
+			continue
+		}
+
+		if failingSince.IsZero() {
+			failingSince = time.Now()
+		} else if time.Since(failingSince) > a.failureTimeout {
+			return nil, fmt.Errorf("failed to accept connections for %s: %w", a.failureTimeout, err)
+		}
+		temporary := isTemporaryAcceptError(err)
+		logger.Error("Failed to accept connection", "error", err, "temporary", temporary, "retry-in", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		delay = min(2*delay, acceptMaxDelay)
+
+		if temporary || rebind == nil {
+			continue
+		}
+		logger.Info("Rebinding listener")
+		if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Error("Failed to close listener", "error", err)
+		}
+		rebound, err := rebind()
+		if err != nil {
+			// Accepting from the closed listener fails, and rebinding is tried again.
+			logger.Error("Failed to rebind listener", "error", err)
+			continue
+		}
+		a.mu.Lock()
+		if a.listener == listener {
+			a.listener = rebound
+		} else {
+			rebound.Close()
+		}
+		a.mu.Unlock()
+	}
+}
+
+// current returns the listener, and how to rebind it.
+func (a *acceptor) current() (net.Listener, func() (net.Listener, error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.listener, a.rebind
+}
+
+// Addr returns the address of the listener.
+func (a *acceptor) Addr() net.Addr {
+	listener, _ := a.current()
+	return listener.Addr()
+}
+
+// replace accepts from a listener bound by rebind from now on, such as for a new address,
+// closing the current one. Connections already accepted are left alone.
+func (a *acceptor) replace(rebind func() (net.Listener, error)) error {
+	listener, err := rebind()
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	previous := a.listener
+	a.listener = listener
+	a.rebind = rebind
+	a.mu.Unlock()
+	if err := previous.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// Close closes the listener.
+func (a *acceptor) Close() error {
+	listener, _ := a.current()
+	if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// acceptResult is the outcome of accepting a connection.
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// mergeAccepts returns a function accepting connections from any of accepts, which are called
+// in the background until one fails or ctx is done.
+func mergeAccepts(ctx context.Context, accepts ...func(context.Context) (net.Conn, error)) func(context.Context) (net.Conn, error) {
+	results := make(chan acceptResult)
+	for _, accept := range accepts {
+		go func() {
+			for {
+				conn, err := accept(ctx)
+				select {
+				case results <- acceptResult{conn: conn, err: err}:
+				case <-ctx.Done():
+					if conn != nil {
+						conn.Close()
+					}
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	return func(ctx context.Context) (net.Conn, error) {
+		select {
+		case result := <-results:
+			return result.conn, result.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
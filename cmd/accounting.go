@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// AccountingRecord is a single session entry of the accounting store.
+type AccountingRecord struct {
+	PortName   string    `json:"port_name"`
+	RemoteAddr string    `json:"remote_addr"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	// Bytes read from the serial port and sent to the client.
+	BytesToClient uint64 `json:"bytes_to_client"`
+	// Bytes received from the client and written to the serial port.
+	BytesToPort uint64 `json:"bytes_to_port"`
+}
+
+// Client returns the client host, without the port.
+func (r AccountingRecord) Client() string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// accountingStore stores AccountingRecord.
+type accountingStore interface {
+	// Append stores record.
+	Append(ctx context.Context, record AccountingRecord) error
+	// Read reads all records which ended at or after since.
+	Read(ctx context.Context, since time.Time) ([]AccountingRecord, error)
+}
+
+// fileAccountingStore is an accounting store file, with one JSON encoded AccountingRecord per line.
+type fileAccountingStore string
+
+func (path fileAccountingStore) Append(ctx context.Context, record AccountingRecord) (err error) {
+	f, err := os.OpenFile(string(path), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open accounting file: %w", err)
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accounting record: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write accounting file: %w", err)
+	}
+	return nil
+}
+
+func (path fileAccountingStore) Read(ctx context.Context, since time.Time) (records []AccountingRecord, err error) {
+	f, err := os.Open(string(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open accounting file: %w", err)
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record AccountingRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: failed to parse accounting record: %w", path, line, err)
+		}
+		if record.End.Before(since) {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read accounting file: %w", err)
+	}
+	return records, nil
+}
+
+// countingWriter wraps an io.Writer counting the number of bytes written.
+type countingWriter struct {
+	io.Writer
+	count atomic.Uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.count.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,95 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fornellas/serialtcp/storage"
+)
+
+// openAccountingStore returns the accounting store at location, which is either a file or remote
+// storage (see storage.New).
+func openAccountingStore(location string) (accountingStore, error) {
+	if !storage.IsRemote(location) {
+		return fileAccountingStore(location), nil
+	}
+	store, err := storage.New(location)
+	if err != nil {
+		return nil, err
+	}
+	return objectAccountingStore{Storage: store}, nil
+}
+
+// Layout of the end time prefixing accounting object names, which sorts chronologically.
+const accountingObjectTimeLayout = "20060102T150405.000000000Z"
+
+// objectAccountingStore stores each AccountingRecord as a JSON encoded object, as object storage can
+// not append. Objects are named after the session end time, so old ones can be skipped by name.
+type objectAccountingStore struct {
+	storage.Storage
+}
+
+func (s objectAccountingStore) Append(ctx context.Context, record AccountingRecord) (err error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accounting record: %w", err)
+	}
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%x.json", record.End.UTC().Format(accountingObjectTimeLayout), suffix)
+
+	w, err := s.Create(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to create accounting record: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return errors.Join(fmt.Errorf("failed to write accounting record: %w", err), w.Close())
+	}
+	return w.Close()
+}
+
+func (s objectAccountingStore) readRecord(ctx context.Context, name string) (record AccountingRecord, err error) {
+	r, err := s.Open(ctx, name)
+	if err != nil {
+		return record, fmt.Errorf("failed to open accounting record: %w", err)
+	}
+	defer func() { err = errors.Join(err, r.Close()) }()
+	if err := json.NewDecoder(r).Decode(&record); err != nil {
+		return record, fmt.Errorf("%s: failed to parse accounting record: %w", name, err)
+	}
+	return record, nil
+}
+
+func (s objectAccountingStore) Read(ctx context.Context, since time.Time) ([]AccountingRecord, error) {
+	names, err := s.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounting records: %w", err)
+	}
+	// Only compared down to the second, records ending within that second are filtered by End.
+	sinceName := since.UTC().Truncate(time.Second).Format("20060102T150405")
+
+	var records []AccountingRecord
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".json") || name < sinceName {
+			continue
+		}
+		record, err := s.readRecord(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if record.End.Before(since) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/net/websocket"
+)
+
+// Prefix of Unix domain socket addresses.
+const unixAddressPrefix = "unix://"
+
+// Prefix of Windows named pipe addresses.
+const pipeAddressPrefix = `\\.\pipe\`
+
+// Prefixes of WebSocket addresses, which are only dialed, such as bridges behind HTTP reverse
+// proxies.
+const (
+	webSocketAddressPrefix       = "ws://"
+	secureWebSocketAddressPrefix = "wss://"
+)
+
+// splitAddress returns the network and address for address, which is either host:port for TCP,
+// unix:///path for a Unix domain socket, \\.\pipe\name for a Windows named pipe or a ws:// or
+// wss:// URL for WebSocket.
+func splitAddress(address string) (string, string) {
+	lower := strings.ToLower(address)
+	if strings.HasPrefix(lower, webSocketAddressPrefix) || strings.HasPrefix(lower, secureWebSocketAddressPrefix) {
+		return "websocket", address
+	}
+	if path, ok := strings.CutPrefix(address, unixAddressPrefix); ok {
+		return "unix", path
+	}
+	if strings.HasPrefix(lower, pipeAddressPrefix) {
+		return "pipe", address
+	}
+	return "tcp", address
+}
+
+// removeStaleSocket removes the Unix domain socket at path if nothing listens on it anymore, as
+// left behind by a process which did not exit cleanly. Anything else at path is left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("address in use, not a socket: %s", path)
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("address in use: %s", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("address in use: %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// listen listens on address, as accepted by splitAddress. A stale Unix domain socket is removed
+// first.
+func listen(address string) (listener net.Listener, err error) {
+	network, addr := splitAddress(address)
+	switch network {
+	case "unix":
+		if err := removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+		listener, err = net.Listen(network, addr)
+	case "pipe":
+		listener, err = listenPipe(addr)
+	case "websocket":
+		err = errors.New("WebSocket addresses can only be connected to")
+	default:
+		listener, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %s: %w", address, err)
+	}
+	return listener, nil
+}
+
+// dial connects to address, as accepted by splitAddress.
+func dial(address string) (conn net.Conn, err error) {
+	network, addr := splitAddress(address)
+	switch network {
+	case "pipe":
+		conn, err = dialPipe(addr)
+	case "websocket":
+		conn, err = dialWebSocket(addr)
+	default:
+		conn, err = net.Dial(network, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	return conn, nil
+}
+
+// dialWebSocket connects to a ws:// or wss:// URL, exchanging data as binary messages.
+func dialWebSocket(rawURL string) (net.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	// Reverse proxies may check the origin, which for a non browser client is the server itself.
+	origin := &url.URL{Scheme: "http", Host: u.Host}
+	if strings.EqualFold(u.Scheme, "wss") {
+		origin.Scheme = "https"
+	}
+	conn, err := websocket.Dial(u.String(), "", origin.String())
+	if err != nil {
+		return nil, err
+	}
+	conn.PayloadType = websocket.BinaryFrame
+	return conn, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+)
+
+var AdminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administrative operations.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cmd.Help(); err != nil {
+			logger := log.MustLogger(cmd.Context())
+			logger.Error("Failed to display help", "err", err)
+		}
+		Exit(1)
+	},
+}
+
+var usageAccountingFile string
+var usageAccountingFileDefault = ""
+
+var usageSince time.Duration
+var usageSinceDefault = 24 * time.Hour
+
+type usageSummary struct {
+	sessions      int
+	bytesToClient uint64
+	bytesToPort   uint64
+}
+
+func (s *usageSummary) add(record AccountingRecord) {
+	s.sessions++
+	s.bytesToClient += record.BytesToClient
+	s.bytesToPort += record.BytesToPort
+}
+
+func printUsageSummaries(w *tabwriter.Writer, title string, summaries map[string]*usageSummary) {
+	keys := make([]string, 0, len(summaries))
+	for key := range summaries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "%s\tSESSIONS\tBYTES TO CLIENT\tBYTES TO PORT\n", title)
+	for _, key := range keys {
+		summary := summaries[key]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", key, summary.sessions, summary.bytesToClient, summary.bytesToPort)
+	}
+}
+
+var UsageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Summarize bandwidth usage.",
+	Long:  "Summarizes per-port and per-client byte counts and session counts from the accounting store written by serve --accounting-file.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		store, err := openAccountingStore(usageAccountingFile)
+		if err != nil {
+			return err
+		}
+		records, err := store.Read(cmd.Context(), time.Now().Add(-usageSince))
+		if err != nil {
+			return err
+		}
+
+		ports := map[string]*usageSummary{}
+		clients := map[string]*usageSummary{}
+		for _, record := range records {
+			if _, ok := ports[record.PortName]; !ok {
+				ports[record.PortName] = &usageSummary{}
+			}
+			ports[record.PortName].add(record)
+			if _, ok := clients[record.Client()]; !ok {
+				clients[record.Client()] = &usageSummary{}
+			}
+			clients[record.Client()].add(record)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		printUsageSummaries(w, "PORT", ports)
+		fmt.Fprintln(w)
+		printUsageSummaries(w, "CLIENT", clients)
+		return w.Flush()
+	}),
+}
+
+var adminControlSocket string
+var adminControlSocketDefault = ""
+
+var drainMessage string
+var drainMessageDefault = "This server is down for maintenance, try again later.\r\n"
+
+var drainWait bool
+var drainWaitDefault = false
+
+// How often drain --wait checks for active sessions.
+const drainWaitInterval = time.Second
+
+var DrainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Stop accepting new clients, for maintenance.",
+	Long:  "Makes a running server turn new clients away with a maintenance message, while letting existing sessions finish, until undrain.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		logger := log.MustLogger(ctx)
+		_, err := controlCall(adminControlSocket, ControlRequest{Command: controlDrain, Enable: true, Message: drainMessage})
+		if err != nil {
+			return err
+		}
+		logger.Info("Draining")
+		if !drainWait {
+			return nil
+		}
+		for {
+			response, err := controlCall(adminControlSocket, ControlRequest{Command: controlStats})
+			if err != nil {
+				return err
+			}
+			if response.Stats.ActiveSessions == 0 {
+				logger.Info("Drained")
+				return nil
+			}
+			logger.Info("Waiting for sessions to finish", "active-sessions", response.Stats.ActiveSessions)
+			if err := sleep(ctx, drainWaitInterval); err != nil {
+				return err
+			}
+		}
+	}),
+}
+
+var UndrainCmd = &cobra.Command{
+	Use:   "undrain",
+	Short: "Accept new clients again, after drain.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		_, err := controlCall(adminControlSocket, ControlRequest{Command: controlDrain, Enable: false})
+		return err
+	}),
+}
+
+func init() {
+	UsageCmd.PersistentFlags().StringVarP(&usageAccountingFile, "accounting-file", "", usageAccountingFileDefault, "Accounting store file or s3://bucket/prefix, as written by serve")
+	if err := UsageCmd.MarkPersistentFlagRequired("accounting-file"); err != nil {
+		panic(err)
+	}
+	UsageCmd.PersistentFlags().DurationVarP(&usageSince, "since", "", usageSinceDefault, "Only consider sessions that ended within this duration")
+	AdminCmd.AddCommand(UsageCmd)
+
+	for _, cmd := range []*cobra.Command{DrainCmd, UndrainCmd} {
+		cmd.PersistentFlags().StringVarP(&adminControlSocket, "control-socket", "c", adminControlSocketDefault, "Server control socket path")
+		if err := cmd.MarkPersistentFlagRequired("control-socket"); err != nil {
+			panic(err)
+		}
+		AdminCmd.AddCommand(cmd)
+	}
+	DrainCmd.PersistentFlags().StringVarP(&drainMessage, "message", "", drainMessageDefault, "Message sent to clients turned away")
+	DrainCmd.PersistentFlags().BoolVarP(&drainWait, "wait", "", drainWaitDefault, "Wait for existing sessions to finish")
+
+	RootCmd.AddCommand(AdminCmd)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var maxConnections int
+var maxConnectionsDefault = 1
+
+var maxQueue int
+var maxQueueDefault = 10
+
+// BusyPolicy defines what happens to connections arriving while --max-connections sessions are
+// in progress.
+type BusyPolicy int
+
+const (
+	// Leave them waiting, unaccepted, in the listen backlog.
+	BusyWait BusyPolicy = iota
+	// Accept and close them, telling them the server is busy.
+	BusyRefuse
+	// Accept and queue them, telling them their position in line.
+	BusyQueue
+)
+
+var busyPolicyNames = map[BusyPolicy]string{
+	BusyWait:   "wait",
+	BusyRefuse: "refuse",
+	BusyQueue:  "queue",
+}
+
+// BusyPolicyValue implements pflag.Value for BusyPolicy
+type BusyPolicyValue BusyPolicy
+
+func (p *BusyPolicyValue) String() string {
+	return busyPolicyNames[BusyPolicy(*p)]
+}
+
+func (p *BusyPolicyValue) Set(s string) error {
+	for policy, name := range busyPolicyNames {
+		if strings.EqualFold(s, name) {
+			*p = BusyPolicyValue(policy)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid busy policy: %s", s)
+}
+
+func (p *BusyPolicyValue) Type() string {
+	return "policy"
+}
+
+var busyPolicy = BusyPolicyValue(BusyWait)
+
+// checkAdmission validates the admission flags.
+func checkAdmission() error {
+	if maxConnections < 1 {
+		return fmt.Errorf("invalid maximum connections: %d", maxConnections)
+	}
+	if maxConnections > 1 && execCommand == "" && shellProgram == "" {
+		return errors.New("--max-connections above 1 requires --exec or --shell, as a serial port can only be open by one session at a time")
+	}
+	if maxQueue < 0 {
+		return fmt.Errorf("invalid maximum queue: %d", maxQueue)
+	}
+	if allowSteal {
+		if maxConnections != 1 {
+			return errors.New("--allow-steal requires --max-connections 1")
+		}
+		if BusyPolicy(busyPolicy) == BusyWait {
+			return errors.New("--allow-steal requires --busy-policy refuse or queue, so busy clients are accepted to ask")
+		}
+	}
+	return nil
+}
+
+// Sent to connections refused by BusyRefuse, or by BusyQueue with a full queue.
+const busyMessage = "Server busy, try again later\r\n"
+
+// Sent to queued connections whenever their position in line changes.
+const positionFormat = "You are #%d in line\r\n"
+
+// Starts the line sent to connections taking over the session.
+const tookOverPrefix = "Took over the session from "
+
+// admission limits sessions in progress to --max-connections, handling connections beyond it by
+// --busy-policy.
+type admission struct {
+	policy   BusyPolicy
+	maxQueue int
+	// With --allow-steal, the server whose sessions busy clients may take over.
+	stealFrom *server
+	// Sessions in progress, taking slots.
+	slots chan struct{}
+
+	mu sync.Mutex
+	// Queued connections, in order, each waiting for its channel to be closed when it is handed
+	// a slot.
+	queue []*queuedConn
+}
+
+// queuedConn is a connection waiting in line.
+type queuedConn struct {
+	conn  net.Conn
+	ready chan struct{}
+}
+
+func newAdmission(maxSessions int, policy BusyPolicy, maxQueue int, stealFrom *server) *admission {
+	return &admission{policy: policy, maxQueue: maxQueue, stealFrom: stealFrom, slots: make(chan struct{}, maxSessions)}
+}
+
+// waitSlot waits for a free slot before accepting, with BusyWait, so that connections wait in the
+// listen backlog, as with a single session at a time. It returns false if ctx is done first.
+func (a *admission) waitSlot(ctx context.Context) bool {
+	if a.policy != BusyWait {
+		return true
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// admit takes a slot for conn, returning false, with conn closed, if it was turned away, or ctx is
+// done while it waits in line. Otherwise, it returns the connection to use for further reads. With
+// BusyWait, the slot was taken by waitSlot.
+func (a *admission) admit(ctx context.Context, conn net.Conn) (net.Conn, bool) {
+	if a.policy == BusyWait {
+		return conn, true
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return conn, true
+	default:
+	}
+	logger := log.MustLogger(ctx)
+	queued := &queuedConn{conn: conn, ready: make(chan struct{})}
+	a.mu.Lock()
+	full := a.policy == BusyRefuse || len(a.queue) >= a.maxQueue
+	if !full {
+		a.queue = append(a.queue, queued)
+	}
+	position := len(a.queue)
+	a.mu.Unlock()
+	if full {
+		if a.stealFrom == nil {
+			logger.Info("Busy, turning client away")
+			turnAway(ctx, conn)
+			return nil, false
+		}
+		logger.Info("Busy, waiting for a steal request")
+		_, _ = io.WriteString(conn, busyMessage)
+	} else {
+		logger.Info("Busy, queueing client", "position", position)
+		tellPosition(conn, position)
+	}
+	return a.await(ctx, queued, full)
+}
+
+// await waits for queued to be handed a slot, or, with --allow-steal, to take over the session.
+// Unless it is in line, it is turned away after stealTimeout.
+func (a *admission) await(ctx context.Context, queued *queuedConn, full bool) (net.Conn, bool) {
+	logger := log.MustLogger(ctx)
+	conn := queued.conn
+	var watch *stealWatch
+	var stole <-chan struct{}
+	if a.stealFrom != nil {
+		_, _ = io.WriteString(conn, stealHint)
+		watch = watchSteal(conn, a.stealFrom)
+		stole = watch.done
+	}
+	var timeout <-chan time.Time
+	if full {
+		timeout = time.After(stealTimeout)
+	}
+	for {
+		select {
+		case <-queued.ready:
+			return a.admitted(ctx, queued, watch)
+		case <-stole:
+			stole = nil
+			if watch.err != nil {
+				logger.Error("Invalid steal request", "error", watch.err)
+				_, _ = fmt.Fprintf(conn, "ERROR %s\r\n", watch.err)
+				return nil, a.abandon(ctx, queued)
+			}
+			if watch.stole {
+				a.steal(ctx, queued)
+				timeout = nil
+			} else if full {
+				return nil, a.abandon(ctx, queued)
+			}
+		case <-timeout:
+			logger.Info("No steal request, turning client away")
+			turnAway(ctx, conn)
+			return nil, false
+		case <-ctx.Done():
+			return nil, a.abandon(ctx, queued)
+		}
+	}
+}
+
+// steal takes over the session for queued, putting it first in line, and disconnecting the
+// sessions in progress.
+func (a *admission) steal(ctx context.Context, queued *queuedConn) {
+	logger := log.MustLogger(ctx)
+	a.mu.Lock()
+	a.remove(queued)
+	a.queue = append([]*queuedConn{queued}, a.queue...)
+	a.tellPositions(1)
+	a.mu.Unlock()
+	holders := a.stealFrom.takeOver(ctx, queued.conn.RemoteAddr().String())
+	logger.Warn("Session taken over", "holders", holders)
+	_, _ = fmt.Fprintf(queued.conn, "%s%s\r\n", tookOverPrefix, strings.Join(holders, ", "))
+}
+
+// admitted returns the connection to use for queued, once it was handed a slot.
+func (a *admission) admitted(ctx context.Context, queued *queuedConn, watch *stealWatch) (net.Conn, bool) {
+	if watch == nil {
+		return queued.conn, true
+	}
+	conn, err := watch.stop()
+	if err != nil {
+		log.MustLogger(ctx).Error("Failed to stop watching for steal requests", "error", err)
+		a.release()
+		return nil, false
+	}
+	return conn, true
+}
+
+// abandon removes queued from the queue, releasing the slot it may have been handed meanwhile, and
+// closes its connection. It returns false, for admit.
+func (a *admission) abandon(ctx context.Context, queued *queuedConn) bool {
+	a.dequeue(queued)
+	select {
+	case <-queued.ready:
+		a.release()
+	default:
+	}
+	if err := queued.conn.Close(); err != nil {
+		log.MustLogger(ctx).Debug("Failed to close queued client", "error", err)
+	}
+	return false
+}
+
+// turnAway tells conn the server is busy, and closes it.
+func turnAway(ctx context.Context, conn net.Conn) {
+	_, err := io.WriteString(conn, busyMessage)
+	if err := errors.Join(err, conn.Close()); err != nil {
+		log.MustLogger(ctx).Debug("Failed to turn client away", "error", err)
+	}
+}
+
+// tellPosition tells conn its position in line. Errors are ignored, as a client gone away is
+// found out once its session starts.
+func tellPosition(conn net.Conn, position int) {
+	_, _ = fmt.Fprintf(conn, positionFormat, position)
+}
+
+// admissionMessage returns whether line is one sent to busy clients before their session starts,
+// which clients expecting a negotiation answer skip.
+func admissionMessage(line string) bool {
+	var position int
+	if _, err := fmt.Sscanf(line, positionFormat, &position); err == nil {
+		return true
+	}
+	return line == busyMessage || line == stealHint || strings.HasPrefix(line, tookOverPrefix)
+}
+
+// dequeue removes queued from the queue, if still there, telling the connections behind it their
+// new position.
+func (a *admission) dequeue(queued *queuedConn) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if i := a.remove(queued); i >= 0 {
+		a.tellPositions(i)
+	}
+}
+
+// remove removes queued from the queue, returning its index, or -1 if it was not there.
+func (a *admission) remove(queued *queuedConn) int {
+	for i, q := range a.queue {
+		if q == queued {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			return i
+		}
+	}
+	return -1
+}
+
+// tellPositions tells the queued connections from index from their position.
+func (a *admission) tellPositions(from int) {
+	for i := from; i < len(a.queue); i++ {
+		tellPosition(a.queue[i].conn, i+1)
+	}
+}
+
+// release frees the slot of an ended session, handing it to the first connection in line, if any.
+func (a *admission) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.queue) > 0 {
+		next := a.queue[0]
+		a.queue = a.queue[1:]
+		close(next.ready)
+		a.tellPositions(0)
+		return
+	}
+	<-a.slots
+}
+
+// serveConnections accepts connections with accept, handling them by the MaxConnections and
+// BusyPolicy of srv, until accepting fails, then waits for the sessions in progress to end.
+func serveConnections(ctx context.Context, accept func(context.Context) (net.Conn, error), srv *server) error {
+	logger := log.MustLogger(ctx)
+	var stealFrom *server
+	if srv.config.AllowSteal {
+		stealFrom = srv
+	}
+	admission := newAdmission(srv.config.MaxConnections, srv.config.BusyPolicy, srv.config.MaxQueue, stealFrom)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	srv.setAccepting(true)
+	defer srv.setAccepting(false)
+	for {
+		if !admission.waitSlot(ctx) {
+			return ctx.Err()
+		}
+		logger.Info("Accepting connection")
+		conn, err := accept(ctx)
+		if err != nil {
+			return err
+		}
+		ctx, logger := log.MustWithGroupAttrs(
+			ctx,
+			"Connection",
+			"LocalAddr", conn.LocalAddr(),
+			"RemoteAddr", conn.RemoteAddr(),
+		)
+		logger.Info("Accepted")
+
+		wg.Go(func() {
+			conn, ok := admission.admit(ctx, conn)
+			if !ok {
+				return
+			}
+			defer admission.release()
+			if err := handleConnection(ctx, conn, srv); err != nil {
+				logger.Error("Failed to handle connection", "error", err)
+			}
+		})
+	}
+}
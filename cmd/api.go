@@ -0,0 +1,204 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// Largest request body accepted by the API.
+const apiMaxBody = 64 << 10
+
+// apiBreakRequest is the body of POST /break.
+type apiBreakRequest struct {
+	// Break duration, as a Go duration (eg: 250ms), or empty for the ctl break default.
+	Duration string `json:"duration"`
+}
+
+// apiModeRequest is the body of POST /mode, leaving settings not given as they are.
+type apiModeRequest struct {
+	BaudRate int    `json:"baud_rate"`
+	DataBits int    `json:"data_bits"`
+	Parity   string `json:"parity"`
+	StopBits string `json:"stop_bits"`
+}
+
+// apiLinesRequest is the body of POST /lines, leaving lines not given as they are.
+type apiLinesRequest struct {
+	DTR *bool `json:"dtr"`
+	RTS *bool `json:"rts"`
+}
+
+// readAPIToken reads the token API requests authenticate with from --api-token-file.
+func readAPIToken() (string, error) {
+	data, err := os.ReadFile(apiTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty API token in %s", apiTokenFile)
+	}
+	return token, nil
+}
+
+// writeAPIResponse writes response as JSON, with status.
+func writeAPIResponse(w http.ResponseWriter, status int, response ControlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// writeAPIError writes err as a JSON error response, with status.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIResponse(w, status, ControlResponse{Error: err.Error()})
+}
+
+// decodeAPIRequest decodes the JSON body of r into v, an empty body leaving v as is.
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// authenticateAPI returns a handler calling next for requests with token as bearer token, logging
+// them.
+func authenticateAPI(ctx context.Context, token string, next http.Handler) http.Handler {
+	logger := log.MustLogger(ctx)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			logger.Warn("Unauthorized API request", "method", r.Method, "path", r.URL.Path, "remote-address", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		logger.Info("API request", "method", r.Method, "path", r.URL.Path, "remote-address", r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiHandler returns the handler of the API controlling srv, as the control socket does.
+func apiHandler(srv *server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		stats := srv.Stats()
+		writeAPIResponse(w, http.StatusOK, ControlResponse{Stats: &stats, Ports: srv.Ports()})
+	})
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		// ControlResponse omits empty lists.
+		sessions := append([]SessionInfo{}, srv.Sessions()...)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string][]SessionInfo{"sessions": sessions})
+	})
+	mux.HandleFunc("DELETE /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid session ID: %w", err))
+			return
+		}
+		if err := srv.Kick(id); err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		writeAPIResponse(w, http.StatusOK, ControlResponse{})
+	})
+	mux.HandleFunc("POST /break", func(w http.ResponseWriter, r *http.Request) {
+		var request apiBreakRequest
+		if err := decodeAPIRequest(w, r, &request); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		duration := ctlBreakDurationDefault
+		if request.Duration != "" {
+			var err error
+			if duration, err = time.ParseDuration(request.Duration); err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %q", request.Duration))
+				return
+			}
+		}
+		if err := checkBreakDuration(duration); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAPIResult(w, srv.Break(duration))
+	})
+	mux.HandleFunc("POST /mode", func(w http.ResponseWriter, r *http.Request) {
+		var request apiModeRequest
+		if err := decodeAPIRequest(w, r, &request); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		if request.BaudRate < 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid baud rate: %d", request.BaudRate))
+			return
+		}
+		writeAPIResult(w, setControlMode(srv, ControlRequest{
+			Command:  controlMode,
+			BaudRate: request.BaudRate,
+			DataBits: request.DataBits,
+			Parity:   request.Parity,
+			StopBits: request.StopBits,
+		}))
+	})
+	mux.HandleFunc("POST /lines", func(w http.ResponseWriter, r *http.Request) {
+		var request apiLinesRequest
+		if err := decodeAPIRequest(w, r, &request); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		var err error
+		if request.DTR != nil {
+			err = srv.SetDTR(*request.DTR)
+		}
+		if request.RTS != nil && err == nil {
+			err = srv.SetRTS(*request.RTS)
+		}
+		writeAPIResult(w, err)
+	})
+	return mux
+}
+
+// writeAPIResult writes the outcome of acting on the serial port, which fails while it is not
+// open, or with invalid settings.
+func writeAPIResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, ControlResponse{})
+}
+
+// serveAPI serves the API controlling srv on listener, authenticated by token, until ctx is done.
+func serveAPI(ctx context.Context, listener net.Listener, srv *server, token string) error {
+	httpServer := &http.Server{
+		Handler:           authenticateAPI(ctx, token, apiHandler(srv)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
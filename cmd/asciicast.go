@@ -0,0 +1,81 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// Terminal size recorded in asciicast headers, as the client terminal size is not known.
+const (
+	asciicastWidth  = 80
+	asciicastHeight = 24
+)
+
+// asciicastHeader is the first line of an asciicast v2 file, see
+// https://docs.asciinema.org/manual/asciicast/v2/.
+type asciicastHeader struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+	Title     string `json:"title,omitempty"`
+}
+
+// asciicastWriter writes an asciicast v2 file, for asciinema to play, with data sent to clients as
+// output events and data sent to the serial port as input events.
+type asciicastWriter struct {
+	encoder *json.Encoder
+	start   time.Time
+	// Incomplete UTF-8 sequences at the end of the last data of each direction, as events are
+	// strings.
+	partial map[string][]byte
+}
+
+// newAsciicastWriter writes the asciicast header for a session starting at start to w.
+func newAsciicastWriter(w io.Writer, start time.Time, title string) (*asciicastWriter, error) {
+	a := &asciicastWriter{encoder: json.NewEncoder(w), start: start, partial: map[string][]byte{}}
+	header := asciicastHeader{
+		Version:   2,
+		Width:     asciicastWidth,
+		Height:    asciicastHeight,
+		Timestamp: start.Unix(),
+		Title:     title,
+	}
+	if err := a.encoder.Encode(header); err != nil {
+		return nil, fmt.Errorf("failed to write capture: %w", err)
+	}
+	return a, nil
+}
+
+// encode writes record as an event, holding back a trailing incomplete UTF-8 sequence until the
+// rest of it arrives.
+func (a *asciicastWriter) encode(record CaptureRecord) error {
+	data := append(a.partial[record.Direction], record.Data...)
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	a.partial[record.Direction] = append([]byte(nil), data[end:]...)
+	if end == 0 {
+		return nil
+	}
+	eventType := "i"
+	if record.Direction == captureToClient {
+		eventType = "o"
+	}
+	event := []any{record.Time.Sub(a.start).Seconds(), eventType, string(data[:end])}
+	if err := a.encoder.Encode(event); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	return nil
+}
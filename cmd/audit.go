@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var auditLog string
+var auditLogDefault = ""
+
+var auditSyslog string
+var auditSyslogDefault = ""
+
+// AuditRecord is an entry of the audit log, recording who used the serial port, from where, when,
+// for how long and how.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Event, as --hook-script SERIALTCP_EVENT: connect, error or disconnect.
+	Event      string `json:"event"`
+	SessionID  uint64 `json:"session_id"`
+	RemoteAddr string `json:"remote_addr"`
+	PortName   string `json:"port_name"`
+	// Who the client authenticated as, see ConnectionInfo.Auth.
+	Auth string `json:"auth"`
+	// Whether the client could write to the serial port.
+	Write bool      `json:"write"`
+	Start time.Time `json:"start"`
+	// Session duration, in seconds, for disconnect events once the session started.
+	Duration float64 `json:"duration,omitempty"`
+	// Bytes read from the serial port and sent to the client, for disconnect events once the
+	// session started.
+	BytesToClient uint64 `json:"bytes_to_client,omitempty"`
+	// Bytes received from the client and written to the serial port, for disconnect events once
+	// the session started.
+	BytesToPort uint64 `json:"bytes_to_port,omitempty"`
+	// Error, for error events.
+	Error string `json:"error,omitempty"`
+}
+
+func newAuditRecord(event Event) AuditRecord {
+	record := AuditRecord{
+		Time:       event.Time,
+		Event:      event.Type.String(),
+		SessionID:  event.Session.ID,
+		RemoteAddr: event.Session.RemoteAddr,
+		PortName:   event.Session.PortName,
+		Auth:       event.Session.Auth,
+		Write:      !event.Session.ReadOnly,
+		Start:      event.Session.Start,
+	}
+	if event.Stats != nil {
+		record.Duration = event.Time.Sub(event.Stats.Start).Seconds()
+		record.BytesToClient = event.Stats.BytesToClient
+		record.BytesToPort = event.Stats.BytesToPort
+	}
+	if event.Err != nil {
+		record.Error = event.Err.Error()
+	}
+	return record
+}
+
+// auditor appends audit records, one JSON encoded AuditRecord per line, to a file, kept apart from
+// debug logs, and to syslog.
+type auditor struct {
+	mu     sync.Mutex
+	file   *os.File
+	syslog io.WriteCloser
+}
+
+// openAuditor opens the audit log file, if path is set, only ever appending to it, and connects
+// to syslog, if syslogAddress is set, see openAuditSyslog.
+func openAuditor(path, syslogAddress string) (*auditor, error) {
+	a := &auditor{}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		a.file = file
+	}
+	if syslogAddress != "" {
+		syslog, err := openAuditSyslog(syslogAddress)
+		if err != nil {
+			return nil, errors.Join(err, a.Close())
+		}
+		a.syslog = syslog
+	}
+	return a, nil
+}
+
+// Append appends record, synced to disk, so it survives crashes.
+func (a *auditor) Append(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil {
+		if _, err := a.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write audit log: %w", err)
+		}
+		if err := a.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+	if a.syslog != nil {
+		if _, err := a.syslog.Write(data); err != nil {
+			return fmt.Errorf("failed to send audit record to syslog: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a *auditor) Close() error {
+	var err error
+	if a.file != nil {
+		err = errors.Join(err, a.file.Close())
+	}
+	if a.syslog != nil {
+		err = errors.Join(err, a.syslog.Close())
+	}
+	return err
+}
+
+// handler returns an EventHandler appending connect, error and disconnect events to a.
+func (a *auditor) handler() EventHandler {
+	return func(ctx context.Context, event Event) {
+		switch event.Type {
+		case EventConnect, EventError, EventDisconnect:
+		default:
+			return
+		}
+		if err := a.Append(newAuditRecord(event)); err != nil {
+			log.MustLogger(ctx).Error("Failed to record audit log", "error", err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fornellas/slogxt/log"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// BackpressureMode is how a client not keeping up is signaled to the device.
+type BackpressureMode int
+
+const (
+	// Do not signal the device.
+	BackpressureOff BackpressureMode = iota
+	// Deassert RTS, for hardware flow control.
+	BackpressureRTS
+	// Send XOFF, and XON to resume, for software flow control.
+	BackpressureXONXOFF
+)
+
+var backpressureModeNames = map[BackpressureMode]string{
+	BackpressureOff:     "off",
+	BackpressureRTS:     "rts",
+	BackpressureXONXOFF: "xon-xoff",
+}
+
+// BackpressureModeValue implements pflag.Value for BackpressureMode
+type BackpressureModeValue BackpressureMode
+
+func (m *BackpressureModeValue) String() string {
+	return backpressureModeNames[BackpressureMode(*m)]
+}
+
+func (m *BackpressureModeValue) Set(s string) error {
+	for mode, name := range backpressureModeNames {
+		if strings.EqualFold(s, name) {
+			*m = BackpressureModeValue(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid backpressure mode: %s", s)
+}
+
+func (m *BackpressureModeValue) Type() string {
+	return "mode"
+}
+
+// Software flow control characters.
+const (
+	xon  = 0x11
+	xoff = 0x13
+)
+
+// backpressure pauses the device transmitting while the client can not keep up.
+type backpressure struct {
+	ctx  context.Context
+	mode BackpressureMode
+	port serialport.Port
+	// Count of failures to propagate.
+	errors *atomic.Uint64
+	paused bool
+}
+
+// newBackpressure returns a backpressure for port, or nil when mode is BackpressureOff. Failures
+// are counted at errors.
+func newBackpressure(ctx context.Context, mode BackpressureMode, port serialport.Port, errors *atomic.Uint64) *backpressure {
+	if mode == BackpressureOff {
+		return nil
+	}
+	return &backpressure{ctx: ctx, mode: mode, port: port, errors: errors}
+}
+
+// Set pauses or resumes the device transmitting. Failures are logged, as data still flows without
+// flow control.
+func (b *backpressure) Set(paused bool) {
+	if paused == b.paused {
+		return
+	}
+	b.paused = paused
+
+	logger := log.MustLogger(b.ctx)
+	logger.Debug("Propagating backpressure", "paused", paused)
+	var err error
+	switch b.mode {
+	case BackpressureRTS:
+		err = b.port.SetRTS(!paused)
+	case BackpressureXONXOFF:
+		c := byte(xon)
+		if paused {
+			c = xoff
+		}
+		_, err = b.port.Write([]byte{c})
+	}
+	if err != nil {
+		b.errors.Add(1)
+		logger.Error("Failed to propagate backpressure", "paused", paused, "error", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var banner string
+var bannerDefault = ""
+
+// bannerData is what banners are executed with, as Go templates.
+type bannerData struct {
+	// The session, such as {{.PortName}} and {{.BaudRate}}.
+	ConnectionInfo
+	// Device identity banner, see serve --identify, or empty.
+	Identity string
+	// Other sessions in progress.
+	Sessions int
+	// Whether the session is recorded to a capture file, see serve --capture-dir.
+	Recorded bool
+}
+
+// parseBanner parses the --banner value: a template with Go string escapes, or, starting with
+// @, the name of a file holding it, taken as is.
+func parseBanner(value string) (*template.Template, error) {
+	if value == "" {
+		return nil, nil
+	}
+	text := ""
+	if name, ok := strings.CutPrefix(value, "@"); ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read banner: %w", err)
+		}
+		text = string(data)
+	} else {
+		var err error
+		text, err = strconv.Unquote(`"` + value + `"`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid banner: %#v: %w", value, err)
+		}
+	}
+	tmpl, err := template.New("banner").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid banner template: %w", err)
+	}
+	// Catch unknown fields now, rather than on every session.
+	if err := tmpl.Execute(io.Discard, bannerData{}); err != nil {
+		return nil, fmt.Errorf("invalid banner template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// banner returns the banner for the session described by info, or nil without one.
+func (s *server) banner(info ConnectionInfo) ([]byte, error) {
+	if s.config.Banner == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	data := bannerData{
+		ConnectionInfo: info,
+		Identity:       s.identity,
+		Sessions:       len(s.sessions),
+		Recorded:       s.captureOptions.enabled(),
+	}
+	s.mu.Unlock()
+	var buf bytes.Buffer
+	if err := s.config.Banner.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute banner template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+
+	"github.com/fornellas/serialtcp/bootevent"
+)
+
+var bootEventsEnabled bool
+var bootEventsEnabledDefault = false
+
+var bootEventsWebhook string
+var bootEventsWebhookDefault = ""
+
+// How many recent boot events are kept for the control socket.
+const bootEventsRecent = 100
+
+// How long posting to a webhook may take.
+const webhookTimeout = 10 * time.Second
+
+// bootEvents records boot console events recognized in serial port output, see serve
+// --boot-events.
+type bootEvents struct {
+	// URL events are posted to as JSON, if any.
+	webhook string
+
+	mu     sync.Mutex
+	recent []bootevent.Event
+	counts map[bootevent.Kind]uint64
+}
+
+func newBootEvents(webhook string) *bootEvents {
+	return &bootEvents{
+		webhook: webhook,
+		counts:  map[bootevent.Kind]uint64{},
+	}
+}
+
+// Decoder returns a decoder recording events in serial port output, with lines up to
+// maxLineLength.
+func (b *bootEvents) Decoder(ctx context.Context, maxLineLength int) *bootevent.Decoder {
+	return bootevent.NewDecoder(maxLineLength, func(event bootevent.Event) {
+		b.record(ctx, event)
+	})
+}
+
+func (b *bootEvents) record(ctx context.Context, event bootevent.Event) {
+	logger := log.MustLogger(ctx)
+	logger.Info("Boot event", "kind", event.Kind, "detail", event.Detail)
+
+	b.mu.Lock()
+	b.recent = append(b.recent, event)
+	if len(b.recent) > bootEventsRecent {
+		b.recent = b.recent[len(b.recent)-bootEventsRecent:]
+	}
+	b.counts[event.Kind]++
+	b.mu.Unlock()
+
+	if b.webhook != "" {
+		// Posting must not stall serial port reads.
+		go func() {
+			if err := postJSON(context.WithoutCancel(ctx), b.webhook, event); err != nil {
+				logger.Error("Failed to post boot event", "error", err)
+			}
+		}()
+	}
+}
+
+// postJSON posts v as JSON to the webhook at url.
+func postJSON(ctx context.Context, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Recent returns the most recent events, oldest first.
+func (b *bootEvents) Recent() []bootevent.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]bootevent.Event{}, b.recent...)
+}
+
+// Counts returns how many events of each kind were recognized.
+func (b *bootEvents) Counts() map[bootevent.Kind]uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := make(map[bootevent.Kind]uint64, len(b.counts))
+	for kind, count := range b.counts {
+		counts[kind] = count
+	}
+	return counts
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/fornellas/serialtcp/rfc2217"
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// breakPort is a serial port holding breaks from when a client starts them until it ends them, see
+// rfc2217.BreakSetter, if it can.
+type breakPort struct {
+	serialport.Port
+}
+
+func (p breakPort) SetBreak(on bool) error {
+	setter, ok := p.Port.(serialport.BreakSetter)
+	if !ok {
+		return rfc2217.ErrBreakUnsupported
+	}
+	return setter.SetBreak(on)
+}
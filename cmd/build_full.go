@@ -0,0 +1,7 @@
+//go:build !minimal
+
+package main
+
+// Whether this is a minimal build, without captures, remote storage, QUIC, SSH, MQTT or HTTP
+// endpoints, see --minimal.
+const minimalBuild = false
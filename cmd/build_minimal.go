@@ -0,0 +1,109 @@
+//go:build minimal
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/fornellas/serialtcp/pipeline"
+)
+
+// Whether this is a minimal build, without captures, remote storage, QUIC, SSH, MQTT or HTTP
+// endpoints, see --minimal.
+const minimalBuild = true
+
+// captureOptions holds nothing, as captures are not available in minimal builds.
+type captureOptions struct{}
+
+func (o *captureOptions) setup() error {
+	if captureDir != "" {
+		return errors.New("captures are not available in minimal builds")
+	}
+	return nil
+}
+
+func (o *captureOptions) enabled() bool {
+	return false
+}
+
+func (o *captureOptions) use(ctx context.Context, session ConnectionInfo, pipe *pipeline.Pipeline) (io.Closer, error) {
+	return nil, nil
+}
+
+// openAccountingStore returns the accounting store file at location, as remote storage is not
+// available in minimal builds.
+func openAccountingStore(location string) (accountingStore, error) {
+	if strings.Contains(location, "://") {
+		return nil, errors.New("remote accounting stores are not available in minimal builds")
+	}
+	return fileAccountingStore(location), nil
+}
+
+var errQUICUnavailable = errors.New("QUIC is not available in minimal builds")
+
+func listenQUIC(address string, tlsConfig *tls.Config) (net.Listener, error) {
+	return nil, errQUICUnavailable
+}
+
+func dialQUIC(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	return nil, errQUICUnavailable
+}
+
+var errSSHUnavailable = errors.New("SSH is not available in minimal builds")
+
+// sshKeys holds nothing, as SSH is not available in minimal builds.
+type sshKeys struct{}
+
+func loadSSHKeys(ctx context.Context, config *ServerConfig) (*sshKeys, error) {
+	return nil, errSSHUnavailable
+}
+
+func listenSSH(ctx context.Context, address string, srv *server, keys *sshKeys) (net.Listener, error) {
+	return nil, errSSHUnavailable
+}
+
+func dialSSHJump(address string) (net.Conn, error) {
+	return nil, errSSHUnavailable
+}
+
+var errHTTPUnavailable = errors.New("HTTP endpoints are not available in minimal builds")
+
+func serveMetrics(ctx context.Context, listener net.Listener, srv *server) error {
+	return errHTTPUnavailable
+}
+
+func servePprof(ctx context.Context, listener net.Listener) error {
+	return errHTTPUnavailable
+}
+
+func serveHealth(ctx context.Context, listener net.Listener, srv *server) error {
+	return errHTTPUnavailable
+}
+
+// sseHub discards serial port output, as Server-Sent Events are not available in minimal builds.
+type sseHub struct{}
+
+func newSSEHub() *sseHub {
+	return &sseHub{}
+}
+
+func (h *sseHub) Writer(maxLineLength int) io.Writer {
+	return io.Discard
+}
+
+func serveSSE(ctx context.Context, listener net.Listener, hub *sseHub) error {
+	return errHTTPUnavailable
+}
+
+func readAPIToken() (string, error) {
+	return "", errHTTPUnavailable
+}
+
+func serveAPI(ctx context.Context, listener net.Listener, srv *server, token string) error {
+	return errHTTPUnavailable
+}
@@ -0,0 +1,256 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/fornellas/slogxt/log"
+
+	"github.com/fornellas/serialtcp/pipeline"
+	"github.com/fornellas/serialtcp/storage"
+)
+
+// CaptureRecord is a chunk of data transferred during a session. JSON capture files hold one JSON
+// encoded CaptureRecord per line, and pcapng ones one packet per CaptureRecord.
+type CaptureRecord struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Data      []byte    `json:"data"`
+}
+
+// captureOptions holds options for capture files.
+type captureOptions struct {
+	// Where capture files are stored, or nil when captures are disabled.
+	storage storage.Storage
+	// Recipients to encrypt capture files to, if any.
+	recipients []age.Recipient
+	// Redaction patterns, see redactor.
+	redactPatterns []*regexp.Regexp
+	// Input redaction prompt patterns, see redactor.
+	redactInputAfter []*regexp.Regexp
+	// Maximum line length and long line policy for redaction, see redactor.
+	maxLineLength int
+	linePolicy    LinePolicy
+	format        CaptureFormat
+}
+
+// captureEncoder writes capture records to a capture file.
+type captureEncoder interface {
+	encode(record CaptureRecord) error
+}
+
+// jsonCaptureEncoder writes one JSON encoded CaptureRecord per line.
+type jsonCaptureEncoder struct {
+	*json.Encoder
+}
+
+func (e jsonCaptureEncoder) encode(record CaptureRecord) error {
+	if err := e.Encode(record); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	return nil
+}
+
+// capture records the data transferred during a session to a file, optionally encrypted.
+type capture struct {
+	mu       sync.Mutex
+	closers  []io.Closer
+	encoder  captureEncoder
+	redactor *redactor
+}
+
+// Longest port name part of capture file names.
+const captureNamePortMax = 64
+
+// captureNamePort returns portName as part of a capture file name, with characters other than
+// letters, digits, dots and dashes replaced by underscores (eg: /dev/ttyUSB0 is dev_ttyUSB0).
+func captureNamePort(portName string) string {
+	name := []byte(strings.TrimLeft(portName, "/"))
+	for i, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '-') {
+			name[i] = '_'
+		}
+	}
+	if len(name) > captureNamePortMax {
+		name = name[:captureNamePortMax]
+	}
+	return string(name)
+}
+
+// openCapture creates a capture file for session at store. When recipients are given, the file is
+// encrypted to them with age. When redaction patterns are given, data is recorded line by line
+// after redaction.
+func openCapture(ctx context.Context, store storage.Storage, session ConnectionInfo, options captureOptions) (*capture, error) {
+	recipients := options.recipients
+	extension := map[CaptureFormat]string{
+		CaptureJSON:      "capture",
+		CapturePcapng:    "pcapng",
+		CaptureAsciicast: "cast",
+	}[options.format]
+	// Session IDs are per port, so the port is part of the name, for ports sharing the directory.
+	name := fmt.Sprintf(
+		"%s-%s-%d.%s",
+		session.Start.UTC().Format("20060102T150405Z"), captureNamePort(session.PortName), session.ID, extension,
+	)
+	if len(recipients) > 0 {
+		name += ".age"
+	}
+
+	f, err := store.Create(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	c := &capture{}
+	var w io.Writer = f
+	if len(recipients) > 0 {
+		encryptWriter, err := age.Encrypt(f, recipients...)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to encrypt capture file: %w", err), f.Close())
+		}
+		c.closers = append(c.closers, encryptWriter)
+		w = encryptWriter
+	}
+	c.closers = append(c.closers, f)
+	switch options.format {
+	case CapturePcapng:
+		c.encoder, err = newPcapngWriter(w, session.PortName)
+	case CaptureAsciicast:
+		c.encoder, err = newAsciicastWriter(w, session.Start, fmt.Sprintf("%s session %d", session.PortName, session.ID))
+	default:
+		c.encoder = jsonCaptureEncoder{json.NewEncoder(w)}
+	}
+	if err != nil {
+		return nil, errors.Join(err, c.close())
+	}
+	if len(options.redactPatterns) > 0 || len(options.redactInputAfter) > 0 {
+		c.redactor = newRedactor(
+			options.redactPatterns, options.redactInputAfter,
+			options.maxLineLength, options.linePolicy,
+			c.encode,
+		)
+	}
+	return c, nil
+}
+
+func (c *capture) encode(direction string, data []byte) error {
+	return c.encoder.encode(CaptureRecord{Time: time.Now(), Direction: direction, Data: data})
+}
+
+func (c *capture) record(direction string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.redactor != nil {
+		return c.redactor.Write(direction, data)
+	}
+	return c.encode(direction, data)
+}
+
+// Writer returns an io.Writer which records everything written to it as transferred in direction.
+func (c *capture) Writer(direction string) io.Writer {
+	return captureWriter{capture: c, direction: direction}
+}
+
+// Close flushes and closes the capture file.
+func (c *capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	if c.redactor != nil {
+		err = c.redactor.Flush()
+	}
+	return errors.Join(err, c.close())
+}
+
+// close closes the capture file.
+func (c *capture) close() error {
+	var err error
+	for _, closer := range c.closers {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+type captureWriter struct {
+	capture   *capture
+	direction string
+}
+
+func (w captureWriter) Write(p []byte) (int, error) {
+	if err := w.capture.record(w.direction, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// enabled returns whether sessions are captured.
+func (o *captureOptions) enabled() bool {
+	return o.storage != nil
+}
+
+// setup sets options from the capture flags.
+func (o *captureOptions) setup() (err error) {
+	if captureDir != "" {
+		o.storage, err = storage.New(captureDir)
+		if err != nil {
+			return err
+		}
+	}
+	o.recipients, err = parseCaptureRecipients(captureRecipients)
+	if err != nil {
+		return err
+	}
+	o.redactPatterns, err = compilePatterns(captureRedact)
+	if err != nil {
+		return err
+	}
+	o.redactInputAfter, err = compilePatterns(captureRedactInputAfter)
+	if err != nil {
+		return err
+	}
+	o.maxLineLength = maxLineLength
+	o.linePolicy = LinePolicy(maxLineLengthPolicy)
+	o.format = CaptureFormat(captureFormat)
+	return nil
+}
+
+// use adds to pipe the recording of the data of session to a capture file, returning the capture
+// to close once done, which is nil when captures are disabled.
+func (o *captureOptions) use(ctx context.Context, session ConnectionInfo, pipe *pipeline.Pipeline) (io.Closer, error) {
+	if o.storage == nil {
+		return nil, nil
+	}
+	logger := log.MustLogger(ctx)
+	logger.Info("Opening capture")
+	// Remote storage uploads on close, which must not be aborted when shutting down.
+	sessionCapture, err := openCapture(context.WithoutCancel(ctx), o.storage, session, *o)
+	if err != nil {
+		return nil, err
+	}
+	pipe.Use(pipeline.ToClient, pipeline.Tee(sessionCapture.Writer(captureToClient)))
+	pipe.Use(pipeline.ToPort, pipeline.Tee(sessionCapture.Writer(captureToPort)))
+	return sessionCapture, nil
+}
+
+// parseCaptureRecipients parses age X25519 recipients (age1...).
+func parseCaptureRecipients(values []string) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(values))
+	for _, value := range values {
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capture recipient: %w", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
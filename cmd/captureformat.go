@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CaptureFormat is the format of capture files.
+type CaptureFormat int
+
+const (
+	// One JSON encoded CaptureRecord per line.
+	CaptureJSON CaptureFormat = iota
+	// pcapng, for Wireshark, see pcapngWriter.
+	CapturePcapng
+	// asciicast v2, for asciinema, see asciicastWriter.
+	CaptureAsciicast
+)
+
+var captureFormatNames = map[CaptureFormat]string{
+	CaptureJSON:      "json",
+	CapturePcapng:    "pcapng",
+	CaptureAsciicast: "asciicast",
+}
+
+// CaptureFormatValue implements pflag.Value for CaptureFormat
+type CaptureFormatValue CaptureFormat
+
+func (f *CaptureFormatValue) String() string {
+	return captureFormatNames[CaptureFormat(*f)]
+}
+
+func (f *CaptureFormatValue) Set(s string) error {
+	for format, name := range captureFormatNames {
+		if strings.EqualFold(s, name) {
+			*f = CaptureFormatValue(format)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid capture format: %s", s)
+}
+
+func (f *CaptureFormatValue) Type() string {
+	return "format"
+}
+
+var captureFormat = CaptureFormatValue(CaptureJSON)
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/fornellas/serialtcp/xmodem"
+)
+
+// ProtocolValue implements pflag.Value for xmodem.Protocol
+type ProtocolValue xmodem.Protocol
+
+func (p *ProtocolValue) String() string {
+	return xmodem.Protocol(*p).String()
+}
+
+func (p *ProtocolValue) Set(s string) error {
+	protocol, err := xmodem.ParseProtocol(s)
+	if err != nil {
+		return err
+	}
+	*p = ProtocolValue(protocol)
+	return nil
+}
+
+func (p *ProtocolValue) Type() string {
+	return "protocol"
+}
+
+var clientAddress string
+var clientAddressDefault = "127.0.0.1:9999"
+
+var clientToken string
+var clientTokenDefault = ""
+
+var clientSSH string
+var clientSSHDefault = ""
+
+var clientSSHIdentity string
+var clientSSHIdentityDefault = ""
+
+var clientSSHKnownHosts string
+var clientSSHKnownHostsDefault = ""
+
+var clientProtocol = ProtocolValue(xmodem.XMODEM)
+
+var ClientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Connect to a server.",
+	Long:  "Connects to a server, to use the serial port behind it. Data is exchanged raw, so the server must not be running with --rfc2217, unless connecting with connect --rfc2217. With --script, runs an expect style script against the device, such as to log in, run commands and collect their output, or, with --send and --expect, a single command, such as for cron jobs and health checks; the output is written to standard output, and the exit status is 2 when expect times out. With --listen, relays local TCP connections to the server, for programs which only connect to host:port, with each connection connecting to the server anew. With --forward, relays local TCP connections to named ports of a server, all over a single connection to it, such as when only one port can be reached through firewalls. With --com, bridges a local serial port to the server, such as one end of a com0com virtual serial port pair on Windows, so that programs opening the other end, such as COM9, use the remote device.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if clientCOM != "" {
+			GetRunFn(runClientCOM)(cmd, args)
+			return
+		}
+		if clientListen != "" {
+			GetRunFn(runClientRelay)(cmd, args)
+			return
+		}
+		if len(clientForwards) > 0 {
+			GetRunFn(runClientForward)(cmd, args)
+			return
+		}
+		if clientScript != "" || clientSend != "" || clientExpect != "" {
+			runClientAutomation(cmd, args)
+			return
+		}
+		if err := cmd.Help(); err != nil {
+			logger := log.MustLogger(cmd.Context())
+			logger.Error("Failed to display help", "err", err)
+		}
+		Exit(1)
+	},
+}
+
+// clientDial connects to the server, authenticating with the token, if given.
+func clientDial() (net.Conn, error) {
+	return clientDialAddress(clientAddress)
+}
+
+// clientDialAddress connects to the server at address, to the named port of --port, if given,
+// authenticating with the token, if given, and negotiating compression, with --compress.
+func clientDialAddress(address string) (net.Conn, error) {
+	conn, err := transportDial(address)
+	if err != nil {
+		return nil, err
+	}
+	token := clientToken
+	if clientPort != "" {
+		if clientSteal {
+			return nil, errors.Join(errors.New("--steal is not supported with --port"), conn.Close())
+		}
+		conn, err = dialNamedPort(conn, clientPort)
+		if err != nil {
+			return nil, err
+		}
+		// Sent to relays before multiplexing.
+		token = ""
+	}
+	return clientHandshake(conn, token)
+}
+
+// clientHandshake authenticates conn with token, if set, and negotiates compression, with
+// --compress, returning the connection to use. On failure, conn is closed.
+func clientHandshake(conn net.Conn, token string) (net.Conn, error) {
+	if clientSteal {
+		stealConn, requested, err := requestSteal(conn, token)
+		if err != nil {
+			return nil, errors.Join(err, conn.Close())
+		}
+		conn = stealConn
+		// The steal request redeems the token.
+		if requested {
+			token = ""
+		}
+	}
+	if token != "" {
+		if _, err := fmt.Fprintf(conn, "%s\n", token); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to send token: %w", err), conn.Close())
+		}
+	}
+	if compression := Compression(clientCompress); compression != CompressionNone {
+		compressedConn, err := negotiateClientCompression(conn, compression)
+		if err != nil {
+			return nil, errors.Join(err, conn.Close())
+		}
+		conn = compressedConn
+	}
+	return conn, nil
+}
+
+var ClientSendFileCmd = &cobra.Command{
+	Use:   "send-file FILE",
+	Short: "Send a file to the device.",
+	Long:  "Sends a file to the device with a file transfer protocol, such as to push firmware to bootloaders. The device must be ready to receive it.",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx := cmd.Context()
+		path := args[0]
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, file.Close()) }()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		conn, err := clientDial()
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, conn.Close()) }()
+
+		ctx, logger := log.MustWithAttrs(ctx, "protocol", xmodem.Protocol(clientProtocol), "size", info.Size())
+		logger.Info("Sending")
+		return xmodem.Send(ctx, conn, xmodem.Protocol(clientProtocol), filepath.Base(path), file, info.Size())
+	}),
+}
+
+var ClientReceiveFileCmd = &cobra.Command{
+	Use:   "receive-file FILE",
+	Short: "Receive a file from the device.",
+	Long:  "Receives a file from the device with a file transfer protocol. The device must be waiting to send it.",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx := cmd.Context()
+		path := args[0]
+
+		conn, err := clientDial()
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, conn.Close()) }()
+
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, file.Close())
+			if err != nil {
+				err = errors.Join(err, os.Remove(path))
+			}
+		}()
+
+		ctx, logger := log.MustWithAttrs(ctx, "protocol", xmodem.Protocol(clientProtocol))
+		logger.Info("Receiving")
+		received, err := xmodem.Receive(ctx, conn, xmodem.Protocol(clientProtocol), file)
+		if err != nil {
+			return err
+		}
+		if received.Name != "" {
+			logger.Info("Received", "name", received.Name, "size", received.Size)
+		}
+		return nil
+	}),
+}
+
+// addClientFlags adds the flags to connect to a server to flags.
+func addClientFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&clientAddress, "address", "a", clientAddressDefault, "Server address: host:port for TCP, unix:///path for a Unix domain socket, \\\\.\\pipe\\name for a Windows named pipe or a ws:// or wss:// URL, such as for servers behind an HTTP reverse proxy")
+	flags.VarP(&clientTransport, "transport", "", "Transport to connect with, as served (tcp or quic)")
+	flags.StringVarP(&clientTLSCA, "tls-ca", "", clientTLSCADefault, "Verify the server TLS certificate against the CA certificates in this PEM file instead of the system ones, for --transport quic")
+	flags.StringVarP(&clientTLSFingerprint, "tls-fingerprint", "", clientTLSFingerprintDefault, "Instead of verifying the server TLS certificate, pin it by its SHA-256 fingerprint, as logged by serve for self-signed certificates, for --transport quic")
+	flags.BoolVarP(&clientTLSInsecure, "tls-insecure", "", clientTLSInsecureDefault, "Do not verify the server TLS certificate, for --transport quic")
+	flags.StringVarP(&clientSSH, "ssh", "", clientSSHDefault, "Connect through this SSH jump host, as [user@]host[:port], authenticating with the SSH agent or identity files, such as when the server sits behind a bastion")
+	flags.StringVarP(&clientSSHIdentity, "ssh-identity", "", clientSSHIdentityDefault, "Private key file to authenticate to the SSH jump host with (default ~/.ssh/id_ed25519, id_ecdsa or id_rsa)")
+	flags.StringVarP(&clientSSHKnownHosts, "ssh-known-hosts", "", clientSSHKnownHostsDefault, "Known hosts file to verify the SSH jump host key against (default ~/.ssh/known_hosts)")
+	flags.VarP(&clientCompress, "compress", "", "Ask the server to compress the stream with this algorithm (none or gzip); the server must be running with --compress")
+	flags.StringVarP(&clientToken, "token", "", clientTokenDefault, "Guest token to authenticate with (see ctl token)")
+	flags.StringVarP(&clientPort, "port", "", clientPortDefault, "Connect to this named port of a server running with --named-port, or to the server of this ID through a relay, followed by /NAME for its named ports, over a multiplexed connection; --token is then sent to the relay")
+	flags.BoolVarP(&clientSteal, "steal", "", clientStealDefault, "When the server, running with --allow-steal, tells it is busy, take over the session in progress, disconnecting its holder; waits up to 2s for the server to tell, before sending --token")
+}
+
+func init() {
+	addClientFlags(ClientCmd.PersistentFlags())
+	ClientCmd.Flags().StringVarP(&clientScript, "script", "", clientScriptDefault, "Run this expect style script, with one command per line: timeout DURATION, set NAME VALUE, send TEXT, sendline TEXT (followed by a carriage return), expect REGEXP [DURATION] (setting ${0}, ${1}... to the match), sleep DURATION, echo TEXT or fail TEXT; arguments may be Go quoted, and ${NAME} expands to variables, or else to environment variables")
+	ClientCmd.Flags().StringArrayVarP(&clientScriptVars, "var", "", clientScriptVarsDefault, "Set a --script variable, as NAME=VALUE; may be given multiple times")
+	ClientCmd.Flags().StringVarP(&clientSend, "send", "", clientSendDefault, "Send this, with Go escape sequences such as \\r, then wait for --expect or, without it, for --timeout, and exit")
+	ClientCmd.Flags().StringVarP(&clientExpect, "expect", "", clientExpectDefault, "Wait for output matching this regular expression, after --send, if given, and exit")
+	ClientCmd.Flags().DurationVarP(&clientTimeout, "timeout", "", clientTimeoutDefault, "How long to wait for --expect")
+	ClientCmd.Flags().StringVarP(&clientListen, "listen", "", clientListenDefault, "Listen on this local host:port, relaying each connection to the server, until interrupted")
+	ClientCmd.Flags().StringVarP(&clientCOM, "com", "", clientCOMDefault, "Bridge this local serial port to the server, such as CNCB0, one end of a com0com virtual serial port pair on Windows, or a nullmodem end, such as pts/3, elsewhere, until either ends or interrupted")
+	ClientCmd.Flags().IntVarP(&clientCOMBaudRate, "com-baud-rate", "", clientCOMBaudRateDefault, "Baud rate to open --com at, which virtual serial ports usually ignore")
+	ClientCmd.Flags().StringArrayVarP(&clientForwards, "forward", "", clientForwardsDefault, "Listen on a local host:port, relaying each connection to a named port of a server running with --named-port, given as ADDRESS=NAME (eg: 127.0.0.1:9001=ttyUSB0), carrying all of them over a single connection to the server, until interrupted; may be given multiple times")
+	for _, name := range []string{"listen", "script", "send", "expect", "forward"} {
+		ClientCmd.MarkFlagsMutuallyExclusive("com", name)
+	}
+	for _, name := range []string{"listen", "script", "send", "expect", "port"} {
+		ClientCmd.MarkFlagsMutuallyExclusive("forward", name)
+	}
+	ClientCmd.MarkFlagsMutuallyExclusive("listen", "script")
+	ClientCmd.MarkFlagsMutuallyExclusive("listen", "send")
+	ClientCmd.MarkFlagsMutuallyExclusive("listen", "expect")
+	ClientCmd.MarkFlagsMutuallyExclusive("script", "send")
+	ClientCmd.MarkFlagsMutuallyExclusive("script", "expect")
+
+	for _, cmd := range []*cobra.Command{ClientSendFileCmd, ClientReceiveFileCmd} {
+		cmd.PersistentFlags().VarP(&clientProtocol, "protocol", "", "File transfer protocol (xmodem, xmodem-1k or ymodem)")
+		ClientCmd.AddCommand(cmd)
+	}
+
+	ClientConnectCmd.PersistentFlags().StringVarP(&connectEscapeChar, "escape-char", "e", connectEscapeCharDefault, "Escape character: a single character, recognized at the start of a line, a control character in caret notation, such as ^], recognized anywhere, or none to disable escape sequences")
+	ClientConnectCmd.PersistentFlags().StringArrayVarP(&connectEscapeBindings, "escape-binding", "", connectEscapeBindingsDefault, "Bind a key typed after the escape character to an action, as KEY=ACTION, with ACTION one of disconnect, break, dtr, rts, log, switch, help or none to unbind the key; may be given multiple times")
+	ClientConnectCmd.PersistentFlags().BoolVarP(&connectRFC2217, "rfc2217", "", connectRFC2217Default, "Speak Telnet with the RFC 2217 Com Port Control Option, to send breaks and set DTR and RTS; the server must be running with --rfc2217")
+	ClientConnectCmd.PersistentFlags().BoolVarP(&connectFramed, "framed", "", connectFramedDefault, "Speak the framed protocol, to send breaks and set DTR and RTS, dropping corrupt data over flaky links; the server must be running with --framed")
+	ClientConnectCmd.MarkFlagsMutuallyExclusive("rfc2217", "framed")
+	ClientConnectCmd.PersistentFlags().DurationVarP(&connectHeartbeatInterval, "heartbeat-interval", "", connectHeartbeatIntervalDefault, "With --framed, ping the server this often, reconnecting when nothing is received from it for 3 intervals, even when TCP keepalives are disabled or mangled by middleboxes; 0 disables")
+	ClientConnectCmd.PersistentFlags().DurationVarP(&connectBreakDuration, "break-duration", "", connectBreakDurationDefault, "Duration of breaks sent by escape sequences")
+	ClientConnectCmd.PersistentFlags().StringVarP(&connectLog, "log", "", connectLogDefault, "Append received output to this file, with each line prefixed by a timestamp; logging starts when given, otherwise it is toggled by an escape sequence")
+	ClientConnectCmd.PersistentFlags().BoolVarP(&connectLogInput, "log-input", "", connectLogInputDefault, "Also log sent input, marking the direction of each line")
+	ClientConnectCmd.PersistentFlags().DurationVarP(&connectDiscoverTimeout, "discover-timeout", "", connectDiscoverTimeoutDefault, "How long to wait for servers on the local network to respond, when picking a port")
+	ClientCmd.AddCommand(ClientConnectCmd)
+
+	RootCmd.AddCommand(ClientCmd)
+}
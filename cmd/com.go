@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var clientCOM string
+var clientCOMDefault = ""
+
+var clientCOMBaudRate int
+var clientCOMBaudRateDefault = 115200
+
+// bridge copies data between port and conn until either direction ends, as a serial port never
+// reads the end of its data, or until ctx is done.
+func bridge(ctx context.Context, port serialport.Port, conn net.Conn) error {
+	errCh := make(chan error, 2)
+	go func() {
+		_, err := copyContext(ctx, conn, port)
+		errCh <- err
+	}()
+	go func() {
+		_, err := copyContext(ctx, port, conn)
+		errCh <- err
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+	}
+	err = errors.Join(err, conn.Close(), port.Close())
+	// Closing unblocks the other direction, failing it.
+	<-errCh
+	return err
+}
+
+// runClientCOM bridges the local serial port given by --com to the server, until either ends or
+// it is interrupted.
+func runClientCOM(cmd *cobra.Command, args []string) (err error) {
+	ctx, logger := log.MustWithAttrs(cmd.Context(), "address", clientAddress, "com", clientCOM, "com-baud-rate", clientCOMBaudRate)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	port, err := serialport.Open(clientCOM, &serial.Mode{BaudRate: clientCOMBaudRate})
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", clientCOM, err)
+	}
+	conn, err := clientDial()
+	if err != nil {
+		return errors.Join(err, port.Close())
+	}
+
+	logger.Info("Bridging")
+	err = bridge(ctx, port, conn)
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
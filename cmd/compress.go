@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// Compression is a compression algorithm for the stream between clients and servers.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+)
+
+var compressionNames = map[Compression]string{
+	CompressionNone: "none",
+	CompressionGzip: "gzip",
+}
+
+// CompressionValue implements pflag.Value for Compression
+type CompressionValue Compression
+
+func (c *CompressionValue) String() string {
+	return compressionNames[Compression(*c)]
+}
+
+func (c *CompressionValue) Set(s string) error {
+	for compression, name := range compressionNames {
+		if strings.EqualFold(s, name) {
+			*c = CompressionValue(compression)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid compression: %s", s)
+}
+
+func (c *CompressionValue) Type() string {
+	return "algorithm"
+}
+
+var compress = CompressionValue(CompressionNone)
+
+var clientCompress = CompressionValue(CompressionNone)
+
+// compressPrefix starts the compression negotiation lines: clients send the algorithms they
+// accept, in order of preference, and servers answer with the one picked, or none.
+const compressPrefix = "COMPRESS"
+
+// How long servers wait for the compression negotiation line.
+const compressTimeout = 10 * time.Second
+
+// compressConn is a net.Conn compressing data written to it and decompressing data read from it.
+// Each write is flushed, so that interactive sessions are not delayed. It does not expose the
+// connection it wraps, as half closes must go through CloseWrite, to end the compressed stream.
+type compressConn struct {
+	net.Conn
+	writeMu sync.Mutex
+	writer  *gzip.Writer
+	// Created on the first read, as it blocks reading the gzip header.
+	reader *gzip.Reader
+}
+
+// newCompressConn returns conn compressed with gzip, with reads going through reader, such as the
+// one the negotiation line was read with.
+func newCompressConn(conn net.Conn, reader io.Reader) (*compressConn, error) {
+	c := &compressConn{Conn: &bufferedConn{Conn: conn, reader: bufio.NewReader(reader)}, writer: gzip.NewWriter(conn)}
+	// Send the gzip header, which the other side reads before any data.
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *compressConn) Read(p []byte) (int, error) {
+	if c.reader == nil {
+		reader, err := gzip.NewReader(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.reader = reader
+	}
+	return c.reader.Read(p)
+}
+
+func (c *compressConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	n, err := c.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.writer.Flush()
+}
+
+// CloseWrite ends the compressed stream, and shuts down the writing side of the connection.
+func (c *compressConn) CloseWrite() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.writer.Close(); err != nil {
+		return err
+	}
+	return closeWrite(baseConn(c.Conn))
+}
+
+// negotiateServerCompression reads the compression negotiation line from conn, answering with
+// compression if the client accepts it, or none, and returns the connection to use. Without
+// compression, there is no negotiation.
+func negotiateServerCompression(ctx context.Context, conn net.Conn, compression Compression) (net.Conn, error) {
+	if compression == CompressionNone {
+		return conn, nil
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(compressTimeout)); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compression negotiation: %w", err)
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != compressPrefix {
+		return nil, fmt.Errorf("invalid compression negotiation, is the client running with --compress?: %q", line)
+	}
+	picked := CompressionNone
+	for _, name := range fields[1:] {
+		if name == compressionNames[compression] {
+			picked = compression
+			break
+		}
+	}
+	log.MustLogger(ctx).Info("Negotiated compression", "compression", compressionNames[picked])
+	if _, err := fmt.Fprintf(conn, "%s %s\n", compressPrefix, compressionNames[picked]); err != nil {
+		return nil, err
+	}
+	if picked == CompressionNone {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return newCompressConn(conn, reader)
+}
+
+// negotiateClientCompression asks the server on conn for compression, returning the connection to
+// use, which is compressed only if the server accepted.
+func negotiateClientCompression(conn net.Conn, compression Compression) (net.Conn, error) {
+	if _, err := fmt.Fprintf(conn, "%s %s\n", compressPrefix, compressionNames[compression]); err != nil {
+		return nil, fmt.Errorf("failed to send compression negotiation: %w", err)
+	}
+	line, err := readNegotiationLine(conn)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 2 || fields[0] != compressPrefix {
+		return nil, fmt.Errorf("invalid compression negotiation, is the server running with --compress?: %q", line)
+	}
+	if fields[1] == compressionNames[CompressionNone] {
+		return conn, nil
+	}
+	if fields[1] != compressionNames[compression] {
+		return nil, fmt.Errorf("server picked an unrequested compression: %s", fields[1])
+	}
+	return newCompressConn(conn, conn)
+}
+
+// readNegotiationLine reads the compression negotiation answer from conn, skipping the messages of
+// servers queueing clients.
+func readNegotiationLine(conn net.Conn) (string, error) {
+	// Read byte by byte, as a server without --compress may send data right away.
+	buf := make([]byte, 1)
+	for {
+		var line []byte
+		for len(line) == 0 || line[len(line)-1] != '\n' {
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return "", fmt.Errorf("failed to read compression negotiation: %w", err)
+			}
+			line = append(line, buf[0])
+			if len(line) > 128 {
+				return "", errors.New("invalid compression negotiation, is the server running with --compress?")
+			}
+		}
+		if !admissionMessage(string(line)) {
+			return string(line), nil
+		}
+	}
+}
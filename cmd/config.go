@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"text/template"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+// ServerConfig is the configuration of how a server handles sessions. The serve command populates
+// it from its flags, which is the only place reading them.
+type ServerConfig struct {
+	// Serial port opened for each session, see serialport.Open.
+	PortName string
+	// Command started for each session in place of the serial port, if set.
+	ExecCommand string
+	// Command started on a pseudo terminal for each session in place of the serial port, if set.
+	ShellCommand string
+	// Initial serial port mode, which the control socket and RFC 2217 clients may change.
+	Mode serial.Mode
+	// Whether to set TIOCEXCL on the serial port.
+	Exclusive bool
+	// Whether to tune the serial port for latency.
+	LowLatency bool
+	// Whether clients speak Telnet with the Com Port Control Option.
+	RFC2217 bool
+	// Whether clients speak the framed protocol, see package framed.
+	Framed bool
+	// How often to ping framed protocol clients, closing connections receiving nothing for
+	// framed.HeartbeatMisses intervals, 0 disabling it.
+	HeartbeatInterval time.Duration
+	// Whether clients must authenticate with a guest token.
+	TokenAuth bool
+	// Compression clients may negotiate, which they all must, if not CompressionNone.
+	Compress Compression
+	// Sent to clients on connect, executed with bannerData, or nil for none.
+	Banner *template.Template
+	// Bytes of client data queued for the serial port, 0 disabling the queue.
+	WriteQueueSize int
+	// Bytes of serial port data buffered for each client, 0 disabling the buffer.
+	ClientBufferSize int
+	// What to do when the client buffer is full.
+	ClientBufferPolicy QueuePolicy
+	// How to pause the device while the client buffer is full.
+	PropagateBackpressure BackpressureMode
+	// Whether half closes are propagated between the client and the serial port.
+	HalfClose bool
+	// Line ending translation of data sent to the serial port.
+	CRLFToPort CRLFMode
+	// Line ending translation of data sent to clients.
+	CRLFToClient CRLFMode
+	// Quiet time ending frames of serial port data, each sent to clients in one write, 0 disabling
+	// framing.
+	FrameGap time.Duration
+	// Maximum size of frames.
+	FrameMaxSize int
+	// How bits beyond the serial port data bits are handled.
+	HighBits HighBitsMode
+	// Delay after each character written to the serial port.
+	CharDelay time.Duration
+	// Delay after each line written to the serial port.
+	LineDelay time.Duration
+	// How long writes to the serial port may block, 0 disabling it.
+	WriteTimeout time.Duration
+	// What to do when a write to the serial port times out.
+	WriteTimeoutPolicy WriteTimeoutPolicy
+	// How long sessions wait for the serial port to open again when its device goes away, 0
+	// ending them instead.
+	ReopenTimeout time.Duration
+	// TCP keepalive of client connections.
+	KeepAlive net.KeepAliveConfig
+	// Sessions served at once.
+	MaxConnections int
+	// What to do with connections while MaxConnections sessions are in progress.
+	BusyPolicy BusyPolicy
+	// Connections waiting for a session, with BusyQueue.
+	MaxQueue int
+	// Whether busy clients may take over the session in progress.
+	AllowSteal bool
+	// Longest line of serial port output kept whole by boot events, triggers and Server-Sent
+	// Events.
+	MaxLineLength int
+	// How the device is identified when sessions open the serial port, or nil not to identify it.
+	Identify *IdentifyConfig
+	// How often to read the UART counters of the open serial port, 0 disabling it.
+	UARTStatsInterval time.Duration
+	// How often to read the modem status lines of the open serial port, 0 disabling it.
+	ModemStatusInterval time.Duration
+}
+
+// newServeConfig returns the ServerConfig set by the serve flags, for mode.
+func newServeConfig(mode *serial.Mode) (*ServerConfig, error) {
+	config := &ServerConfig{
+		PortName:              portName,
+		ExecCommand:           execCommand,
+		ShellCommand:          shellProgram,
+		Mode:                  *mode,
+		Exclusive:             exclusive,
+		LowLatency:            lowLatency,
+		RFC2217:               rfc2217Enabled,
+		Framed:                framedEnabled,
+		HeartbeatInterval:     heartbeatInterval,
+		Compress:              Compression(compress),
+		TokenAuth:             tokenAuth,
+		WriteQueueSize:        writeQueueSize,
+		ClientBufferSize:      clientBufferSize,
+		ClientBufferPolicy:    QueuePolicy(clientBufferPolicy),
+		PropagateBackpressure: BackpressureMode(propagateBackpressure),
+		HalfClose:             halfClose,
+		CRLFToPort:            CRLFMode(crlfToPort),
+		CRLFToClient:          CRLFMode(crlfToClient),
+		FrameGap:              frameGap,
+		FrameMaxSize:          frameMaxSize,
+		HighBits:              HighBitsMode(highBits),
+		CharDelay:             charDelay,
+		LineDelay:             lineDelay,
+		WriteTimeout:          writeTimeout,
+		WriteTimeoutPolicy:    WriteTimeoutPolicy(writeTimeoutPolicy),
+		ReopenTimeout:         reopenTimeout,
+		KeepAlive:             keepAliveConfig(),
+		MaxConnections:        maxConnections,
+		BusyPolicy:            BusyPolicy(busyPolicy),
+		MaxQueue:              maxQueue,
+		AllowSteal:            allowSteal,
+		MaxLineLength:         maxLineLength,
+		UARTStatsInterval:     uartStatsInterval,
+		ModemStatusInterval:   modemStatusInterval,
+	}
+	if mode.DataBits < 5 || mode.DataBits > 8 {
+		return nil, fmt.Errorf("invalid data bits: %d", mode.DataBits)
+	}
+	if err := config.HighBits.check(config.Mode); err != nil {
+		return nil, err
+	}
+	if config.HeartbeatInterval > 0 && !config.Framed {
+		return nil, errors.New("--heartbeat-interval requires --framed")
+	}
+	if err := config.checkSerialPortOptions(); err != nil {
+		return nil, err
+	}
+	var err error
+	config.Identify, err = identifyFlags()
+	if err != nil {
+		return nil, err
+	}
+	config.Banner, err = parseBanner(banner)
+	if err != nil {
+		return nil, err
+	}
+	if config.PropagateBackpressure != BackpressureOff {
+		if config.ClientBufferSize == 0 {
+			return nil, errors.New("--propagate-backpressure requires a client buffer")
+		}
+		if config.PropagateBackpressure == BackpressureRTS && disableRts {
+			return nil, errors.New("--propagate-backpressure rts requires RTS enabled")
+		}
+	}
+	return config, nil
+}
+
+// checkSerialPortOptions fails for options which only apply to serial ports, when commands are
+// served in their place, and for invalid values of them.
+func (c *ServerConfig) checkSerialPortOptions() error {
+	if c.FrameGap > 0 {
+		if c.runsCommand() {
+			return errors.New("--frame-gap requires a serial port, not --exec or --shell")
+		}
+		if c.FrameMaxSize <= 0 {
+			return fmt.Errorf("invalid frame maximum size: %d", c.FrameMaxSize)
+		}
+	}
+	if c.ReopenTimeout > 0 && c.runsCommand() {
+		return errors.New("--reopen-timeout requires a serial port, not --exec or --shell")
+	}
+	return nil
+}
+
+// runsCommand returns whether commands are served in place of the serial port, with --exec or
+// --shell.
+func (c *ServerConfig) runsCommand() bool {
+	return c.ExecCommand != "" || c.ShellCommand != ""
+}
+
+// backendName returns the name of what is served: the serial port name, or the exec or shell
+// command.
+func (c *ServerConfig) backendName() string {
+	if c.ExecCommand != "" {
+		return c.ExecCommand
+	}
+	if c.ShellCommand != "" {
+		return c.ShellCommand
+	}
+	return c.PortName
+}
+
+// ServerOption sets an optional part of a server.
+type ServerOption func(*server)
+
+// WithAccounting records per session accounting to store.
+func WithAccounting(store accountingStore) ServerOption {
+	return func(s *server) { s.accounting = store }
+}
+
+// WithCapture records sessions to capture files, as set up by options.
+func WithCapture(options captureOptions) ServerOption {
+	return func(s *server) { s.captureOptions = options }
+}
+
+// WithBootEvents recognizes boot console events in serial port output.
+func WithBootEvents(events *bootEvents) ServerOption {
+	return func(s *server) { s.bootEvents = events }
+}
+
+// WithTriggers runs triggers on serial port output matches.
+func WithTriggers(triggers []*trigger) ServerOption {
+	return func(s *server) { s.triggers = triggers }
+}
+
+// WithSSE sends lines of serial port output to the Server-Sent Events subscribers of hub.
+func WithSSE(hub *sseHub) ServerOption {
+	return func(s *server) { s.sse = hub }
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var configFile string
+var configFileDefault = ""
+
+// serveConfigReloader reloads --config, once applied by serve.
+var serveConfigReloader *configReloader
+
+// readConfigFile reads serve flags from path: one "name = value" per line, with names as the
+// flags without the leading --, given multiple times for flags taking lists. Blank lines and lines
+// starting with # are ignored.
+func readConfigFile(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+	settings := map[string][]string{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: missing '='", path, lineNumber)
+		}
+		name = strings.TrimPrefix(strings.TrimSpace(name), "--")
+		if name == "config" {
+			return nil, fmt.Errorf("%s:%d: config files can not include others", path, lineNumber)
+		}
+		settings[name] = append(settings[name], strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return settings, nil
+}
+
+// configReloader applies changes to --config to a running server.
+type configReloader struct {
+	path  string
+	flags *pflag.FlagSet
+	// Flags set on the command line, which take precedence over the config file.
+	commandLine map[string]bool
+	// Settings last read from the config file.
+	settings map[string][]string
+}
+
+// applyConfigFile sets the flags in --config, unless set on the command line, returning what
+// reloads it, or nil without one. It goes before --profile, so the config file flags count as set
+// explicitly.
+func applyConfigFile(cmd *cobra.Command) (*configReloader, error) {
+	if configFile == "" {
+		return nil, nil
+	}
+	settings, err := readConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	flags := cmd.Flags()
+	r := &configReloader{path: configFile, flags: flags, commandLine: map[string]bool{}, settings: settings}
+	flags.Visit(func(flag *pflag.Flag) { r.commandLine[flag.Name] = true })
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if r.commandLine[name] {
+			continue
+		}
+		for _, value := range settings[name] {
+			if err := flags.Set(name, value); err != nil {
+				return nil, fmt.Errorf("%s: --%s: %w", configFile, name, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// configValue returns the value of a flag taking a single one from values, or its default once
+// removed from the config file.
+func configValue(flag *pflag.Flag, values []string) string {
+	if len(values) == 0 {
+		return flag.DefValue
+	}
+	return values[len(values)-1]
+}
+
+// reloadTarget is what config file reloads change.
+type reloadTarget struct {
+	ctx context.Context
+	// The server of the serial port, or, with --named-port, the ports by name.
+	srv   *server
+	multi *multiPort
+	// Accepts connections, or nil with --stdio.
+	acceptor *acceptor
+}
+
+// servers returns the servers of the serial ports served.
+func (t *reloadTarget) servers() []*server {
+	if t.multi != nil {
+		return t.multi.list()
+	}
+	return []*server{t.srv}
+}
+
+// setMode changes the serial port mode of the ports served.
+func (t *reloadTarget) setMode(update func(mode *serial.Mode)) error {
+	if t.multi != nil {
+		return t.multi.SetMode(update)
+	}
+	return t.srv.SetMode(update)
+}
+
+// configInt returns the value of an integer flag from values, as configValue.
+func configInt(flag *pflag.Flag, values []string) (int, error) {
+	value, err := strconv.Atoi(configValue(flag, values))
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid value: %s", configValue(flag, values))
+	}
+	return value, nil
+}
+
+// configReloaders apply flags changed in the config file to a running server, given their values,
+// or none once removed from it. Other flags only change on restart.
+var configReloaders = map[string]func(target *reloadTarget, flag *pflag.Flag, values []string) error{
+	"baud-rate": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		baudRate, err := strconv.Atoi(configValue(flag, values))
+		if err != nil || baudRate < 1 {
+			return fmt.Errorf("invalid baud rate: %s", configValue(flag, values))
+		}
+		return target.setMode(func(mode *serial.Mode) { mode.BaudRate = baudRate })
+	},
+	"data-bits": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		dataBits, err := strconv.Atoi(configValue(flag, values))
+		if err != nil || dataBits < 5 || dataBits > 8 {
+			return fmt.Errorf("invalid data bits: %s", configValue(flag, values))
+		}
+		return target.setMode(func(mode *serial.Mode) { mode.DataBits = dataBits })
+	},
+	"parity": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		var parity ParityValue
+		if err := parity.Set(configValue(flag, values)); err != nil {
+			return err
+		}
+		return target.setMode(func(mode *serial.Mode) { mode.Parity = serial.Parity(parity) })
+	},
+	"stop-bits": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		var stopBits StopBitsValue
+		if err := stopBits.Set(configValue(flag, values)); err != nil {
+			return err
+		}
+		return target.setMode(func(mode *serial.Mode) { mode.StopBits = serial.StopBits(stopBits) })
+	},
+	"proxy-protocol-from": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		var from []string
+		for _, value := range values {
+			from = append(from, strings.Split(value, ",")...)
+		}
+		trusted, err := parseTrustedProxies(from)
+		if err != nil {
+			return err
+		}
+		trustedProxies.Store(&trusted)
+		return nil
+	},
+	"max-conns-per-ip": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		maxConns, err := configInt(flag, values)
+		if err != nil {
+			return err
+		}
+		return connLimits.update(func(settings *connLimitSettings) { settings.maxConns = maxConns })
+	},
+	"conn-interval-per-ip": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		interval, err := time.ParseDuration(configValue(flag, values))
+		if err != nil || interval < 0 {
+			return fmt.Errorf("invalid interval: %s", configValue(flag, values))
+		}
+		return connLimits.update(func(settings *connLimitSettings) { settings.interval = interval })
+	},
+	"conn-burst-per-ip": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		burst, err := configInt(flag, values)
+		if err != nil {
+			return err
+		}
+		return connLimits.update(func(settings *connLimitSettings) { settings.burst = burst })
+	},
+	"address": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		if target.acceptor == nil {
+			return errors.New("not listening, as serving --stdio")
+		}
+		if _, rebind := target.acceptor.current(); rebind == nil {
+			return errors.New("the listener passed by systemd can not be changed")
+		}
+		address := configValue(flag, values)
+		listen, err := addressListen(target.ctx, address)
+		if err != nil {
+			return err
+		}
+		if err := target.acceptor.replace(listen); err != nil {
+			return err
+		}
+		log.MustLogger(target.ctx).Info("Listening", "address", target.acceptor.Addr())
+		return nil
+	},
+	"named-port": func(target *reloadTarget, flag *pflag.Flag, values []string) error {
+		if target.multi == nil {
+			return errors.New("serving named ports instead of a single port takes effect on restart")
+		}
+		if len(values) == 0 {
+			return errors.New("at least one named port is required")
+		}
+		configs, err := namedPortConfigs(&target.multi.config, values)
+		if err != nil {
+			return err
+		}
+		added, removed := target.multi.update(configs)
+		log.MustLogger(target.ctx).Info("Updated named ports", "added", added, "removed", removed)
+		return nil
+	},
+}
+
+// reload reads the config file again, applying the flags changed since it was last read to target,
+// keeping sessions connected, and returns the flags reloaded and the ones changed that only take
+// effect on restart. Flags set on the command line are left alone.
+func (r *configReloader) reload(target *reloadTarget) ([]string, []string, error) {
+	settings, err := readConfigFile(r.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	all := maps.Clone(r.settings)
+	maps.Copy(all, settings)
+	names := slices.Sorted(maps.Keys(all))
+	var reloaded, restart []string
+	for _, name := range names {
+		if r.commandLine[name] || slices.Equal(r.settings[name], settings[name]) {
+			continue
+		}
+		flag := r.flags.Lookup(name)
+		if flag == nil {
+			err = errors.Join(err, fmt.Errorf("%s: unknown flag: --%s", r.path, name))
+			continue
+		}
+		apply, ok := configReloaders[name]
+		if !ok {
+			restart = append(restart, name)
+			continue
+		}
+		if applyErr := apply(target, flag, settings[name]); applyErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: --%s: %w", r.path, name, applyErr))
+			continue
+		}
+		reloaded = append(reloaded, name)
+	}
+	// Keep the failed changes pending, so the next reload tries them again.
+	for _, name := range names {
+		if !slices.Contains(reloaded, name) && !slices.Contains(restart, name) {
+			settings[name] = r.settings[name]
+		}
+	}
+	r.settings = settings
+	return reloaded, restart, err
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/fornellas/serialtcp/framed"
+	"github.com/fornellas/serialtcp/mdns"
+	"github.com/fornellas/serialtcp/rfc2217"
+)
+
+var connectDiscoverTimeout time.Duration
+var connectDiscoverTimeoutDefault = 2 * time.Second
+
+var connectEscapeChar string
+var connectEscapeCharDefault = "~"
+
+var connectEscapeBindings []string
+var connectEscapeBindingsDefault = []string{}
+
+var connectRFC2217 bool
+var connectRFC2217Default = false
+
+var connectFramed bool
+var connectFramedDefault = false
+
+var connectHeartbeatInterval time.Duration
+var connectHeartbeatIntervalDefault = time.Duration(0)
+
+// portControl controls the serial port behind a server.
+type portControl interface {
+	Break(duration time.Duration) error
+	SetDTR(dtr bool) error
+	SetRTS(rts bool) error
+}
+
+var connectBreakDuration time.Duration
+var connectBreakDurationDefault = 250 * time.Millisecond
+
+var connectLog string
+var connectLogDefault = "serialtcp-session.log"
+
+var connectLogInput bool
+var connectLogInputDefault = false
+
+// connectAction is what ends an interactive session.
+type connectAction int
+
+const (
+	connectQuit connectAction = iota
+	connectSwitch
+	connectReconnect
+)
+
+// stdinReader reads the standard input in the background, so it can be shared between the port
+// picker and successive sessions.
+func stdinReader() <-chan []byte {
+	input := make(chan []byte)
+	go func() {
+		defer close(input)
+		for {
+			buf := make([]byte, 1024)
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				input <- buf[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return input
+}
+
+// readLine reads a line from input, returning io.EOF when it is closed.
+func readLine(input <-chan []byte) (string, error) {
+	var line []byte
+	for data := range input {
+		for _, c := range data {
+			if c == '\n' || c == '\r' {
+				return string(line), nil
+			}
+			line = append(line, c)
+		}
+	}
+	return "", io.EOF
+}
+
+// pickServer lists servers advertised on the local network (see serve --mdns) and asks which one
+// to connect to.
+func pickServer(ctx context.Context, input <-chan []byte, out io.Writer) (string, error) {
+	discoverCtx, cancel := context.WithTimeout(ctx, connectDiscoverTimeout)
+	defer cancel()
+	fmt.Fprintln(out, "Looking for servers on the local network...")
+	entries, err := mdns.Browse(discoverCtx, mdnsService, mdnsDomain)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", errors.New("no servers found on the local network, give --address or check serve --mdns")
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tPORT NAME\tADDRESS\tBAUD RATE\tINSTANCE")
+	for i, entry := range entries {
+		fmt.Fprintf(
+			w, "%d\t%s\t%s\t%s\t%s\n",
+			i+1, txtValue(entry.Text, "port-name"), entryAddress(entry), txtValue(entry.Text, "baud-rate"), entry.Instance,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	for {
+		fmt.Fprintf(out, "Port [1-%d, q to quit]: ", len(entries))
+		line, err := readLine(input)
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "q" {
+			return "", io.EOF
+		}
+		if i, err := strconv.Atoi(line); err == nil && i >= 1 && i <= len(entries) {
+			return entryAddress(entries[i-1]), nil
+		}
+	}
+}
+
+// connectSession is an interactive session with a server.
+type connectSession struct {
+	conn io.ReadWriteCloser
+	// Only with --rfc2217 or --framed.
+	control portControl
+	escaper *escaper
+	log     *sessionLog
+	out     io.Writer
+
+	dtr bool
+	rts bool
+	// Whether the heartbeat found the server dead, with --heartbeat-interval.
+	dead atomic.Bool
+}
+
+// newConnectSession starts a session over conn, negotiating serial port control with --rfc2217, or
+// speaking the framed protocol with --framed, with heartbeats with --heartbeat-interval.
+func newConnectSession(ctx context.Context, conn net.Conn, escaper *escaper, sessionLog *sessionLog, out io.Writer) (*connectSession, error) {
+	s := &connectSession{conn: conn, escaper: escaper, log: sessionLog, out: out, dtr: true, rts: true}
+	if connectRFC2217 {
+		control, err := rfc2217.NewClientConn(conn)
+		if err != nil {
+			return nil, err
+		}
+		s.conn = control
+		s.control = control
+	}
+	if connectFramed {
+		control := framed.NewClientConn(conn)
+		s.conn = control
+		s.control = control
+		if connectHeartbeatInterval > 0 {
+			go func() {
+				// Returns once the session closes the connection, failing to ping.
+				if errors.Is(control.Heartbeat(ctx, connectHeartbeatInterval), framed.ErrDeadPeer) {
+					s.dead.Store(true)
+					control.Close()
+				}
+			}()
+		}
+	}
+	return s, nil
+}
+
+func (s *connectSession) message(format string, a ...any) {
+	fmt.Fprintf(s.out, "\r\n[serialtcp] "+format+"\r\n", a...)
+}
+
+// send sends data typed by the user, logging it with --log-input.
+func (s *connectSession) send(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if connectLogInput {
+		s.log.Sent(data)
+	}
+	_, err := s.conn.Write(data)
+	return err
+}
+
+// run runs an escape action, returning true when it ends the session.
+func (s *connectSession) run(action EscapeAction) (connectAction, bool, error) {
+	switch action {
+	case EscapeDisconnect:
+		return connectQuit, true, nil
+	case EscapeSwitch:
+		return connectSwitch, true, nil
+	case EscapeHelp:
+		fmt.Fprint(s.out, s.escaper.help())
+	case EscapeLog:
+		enabled, err := s.log.Toggle()
+		if err != nil {
+			s.message("Session log: %s", err)
+		} else if enabled {
+			s.message("Logging to %s", s.log.path)
+		} else {
+			s.message("Logging stopped")
+		}
+	case EscapeBreak, EscapeDTR, EscapeRTS:
+		if s.control == nil {
+			s.message("Serial port control requires --rfc2217 or --framed")
+			return connectQuit, false, nil
+		}
+		var err error
+		switch action {
+		case EscapeBreak:
+			err = s.control.Break(connectBreakDuration)
+			s.message("Break sent")
+		case EscapeDTR:
+			s.dtr = !s.dtr
+			err = s.control.SetDTR(s.dtr)
+			s.message("DTR %s", onOff(s.dtr))
+		case EscapeRTS:
+			s.rts = !s.rts
+			err = s.control.SetRTS(s.rts)
+			s.message("RTS %s", onOff(s.rts))
+		}
+		if err != nil {
+			return connectQuit, true, err
+		}
+	}
+	return connectQuit, false, nil
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// interact bridges the session and the terminal until the connection is closed or the user
+// escapes.
+func (s *connectSession) interact(input <-chan []byte) (connectAction, error) {
+	outputErrCh := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.MultiWriter(s.out, s.log.Received()), s.conn)
+		outputErrCh <- err
+	}()
+	// Unblock the output copy on return.
+	defer func() { <-outputErrCh }()
+	defer s.conn.Close()
+
+	for {
+		select {
+		case err := <-outputErrCh:
+			// Deliver it to the deferred receive.
+			outputErrCh <- err
+			if s.dead.Load() {
+				s.message("Server not responding, reconnecting")
+				return connectReconnect, nil
+			}
+			s.message("Connection closed")
+			if errors.Is(err, net.ErrClosed) {
+				err = nil
+			}
+			return connectQuit, err
+		case data, ok := <-input:
+			if !ok {
+				return connectQuit, nil
+			}
+			var toConn []byte
+			for _, c := range data {
+				send, escapeAction := s.escaper.feed(c)
+				toConn = append(toConn, send...)
+				if escapeAction == escapeNone {
+					continue
+				}
+				if err := s.send(toConn); err != nil {
+					return connectQuit, err
+				}
+				toConn = nil
+				action, done, err := s.run(escapeAction)
+				if done || err != nil {
+					return action, err
+				}
+			}
+			if err := s.send(toConn); err != nil {
+				return connectQuit, err
+			}
+		}
+	}
+}
+
+// connectDial connects to the server at address. When reconnecting, it retries every
+// --heartbeat-interval until it succeeds or ctx is done.
+func connectDial(ctx context.Context, address string, reconnect bool, out io.Writer) (net.Conn, error) {
+	for {
+		conn, err := clientDialAddress(address)
+		if err == nil || !reconnect {
+			return conn, err
+		}
+		fmt.Fprintf(out, "Failed to reconnect, retrying in %s: %s\n", connectHeartbeatInterval, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(connectHeartbeatInterval):
+		}
+	}
+}
+
+// makeRaw puts the standard input in raw mode, when it is a terminal, returning a function
+// restoring it.
+func makeRaw() (func() error, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return func() error { return nil }, nil
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set terminal raw mode: %w", err)
+	}
+	return func() error { return term.Restore(fd, state) }, nil
+}
+
+var ClientConnectCmd = &cobra.Command{
+	Use:   "connect",
+	Short: "Use the serial port interactively.",
+	Long:  "Connects the terminal to the serial port. Without --address, servers advertised on the local network (see serve --mdns) are listed to pick from. During the session, escape sequences are typed at the start of a line, as with ssh: ~. disconnects, ~B sends a break, ~D and ~R toggle DTR and RTS, ~L toggles logging the session to --log, ~P picks another port and ~? lists them all. Break, DTR and RTS require --rfc2217 or --framed, with the server running with the same flag.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx := cmd.Context()
+		logger := log.MustLogger(ctx)
+		out := cmd.OutOrStdout()
+
+		escapeChar, escapeEnabled, err := parseEscapeChar(connectEscapeChar)
+		if err != nil {
+			return err
+		}
+		bindings, err := parseEscapeBindings(connectEscapeBindings)
+		if err != nil {
+			return err
+		}
+		sessionLog := &sessionLog{path: connectLog, out: out}
+		defer func() { err = errors.Join(err, sessionLog.Close()) }()
+		if cmd.Flags().Changed("log") {
+			if _, err := sessionLog.Toggle(); err != nil {
+				return fmt.Errorf("failed to open session log: %w", err)
+			}
+		}
+
+		input := stdinReader()
+
+		address := clientAddress
+		pick := !cmd.Flags().Changed("address")
+		reconnect := false
+		for {
+			if pick {
+				address, err = pickServer(ctx, input, out)
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			conn, err := connectDial(ctx, address, reconnect, out)
+			if err != nil {
+				return err
+			}
+			escaper := newEscaper(escapeChar, escapeEnabled, bindings)
+			session, err := newConnectSession(ctx, conn, escaper, sessionLog, out)
+			if err != nil {
+				return errors.Join(err, conn.Close())
+			}
+			logger.Info("Connected", "address", address)
+			if escapeEnabled {
+				fmt.Fprintf(out, "Connected to %s, %s? for help\n", address, escapeCharString(escapeChar))
+			} else {
+				fmt.Fprintf(out, "Connected to %s\n", address)
+			}
+
+			restore, err := makeRaw()
+			if err != nil {
+				return errors.Join(err, conn.Close())
+			}
+			action, err := session.interact(input)
+			if restoreErr := restore(); restoreErr != nil {
+				err = errors.Join(err, restoreErr)
+			}
+			fmt.Fprintln(out)
+			if err != nil || action == connectQuit {
+				return err
+			}
+			reconnect = action == connectReconnect
+			pick = !reconnect
+		}
+	}),
+}
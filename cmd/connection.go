@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+// ConnectionInfo is the context of a client connection, exposed to automations such as --exec
+// commands. It is a stable schema: fields are only ever added. Each field is also available as
+// the environment variable noted next to it.
+type ConnectionInfo struct {
+	// Session id, as listed by ctl sessions. SERIALTCP_SESSION_ID.
+	ID uint64 `json:"id"`
+	// Client address. SERIALTCP_REMOTE_ADDR.
+	RemoteAddr string `json:"remote_addr"`
+	// Whether the client authenticated with a read only token. SERIALTCP_READ_ONLY, "true" or
+	// "false".
+	ReadOnly bool `json:"read_only"`
+	// Who the client authenticated as: empty without authentication, "token" for a guest token, or
+	// "ssh:USER" followed by the public key fingerprint or "token" over SSH. SERIALTCP_AUTH.
+	Auth string `json:"auth"`
+	// Serial port name, or --exec command. SERIALTCP_PORT_NAME.
+	PortName string `json:"port_name"`
+	// Serial port mode. SERIALTCP_BAUD_RATE, SERIALTCP_DATA_BITS, SERIALTCP_PARITY (no, odd,
+	// even, mark or space) and SERIALTCP_STOP_BITS (1, 1.5 or 2).
+	BaudRate int    `json:"baud_rate"`
+	DataBits int    `json:"data_bits"`
+	Parity   string `json:"parity"`
+	StopBits string `json:"stop_bits"`
+	// When the connection started. SERIALTCP_START, in RFC 3339 format.
+	Start time.Time `json:"start"`
+}
+
+func newConnectionInfo(id uint64, portName, remoteAddr string, auth authentication, mode serial.Mode) ConnectionInfo {
+	parity := ParityValue(mode.Parity)
+	stopBits := StopBitsValue(mode.StopBits)
+	return ConnectionInfo{
+		ID:         id,
+		RemoteAddr: remoteAddr,
+		ReadOnly:   auth.readOnly,
+		Auth:       auth.identity,
+		PortName:   portName,
+		BaudRate:   mode.BaudRate,
+		DataBits:   mode.DataBits,
+		Parity:     parity.String(),
+		StopBits:   stopBits.String(),
+		Start:      time.Now(),
+	}
+}
+
+// Environ returns c as environment variables, in the form "key=value".
+func (c ConnectionInfo) Environ() []string {
+	return []string{
+		fmt.Sprintf("SERIALTCP_SESSION_ID=%d", c.ID),
+		"SERIALTCP_REMOTE_ADDR=" + c.RemoteAddr,
+		"SERIALTCP_READ_ONLY=" + strconv.FormatBool(c.ReadOnly),
+		"SERIALTCP_AUTH=" + c.Auth,
+		"SERIALTCP_PORT_NAME=" + c.PortName,
+		fmt.Sprintf("SERIALTCP_BAUD_RATE=%d", c.BaudRate),
+		fmt.Sprintf("SERIALTCP_DATA_BITS=%d", c.DataBits),
+		"SERIALTCP_PARITY=" + c.Parity,
+		"SERIALTCP_STOP_BITS=" + c.StopBits,
+		"SERIALTCP_START=" + c.Start.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var maxConnsPerIP int
+var maxConnsPerIPDefault = 0
+
+var connIntervalPerIP time.Duration
+var connIntervalPerIPDefault = time.Duration(0)
+
+var connBurstPerIP int
+var connBurstPerIPDefault = 3
+
+// connLimitEntry is the state of a client address.
+type connLimitEntry struct {
+	// Connections accepted and not closed yet, including the ones waiting for their session.
+	open int
+	// Token bucket of new connections, refilled by one every --conn-interval-per-ip.
+	tokens float64
+	last   time.Time
+}
+
+// connLimitSettings are the limits of a connLimiter, from --max-conns-per-ip,
+// --conn-interval-per-ip and --conn-burst-per-ip.
+type connLimitSettings struct {
+	maxConns int
+	interval time.Duration
+	burst    int
+}
+
+// connLimitFlags returns the limits set by the flags.
+func connLimitFlags() connLimitSettings {
+	return connLimitSettings{maxConns: maxConnsPerIP, interval: connIntervalPerIP, burst: connBurstPerIP}
+}
+
+// check returns why the limits are invalid, if they are.
+func (s connLimitSettings) check() error {
+	if s.interval > 0 && s.burst < 1 {
+		return fmt.Errorf("invalid connection burst: %d", s.burst)
+	}
+	return nil
+}
+
+// connLimiter limits connections per client address, with --max-conns-per-ip and
+// --conn-interval-per-ip. Its state is shared by all listeners, and kept across rebinds and
+// reloads.
+type connLimiter struct {
+	mu       sync.Mutex
+	settings connLimitSettings
+	entries  map[netip.Addr]*connLimitEntry
+}
+
+var connLimits = &connLimiter{entries: map[netip.Addr]*connLimitEntry{}}
+
+// connLimitsEnabled returns whether listeners enforce per address limits: when any is set, or
+// when a config file reload may set them.
+func connLimitsEnabled() bool {
+	return maxConnsPerIP > 0 || connIntervalPerIP > 0 || configFile != ""
+}
+
+// update changes the limits with change, for connections from now on.
+func (l *connLimiter) update(change func(settings *connLimitSettings)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	settings := l.settings
+	change(&settings)
+	if err := settings.check(); err != nil {
+		return err
+	}
+	l.settings = settings
+	return nil
+}
+
+// remoteIP returns the IP address of a TCP or UDP peer; other peers are local, and not limited.
+func remoteIP(addr net.Addr) (netip.Addr, bool) {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.AddrPort().Addr().Unmap(), true
+	case *net.UDPAddr:
+		return addr.AddrPort().Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// refill adds the tokens earned since the last connection to entry.
+func (e *connLimitEntry) refill(settings connLimitSettings, now time.Time) {
+	if settings.interval <= 0 {
+		return
+	}
+	e.tokens = min(float64(settings.burst), e.tokens+float64(now.Sub(e.last))/float64(settings.interval))
+	e.last = now
+}
+
+// prune forgets addresses without open connections and with a full bucket, as they are back to
+// their initial state.
+func (l *connLimiter) prune(now time.Time) {
+	for ip, entry := range l.entries {
+		entry.refill(l.settings, now)
+		if entry.open == 0 && (l.settings.interval <= 0 || entry.tokens >= float64(l.settings.burst)) {
+			delete(l.entries, ip)
+		}
+	}
+}
+
+// admit counts a new connection from ip, returning why it is refused, if it is.
+func (l *connLimiter) admit(ip netip.Addr) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.prune(now)
+	entry, ok := l.entries[ip]
+	if !ok {
+		entry = &connLimitEntry{tokens: float64(l.settings.burst), last: now}
+		l.entries[ip] = entry
+	}
+	if l.settings.maxConns > 0 && entry.open >= l.settings.maxConns {
+		return errors.New("too many connections from address")
+	}
+	if l.settings.interval > 0 {
+		if entry.tokens < 1 {
+			return errors.New("connecting too often from address")
+		}
+		entry.tokens--
+	}
+	entry.open++
+	return nil
+}
+
+// release uncounts a closed connection from ip.
+func (l *connLimiter) release(ip netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry, ok := l.entries[ip]; ok && entry.open > 0 {
+		entry.open--
+	}
+}
+
+// connLimitConn is a connection counted by a connLimiter until closed.
+type connLimitConn struct {
+	net.Conn
+	limiter *connLimiter
+	ip      netip.Addr
+	once    sync.Once
+}
+
+func (c *connLimitConn) Close() error {
+	c.once.Do(func() { c.limiter.release(c.ip) })
+	return c.Conn.Close()
+}
+
+// NetConn returns the limited connection.
+func (c *connLimitConn) NetConn() net.Conn { return c.Conn }
+
+// connLimitListener is a net.Listener enforcing a connLimiter. Connections are accepted in the
+// background as they arrive, instead of waiting in the listen backlog while a session is in
+// progress, so that ones over the limits are counted and refused right away.
+type connLimitListener struct {
+	net.Listener
+	ctx     context.Context
+	limiter *connLimiter
+	conns   chan net.Conn
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// listen returns listener enforcing the limits.
+func (l *connLimiter) listen(ctx context.Context, listener net.Listener) net.Listener {
+	limited := &connLimitListener{
+		Listener: listener,
+		ctx:      ctx,
+		limiter:  l,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go limited.run()
+	return limited
+}
+
+func (l *connLimitListener) run() {
+	logger := log.MustLogger(l.ctx)
+	delay := acceptMinDelay
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if isTemporaryAcceptError(err) {
+				logger.Error("Failed to accept connection", "error", err, "temporary", true, "retry-in", delay)
+				time.Sleep(delay)
+				delay = min(2*delay, acceptMaxDelay)
+				continue
+			}
+			l.mu.Lock()
+			l.err = err
+			l.mu.Unlock()
+			close(l.done)
+			return
+		}
+		delay = acceptMinDelay
+		ip, ok := remoteIP(conn.RemoteAddr())
+		if !ok {
+			go l.deliver(conn)
+			continue
+		}
+		if err := l.limiter.admit(ip); err != nil {
+			logger.Warn("Refusing connection", "remote-addr", conn.RemoteAddr(), "reason", err)
+			conn.Close()
+			continue
+		}
+		go l.deliver(&connLimitConn{Conn: conn, limiter: l.limiter, ip: ip})
+	}
+}
+
+func (l *connLimitListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return nil, l.err
+	}
+}
+
+// withConnLimits returns listen with its listeners enforcing the per address limits, if any.
+func withConnLimits(ctx context.Context, listen func() (net.Listener, error)) (func() (net.Listener, error), error) {
+	if !connLimitsEnabled() {
+		return listen, nil
+	}
+	if err := connLimits.update(func(settings *connLimitSettings) { *settings = connLimitFlags() }); err != nil {
+		return nil, err
+	}
+	return func() (net.Listener, error) {
+		listener, err := listen()
+		if err != nil {
+			return nil, err
+		}
+		return connLimits.listen(ctx, listener), nil
+	}, nil
+}
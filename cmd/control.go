@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/bootevent"
+)
+
+// ControlRequest is a request sent to the control socket. Each connection to the control socket
+// carries a single JSON encoded request, followed by a single JSON encoded ControlResponse.
+type ControlRequest struct {
+	Command  string        `json:"command"`
+	ID       uint64        `json:"id,omitempty"`
+	Enable   bool          `json:"enable,omitempty"`
+	BaudRate int           `json:"baud_rate,omitempty"`
+	DataBits int           `json:"data_bits,omitempty"`
+	Parity   string        `json:"parity,omitempty"`
+	StopBits string        `json:"stop_bits,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	ReadOnly bool          `json:"read_only,omitempty"`
+	Steal    bool          `json:"steal,omitempty"`
+	Message  string        `json:"message,omitempty"`
+}
+
+// ControlResponse is the response to a ControlRequest.
+type ControlResponse struct {
+	Error    string            `json:"error,omitempty"`
+	Sessions []SessionInfo     `json:"sessions,omitempty"`
+	Stats    *Stats            `json:"stats,omitempty"`
+	Token    string            `json:"token,omitempty"`
+	Ports    []PortInfo        `json:"ports,omitempty"`
+	Events   []bootevent.Event `json:"events,omitempty"`
+}
+
+// Control socket commands.
+const (
+	controlSessions = "sessions"
+	controlKick     = "kick"
+	controlBreak    = "break"
+	controlDTR      = "dtr"
+	controlRTS      = "rts"
+	controlBaudRate = "baud-rate"
+	controlMode     = "mode"
+	controlStats    = "stats"
+	controlToken    = "token"
+	controlDebug    = "debug"
+	controlPorts    = "ports"
+	controlEvents   = "events"
+	controlDrain    = "drain"
+)
+
+func handleControlRequest(srv *server, request ControlRequest) (response ControlResponse) {
+	var err error
+	switch request.Command {
+	case controlSessions:
+		response.Sessions = srv.Sessions()
+	case controlKick:
+		err = srv.Kick(request.ID)
+	case controlBreak:
+		err = srv.Break(request.Duration)
+	case controlDTR:
+		err = srv.SetDTR(request.Enable)
+	case controlRTS:
+		err = srv.SetRTS(request.Enable)
+	case controlBaudRate:
+		err = srv.SetBaudRate(request.BaudRate)
+	case controlMode:
+		err = setControlMode(srv, request)
+	case controlStats:
+		stats := srv.Stats()
+		response.Stats = &stats
+	case controlToken:
+		response.Token = srv.MintToken(request.Duration, request.ReadOnly, request.Steal)
+	case controlPorts:
+		response.Ports = srv.Ports()
+	case controlEvents:
+		response.Events, err = srv.BootEvents()
+	case controlDrain:
+		srv.SetDraining(request.Enable, request.Message)
+	case controlDebug:
+		setDebug(request.Enable)
+	default:
+		err = fmt.Errorf("unknown command: %#v", request.Command)
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	return response
+}
+
+// setControlMode changes the serial port mode to the settings given in request, keeping the others.
+func setControlMode(srv *server, request ControlRequest) error {
+	if request.BaudRate < 0 {
+		return fmt.Errorf("invalid baud rate: %d", request.BaudRate)
+	}
+	if request.DataBits != 0 && (request.DataBits < 5 || request.DataBits > 8) {
+		return fmt.Errorf("invalid data bits: %d", request.DataBits)
+	}
+	var parity ParityValue
+	if request.Parity != "" {
+		if err := parity.Set(request.Parity); err != nil {
+			return err
+		}
+	}
+	var stopBits StopBitsValue
+	if request.StopBits != "" {
+		if err := stopBits.Set(request.StopBits); err != nil {
+			return err
+		}
+	}
+	return srv.SetMode(func(mode *serial.Mode) {
+		if request.BaudRate != 0 {
+			mode.BaudRate = request.BaudRate
+		}
+		if request.DataBits != 0 {
+			mode.DataBits = request.DataBits
+		}
+		if request.Parity != "" {
+			mode.Parity = serial.Parity(parity)
+		}
+		if request.StopBits != "" {
+			mode.StopBits = serial.StopBits(stopBits)
+		}
+	})
+}
+
+func handleControlConn(ctx context.Context, conn net.Conn, srv *server) (err error) {
+	defer func() { err = errors.Join(err, conn.Close()) }()
+
+	var request ControlRequest
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		return fmt.Errorf("failed to decode control request: %w", err)
+	}
+
+	logger := log.MustLogger(ctx)
+	logger.Info("Control request", "command", request.Command)
+
+	response := handleControlRequest(srv, request)
+	if err := json.NewEncoder(conn).Encode(response); err != nil {
+		return fmt.Errorf("failed to encode control response: %w", err)
+	}
+	return nil
+}
+
+// listenControl listens on a Unix socket at path for control requests, only accessible by the
+// owner.
+func listenControl(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %s: %w", path, err)
+	}
+	// Anyone able to connect can control the serial port.
+	if err := os.Chmod(path, 0o600); err != nil {
+		return nil, errors.Join(
+			fmt.Errorf("failed to restrict control socket permissions: %w", err),
+			listener.Close(),
+		)
+	}
+	return listener, nil
+}
+
+// serveControl serves control requests from listener until it is closed.
+func serveControl(ctx context.Context, listener net.Listener, srv *server) {
+	logger := log.MustLogger(ctx)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Error("Failed to accept control connection", "error", err)
+			continue
+		}
+		go func() {
+			if err := handleControlConn(ctx, conn, srv); err != nil {
+				logger.Error("Failed to handle control connection", "error", err)
+			}
+		}()
+	}
+}
+
+// controlCall sends request to the control socket at path and returns its response.
+func controlCall(path string, request ControlRequest) (response ControlResponse, err error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return response, fmt.Errorf("failed to connect to control socket: %w", err)
+	}
+	defer func() { err = errors.Join(err, conn.Close()) }()
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return response, fmt.Errorf("failed to send control request: %w", err)
+	}
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return response, fmt.Errorf("failed to read control response: %w", err)
+	}
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
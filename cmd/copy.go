@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// copyBufferSize is the size of the buffer copyContext reads into, as io.Copy's.
+const copyBufferSize = 32 * 1024
+
+// readDeadliner is a reader whose blocked reads can be interrupted, such as a net.Conn.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// copyContext copies from src to dst as io.Copy does, until src is done or ctx is. When ctx is
+// done, a read blocked on src is interrupted by setting a read deadline in the past, if src
+// supports it; otherwise, it stays blocked until src is closed, as endSession does.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (written int64, err error) {
+	if src, ok := src.(readDeadliner); ok {
+		stop := context.AfterFunc(ctx, func() {
+			// The interrupted read returns os.ErrDeadlineExceeded, replaced by the context error.
+			_ = src.SetReadDeadline(time.Unix(1, 0))
+		})
+		defer stop()
+	}
+	buf := make([]byte, copyBufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			m, err := dst.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+			if m < n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if readErr != nil {
+			if errors.Is(readErr, os.ErrDeadlineExceeded) && ctx.Err() != nil {
+				return written, ctx.Err()
+			}
+			if readErr == io.EOF {
+				return written, nil
+			}
+			return written, readErr
+		}
+	}
+}
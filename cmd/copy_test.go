@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// copyBothWays copies between a and b in two goroutines, as sessions do, returning the channel
+// each copy's error is sent to.
+func copyBothWays(ctx context.Context, a, b io.ReadWriter) <-chan error {
+	errs := make(chan error, 2)
+	go func() {
+		_, err := copyContext(ctx, a, b)
+		errs <- err
+	}()
+	go func() {
+		_, err := copyContext(ctx, b, a)
+		errs <- err
+	}()
+	return errs
+}
+
+// waitCopies waits for both copies of copyBothWays to return, failing t if they do not in time.
+func waitCopies(t *testing.T, errs <-chan error) []error {
+	t.Helper()
+	var results []error
+	for range 2 {
+		select {
+		case err := <-errs:
+			results = append(results, err)
+		case <-time.After(time.Second):
+			t.Fatal("copy did not return")
+		}
+	}
+	return results
+}
+
+// waitGoroutines waits for the count of goroutines to drop back to want, failing t if it does not
+// in time.
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: %d running, %d before", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCopyContextCancelInterruptsDeadlineReads(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	client, clientPeer := net.Pipe()
+	port, portPeer := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := copyBothWays(ctx, client, port)
+
+	// Both copies are blocked reading, as neither peer writes.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	for _, err := range waitCopies(t, errs) {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	}
+
+	for _, conn := range []net.Conn{client, clientPeer, port, portPeer} {
+		conn.Close()
+	}
+	waitGoroutines(t, before)
+}
+
+func TestCopyContextCopiesUntilEOF(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	client, clientPeer := net.Pipe()
+	port, portPeer := net.Pipe()
+	errs := copyBothWays(context.Background(), client, port)
+
+	go func() {
+		_, _ = clientPeer.Write([]byte("hello"))
+	}()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(portPeer, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("expected %q, got %q", "hello", buf)
+	}
+
+	// Closing the peers ends the reads of both copies.
+	clientPeer.Close()
+	portPeer.Close()
+	waitCopies(t, errs)
+
+	client.Close()
+	port.Close()
+	waitGoroutines(t, before)
+}
+
+func TestCopyContextCancelWaitsForCloseWithoutDeadlines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	// io.Pipe has no read deadlines, so reads are only interrupted by closing.
+	clientReader, clientWriter := io.Pipe()
+	portReader, portWriter := io.Pipe()
+	client := struct {
+		io.Reader
+		io.Writer
+	}{clientReader, io.Discard}
+	port := struct {
+		io.Reader
+		io.Writer
+	}{portReader, io.Discard}
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := copyBothWays(ctx, client, port)
+
+	// Once written, both copies are running, and soon blocked reading again.
+	for _, writer := range []io.Writer{clientWriter, portWriter} {
+		if _, err := writer.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errs:
+		t.Fatalf("copy returned before its reader was closed: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// As endSession does.
+	clientReader.Close()
+	portReader.Close()
+	for _, err := range waitCopies(t, errs) {
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	clientWriter.Close()
+	portWriter.Close()
+	waitGoroutines(t, before)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fornellas/serialtcp/pipeline"
+)
+
+// CRLFMode is a line ending translation.
+type CRLFMode int
+
+const (
+	CRLFRaw CRLFMode = iota
+	CRLFCRToLF
+	CRLFLFToCR
+	CRLFCRToCRLF
+	CRLFLFToCRLF
+	CRLFStripCR
+	CRLFStripLF
+)
+
+var crlfModeNames = map[CRLFMode]string{
+	CRLFRaw:      "raw",
+	CRLFCRToLF:   "cr-to-lf",
+	CRLFLFToCR:   "lf-to-cr",
+	CRLFCRToCRLF: "cr-to-crlf",
+	CRLFLFToCRLF: "lf-to-crlf",
+	CRLFStripCR:  "strip-cr",
+	CRLFStripLF:  "strip-lf",
+}
+
+// CRLFModeValue implements pflag.Value for CRLFMode
+type CRLFModeValue CRLFMode
+
+func (m *CRLFModeValue) String() string {
+	return crlfModeNames[CRLFMode(*m)]
+}
+
+func (m *CRLFModeValue) Set(s string) error {
+	for mode, name := range crlfModeNames {
+		if strings.EqualFold(s, name) {
+			*m = CRLFModeValue(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid CR/LF mode: %s", s)
+}
+
+func (m *CRLFModeValue) Type() string {
+	return "mode"
+}
+
+// translate returns p with line endings translated by mode.
+func (m CRLFMode) translate(p []byte) []byte {
+	switch m {
+	case CRLFCRToLF:
+		return bytes.ReplaceAll(p, []byte{'\r'}, []byte{'\n'})
+	case CRLFLFToCR:
+		return bytes.ReplaceAll(p, []byte{'\n'}, []byte{'\r'})
+	case CRLFCRToCRLF:
+		return bytes.ReplaceAll(p, []byte{'\r'}, []byte("\r\n"))
+	case CRLFLFToCRLF:
+		return bytes.ReplaceAll(p, []byte{'\n'}, []byte("\r\n"))
+	case CRLFStripCR:
+		return bytes.ReplaceAll(p, []byte{'\r'}, nil)
+	case CRLFStripLF:
+		return bytes.ReplaceAll(p, []byte{'\n'}, nil)
+	default:
+		return p
+	}
+}
+
+// crlfWriter translates line endings of data written to it.
+type crlfWriter struct {
+	io.Writer
+	mode CRLFMode
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := w.Writer.Write(w.mode.translate(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// newCRLFWriter returns w translating line endings by mode.
+func newCRLFWriter(w io.Writer, mode CRLFMode) io.Writer {
+	if mode == CRLFRaw {
+		return w
+	}
+	return &crlfWriter{Writer: w, mode: mode}
+}
+
+// crlfMiddleware returns middleware translating line endings by mode.
+func crlfMiddleware(mode CRLFMode) pipeline.Middleware {
+	return func(w io.Writer) io.Writer { return newCRLFWriter(w, mode) }
+}
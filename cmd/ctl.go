@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/bootevent"
+)
+
+var ctlControlSocket string
+var ctlControlSocketDefault = ""
+
+var CtlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Control a running server.",
+	Long:  "Controls a running server through its control socket (see serve --control-socket).",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cmd.Help(); err != nil {
+			logger := log.MustLogger(cmd.Context())
+			logger.Error("Failed to display help", "err", err)
+		}
+		Exit(1)
+	},
+}
+
+func parseOnOff(s string) (bool, error) {
+	switch s {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid value, expected on or off: %s", s)
+	}
+}
+
+var CtlSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List active sessions.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		response, err := controlCall(ctlControlSocket, ControlRequest{Command: controlSessions})
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tREMOTE ADDRESS\tSTART\tBYTES TO CLIENT\tBYTES TO PORT\tBYTES DROPPED\tERRORS")
+		for _, sess := range response.Sessions {
+			fmt.Fprintf(
+				w, "%d\t%s\t%s\t%d\t%d\t%d\t%d\n",
+				sess.ID, sess.RemoteAddr, sess.Start.Format(time.DateTime), sess.BytesToClient, sess.BytesToPort, sess.BytesDropped, sess.Errors,
+			)
+		}
+		return w.Flush()
+	}),
+}
+
+var CtlPortsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "List served serial ports.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		response, err := controlCall(ctlControlSocket, ControlRequest{Command: controlPorts})
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tBAUD RATE\tDATA BITS\tPARITY\tSTOP BITS\tIDENTITY")
+		for _, port := range response.Ports {
+			identity := ""
+			if !port.IdentifiedAt.IsZero() {
+				identity = strconv.Quote(port.Identity)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", port.Name, port.BaudRate, port.DataBits, port.Parity, port.StopBits, identity)
+		}
+		return w.Flush()
+	}),
+}
+
+var CtlKickCmd = &cobra.Command{
+	Use:   "kick ID",
+	Short: "Disconnect a session.",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid session id: %w", err)
+		}
+		_, err = controlCall(ctlControlSocket, ControlRequest{Command: controlKick, ID: id})
+		return err
+	}),
+}
+
+var ctlBreakDuration time.Duration
+var ctlBreakDurationDefault = 250 * time.Millisecond
+
+var CtlBreakCmd = &cobra.Command{
+	Use:   "break",
+	Short: "Send a break to the serial port.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		_, err := controlCall(ctlControlSocket, ControlRequest{Command: controlBreak, Duration: ctlBreakDuration})
+		return err
+	}),
+}
+
+var CtlDtrCmd = &cobra.Command{
+	Use:   "dtr on|off",
+	Short: "Set serial port DTR (Data Terminal Ready).",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		enable, err := parseOnOff(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = controlCall(ctlControlSocket, ControlRequest{Command: controlDTR, Enable: enable})
+		return err
+	}),
+}
+
+var CtlRtsCmd = &cobra.Command{
+	Use:   "rts on|off",
+	Short: "Set serial port RTS (Request To Send).",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		enable, err := parseOnOff(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = controlCall(ctlControlSocket, ControlRequest{Command: controlRTS, Enable: enable})
+		return err
+	}),
+}
+
+var CtlBaudRateCmd = &cobra.Command{
+	Use:   "baud-rate RATE",
+	Short: "Change the serial port baud rate.",
+	Long:  "Changes the baud rate of the open serial port, and of sessions started afterwards.",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		baudRate, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid baud rate: %w", err)
+		}
+		_, err = controlCall(ctlControlSocket, ControlRequest{Command: controlBaudRate, BaudRate: baudRate})
+		return err
+	}),
+}
+
+var ctlModeBaudRate int
+var ctlModeBaudRateDefault = 0
+
+var ctlModeDataBits int
+var ctlModeDataBitsDefault = 0
+
+var ctlModeParity ParityValue
+
+var ctlModeStopBits StopBitsValue
+
+var CtlModeCmd = &cobra.Command{
+	Use:   "mode",
+	Short: "Change the serial port mode.",
+	Long:  "Changes the baud rate, data bits, parity or stop bits of the open serial port, and of sessions started afterwards, keeping sessions connected, such as when a device switches speeds between its bootloader and operating system. Settings which are not given are kept.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		request := ControlRequest{Command: controlMode, BaudRate: ctlModeBaudRate, DataBits: ctlModeDataBits}
+		flags := cmd.Flags()
+		if flags.Changed("parity") {
+			request.Parity = ctlModeParity.String()
+		}
+		if flags.Changed("stop-bits") {
+			request.StopBits = ctlModeStopBits.String()
+		}
+		if request == (ControlRequest{Command: controlMode}) {
+			return errors.New("no setting to change given")
+		}
+		_, err := controlCall(ctlControlSocket, request)
+		return err
+	}),
+}
+
+var CtlStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Dump server statistics.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		response, err := controlCall(ctlControlSocket, ControlRequest{Command: controlStats})
+		if err != nil {
+			return err
+		}
+		stats := response.Stats
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Uptime:\t%s\n", time.Since(stats.Start).Round(time.Second))
+		fmt.Fprintf(w, "Active sessions:\t%d\n", stats.ActiveSessions)
+		fmt.Fprintf(w, "Total sessions:\t%d\n", stats.TotalSessions)
+		fmt.Fprintf(w, "Bytes to client:\t%d\n", stats.BytesToClient)
+		fmt.Fprintf(w, "Bytes to port:\t%d\n", stats.BytesToPort)
+		fmt.Fprintf(w, "Bytes dropped:\t%d\n", stats.BytesDropped)
+		fmt.Fprintf(w, "Errors:\t%d\n", stats.Errors)
+		fmt.Fprintf(w, "Draining:\t%t\n", stats.Draining)
+		if modem := stats.Modem; modem != nil {
+			fmt.Fprintf(w, "Modem status at:\t%s\n", modem.Time.Format(time.DateTime))
+			fmt.Fprintf(w, "Modem status:\tCTS %s, DSR %s, RI %s, DCD %s\n", onOff(modem.CTS), onOff(modem.DSR), onOff(modem.RI), onOff(modem.DCD))
+		}
+		if uart := stats.UART; uart != nil {
+			fmt.Fprintf(w, "UART counters at:\t%s\n", uart.Time.Format(time.DateTime))
+			fmt.Fprintf(w, "UART RX:\t%d\n", uart.RX)
+			fmt.Fprintf(w, "UART TX:\t%d\n", uart.TX)
+			fmt.Fprintf(w, "UART frame errors:\t%d\n", uart.Frame)
+			fmt.Fprintf(w, "UART overruns:\t%d\n", uart.Overrun)
+			fmt.Fprintf(w, "UART parity errors:\t%d\n", uart.Parity)
+			fmt.Fprintf(w, "UART breaks:\t%d\n", uart.Break)
+			fmt.Fprintf(w, "UART buffer overruns:\t%d\n", uart.BufferOverrun)
+		}
+		kinds := make([]string, 0, len(stats.BootEvents))
+		for kind := range stats.BootEvents {
+			kinds = append(kinds, string(kind))
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "Boot events %s:\t%d\n", kind, stats.BootEvents[bootevent.Kind(kind)])
+		}
+		return w.Flush()
+	}),
+}
+
+var CtlEventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "List recent boot console events.",
+	Long:  "Lists the most recent boot console events recognized by a server running with --boot-events.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		response, err := controlCall(ctlControlSocket, ControlRequest{Command: controlEvents})
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tKIND\tDETAIL")
+		for _, event := range response.Events {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", event.Time.Format(time.DateTime), event.Kind, strconv.Quote(event.Detail))
+		}
+		return w.Flush()
+	}),
+}
+
+var CtlDebugCmd = &cobra.Command{
+	Use:   "debug on|off",
+	Short: "Toggle server debug logging.",
+	Long:  "Toggles server debug logging, including tracing of all data transferred, without restarting it. Sending SIGUSR2 to the server toggles it as well.",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		enable, err := parseOnOff(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = controlCall(ctlControlSocket, ControlRequest{Command: controlDebug, Enable: enable})
+		return err
+	}),
+}
+
+var ctlTokenTTL time.Duration
+var ctlTokenTTLDefault = time.Hour
+
+var ctlTokenReadOnly bool
+var ctlTokenReadOnlyDefault = false
+
+var ctlTokenSteal bool
+var ctlTokenStealDefault = false
+
+var CtlTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Mint a guest access token.",
+	Long:  "Mints a time limited, single use token granting access to the port of a server running with --token-auth. Clients send the token as their first line.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		response, err := controlCall(ctlControlSocket, ControlRequest{
+			Command:  controlToken,
+			Duration: ctlTokenTTL,
+			ReadOnly: ctlTokenReadOnly,
+			Steal:    ctlTokenSteal,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), response.Token)
+		return err
+	}),
+}
+
+func init() {
+	CtlCmd.PersistentFlags().StringVarP(&ctlControlSocket, "control-socket", "c", ctlControlSocketDefault, "Server control socket path")
+	if err := CtlCmd.MarkPersistentFlagRequired("control-socket"); err != nil {
+		panic(err)
+	}
+
+	CtlBreakCmd.PersistentFlags().DurationVarP(&ctlBreakDuration, "duration", "", ctlBreakDurationDefault, "Break duration, at most 10s")
+
+	CtlModeCmd.PersistentFlags().IntVarP(&ctlModeBaudRate, "baud-rate", "b", ctlModeBaudRateDefault, "Serial port baud rate")
+	CtlModeCmd.PersistentFlags().IntVarP(&ctlModeDataBits, "data-bits", "d", ctlModeDataBitsDefault, "Serial port data bits (5, 6, 7, or 8)")
+	CtlModeCmd.PersistentFlags().VarP(&ctlModeParity, "parity", "", "Serial port parity (no, odd, even, mark or space)")
+	CtlModeCmd.PersistentFlags().VarP(&ctlModeStopBits, "stop-bits", "", "Serial port stop bits (1, 1.5, or 2)")
+
+	CtlTokenCmd.PersistentFlags().DurationVarP(&ctlTokenTTL, "ttl", "", ctlTokenTTLDefault, "How long the token is valid for")
+	CtlTokenCmd.PersistentFlags().BoolVarP(&ctlTokenReadOnly, "read-only", "", ctlTokenReadOnlyDefault, "Grant read only access: data sent by the client is discarded")
+	CtlTokenCmd.PersistentFlags().BoolVarP(&ctlTokenSteal, "steal", "", ctlTokenStealDefault, "Also grant taking over the session in progress, on a server running with --allow-steal, with client --steal")
+
+	CtlCmd.AddCommand(CtlPortsCmd)
+	CtlCmd.AddCommand(CtlSessionsCmd)
+	CtlCmd.AddCommand(CtlKickCmd)
+	CtlCmd.AddCommand(CtlBreakCmd)
+	CtlCmd.AddCommand(CtlDtrCmd)
+	CtlCmd.AddCommand(CtlRtsCmd)
+	CtlCmd.AddCommand(CtlBaudRateCmd)
+	CtlCmd.AddCommand(CtlModeCmd)
+	CtlCmd.AddCommand(CtlStatsCmd)
+	CtlCmd.AddCommand(CtlEventsCmd)
+	CtlCmd.AddCommand(CtlTokenCmd)
+	CtlCmd.AddCommand(CtlDebugCmd)
+
+	RootCmd.AddCommand(CtlCmd)
+}
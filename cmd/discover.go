@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/mdns"
+)
+
+// DNS-SD service type and domain servers are advertised as.
+const (
+	mdnsService = "_serialtcp._tcp"
+	mdnsDomain  = "local"
+)
+
+var discoverTimeout time.Duration
+var discoverTimeoutDefault = 2 * time.Second
+
+// txtValue returns the value for key from DNS-SD TXT record strings.
+func txtValue(text []string, key string) string {
+	for _, kv := range text {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// entryAddress returns the address to connect to entry at.
+func entryAddress(entry mdns.Entry) string {
+	host := entry.Host
+	if len(entry.IPs) > 0 {
+		host = entry.IPs[0].String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(entry.Port)))
+}
+
+var DiscoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "List servers advertised on the local network.",
+	Long:  "Lists servers advertised on the local network via DNS-SD over multicast DNS (see serve --mdns).",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(cmd.Context(), discoverTimeout)
+		defer cancel()
+
+		entries, err := mdns.Browse(ctx, mdnsService, mdnsDomain)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "INSTANCE\tADDRESS\tPORT NAME\tBAUD RATE")
+		for _, entry := range entries {
+			fmt.Fprintf(
+				w, "%s\t%s\t%s\t%s\n",
+				entry.Instance,
+				entryAddress(entry),
+				txtValue(entry.Text, "port-name"),
+				txtValue(entry.Text, "baud-rate"),
+			)
+		}
+		return w.Flush()
+	}),
+}
+
+func init() {
+	DiscoverCmd.PersistentFlags().DurationVarP(&discoverTimeout, "timeout", "t", discoverTimeoutDefault, "How long to wait for responses")
+
+	RootCmd.AddCommand(DiscoverCmd)
+}
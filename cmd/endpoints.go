@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// endpoints are the listeners of serve besides the ones clients start sessions with, bound before
+// anything is served from them, so --dry-run fails as starting would.
+type endpoints struct {
+	control net.Listener
+	metrics net.Listener
+	pprof   net.Listener
+	health  net.Listener
+	sse     net.Listener
+	api     net.Listener
+}
+
+// listenEndpoints binds the listeners of --control-socket, --metrics-address, --pprof-address,
+// --health-address, --sse-address and --api-address, the ones set.
+func listenEndpoints() (_ *endpoints, err error) {
+	e := &endpoints{}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, e.closeHTTP())
+			if e.control != nil {
+				err = errors.Join(err, e.control.Close())
+			}
+		}
+	}()
+	if controlSocket != "" {
+		if e.control, err = listenControl(controlSocket); err != nil {
+			return nil, err
+		}
+	}
+	for _, listen := range []struct {
+		address  string
+		listener *net.Listener
+		what     string
+	}{
+		{metricsAddress, &e.metrics, "metrics"},
+		{pprofAddress, &e.pprof, "pprof"},
+		{healthAddress, &e.health, "health checks"},
+		{sseAddress, &e.sse, "events"},
+		{apiAddress, &e.api, "the API"},
+	} {
+		if listen.address == "" {
+			continue
+		}
+		listener, err := net.Listen("tcp", listen.address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for %s: %w", listen.what, err)
+		}
+		*listen.listener = listener
+	}
+	return e, nil
+}
+
+// closeHTTP closes the listeners served over HTTP, for when they are not served, as serving them
+// closes them once ctx is done.
+func (e *endpoints) closeHTTP() error {
+	var errs []error
+	for _, listener := range []net.Listener{e.metrics, e.pprof, e.health, e.sse, e.api} {
+		if listener != nil {
+			errs = append(errs, listener.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// serve serves the HTTP endpoints of srv, until ctx is done.
+func (e *endpoints) serve(ctx context.Context, srv *server, sse *sseHub, apiToken string) {
+	logger := log.MustLogger(ctx)
+	if e.metrics != nil {
+		logger.Info("Serving metrics", "address", e.metrics.Addr())
+		go func() {
+			if err := serveMetrics(ctx, e.metrics, srv); err != nil {
+				logger.Error("Failed to serve metrics", "error", err)
+			}
+		}()
+	}
+	if e.pprof != nil {
+		logger.Warn("Serving pprof, exposing internals to whoever can connect", "address", e.pprof.Addr())
+		go func() {
+			if err := servePprof(ctx, e.pprof); err != nil {
+				logger.Error("Failed to serve pprof", "error", err)
+			}
+		}()
+	}
+	if e.health != nil {
+		logger.Info("Serving health checks", "address", e.health.Addr())
+		go func() {
+			if err := serveHealth(ctx, e.health, srv); err != nil {
+				logger.Error("Failed to serve health checks", "error", err)
+			}
+		}()
+	}
+	if e.sse != nil {
+		logger.Info("Serving events", "address", e.sse.Addr())
+		go func() {
+			if err := serveSSE(ctx, e.sse, sse); err != nil {
+				logger.Error("Failed to serve events", "error", err)
+			}
+		}()
+	}
+	if e.api != nil {
+		logger.Info("Serving API", "address", e.api.Addr())
+		go func() {
+			if err := serveAPI(ctx, e.api, srv, apiToken); err != nil {
+				logger.Error("Failed to serve API", "error", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,25 @@
+//go:build (!darwin || cgo) && !freebsd && !openbsd
+
+package main
+
+import "github.com/kotaira/go-serial/enumerator"
+
+// detailedPorts returns serial ports with USB details, enumerated via IOKit on macOS, sysfs on
+// Linux and SetupAPI on Windows.
+func detailedPorts() ([]portDetails, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, err
+	}
+	details := make([]portDetails, 0, len(ports))
+	for _, port := range ports {
+		details = append(details, portDetails{
+			Name:         port.Name,
+			VID:          port.VID,
+			PID:          port.PID,
+			SerialNumber: port.SerialNumber,
+			Product:      port.Product,
+		})
+	}
+	return details, nil
+}
@@ -0,0 +1,29 @@
+//go:build freebsd || openbsd
+
+package main
+
+import (
+	"os"
+	"regexp"
+)
+
+// Call-out devices, which unlike tty* devices do not wait for carrier detect: cuau0 (FreeBSD
+// UART), cuaU0 (USB) and cua00 (OpenBSD UART). The .init and .lock devices hold settings, and are
+// not ports.
+var bsdPortPattern = regexp.MustCompile(`^cua[uU]?[0-9]+$`)
+
+// detailedPorts returns the call-out serial devices at /dev, without USB details, which go-serial
+// does not enumerate on BSD.
+func detailedPorts() ([]portDetails, error) {
+	entries, err := os.ReadDir(devDir)
+	if err != nil {
+		return nil, err
+	}
+	var ports []portDetails
+	for _, entry := range entries {
+		if bsdPortPattern.MatchString(entry.Name()) {
+			ports = append(ports, portDetails{Name: devDir + entry.Name()})
+		}
+	}
+	return ports, nil
+}
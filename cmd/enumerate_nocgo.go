@@ -0,0 +1,10 @@
+//go:build darwin && !cgo
+
+package main
+
+import "errors"
+
+// detailedPorts fails, as IOKit enumeration on macOS requires cgo.
+func detailedPorts() ([]portDetails, error) {
+	return nil, errors.New("USB details require cgo on macOS")
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EscapeAction is run by an escape sequence in client connect.
+type EscapeAction int
+
+const (
+	escapeNone EscapeAction = iota
+	// Close the connection and exit.
+	EscapeDisconnect
+	// Send a break to the serial port.
+	EscapeBreak
+	// Toggle serial port DTR.
+	EscapeDTR
+	// Toggle serial port RTS.
+	EscapeRTS
+	// Toggle logging of received output to the session log.
+	EscapeLog
+	// Pick another port.
+	EscapeSwitch
+	// Print the escape sequences.
+	EscapeHelp
+)
+
+var escapeActionNames = map[EscapeAction]string{
+	EscapeDisconnect: "disconnect",
+	EscapeBreak:      "break",
+	EscapeDTR:        "dtr",
+	EscapeRTS:        "rts",
+	EscapeLog:        "log",
+	EscapeSwitch:     "switch",
+	EscapeHelp:       "help",
+}
+
+var escapeActionDescriptions = map[EscapeAction]string{
+	EscapeDisconnect: "disconnect",
+	EscapeBreak:      "send break",
+	EscapeDTR:        "toggle DTR",
+	EscapeRTS:        "toggle RTS",
+	EscapeLog:        "toggle session log",
+	EscapeSwitch:     "pick another port",
+	EscapeHelp:       "help",
+}
+
+// Default escape bindings, keys are matched case insensitively.
+var escapeBindingsDefault = map[byte]EscapeAction{
+	'.': EscapeDisconnect,
+	'B': EscapeBreak,
+	'D': EscapeDTR,
+	'R': EscapeRTS,
+	'L': EscapeLog,
+	'P': EscapeSwitch,
+	'?': EscapeHelp,
+}
+
+// parseEscapeChar parses an escape character: a single character, caret notation for control
+// characters (eg: ^]) or none.
+func parseEscapeChar(s string) (byte, bool, error) {
+	switch {
+	case strings.EqualFold(s, "none"):
+		return 0, false, nil
+	case len(s) == 1:
+		return s[0], true, nil
+	case len(s) == 2 && s[0] == '^' && s[1] >= '@' && s[1] <= '_':
+		return s[1] - '@', true, nil
+	case len(s) == 2 && s[0] == '^' && s[1] >= 'a' && s[1] <= 'z':
+		return s[1] - 'a' + 1, true, nil
+	}
+	return 0, false, fmt.Errorf("invalid escape character, expected a single character, ^X or none: %s", s)
+}
+
+// parseEscapeBindings returns the default bindings overridden by bindings given as KEY=ACTION.
+func parseEscapeBindings(values []string) (map[byte]EscapeAction, error) {
+	bindings := map[byte]EscapeAction{}
+	for key, action := range escapeBindingsDefault {
+		bindings[key] = action
+	}
+	for _, value := range values {
+		key, name, ok := strings.Cut(value, "=")
+		if !ok || len(key) != 1 {
+			return nil, fmt.Errorf("invalid escape binding, expected KEY=ACTION: %s", value)
+		}
+		action := escapeNone
+		for a, n := range escapeActionNames {
+			if strings.EqualFold(name, n) {
+				action = a
+			}
+		}
+		if action == escapeNone && !strings.EqualFold(name, "none") {
+			return nil, fmt.Errorf("invalid escape binding action: %s", name)
+		}
+		// Rebinding an action moves it.
+		for k, a := range bindings {
+			if a == action || unicode.ToUpper(rune(k)) == unicode.ToUpper(rune(key[0])) {
+				delete(bindings, k)
+			}
+		}
+		if action != escapeNone {
+			bindings[key[0]] = action
+		}
+	}
+	return bindings, nil
+}
+
+// escaper recognizes escape sequences typed by the user: the escape character followed by a
+// bound key. Printable escape characters, such as ~, are only recognized at the start of a line,
+// like ssh does, while control characters, such as ^], are recognized anywhere, like telnet does.
+type escaper struct {
+	char     byte
+	enabled  bool
+	bindings map[byte]EscapeAction
+
+	atLineStart bool
+	pending     bool
+}
+
+func newEscaper(char byte, enabled bool, bindings map[byte]EscapeAction) *escaper {
+	return &escaper{char: char, enabled: enabled, bindings: bindings, atLineStart: true}
+}
+
+func (e *escaper) lookup(key byte) EscapeAction {
+	if action, ok := e.bindings[key]; ok {
+		return action
+	}
+	for k, action := range e.bindings {
+		if unicode.ToUpper(rune(k)) == unicode.ToUpper(rune(key)) {
+			return action
+		}
+	}
+	return escapeNone
+}
+
+// feed processes a typed character, returning the data to send, and the escape action to run, if
+// any. Typing the escape character twice sends it.
+func (e *escaper) feed(c byte) ([]byte, EscapeAction) {
+	if !e.enabled {
+		return []byte{c}, escapeNone
+	}
+	if e.pending {
+		e.pending = false
+		if c == e.char {
+			return []byte{c}, escapeNone
+		}
+		if action := e.lookup(c); action != escapeNone {
+			return nil, action
+		}
+		e.atLineStart = c == '\r' || c == '\n'
+		return []byte{e.char, c}, escapeNone
+	}
+	if c == e.char && (e.atLineStart || e.char < ' ') {
+		e.pending = true
+		return nil, escapeNone
+	}
+	e.atLineStart = c == '\r' || c == '\n'
+	return []byte{c}, escapeNone
+}
+
+// escapeCharString returns the escape character in caret notation if it is a control character.
+func escapeCharString(c byte) string {
+	if c < ' ' {
+		return "^" + string(rune(c+'@'))
+	}
+	return string(rune(c))
+}
+
+// help returns the escape sequences, with terminal line endings.
+func (e *escaper) help() string {
+	if !e.enabled {
+		return ""
+	}
+	keys := make([]int, 0, len(e.bindings))
+	for key := range e.bindings {
+		keys = append(keys, int(key))
+	}
+	sort.Ints(keys)
+	var b strings.Builder
+	char := escapeCharString(e.char)
+	b.WriteString("\r\n[serialtcp] Escape sequences")
+	if e.char >= ' ' {
+		b.WriteString(", at the start of a line")
+	}
+	b.WriteString(":\r\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "  %s%s  %s\r\n", char, string(rune(key)), escapeActionDescriptions[e.bindings[byte(key)]])
+	}
+	fmt.Fprintf(&b, "  %s%s  send %s\r\n", char, char, strconv.Quote(char))
+	return b.String()
+}
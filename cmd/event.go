@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var hookScript string
+var hookScriptDefault = ""
+
+var onConnect string
+var onConnectDefault = ""
+
+var onDisconnect string
+var onDisconnectDefault = ""
+
+// EventType is the type of session lifecycle events.
+type EventType int
+
+const (
+	// A client connected, and was authenticated.
+	EventConnect EventType = iota
+	// A client disconnected.
+	EventDisconnect
+	// The serial port was opened, or the exec command started, for a session.
+	EventPortOpen
+	// The serial port was closed, or the exec command ended, for a session.
+	EventPortClose
+	// A session failed, including failing to open the serial port.
+	EventError
+)
+
+var eventTypeNames = map[EventType]string{
+	EventConnect:    "connect",
+	EventDisconnect: "disconnect",
+	EventPortOpen:   "port-open",
+	EventPortClose:  "port-close",
+	EventError:      "error",
+}
+
+func (t EventType) String() string {
+	return eventTypeNames[t]
+}
+
+// Event is a session lifecycle event.
+type Event struct {
+	Type    EventType
+	Time    time.Time
+	Session ConnectionInfo
+	// Session statistics, for EventPortClose and EventDisconnect once the session started.
+	Stats *SessionInfo
+	// Error, for EventError.
+	Err error
+}
+
+// Environ returns e as environment variables, in the form "key=value", including the session ones.
+func (e Event) Environ() []string {
+	env := append(e.Session.Environ(),
+		"SERIALTCP_EVENT="+e.Type.String(),
+		"SERIALTCP_EVENT_TIME="+e.Time.Format(time.RFC3339),
+	)
+	if e.Stats != nil {
+		env = append(env,
+			fmt.Sprintf("SERIALTCP_BYTES_TO_CLIENT=%d", e.Stats.BytesToClient),
+			fmt.Sprintf("SERIALTCP_BYTES_TO_PORT=%d", e.Stats.BytesToPort),
+			fmt.Sprintf("SERIALTCP_BYTES_DROPPED=%d", e.Stats.BytesDropped),
+			fmt.Sprintf("SERIALTCP_DURATION=%d", int64(e.Time.Sub(e.Stats.Start).Seconds())),
+		)
+	}
+	if e.Err != nil {
+		env = append(env, "SERIALTCP_ERROR="+e.Err.Error())
+	}
+	return env
+}
+
+// EventHandler is called with each event. It is called from session routines, so it must not
+// block.
+type EventHandler func(ctx context.Context, event Event)
+
+// WithEventHandler calls handler on session lifecycle events.
+func WithEventHandler(handler EventHandler) ServerOption {
+	return func(s *server) { s.Subscribe(handler) }
+}
+
+// Subscribe calls handler on session lifecycle events, from now on.
+func (s *server) Subscribe(handler EventHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eventHandlers = append(s.eventHandlers, handler)
+}
+
+// emit calls the event handlers with event, timestamping it.
+func (s *server) emit(ctx context.Context, event Event) {
+	s.mu.Lock()
+	handlers := s.eventHandlers
+	s.mu.Unlock()
+	event.Time = time.Now()
+	for _, handler := range handlers {
+		handler(ctx, event)
+	}
+}
+
+// emitSession emits an event of eventType for sess, with its statistics, if it started.
+func (s *server) emitSession(ctx context.Context, eventType EventType, info ConnectionInfo, sess *session) {
+	event := Event{Type: eventType, Session: info}
+	if sess != nil {
+		stats := sess.info()
+		event.Stats = &stats
+	}
+	s.emit(ctx, event)
+}
+
+// endSessionEvents emits the events of sess ending with err.
+func (s *server) endSessionEvents(ctx context.Context, info ConnectionInfo, sess *session, err error) {
+	if err != nil {
+		s.emit(ctx, Event{Type: EventError, Session: info, Err: err})
+	}
+	s.emitSession(ctx, EventDisconnect, info, sess)
+}
+
+// Events queued for the hook script at most, beyond which they are dropped.
+const hookScriptQueueSize = 64
+
+// hookScriptHandler returns an EventHandler running command with the system shell on events of
+// types, or on all events if none, with SERIALTCP_* environment variables describing the event,
+// see serve --hook-script. So that hooks do not stall sessions, they run in the background, one at
+// a time, in the order of events.
+func hookScriptHandler(ctx context.Context, command string, types ...EventType) EventHandler {
+	type queued struct {
+		ctx   context.Context
+		event Event
+	}
+	queue := make(chan queued, hookScriptQueueSize)
+	go func() {
+		for {
+			select {
+			case q := <-queue:
+				logger := log.MustLogger(q.ctx)
+				logger.Debug("Running hook script", "event", q.event.Type.String())
+				if err := shellCommand(command, q.event.Environ()).Run(); err != nil {
+					logger.Error("Failed to run hook script", "event", q.event.Type.String(), "error", fmt.Errorf("failed to run: %s: %w", command, err))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func(ctx context.Context, event Event) {
+		if len(types) > 0 && !slices.Contains(types, event.Type) {
+			return
+		}
+		select {
+		case queue <- queued{ctx: ctx, event: event}:
+		default:
+			log.MustLogger(ctx).Warn("Hook script queue full, dropping event", "event", event.Type.String())
+		}
+	}
+}
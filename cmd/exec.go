@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+var errExecUnsupported = errors.New("not supported by the exec backend")
+
+// execPort is a serialport.Port backed by a subprocess: reads come from its stdout and writes go
+// to its stdin. Mode changes are accepted and ignored, as there is no serial line, and modem
+// control lines are not supported.
+type execPort struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// shellCommand returns a command running command with the system shell, with env added to its
+// environment.
+func shellCommand(command string, env []string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// startExec starts command with the system shell, with env added to its environment.
+func startExec(command string, env []string) (*execPort, error) {
+	cmd := shellCommand(command, env)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &execPort{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (p *execPort) SetMode(mode *serial.Mode) error { return nil }
+
+func (p *execPort) Read(b []byte) (int, error) {
+	n, err := p.stdout.Read(b)
+	if errors.Is(err, os.ErrClosed) {
+		// Closed by Close.
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (p *execPort) Write(b []byte) (int, error) { return p.stdin.Write(b) }
+
+func (p *execPort) Drain() error { return nil }
+
+func (p *execPort) ResetInputBuffer() error { return nil }
+
+func (p *execPort) ResetOutputBuffer() error { return nil }
+
+func (p *execPort) SetDTR(dtr bool) error { return errExecUnsupported }
+
+func (p *execPort) SetRTS(rts bool) error { return errExecUnsupported }
+
+func (p *execPort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return &serial.ModemStatusBits{}, nil
+}
+
+func (p *execPort) SetReadTimeout(t time.Duration) error { return errExecUnsupported }
+
+func (p *execPort) Break(time.Duration) error { return errExecUnsupported }
+
+// CloseWrite closes the standard input of the subprocess, which it reads as EOF.
+func (p *execPort) CloseWrite() error {
+	return p.stdin.Close()
+}
+
+// Close terminates the subprocess.
+func (p *execPort) Close() error {
+	p.closeOnce.Do(func() {
+		// Already closed by CloseWrite, with --half-close.
+		if err := p.stdin.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			p.closeErr = err
+		}
+		if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			p.closeErr = errors.Join(p.closeErr, err)
+		}
+		var exitErr *exec.ExitError
+		if err := p.cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+			p.closeErr = errors.Join(p.closeErr, err)
+		}
+	})
+	return p.closeErr
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/mux"
+)
+
+var clientPort string
+var clientPortDefault = ""
+
+var clientForwards []string
+var clientForwardsDefault = []string{}
+
+// openMux asks the server on conn, serving --named-port, or the relay on conn, after sending it the
+// token, if given, to multiplex ports over it. On failure, conn is closed.
+func openMux(conn net.Conn) (*mux.Session, error) {
+	if clientToken != "" {
+		if _, err := fmt.Fprintf(conn, "%s\n", clientToken); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to send token: %w", err), conn.Close())
+		}
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", muxRequest); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to send multiplexing request: %w", err), conn.Close())
+	}
+	return mux.Client(conn), nil
+}
+
+// muxStreamConn is a stream over a multiplexed connection of its own, closed along with it.
+type muxStreamConn struct {
+	*mux.Stream
+	session *mux.Session
+}
+
+func (c *muxStreamConn) Close() error {
+	err := c.Stream.Close()
+	if closeErr := c.session.Close(); !errors.Is(closeErr, net.ErrClosed) {
+		err = errors.Join(err, closeErr)
+	}
+	return err
+}
+
+// dialNamedPort opens a stream to the named port name over conn. On failure, conn is closed.
+func dialNamedPort(conn net.Conn, name string) (net.Conn, error) {
+	session, err := openMux(conn)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := session.Open(name)
+	if err != nil {
+		return nil, errors.Join(err, session.Close())
+	}
+	return &muxStreamConn{Stream: stream, session: session}, nil
+}
+
+// muxDialer opens streams to named ports over a single multiplexed connection to the server,
+// connecting again once it is lost.
+type muxDialer struct {
+	mu      sync.Mutex
+	session *mux.Session
+}
+
+// connect returns the multiplexed connection, connecting if needed.
+func (d *muxDialer) connect() (*mux.Session, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.session != nil {
+		select {
+		case <-d.session.Done():
+		default:
+			return d.session, nil
+		}
+	}
+	conn, err := transportDial(clientAddress)
+	if err != nil {
+		return nil, err
+	}
+	d.session, err = openMux(conn)
+	return d.session, err
+}
+
+// open opens a stream to the named port name, negotiating compression with --compress.
+func (d *muxDialer) open(name string) (net.Conn, error) {
+	session, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := session.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return clientHandshake(stream, "")
+}
+
+// Close closes the multiplexed connection, if any.
+func (d *muxDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.session == nil {
+		return nil
+	}
+	if err := d.session.Close(); !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// forward listens on address, relaying each connection to the named port name with dialer, until
+// ctx is done.
+func forward(ctx context.Context, address, name string, dialer *muxDialer) error {
+	ctx, logger := log.MustWithAttrs(ctx, "forward", address, "named-port", name)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = listener.Close() })
+	defer stop()
+
+	logger.Info("Listening", "local-address", listener.Addr())
+	dial := func() (net.Conn, error) { return dialer.open(name) }
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept: %w", err)
+		}
+		go relayConn(ctx, local, dial)
+	}
+}
+
+// runClientForward listens on each --forward address, relaying its connections to its named port,
+// all over the same connection to the server, until interrupted.
+func runClientForward(cmd *cobra.Command, args []string) (err error) {
+	ctx, logger := log.MustWithAttrs(cmd.Context(), "address", clientAddress)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dialer := &muxDialer{}
+	defer func() { err = errors.Join(err, dialer.Close()) }()
+
+	names := map[string]string{}
+	for _, value := range clientForwards {
+		address, name, ok := strings.Cut(value, "=")
+		if !ok || address == "" || name == "" {
+			return fmt.Errorf("invalid forward, expected ADDRESS=NAME: %q", value)
+		}
+		names[address] = name
+	}
+	errCh := make(chan error, len(names))
+	for address, name := range names {
+		go func() { errCh <- forward(ctx, address, name, dialer) }()
+	}
+	// One failing stops the others.
+	for range names {
+		if forwardErr := <-errCh; forwardErr != nil {
+			err = errors.Join(err, forwardErr)
+			cancel()
+		}
+	}
+	logger.Info("Stopped")
+	return err
+}
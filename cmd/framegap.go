@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var frameGap time.Duration
+var frameGapDefault = time.Duration(0)
+
+var frameMaxSize int
+var frameMaxSizeDefault = 256
+
+// frameGapReader reads frames from a serial port: data received until the line stays quiet for a
+// gap, as frames of Modbus RTU and similar protocols are delimited, or until a maximum size. Each
+// Read returns data of a single frame, so that it is sent to clients in one write.
+type frameGapReader struct {
+	port    serialport.Port
+	gap     time.Duration
+	maxSize int
+	// Frame being received.
+	buf []byte
+	// Whether the read timeout is set to gap, which it is only while receiving a frame, so that
+	// reads block while the line is idle.
+	timed bool
+	// Received frame not read yet.
+	frame []byte
+	// Error to return once frame is read.
+	err error
+}
+
+// newFrameGapReader returns port split in frames by gap, up to maxSize, or port itself if gap is 0.
+func newFrameGapReader(port serialport.Port, gap time.Duration, maxSize int) io.Reader {
+	if gap == 0 {
+		return port
+	}
+	return &frameGapReader{port: port, gap: gap, maxSize: maxSize}
+}
+
+// setTimed sets the port read timeout to gap if timed, or no timeout otherwise.
+func (r *frameGapReader) setTimed(timed bool) error {
+	if timed == r.timed {
+		return nil
+	}
+	timeout := serial.NoTimeout
+	if timed {
+		timeout = r.gap
+	}
+	if err := r.port.SetReadTimeout(timeout); err != nil {
+		return fmt.Errorf("failed to set read timeout for frame gap: %w", err)
+	}
+	r.timed = timed
+	return nil
+}
+
+// receive reads until a frame is complete or reading fails.
+func (r *frameGapReader) receive() {
+	chunk := make([]byte, r.maxSize)
+	for {
+		if err := r.setTimed(len(r.buf) > 0); err != nil {
+			r.err = err
+			return
+		}
+		n, err := r.port.Read(chunk[:r.maxSize-len(r.buf)])
+		r.buf = append(r.buf, chunk[:n]...)
+		if err != nil {
+			r.frame, r.buf, r.err = r.buf, nil, err
+			return
+		}
+		// A read returning nothing timed out: the gap elapsed.
+		if (n == 0 && len(r.buf) > 0) || len(r.buf) >= r.maxSize {
+			r.frame, r.buf = r.buf, nil
+			return
+		}
+	}
+}
+
+func (r *frameGapReader) Read(p []byte) (int, error) {
+	if len(r.frame) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.receive()
+	}
+	n := copy(p, r.frame)
+	r.frame = r.frame[n:]
+	if len(r.frame) == 0 && r.err != nil {
+		return n, r.err
+	}
+	return n, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Framing is how serial output is split into messages, such as MQTT messages or UDP datagrams.
+type Framing int
+
+const (
+	// Each chunk read from the serial port is a message.
+	FramingRaw Framing = iota
+	// Each line is a message, without its line ending.
+	FramingLine
+)
+
+var framingNames = map[Framing]string{
+	FramingRaw:  "raw",
+	FramingLine: "line",
+}
+
+// FramingValue implements pflag.Value for Framing
+type FramingValue Framing
+
+func (f *FramingValue) String() string {
+	return framingNames[Framing(*f)]
+}
+
+func (f *FramingValue) Set(s string) error {
+	for framing, name := range framingNames {
+		if strings.EqualFold(s, name) {
+			*f = FramingValue(framing)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid framing: %s", s)
+}
+
+func (f *FramingValue) Type() string {
+	return "framing"
+}
+
+// readMessages calls fn with each message read from r until it fails, split as framing, with
+// messages longer than maxLength split. Messages passed to fn are not reused.
+func readMessages(r io.Reader, framing Framing, maxLength int, fn func(message []byte)) error {
+	if framing == FramingRaw {
+		buf := make([]byte, maxLength)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				fn(append([]byte(nil), buf[:n]...))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, min(4096, maxLength)), maxLength)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if advance == 0 && token == nil && len(data) >= maxLength {
+			return len(data), data, nil
+		}
+		return advance, token, err
+	})
+	for scanner.Scan() {
+		fn(append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -0,0 +1,321 @@
+//go:build grpc && !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/fornellas/serialtcp/grpcapi"
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// Largest serial port output sent in a single Open response.
+const grpcChunkSize = 32 << 10
+
+// grpcConn is a net.Conn over the stream of an Open call.
+type grpcConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *grpcConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+// grpcListener serves the gRPC API of --grpc-address, as a net.Listener accepting the sessions of
+// Open calls, each bridged to the serial port as a connection. Other calls act on srv, as the
+// control socket does.
+type grpcListener struct {
+	grpcapi.UnimplementedSerialPortServer
+	ctx      context.Context
+	srv      *server
+	hub      *sseHub
+	token    string
+	listener net.Listener
+	server   *grpc.Server
+	conns    chan net.Conn
+	done     chan struct{}
+}
+
+// readGRPCToken reads the token gRPC calls authenticate with from --grpc-token-file.
+func readGRPCToken() (string, error) {
+	data, err := os.ReadFile(grpcTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read gRPC token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty gRPC token in %s", grpcTokenFile)
+	}
+	return token, nil
+}
+
+// listenGRPC serves the gRPC API of srv at address, authenticated by token, with Read following
+// the serial port output of hub.
+func listenGRPC(ctx context.Context, address string, srv *server, hub *sseHub, token string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %s: %w", address, err)
+	}
+	l := &grpcListener{
+		ctx:      ctx,
+		srv:      srv,
+		hub:      hub,
+		token:    token,
+		listener: listener,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	l.server = grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := l.authenticate(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := l.authenticate(stream.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	grpcapi.RegisterSerialPortServer(l.server, l)
+	go l.run()
+	return l, nil
+}
+
+func (l *grpcListener) run() {
+	defer close(l.done)
+	if err := l.server.Serve(l.listener); err != nil {
+		log.MustLogger(l.ctx).Error("Failed to serve gRPC", "error", err)
+	}
+}
+
+// peerAddr returns the address of the caller of ctx.
+func peerAddr(ctx context.Context) net.Addr {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr
+	}
+	return &net.TCPAddr{}
+}
+
+// authenticate verifies calls carry the token as bearer token, logging them.
+func (l *grpcListener) authenticate(ctx context.Context, method string) error {
+	logger := log.MustLogger(l.ctx)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		given, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(given), []byte(l.token)) == 1 {
+			logger.Info("gRPC call", "method", method, "remote-address", peerAddr(ctx))
+			return nil
+		}
+	}
+	logger.Warn("Unauthorized gRPC call", "method", method, "remote-address", peerAddr(ctx))
+	return status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+func (l *grpcListener) Open(stream grpcapi.SerialPort_OpenServer) error {
+	ctx := stream.Context()
+	local, remote := net.Pipe()
+	defer local.Close()
+	select {
+	case l.conns <- &grpcConn{Conn: remote, remoteAddr: peerAddr(ctx)}:
+	case <-l.done:
+		remote.Close()
+		return status.Error(codes.Unavailable, "server stopped")
+	case <-ctx.Done():
+		remote.Close()
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	go func() {
+		// The session ends with the client stream.
+		defer local.Close()
+		for {
+			request, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if _, err := local.Write(request.Data); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, grpcChunkSize)
+	for {
+		n, err := local.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&grpcapi.OpenResponse{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (l *grpcListener) Read(request *grpcapi.ReadRequest, stream grpcapi.SerialPort_ReadServer) error {
+	ctx := stream.Context()
+	subscriber := l.hub.subscribe()
+	defer func() {
+		if dropped := l.hub.unsubscribe(subscriber); dropped > 0 {
+			log.MustLogger(l.ctx).Warn("gRPC reader missed lines", "dropped", dropped, "remote-address", peerAddr(ctx))
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case data := <-subscriber.events:
+			var event sseEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			response := &grpcapi.ReadResponse{Line: []byte(event.Line), Time: timestamppb.New(event.Time)}
+			if err := stream.Send(response); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcResult returns the outcome of acting on the serial port, which fails while it is not open,
+// or with invalid settings.
+func grpcResult[T any](response T, err error) (T, error) {
+	if err != nil {
+		var zero T
+		return zero, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return response, nil
+}
+
+func (l *grpcListener) Write(ctx context.Context, request *grpcapi.WriteRequest) (*grpcapi.WriteResponse, error) {
+	return grpcResult(&grpcapi.WriteResponse{}, l.srv.withPorts(func(port serialport.Port) error {
+		_, err := port.Write(request.Data)
+		return err
+	}))
+}
+
+func (l *grpcListener) SetMode(ctx context.Context, request *grpcapi.SetModeRequest) (*grpcapi.SetModeResponse, error) {
+	return grpcResult(&grpcapi.SetModeResponse{}, setControlMode(l.srv, ControlRequest{
+		Command:  controlMode,
+		BaudRate: int(request.BaudRate),
+		DataBits: int(request.DataBits),
+		Parity:   request.Parity,
+		StopBits: request.StopBits,
+	}))
+}
+
+func (l *grpcListener) SendBreak(ctx context.Context, request *grpcapi.SendBreakRequest) (*grpcapi.SendBreakResponse, error) {
+	duration := ctlBreakDurationDefault
+	if request.Duration != nil {
+		if err := request.Duration.CheckValid(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid duration: %s", err)
+		}
+		duration = request.Duration.AsDuration()
+	}
+	if err := checkBreakDuration(duration); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return grpcResult(&grpcapi.SendBreakResponse{}, l.srv.Break(duration))
+}
+
+func (l *grpcListener) Status(request *grpcapi.StatusRequest, stream grpcapi.SerialPort_StatusServer) error {
+	var interval time.Duration
+	if request.Interval != nil {
+		interval = request.Interval.AsDuration()
+		if err := request.Interval.CheckValid(); err != nil || interval <= 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid interval: %s", request.Interval)
+		}
+	}
+	for {
+		if err := stream.Send(grpcStatus(l.srv)); err != nil {
+			return err
+		}
+		if interval == 0 {
+			return nil
+		}
+		if err := sleep(stream.Context(), interval); err != nil {
+			return nil
+		}
+	}
+}
+
+// grpcTimestamp returns t, or nil if it is zero.
+func grpcTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// grpcStatus returns the status of srv, as the control socket status command does.
+func grpcStatus(srv *server) *grpcapi.StatusResponse {
+	stats := srv.Stats()
+	response := &grpcapi.StatusResponse{
+		Start:          grpcTimestamp(stats.Start),
+		ActiveSessions: uint32(stats.ActiveSessions),
+		TotalSessions:  stats.TotalSessions,
+		BytesToClient:  stats.BytesToClient,
+		BytesToPort:    stats.BytesToPort,
+		BytesDropped:   stats.BytesDropped,
+		Errors:         stats.Errors,
+		Draining:       stats.Draining,
+	}
+	for _, port := range srv.Ports() {
+		response.Ports = append(response.Ports, &grpcapi.Port{
+			Name:         port.Name,
+			BaudRate:     uint32(port.BaudRate),
+			DataBits:     uint32(port.DataBits),
+			Parity:       port.Parity,
+			StopBits:     port.StopBits,
+			Identity:     port.Identity,
+			IdentifiedAt: grpcTimestamp(port.IdentifiedAt),
+		})
+	}
+	for _, session := range srv.Sessions() {
+		response.Sessions = append(response.Sessions, &grpcapi.Session{
+			Id:            session.ID,
+			RemoteAddr:    session.RemoteAddr,
+			Start:         grpcTimestamp(session.Start),
+			BytesToClient: session.BytesToClient,
+			BytesToPort:   session.BytesToPort,
+			BytesDropped:  session.BytesDropped,
+			Errors:        session.Errors,
+		})
+	}
+	return response
+}
+
+func (l *grpcListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the server, ending calls in progress.
+func (l *grpcListener) Close() error {
+	l.server.Stop()
+	return nil
+}
+
+func (l *grpcListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
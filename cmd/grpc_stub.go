@@ -0,0 +1,19 @@
+//go:build !grpc || minimal
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var errGRPCUnavailable = errors.New("gRPC is only available in builds with the grpc tag, and without the minimal tag")
+
+func readGRPCToken() (string, error) {
+	return "", errGRPCUnavailable
+}
+
+func listenGRPC(ctx context.Context, address string, srv *server, hub *sseHub, token string) (net.Listener, error) {
+	return nil, errGRPCUnavailable
+}
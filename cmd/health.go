@@ -0,0 +1,54 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// writeHealth answers a health check with err.
+func writeHealth(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "%s\n", err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveHealth serves health checks of srv on listener, until ctx is done: /healthz, failing while
+// the serial port can not be opened, for restarting broken instances, and /readyz, failing until
+// clients are accepted and while draining, for routing clients around them.
+func serveHealth(ctx context.Context, listener net.Listener, srv *server) error {
+	logger := log.MustLogger(ctx)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		err := srv.portHealth(log.WithLogger(r.Context(), logger))
+		if err != nil {
+			logger.Debug("Unhealthy", "error", err)
+		}
+		writeHealth(w, err)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, srv.readiness())
+	})
+	httpServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
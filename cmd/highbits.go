@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+	"sync"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/pipeline"
+)
+
+// HighBitsMode is how bits beyond the serial port data bits are handled.
+type HighBitsMode int
+
+const (
+	// Bytes pass unchanged, leaving it to the driver.
+	HighBitsPass HighBitsMode = iota
+	// Bits beyond the data bits are cleared, in both directions.
+	HighBitsStrip
+	// Sent bytes with bits beyond the data bits are dropped, and received ones stripped.
+	HighBitsDrop
+	// 7 data bits with even parity are emulated over 8 data bits without parity: the high bit of
+	// sent bytes is set to their parity, and stripped from received bytes.
+	HighBitsEvenParity
+	// As HighBitsEvenParity, with odd parity.
+	HighBitsOddParity
+)
+
+var highBitsModeNames = map[HighBitsMode]string{
+	HighBitsPass:       "pass",
+	HighBitsStrip:      "strip",
+	HighBitsDrop:       "drop",
+	HighBitsEvenParity: "even-parity",
+	HighBitsOddParity:  "odd-parity",
+}
+
+// HighBitsModeValue implements pflag.Value for HighBitsMode
+type HighBitsModeValue HighBitsMode
+
+func (m *HighBitsModeValue) String() string {
+	return highBitsModeNames[HighBitsMode(*m)]
+}
+
+func (m *HighBitsModeValue) Set(s string) error {
+	for mode, name := range highBitsModeNames {
+		if strings.EqualFold(s, name) {
+			*m = HighBitsModeValue(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid high bits mode: %s", s)
+}
+
+func (m *HighBitsModeValue) Type() string {
+	return "mode"
+}
+
+var highBits = HighBitsModeValue(HighBitsPass)
+
+// emulatesParity returns whether m emulates 7 data bits with parity.
+func (m HighBitsMode) emulatesParity() bool {
+	return m == HighBitsEvenParity || m == HighBitsOddParity
+}
+
+// check returns an error if m does not apply to mode.
+func (m HighBitsMode) check(mode serial.Mode) error {
+	switch {
+	case m.emulatesParity() && (mode.DataBits != 8 || mode.Parity != serial.NoParity):
+		return fmt.Errorf("--high-bits %s requires 8 data bits without parity", highBitsModeNames[m])
+	case (m == HighBitsStrip || m == HighBitsDrop) && mode.DataBits == 8:
+		return fmt.Errorf("--high-bits %s requires less than 8 data bits", highBitsModeNames[m])
+	}
+	return nil
+}
+
+// highBitsWriter handles the bits beyond dataBits of data written to it, by mode.
+type highBitsWriter struct {
+	io.Writer
+	ctx      context.Context
+	mode     HighBitsMode
+	toPort   bool
+	mask     byte
+	warnOnce sync.Once
+}
+
+// parityBit returns the high bit setting the parity of the 7 low bits of b by mode.
+func (w *highBitsWriter) parityBit(b byte) byte {
+	odd := bits.OnesCount8(b&0x7f)%2 == 1
+	if odd == (w.mode == HighBitsEvenParity) {
+		return 0x80
+	}
+	return 0
+}
+
+func (w *highBitsWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p))
+	dropped := 0
+	for _, b := range p {
+		switch {
+		case !w.toPort:
+			b &= w.mask
+		case w.mode.emulatesParity():
+			b = b&w.mask | w.parityBit(b)
+		case w.mode == HighBitsDrop && b&^w.mask != 0:
+			dropped++
+			continue
+		default:
+			b &= w.mask
+		}
+		out = append(out, b)
+	}
+	if dropped > 0 {
+		w.warnOnce.Do(func() {
+			logger := log.MustLogger(w.ctx)
+			logger.Warn("Dropping bytes beyond the serial port data bits, further ones are dropped silently", "dropped", dropped)
+		})
+	}
+	if _, err := w.Writer.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// highBitsMiddleware returns middleware handling bits beyond dataBits by mode, for data sent to the
+// serial port if toPort, or to clients otherwise.
+func highBitsMiddleware(ctx context.Context, mode HighBitsMode, dataBits int, toPort bool) pipeline.Middleware {
+	return func(next io.Writer) io.Writer {
+		if mode == HighBitsPass {
+			return next
+		}
+		mask := byte(1<<dataBits - 1)
+		if mode.emulatesParity() {
+			mask = 0x7f
+		}
+		return &highBitsWriter{Writer: next, ctx: ctx, mode: mode, toPort: toPort, mask: mask}
+	}
+}
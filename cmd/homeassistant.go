@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/fornellas/slogxt/log"
+
+	"github.com/fornellas/serialtcp/mdns"
+)
+
+// Service type Home Assistant's Zigbee Home Automation integration discovers network attached
+// Zigbee coordinators by, connecting to them at socket://host:port.
+const zigbeeCoordinatorService = "_zigbee-coordinator._tcp"
+
+// ZigbeeRadioType is the Zigbee radio type of the served adapter, as named by Home Assistant.
+type ZigbeeRadioType int
+
+const (
+	// Not a Zigbee coordinator.
+	ZigbeeRadioNone ZigbeeRadioType = iota
+	// Silicon Labs EmberZNet, such as the Sonoff ZBDongle-E or SkyConnect.
+	ZigbeeRadioEZSP
+	// Texas Instruments Z-Stack, such as the Sonoff ZBDongle-P.
+	ZigbeeRadioZNP
+	// dresden elektronik deCONZ, such as the ConBee.
+	ZigbeeRadioDeconz
+	// ZiGate.
+	ZigbeeRadioZigate
+	// Digi XBee.
+	ZigbeeRadioXBee
+)
+
+var zigbeeRadioTypeNames = map[ZigbeeRadioType]string{
+	ZigbeeRadioNone:   "none",
+	ZigbeeRadioEZSP:   "ezsp",
+	ZigbeeRadioZNP:    "znp",
+	ZigbeeRadioDeconz: "deconz",
+	ZigbeeRadioZigate: "zigate",
+	ZigbeeRadioXBee:   "xbee",
+}
+
+// ZigbeeRadioTypeValue implements pflag.Value for ZigbeeRadioType
+type ZigbeeRadioTypeValue ZigbeeRadioType
+
+func (t *ZigbeeRadioTypeValue) String() string {
+	return zigbeeRadioTypeNames[ZigbeeRadioType(*t)]
+}
+
+func (t *ZigbeeRadioTypeValue) Set(s string) error {
+	for radioType, name := range zigbeeRadioTypeNames {
+		if strings.EqualFold(s, name) {
+			*t = ZigbeeRadioTypeValue(radioType)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid Zigbee radio type: %s", s)
+}
+
+func (t *ZigbeeRadioTypeValue) Type() string {
+	return "type"
+}
+
+var zigbeeRadioType = ZigbeeRadioTypeValue(ZigbeeRadioNone)
+
+// advertiseZigbee advertises the server of name as a Zigbee coordinator, for Home Assistant to
+// discover, via DNS-SD over multicast DNS until ctx is done.
+func advertiseZigbee(ctx context.Context, listener net.Listener, name string) error {
+	logger := log.MustLogger(ctx)
+	service, err := localService(listener, name)
+	if err != nil {
+		return err
+	}
+	service.Service = zigbeeCoordinatorService
+	service.Text = []string{
+		"radio_type=" + zigbeeRadioType.String(),
+		"name=" + service.Instance,
+	}
+	logger.Info("Advertising Zigbee coordinator via multicast DNS", "instance", service.Instance, "radio-type", zigbeeRadioType.String())
+	return mdns.Advertise(ctx, service)
+}
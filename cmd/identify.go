@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// Minimum time between identifications, so that clients reconnecting in a loop do not probe the
+// device on every session.
+const identifyInterval = time.Minute
+
+// IdentifyConfig is how devices are identified, see serve --identify.
+type IdentifyConfig struct {
+	// Sent to the device.
+	Probe []byte
+	// Maximum length of the identity banner.
+	Bytes int
+	// How long to wait for the identity banner.
+	Timeout time.Duration
+}
+
+// identifyFlags returns the IdentifyConfig set by the --identify flags, or nil without --identify.
+// The probe is verified either way.
+func identifyFlags() (*IdentifyConfig, error) {
+	probe, err := strconv.Unquote(`"` + identifyProbe + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid probe: %#v: %w", identifyProbe, err)
+	}
+	if !identifyEnabled {
+		return nil, nil
+	}
+	return &IdentifyConfig{Probe: []byte(probe), Bytes: identifyBytes, Timeout: identifyTimeout}, nil
+}
+
+// identify sends the identification probe of config to port, and returns the first bytes of the
+// response as the device identity banner.
+func identify(port serialport.Port, config *IdentifyConfig) (identity string, err error) {
+	if err := port.SetReadTimeout(100 * time.Millisecond); err != nil {
+		return "", err
+	}
+	defer func() {
+		if timeoutErr := port.SetReadTimeout(serial.NoTimeout); timeoutErr != nil && err == nil {
+			err = timeoutErr
+		}
+	}()
+	if err := port.ResetInputBuffer(); err != nil {
+		return "", err
+	}
+	if _, err := port.Write(config.Probe); err != nil {
+		return "", fmt.Errorf("failed to send probe: %w", err)
+	}
+
+	banner := make([]byte, config.Bytes)
+	n := 0
+	deadline := time.Now().Add(config.Timeout)
+	for n < len(banner) && time.Now().Before(deadline) {
+		read, err := port.Read(banner[n:])
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
+		n += read
+	}
+	return string(banner[:n]), nil
+}
+
+// identifyDue tells whether the device is to be identified, at most once per identifyInterval,
+// recording the attempt.
+func (s *server) identifyDue() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.identifyAttemptAt.IsZero() && time.Since(s.identifyAttemptAt) < identifyInterval {
+		return false
+	}
+	s.identifyAttemptAt = time.Now()
+	return true
+}
+
+// identifyPort identifies the device on port, just opened for a session, when configured to and
+// an identification is due, recording it with SetIdentity.
+func (s *server) identifyPort(ctx context.Context, port serialport.Port) {
+	if s.config.Identify == nil || s.config.runsCommand() || !s.identifyDue() {
+		return
+	}
+	logger := log.MustLogger(ctx)
+	identity, err := identify(port, s.config.Identify)
+	if err != nil {
+		logger.Error("Failed to identify device", "error", err)
+		return
+	}
+	logger.Info("Identified device", "identity", strconv.Quote(identity))
+	s.SetIdentity(identity)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/ser2net"
+)
+
+var ImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import configuration from other tools.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cmd.Help(); err != nil {
+			logger := log.MustLogger(cmd.Context())
+			logger.Error("Failed to display help", "err", err)
+		}
+		Exit(1)
+	},
+}
+
+// shellSafe matches words which need no quoting in POSIX shells.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ser2netSetting is a serve flag, by name without the leading --, and its value, with boolean
+// flags set to true.
+type ser2netSetting struct {
+	name, value string
+}
+
+// ser2netSettings returns the serve flags equivalent to the serial port settings of connection,
+// which are all but its device and address, and comments on what could not be mapped.
+func ser2netSettings(connection ser2net.Connection) ([]ser2netSetting, []string) {
+	var settings []ser2netSetting
+	if connection.BaudRate != 0 {
+		settings = append(settings, ser2netSetting{"baud-rate", strconv.Itoa(connection.BaudRate)})
+	}
+	if connection.DataBits != 0 {
+		settings = append(settings, ser2netSetting{"data-bits", strconv.Itoa(connection.DataBits)})
+	}
+	if connection.Parity != "" {
+		parity := connection.Parity
+		if parity == "none" {
+			parity = "no"
+		}
+		settings = append(settings, ser2netSetting{"parity", parity})
+	}
+	if connection.StopBits != "" {
+		settings = append(settings, ser2netSetting{"stop-bits", connection.StopBits})
+	}
+
+	var comments []string
+	if connection.Telnet {
+		settings = append(settings, ser2netSetting{"rfc2217", "true"})
+		if !connection.RFC2217 {
+			comments = append(comments, "Telnet is served with RFC 2217 serial port control, which Telnet clients not supporting it ignore")
+		}
+	}
+	if connection.Banner != "" {
+		banner, unsupported := connection.ExpandBanner()
+		quoted := strconv.Quote(banner)
+		settings = append(settings, ser2netSetting{"banner", quoted[1 : len(quoted)-1]})
+		for _, escape := range unsupported {
+			comments = append(comments, "unsupported: banner escape, removed: "+escape)
+		}
+	}
+	for _, unsupported := range connection.Unsupported {
+		comments = append(comments, "unsupported: "+unsupported)
+	}
+	return settings, comments
+}
+
+// ser2netServeArgs returns serve arguments equivalent to connection, and comments on what could
+// not be mapped.
+func ser2netServeArgs(connection ser2net.Connection) ([]string, []string) {
+	args := []string{"serve", "--port-name", connection.Device, "--address", connection.Address}
+	settings, comments := ser2netSettings(connection)
+	for _, setting := range settings {
+		if setting.value == "true" {
+			args = append(args, "--"+setting.name)
+			continue
+		}
+		args = append(args, "--"+setting.name, setting.value)
+	}
+	return args, comments
+}
+
+// commentEscaper escapes line endings in text written into shell script comments, which would
+// otherwise end the comment, leaving the rest to be run.
+var commentEscaper = strings.NewReplacer("\r", `\r`, "\n", `\n`)
+
+// writeSer2netScript writes a shell script running a server for each connection.
+func writeSer2netScript(w io.Writer, source string, connections []ser2net.Connection) error {
+	fmt.Fprintf(w, "#!/bin/sh\n# Imported from ser2net configuration %s by serialtcp import ser2net.\n", commentEscaper.Replace(source))
+	for _, connection := range connections {
+		args, comments := ser2netServeArgs(connection)
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+
+		fmt.Fprintf(w, "\n# %s\n", commentEscaper.Replace(connection.Name))
+		for _, comment := range comments {
+			fmt.Fprintf(w, "# %s\n", commentEscaper.Replace(comment))
+		}
+		prefix := ""
+		if !connection.Enabled {
+			fmt.Fprintln(w, "# disabled")
+			prefix = "# "
+		}
+		fmt.Fprintf(w, "%sserialtcp %s &\n", prefix, strings.Join(quoted, " "))
+	}
+	_, err := fmt.Fprintln(w, "\nwait")
+	return err
+}
+
+// importSer2net reads the ser2net configuration at path and writes an equivalent script to w.
+func importSer2net(ctx context.Context, w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	connections, err := ser2net.Parse(path, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	logger := log.MustLogger(ctx)
+	logger.Info("Imported", "connections", len(connections))
+	return writeSer2netScript(w, path, connections)
+}
+
+var ImportSer2netCmd = &cobra.Command{
+	Use:   "ser2net FILE",
+	Short: "Import a ser2net configuration.",
+	Long:  "Reads a ser2net configuration, either ser2net.yaml (ser2net 4) or ser2net.conf (earlier versions), and prints a shell script running an equivalent server for each port. Settings which can not be mapped are left as comments in the script.",
+	Args:  cobra.ExactArgs(1),
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		return importSer2net(cmd.Context(), cmd.OutOrStdout(), args[0])
+	}),
+}
+
+// ser2netPortName turns the name of a ser2net connection into a --named-port name, which can not
+// contain spaces or =.
+var ser2netPortName = strings.NewReplacer(" ", "-", "\t", "-", "\r", "-", "\n", "-", "=", "-")
+
+// writeSer2netConfig writes a serve --config file serving the enabled connections as named ports
+// from the address of the first one. Named ports share their serial port settings, so connections
+// with settings other than the first one's are left as comments, with the command serving them
+// separately.
+func writeSer2netConfig(w io.Writer, source string, connections []ser2net.Connection) error {
+	fmt.Fprintf(w, "# Migrated from ser2net configuration %s by serialtcp migrate.\n", commentEscaper.Replace(source))
+	var first *ser2net.Connection
+	for i := range connections {
+		if connections[i].Enabled {
+			first = &connections[i]
+			break
+		}
+	}
+	if first == nil {
+		_, err := fmt.Fprintln(w, "# no enabled connections")
+		return err
+	}
+	settings, _ := ser2netSettings(*first)
+	fmt.Fprintf(w, "# Clients pick ports with OPEN NAME as their first line, by connecting to\n# ws://%s/NAME, or with client --port NAME.\n", commentEscaper.Replace(first.Address))
+	fmt.Fprintf(w, "address = %s\n", first.Address)
+	for _, setting := range settings {
+		fmt.Fprintf(w, "%s = %s\n", setting.name, setting.value)
+	}
+
+	names := map[string]bool{}
+	for _, connection := range connections {
+		name := ser2netPortName.Replace(connection.Name)
+		connectionSettings, comments := ser2netSettings(connection)
+		fmt.Fprintf(w, "\n# %s\n", commentEscaper.Replace(connection.Name))
+		if connection.Address != first.Address {
+			fmt.Fprintf(w, "# was served at %s\n", commentEscaper.Replace(connection.Address))
+		}
+		for _, comment := range comments {
+			fmt.Fprintf(w, "# %s\n", commentEscaper.Replace(comment))
+		}
+		prefix := ""
+		switch {
+		case !connection.Enabled:
+			fmt.Fprintln(w, "# disabled")
+			prefix = "# "
+		case names[name]:
+			fmt.Fprintf(w, "# duplicate name: %s\n", commentEscaper.Replace(name))
+			prefix = "# "
+		case !slices.Equal(connectionSettings, settings):
+			args, _ := ser2netServeArgs(connection)
+			quoted := make([]string, len(args))
+			for i, arg := range args {
+				quoted[i] = shellQuote(arg)
+			}
+			fmt.Fprintf(w, "# serial port settings differ from the ones above, serve it separately with:\n# serialtcp %s\n", commentEscaper.Replace(strings.Join(quoted, " ")))
+			prefix = "# "
+		}
+		names[name] = true
+		fmt.Fprintf(w, "%snamed-port = %s=%s\n", prefix, name, connection.Device)
+	}
+	return nil
+}
+
+// migrateSer2net reads the ser2net configuration at path and writes an equivalent serve --config
+// file to w.
+func migrateSer2net(ctx context.Context, w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	connections, err := ser2net.Parse(path, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	logger := log.MustLogger(ctx)
+	logger.Info("Migrated", "connections", len(connections))
+	return writeSer2netConfig(w, path, connections)
+}
+
+var migrateFromSer2net string
+var migrateFromSer2netDefault = ""
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate from other tools.",
+	Long:  "Converts the configuration of other tools into a serve --config file, serving every port by name from a single listener (--named-port), with settings which can not be mapped left as comments. Ports with serial port settings differing from the first one's are left as comments too, as named ports share them. To keep serving each port at its own address instead, use import.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		return migrateSer2net(cmd.Context(), cmd.OutOrStdout(), migrateFromSer2net)
+	}),
+}
+
+func init() {
+	ImportCmd.AddCommand(ImportSer2netCmd)
+
+	RootCmd.AddCommand(ImportCmd)
+
+	MigrateCmd.PersistentFlags().StringVarP(&migrateFromSer2net, "from-ser2net", "", migrateFromSer2netDefault, "ser2net configuration to migrate: ser2net.yaml (ser2net 4) or ser2net.conf (earlier versions)")
+	if err := MigrateCmd.MarkPersistentFlagRequired("from-ser2net"); err != nil {
+		panic(err)
+	}
+	RootCmd.AddCommand(MigrateCmd)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+)
+
+// Socket of the journald native protocol.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// newJournaldHandler returns a slog.Handler sending records to journald, with the native protocol,
+// with facility and tag, and their level mapped to a priority.
+func newJournaldHandler(facility SyslogFacility, tag string, addSource bool) (slog.Handler, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return newSeverityHandler(addSource, func(level slog.Level, message []byte) error {
+		var buf bytes.Buffer
+		appendJournaldField(&buf, "MESSAGE", message)
+		appendJournaldField(&buf, "PRIORITY", []byte(strconv.Itoa(syslogSeverity(level))))
+		appendJournaldField(&buf, "SYSLOG_FACILITY", []byte(strconv.Itoa(int(facility))))
+		appendJournaldField(&buf, "SYSLOG_IDENTIFIER", []byte(tag))
+		_, err := conn.Write(buf.Bytes())
+		return err
+	}), nil
+}
+
+// appendJournaldField appends a field in the journald native protocol to buf, in the binary form
+// when value spans lines.
+func appendJournaldField(buf *bytes.Buffer, key string, value []byte) {
+	buf.WriteString(key)
+	if !bytes.ContainsRune(value, '\n') {
+		buf.WriteByte('=')
+		buf.Write(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(value))))
+	buf.Write(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Defaults match what Go uses for accepted connections.
+var tcpKeepAlive time.Duration
+var tcpKeepAliveDefault = 15 * time.Second
+
+var tcpKeepAliveInterval time.Duration
+var tcpKeepAliveIntervalDefault = 15 * time.Second
+
+var tcpKeepAliveCount int
+var tcpKeepAliveCountDefault = 9
+
+// checkKeepAlive verifies the TCP keepalive flags.
+func checkKeepAlive() error {
+	if tcpKeepAlive < 0 {
+		return fmt.Errorf("invalid TCP keepalive idle time: %s", tcpKeepAlive)
+	}
+	if tcpKeepAliveInterval <= 0 {
+		return fmt.Errorf("invalid TCP keepalive interval: %s", tcpKeepAliveInterval)
+	}
+	if tcpKeepAliveCount < 1 {
+		return fmt.Errorf("invalid TCP keepalive count: %d", tcpKeepAliveCount)
+	}
+	return nil
+}
+
+// keepAliveConfig returns the TCP keepalive set by the flags.
+func keepAliveConfig() net.KeepAliveConfig {
+	return net.KeepAliveConfig{
+		Enable:   tcpKeepAlive > 0,
+		Idle:     tcpKeepAlive,
+		Interval: tcpKeepAliveInterval,
+		Count:    tcpKeepAliveCount,
+	}
+}
+
+// setKeepAlive configures TCP keepalives on conn as config, if it is a TCP connection, so that the
+// connections of crashed clients, or lost behind NAT, are ended, releasing the serial port.
+func setKeepAlive(conn net.Conn, config net.KeepAliveConfig) error {
+	tcpConn, ok := baseConn(conn).(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	return tcpConn.SetKeepAliveConfig(config)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+	"github.com/spf13/cobra"
+)
+
+// Directory port names given to serve --port-name are relative to, outside Windows.
+const devDir = "/dev/"
+
+// portDetails describes a serial port, with USB details when available.
+type portDetails struct {
+	Name         string
+	VID          string
+	PID          string
+	SerialNumber string
+	Product      string
+}
+
+// listPorts returns the serial ports on the system, with USB details when available.
+func listPorts() ([]portDetails, error) {
+	if ports, err := detailedPorts(); err == nil {
+		return ports, nil
+	}
+	names, err := serial.GetPortsList()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]portDetails, 0, len(names))
+	for _, name := range names {
+		ports = append(ports, portDetails{Name: name})
+	}
+	return ports, nil
+}
+
+var ListPortsCmd = &cobra.Command{
+	Use:   "list-ports",
+	Short: "List serial ports.",
+	Long:  "Lists serial ports on this system, with USB details when available, by the name to give to serve --port-name.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		ports, err := listPorts()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVID\tPID\tSERIAL NUMBER\tPRODUCT")
+		for _, port := range ports {
+			name := port.Name
+			if runtime.GOOS != "windows" {
+				name = strings.TrimPrefix(name, devDir)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, port.VID, port.PID, port.SerialNumber, port.Product)
+		}
+		return w.Flush()
+	}),
+}
+
+// warnPortName warns about port names which are known to misbehave.
+func warnPortName(cmd *cobra.Command) {
+	if runtime.GOOS == "darwin" && strings.HasPrefix(portName, "tty.") {
+		logger := log.MustLogger(cmd.Context())
+		logger.Warn("macOS tty.* devices block opening until carrier detect is asserted, prefer the matching cu.* device", "suggestion", "cu."+strings.TrimPrefix(portName, "tty."))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(ListPortsCmd)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kotaira/go-serial"
+)
+
+var exclusive bool
+var exclusiveDefault = false
+
+// openError returns err from opening the serial port name, explaining it when the port is busy.
+func openError(name string, err error) error {
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) && portErr.Code() == serial.PortBusy {
+		return fmt.Errorf("failed to open: %s: port is busy, it is opened exclusively by another program: %w", name, err)
+	}
+	return fmt.Errorf("failed to open: %s: %w", name, err)
+}
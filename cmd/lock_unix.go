@@ -0,0 +1,106 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var lockDir string
+var lockDirDefault = "/var/lock"
+
+// portLock is a UUCP style lockfile, which serial programs such as minicom, picocom and cu honor,
+// owned by this process.
+type portLock struct {
+	path string
+}
+
+// lockPath returns the lockfile path for the serial port name. Symlinks, such as
+// /dev/serial/by-id/*, are resolved, so that all names of a device share the same lockfile.
+func lockPath(name string) string {
+	if resolved, err := filepath.EvalSymlinks(name); err == nil {
+		name = resolved
+	}
+	return filepath.Join(lockDir, "LCK.."+filepath.Base(name))
+}
+
+// lockOwner returns the PID in the lockfile at path, and whether that process is still running.
+func lockOwner(path string) (int, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		// Binary lockfiles from ancient UUCP, or garbage: either way, not ours to judge.
+		return 0, true, nil
+	}
+	if err := unix.Kill(pid, 0); errors.Is(err, unix.ESRCH) {
+		return pid, false, nil
+	}
+	return pid, true, nil
+}
+
+// lockPort creates the lockfile for the serial port name, failing if another running process owns
+// it. Stale lockfiles, from processes no longer running, are removed.
+func lockPort(name string) (*portLock, error) {
+	path := lockPath(name)
+	// The lockfile is written to a temporary file first, and then hard linked, which fails if it
+	// exists, so that others never see it empty.
+	tmp, err := os.CreateTemp(lockDir, ".LCK.")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lockfile: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = fmt.Fprintf(tmp, "%10d\n", os.Getpid())
+	if err = errors.Join(err, tmp.Close()); err != nil {
+		return nil, fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	for {
+		err := os.Link(tmp.Name(), path)
+		if err == nil {
+			return &portLock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lockfile: %w", err)
+		}
+		pid, running, err := lockOwner(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read lockfile: %w", err)
+		}
+		if running {
+			if pid == 0 {
+				return nil, fmt.Errorf("%s is locked: %s", name, path)
+			}
+			return nil, fmt.Errorf("%s is locked by process %d: %s", name, pid, path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lockfile: %w", err)
+		}
+	}
+}
+
+// Unlock removes the lockfile, unless some other process took it over.
+func (l *portLock) Unlock() error {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err != nil || pid != os.Getpid() {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to remove lockfile: %w", err)
+	}
+	return nil
+}
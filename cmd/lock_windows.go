@@ -0,0 +1,15 @@
+package main
+
+var lockDir string
+var lockDirDefault = ""
+
+// portLock does nothing, as Windows opens serial ports exclusively.
+type portLock struct{}
+
+func lockPort(name string) (*portLock, error) {
+	return &portLock{}, nil
+}
+
+func (l *portLock) Unlock() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	slogxtCobra "github.com/fornellas/slogxt/cobra"
+	"github.com/spf13/cobra"
+)
+
+// Log level set with --log-level.
+var configuredLogLevel slog.Level
+
+// Effective log level, which can be changed at runtime with setDebug.
+var logLevel slog.LevelVar
+
+// levelHandler is a slog.Handler which drops records below a level that can change at runtime.
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// getLogger returns a logger configured by the logger flags, whose level is controlled by
+// logLevel. Records are written to --log-output and, with --log-file, also to it as JSON.
+func getLogger(cmd *cobra.Command) (*slog.Logger, error) {
+	flags := cmd.Flags()
+	configuredLogLevel = flags.Lookup("log-level").Value.(*slogxtCobra.LogLevelValue).Level()
+	logLevel.Set(configuredLogLevel)
+
+	addSource, err := flags.GetBool("log-handler-add-source")
+	if err != nil {
+		panic(err)
+	}
+	terminalTime, err := flags.GetBool("log-handler-terminal-time")
+	if err != nil {
+		panic(err)
+	}
+	terminalForceColor, err := flags.GetBool("log-handler-terminal-force-color")
+	if err != nil {
+		panic(err)
+	}
+	handler := flags.Lookup("log-handler").Value.(*slogxtCobra.LogHandlerValue).GetHandler(
+		cmd.OutOrStderr(),
+		slogxtCobra.LogHandlerValueOptions{
+			Level:              slog.LevelDebug,
+			AddSource:          addSource,
+			TerminalTime:       terminalTime,
+			TerminalForceColor: terminalForceColor,
+		},
+	)
+	switch LogOutput(logOutput) {
+	case LogOutputSyslog:
+		handler, err = newSyslogHandler(logSyslogAddress, SyslogFacility(logSyslogFacility), logSyslogTag, addSource)
+	case LogOutputJournald:
+		handler, err = newJournaldHandler(SyslogFacility(logSyslogFacility), logSyslogTag, addSource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if logFile != "" {
+		file, err := openRotatingFile(logFile, logFileMaxSize, logFileMaxAge, logFileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		handler = multiHandler{
+			handler,
+			slog.NewJSONHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: addSource}),
+		}
+	}
+	return slog.New(&levelHandler{Handler: handler, level: &logLevel}), nil
+}
+
+// setDebug switches between debug logging and the configured log level.
+func setDebug(enable bool) {
+	if enable {
+		logLevel.Set(slog.LevelDebug)
+	} else {
+		logLevel.Set(configuredLogLevel)
+	}
+}
+
+// traceWriter logs data written to it at debug level.
+type traceWriter struct {
+	ctx       context.Context
+	logger    *slog.Logger
+	direction string
+}
+
+func (w *traceWriter) Write(p []byte) (int, error) {
+	if w.logger.Enabled(w.ctx, slog.LevelDebug) {
+		w.logger.Debug("Data", "direction", w.direction, "data", strconv.Quote(string(p)))
+	}
+	return len(p), nil
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// toggleDebugOnSignal toggles debug logging on every SIGUSR2, until ctx is done.
+func toggleDebugOnSignal(ctx context.Context) {
+	logger := log.MustLogger(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			enable := logLevel.Level() > slog.LevelDebug
+			setDebug(enable)
+			logger.Warn("Debug logging toggled", "enabled", enable)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+import "context"
+
+// toggleDebugOnSignal does nothing, as there is no SIGUSR2 on Windows: use ctl debug instead.
+func toggleDebugOnSignal(ctx context.Context) {}
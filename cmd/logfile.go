@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logFile string
+var logFileDefault = ""
+
+var logFileMaxSize int64
+var logFileMaxSizeDefault int64 = 100 << 20
+
+var logFileMaxAge time.Duration
+var logFileMaxAgeDefault = 24 * time.Hour
+
+var logFileMaxBackups int
+var logFileMaxBackupsDefault = 10
+
+// Layout of the timestamp suffixed to rotated log files, which sorts chronologically.
+const logFileBackupTimeLayout = "20060102T150405.000Z"
+
+// rotatingFile is an io.Writer to a file which is rotated once it grows past maxSize or gets
+// older than maxAge, keeping at most maxBackups rotated files.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// openRotatingFile opens path for appending, see rotatingFile. Zero maxSize, maxAge or maxBackups
+// disable the respective limit.
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open log file: %w", err), file.Close())
+	}
+	f.file = file
+	f.size = info.Size()
+	// The creation time is not portably available, the age counts from when it was opened.
+	f.openedAt = time.Now()
+	return nil
+}
+
+// backups returns rotated files, oldest first.
+func (f *rotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, f.path+".")
+		if _, err := time.Parse(logFileBackupTimeLayout, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// rotate renames the current file to a backup, opens a new one and removes excess backups.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	backup := f.path + "." + time.Now().UTC().Format(logFileBackupTimeLayout)
+	if err := os.Rename(f.path, backup); err != nil {
+		return errors.Join(fmt.Errorf("failed to rotate log file: %w", err), f.open())
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if f.maxBackups == 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return fmt.Errorf("failed to list rotated log files: %w", err)
+	}
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("failed to remove rotated log file: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 &&
+		((f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize) ||
+			(f.maxAge > 0 && time.Since(f.openedAt) > f.maxAge)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// multiHandler is a slog.Handler which sends records to all of its handlers.
+type multiHandler []slog.Handler
+
+func (h multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var err error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			err = errors.Join(err, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return err
+}
+
+func (h multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
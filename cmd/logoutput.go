@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// LogOutput is where logs are written to.
+type LogOutput int
+
+const (
+	LogOutputStderr LogOutput = iota
+	LogOutputSyslog
+	LogOutputJournald
+)
+
+var logOutputNames = map[LogOutput]string{
+	LogOutputStderr:   "stderr",
+	LogOutputSyslog:   "syslog",
+	LogOutputJournald: "journald",
+}
+
+// LogOutputValue implements pflag.Value for LogOutput
+type LogOutputValue LogOutput
+
+func (o *LogOutputValue) String() string {
+	return logOutputNames[LogOutput(*o)]
+}
+
+func (o *LogOutputValue) Set(s string) error {
+	for output, name := range logOutputNames {
+		if strings.EqualFold(s, name) {
+			*o = LogOutputValue(output)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid log output: %s", s)
+}
+
+func (o *LogOutputValue) Type() string {
+	return "output"
+}
+
+var logOutput = LogOutputValue(LogOutputStderr)
+
+// SyslogFacility is a syslog facility.
+type SyslogFacility int
+
+var syslogFacilityNames = map[SyslogFacility]string{
+	0:  "kern",
+	1:  "user",
+	2:  "mail",
+	3:  "daemon",
+	4:  "auth",
+	5:  "syslog",
+	6:  "lpr",
+	7:  "news",
+	8:  "uucp",
+	9:  "cron",
+	10: "authpriv",
+	11: "ftp",
+	16: "local0",
+	17: "local1",
+	18: "local2",
+	19: "local3",
+	20: "local4",
+	21: "local5",
+	22: "local6",
+	23: "local7",
+}
+
+// SyslogFacilityValue implements pflag.Value for SyslogFacility
+type SyslogFacilityValue SyslogFacility
+
+func (f *SyslogFacilityValue) String() string {
+	return syslogFacilityNames[SyslogFacility(*f)]
+}
+
+func (f *SyslogFacilityValue) Set(s string) error {
+	for facility, name := range syslogFacilityNames {
+		if strings.EqualFold(s, name) {
+			*f = SyslogFacilityValue(facility)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid syslog facility: %s", s)
+}
+
+func (f *SyslogFacilityValue) Type() string {
+	return "facility"
+}
+
+// daemon
+var logSyslogFacility = SyslogFacilityValue(3)
+
+var logSyslogTag string
+var logSyslogTagDefault = "serialtcp"
+
+var logSyslogAddress string
+var logSyslogAddressDefault = "local"
+
+// syslogSeverity maps level to a syslog severity.
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		// err
+		return 3
+	case level >= slog.LevelWarn:
+		// warning
+		return 4
+	case level >= slog.LevelInfo:
+		// info
+		return 6
+	default:
+		// debug
+		return 7
+	}
+}
+
+// parseSyslogAddress parses a syslog address: local, or udp://host:port, tcp://host:port or
+// unix:///path, returning the network and address, empty for local.
+func parseSyslogAddress(address string) (string, string, error) {
+	if address == "local" {
+		return "", "", nil
+	}
+	network, addr, ok := strings.Cut(address, "://")
+	if !ok || addr == "" {
+		return "", "", fmt.Errorf("invalid syslog address: %s", address)
+	}
+	switch network {
+	case "udp", "tcp", "unix", "unixgram":
+		return network, addr, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog network: %s", network)
+	}
+}
+
+// severitySink receives the attributes of log records formatted as text, sending them after the
+// record message, with the record level.
+type severitySink struct {
+	mu      sync.Mutex
+	level   slog.Level
+	message string
+	send    func(level slog.Level, message []byte) error
+}
+
+func (s *severitySink) Write(p []byte) (int, error) {
+	message := []byte(s.message)
+	if attrs := bytes.TrimSuffix(p, []byte("\n")); len(attrs) > 0 {
+		message = append(append(message, ' '), attrs...)
+	}
+	if err := s.send(s.level, message); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// severityHandler is a slog.Handler formatting records as their message followed by their
+// attributes as text, without time and level, for sinks recording them along with their own, such
+// as syslog and journald.
+type severityHandler struct {
+	slog.Handler
+	sink *severitySink
+}
+
+// newSeverityHandler returns a severityHandler sending records to send.
+func newSeverityHandler(addSource bool, send func(level slog.Level, message []byte) error) *severityHandler {
+	sink := &severitySink{send: send}
+	return &severityHandler{
+		Handler: slog.NewTextHandler(sink, &slog.HandlerOptions{
+			Level:     slog.LevelDebug,
+			AddSource: addSource,
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				if len(groups) == 0 && (attr.Key == slog.TimeKey || attr.Key == slog.LevelKey || attr.Key == slog.MessageKey) {
+					return slog.Attr{}
+				}
+				return attr
+			},
+		}),
+		sink: sink,
+	}
+}
+
+func (h *severityHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+	h.sink.level = record.Level
+	h.sink.message = record.Message
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *severityHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &severityHandler{Handler: h.Handler.WithAttrs(attrs), sink: h.sink}
+}
+
+func (h *severityHandler) WithGroup(name string) slog.Handler {
+	return &severityHandler{Handler: h.Handler.WithGroup(name), sink: h.sink}
+}
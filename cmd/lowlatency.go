@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var lowLatency bool
+var lowLatencyDefault = false
+
+// Latency timer, in milliseconds, set on FTDI adapters with --low-latency. Their default, 16ms,
+// delays every read of less than a full USB packet.
+const ftdiLowLatencyTimer = 1
+
+// applyLowLatency disables internal buffering with --low-latency, unless its size was set
+// explicitly.
+func applyLowLatency(cmd *cobra.Command) {
+	if !lowLatency {
+		return
+	}
+	flags := cmd.Flags()
+	if !flags.Changed("write-queue-size") {
+		writeQueueSize = 0
+	}
+	if !flags.Changed("client-buffer-size") {
+		clientBufferSize = 0
+	}
+}
+
+// tuneLowLatency sets the serial port low latency settings with --low-latency. As these are not
+// available for all drivers, failures are only logged.
+func tuneLowLatency(ctx context.Context, config *ServerConfig, port serialport.Port) {
+	if !config.LowLatency || config.runsCommand() {
+		return
+	}
+	if err := setLowLatency(port, config.PortName); err != nil {
+		log.MustLogger(ctx).Warn("Failed to set low latency mode", "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// serialStruct is struct serial_struct from linux/serial.h.
+type serialStruct struct {
+	typ           int32
+	line          int32
+	port          uint32
+	irq           int32
+	flags         int32
+	xmitFifoSize  int32
+	customDivisor int32
+	baudBase      int32
+	closeDelay    uint16
+	ioType        int8
+	reservedChar  int8
+	hub6          int32
+	closingWait   uint16
+	closingWait2  uint16
+	iomemBase     uintptr
+	iomemRegShift uint16
+	portHigh      uint32
+	iomapBase     uintptr
+}
+
+// ASYNC_LOW_LATENCY from linux/tty_flags.h.
+const asyncLowLatency = 1 << 13
+
+// setLowLatency sets the ASYNC_LOW_LATENCY flag of port, and, for FTDI adapters, the latency timer
+// of the serial port name.
+func setLowLatency(port serialport.Port, name string) error {
+	descriptor, ok := port.(serialport.Descriptor)
+	if !ok {
+		return nil
+	}
+
+	var serial serialStruct
+	if _, _, errno := unix.Syscall(
+		unix.SYS_IOCTL, descriptor.Fd(), unix.TIOCGSERIAL, uintptr(unsafe.Pointer(&serial)),
+	); errno != 0 {
+		return fmt.Errorf("failed to get serial port flags: %w", errno)
+	}
+	if serial.flags&asyncLowLatency == 0 {
+		serial.flags |= asyncLowLatency
+		if _, _, errno := unix.Syscall(
+			unix.SYS_IOCTL, descriptor.Fd(), unix.TIOCSSERIAL, uintptr(unsafe.Pointer(&serial)),
+		); errno != 0 {
+			return fmt.Errorf("failed to set low latency flag: %w", errno)
+		}
+	}
+
+	if resolved, err := filepath.EvalSymlinks(name); err == nil {
+		name = resolved
+	}
+	path := filepath.Join("/sys/class/tty", filepath.Base(name), "device", "latency_timer")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(ftdiLowLatencyTimer)), 0); err != nil {
+		// Only FTDI adapters have a latency timer.
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to set latency timer: %w", err)
+	}
+	return nil
+}
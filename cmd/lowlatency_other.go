@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+func setLowLatency(port serialport.Port, name string) error {
+	return errors.New("low latency mode is not supported on this platform")
+}
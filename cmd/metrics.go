@@ -0,0 +1,72 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// writeMetrics writes stats to w in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, stats Stats) error {
+	bw := bufio.NewWriter(w)
+	metric := func(name, kind, help string, samples ...any) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for i := 0; i < len(samples); i += 2 {
+			fmt.Fprintf(bw, "%s%s %v\n", name, samples[i], samples[i+1])
+		}
+	}
+	metric("serialtcp_sessions_active", "gauge", "Sessions in progress.", "", stats.ActiveSessions)
+	metric("serialtcp_sessions_total", "counter", "Sessions started.", "", stats.TotalSessions)
+	metric("serialtcp_bytes_total", "counter", "Bytes transferred.",
+		`{direction="to-client"}`, stats.BytesToClient,
+		`{direction="to-port"}`, stats.BytesToPort,
+	)
+	metric("serialtcp_bytes_dropped_total", "counter", "Bytes dropped by full client buffers or write timeouts.", "", stats.BytesDropped)
+	metric("serialtcp_errors_total", "counter", "Session errors.", "", stats.Errors)
+	if uart := stats.UART; uart != nil {
+		metric("serialtcp_uart_bytes_total", "counter", "Bytes counted by the serial port driver, since it was loaded.",
+			`{direction="rx"}`, uart.RX,
+			`{direction="tx"}`, uart.TX,
+		)
+		metric("serialtcp_uart_errors_total", "counter", "Errors counted by the serial port driver, since it was loaded: framing and parity errors point at the cabling or the baud rate, overruns at the host not keeping up.",
+			`{kind="frame"}`, uart.Frame,
+			`{kind="parity"}`, uart.Parity,
+			`{kind="overrun"}`, uart.Overrun,
+			`{kind="buffer-overrun"}`, uart.BufferOverrun,
+		)
+		metric("serialtcp_uart_breaks_total", "counter", "Breaks counted by the serial port driver, since it was loaded.", "", uart.Break)
+	}
+	return bw.Flush()
+}
+
+// serveMetrics serves the metrics of srv at /metrics on listener, until ctx is done.
+func serveMetrics(ctx context.Context, listener net.Listener, srv *server) error {
+	logger := log.MustLogger(ctx)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := writeMetrics(w, srv.Stats()); err != nil {
+			logger.Debug("Failed to write metrics", "error", err)
+		}
+	})
+	httpServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+var minimal bool
+var minimalDefault = minimalBuild
+
+// Soft memory limit of the Go runtime with --minimal.
+const minimalMemoryLimit = 4 << 20
+
+// Buffer sizes with --minimal.
+const minimalBufferSize = 16 << 10
+
+// applyMinimal applies --minimal, for resource constrained devices such as routers: subsystems
+// which are not needed to bridge the port are disabled, and buffers shrunk, unless set explicitly.
+func applyMinimal(cmd *cobra.Command) error {
+	if !minimal {
+		return nil
+	}
+	flags := cmd.Flags()
+	for _, name := range []string{
+		"capture-dir", "mdns", "identify",
+		"metrics-address", "pprof-address", "health-address", "sse-address", "api-address",
+		"grpc-address",
+	} {
+		if flags.Changed(name) {
+			return fmt.Errorf("--%s is not available with --minimal", name)
+		}
+	}
+	if !flags.Changed("write-queue-size") {
+		writeQueueSize = minimalBufferSize
+	}
+	if !flags.Changed("client-buffer-size") {
+		clientBufferSize = minimalBufferSize
+	}
+	if !flags.Changed("uart-stats-interval") {
+		uartStatsInterval = 0
+	}
+	debug.SetMemoryLimit(minimalMemoryLimit)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var modemStatusInterval time.Duration
+var modemStatusIntervalDefault = time.Duration(0)
+
+// ModemStatus is the state of the serial port modem status lines.
+type ModemStatus struct {
+	Time time.Time `json:"time"`
+	CTS  bool      `json:"cts"`
+	DSR  bool      `json:"dsr"`
+	RI   bool      `json:"ri"`
+	DCD  bool      `json:"dcd"`
+}
+
+func newModemStatus(bits *serial.ModemStatusBits) *ModemStatus {
+	return &ModemStatus{Time: time.Now(), CTS: bits.CTS, DSR: bits.DSR, RI: bits.RI, DCD: bits.DCD}
+}
+
+func (m *ModemStatus) bits() *serial.ModemStatusBits {
+	return &serial.ModemStatusBits{CTS: m.CTS, DSR: m.DSR, RI: m.RI, DCD: m.DCD}
+}
+
+// changed returns the names of the lines which differ from previous.
+func (m *ModemStatus) changed(previous *ModemStatus) []string {
+	var names []string
+	for _, line := range []struct {
+		name      string
+		now, then bool
+	}{
+		{"cts", m.CTS, previous.CTS},
+		{"dsr", m.DSR, previous.DSR},
+		{"ri", m.RI, previous.RI},
+		{"dcd", m.DCD, previous.DCD},
+	} {
+		if line.now != line.then {
+			names = append(names, line.name)
+		}
+	}
+	return names
+}
+
+// pollModemStatus periodically reads the modem status lines of the open serial port, until ctx is
+// done. Changes are logged, a dropped carrier (DCD) as a warning, as it often means the device
+// rebooted or the cable came loose, and RFC 2217 clients are notified of them.
+func pollModemStatus(ctx context.Context, srv *server, interval time.Duration) {
+	logger := log.MustLogger(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// Status of the currently open port, nil until read.
+	var previous *ModemStatus
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var bits *serial.ModemStatusBits
+		if err := srv.withPorts(func(port serialport.Port) error {
+			var err error
+			bits, err = port.GetModemStatusBits()
+			return err
+		}); err != nil {
+			previous = nil
+			continue
+		}
+		status := newModemStatus(bits)
+		attrs := []any{"cts", status.CTS, "dsr", status.DSR, "ri", status.RI, "dcd", status.DCD}
+		if previous == nil {
+			logger.Info("Modem status", attrs...)
+		} else if changed := status.changed(previous); len(changed) > 0 {
+			level := slog.LevelInfo
+			if previous.DCD && !status.DCD {
+				level = slog.LevelWarn
+			}
+			logger.Log(ctx, level, "Modem status changed", append(attrs, "changed", changed)...)
+		} else {
+			continue
+		}
+		var previousBits *serial.ModemStatusBits
+		if previous != nil {
+			previousBits = previous.bits()
+		}
+		srv.setModemStatus(status)
+		if err := srv.notifyModemStatus(status.bits(), previousBits); err != nil {
+			logger.Error("Failed to notify modem status", "error", err)
+		}
+		previous = status
+	}
+}
@@ -0,0 +1,270 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var mqttPortName string
+var mqttPortNameDefault = ""
+
+var mqttBaudRate int
+var mqttBaudRateDefault = 9600
+
+var mqttDataBits int
+var mqttDataBitsDefault = 8
+
+var mqttParity ParityValue
+
+var mqttStopBits StopBitsValue
+
+var mqttBroker string
+var mqttBrokerDefault = ""
+
+var mqttClientID string
+var mqttClientIDDefault = ""
+
+var mqttUsername string
+var mqttUsernameDefault = ""
+
+var mqttPasswordFile string
+var mqttPasswordFileDefault = ""
+
+var mqttPublishTopic string
+var mqttPublishTopicDefault = ""
+
+var mqttSubscribeTopic string
+var mqttSubscribeTopicDefault = ""
+
+var mqttQoS int
+var mqttQoSDefault = 0
+
+var mqttRetain bool
+var mqttRetainDefault = false
+
+var mqttFraming = FramingValue(FramingRaw)
+
+var mqttTLSCA string
+var mqttTLSCADefault = ""
+
+var mqttTLSCert string
+var mqttTLSCertDefault = ""
+
+var mqttTLSKey string
+var mqttTLSKeyDefault = ""
+
+var mqttTLSInsecure bool
+var mqttTLSInsecureDefault = false
+
+// Longest line published with --framing line; longer ones are split.
+const mqttMaxLine = 64 << 10
+
+// How long connecting to the broker may take, before retrying.
+const mqttConnectTimeout = 30 * time.Second
+
+// mqttTLSConfig returns the TLS configuration for ssl:// and wss:// brokers, verifying the broker
+// certificate against --tls-ca or the system roots, and authenticating with --tls-cert and
+// --tls-key, if given.
+func mqttTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: mqttTLSInsecure}
+	if mqttTLSCA != "" {
+		pem, err := os.ReadFile(mqttTLSCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", mqttTLSCA)
+		}
+	}
+	switch {
+	case mqttTLSCert != "" && mqttTLSKey != "":
+		certificate, err := tls.LoadX509KeyPair(mqttTLSCert, mqttTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	case mqttTLSCert != "" || mqttTLSKey != "":
+		return nil, errors.New("--tls-cert and --tls-key must be given together")
+	}
+	return config, nil
+}
+
+// mqttClientOptions returns the options to connect to the broker, which are retried forever, as
+// brokers may be restarted or unreachable for a while.
+func mqttClientOptions(ctx context.Context, port serialport.Port) (*mqtt.ClientOptions, error) {
+	logger := log.MustLogger(ctx)
+	options := mqtt.NewClientOptions().
+		AddBroker(mqttBroker).
+		SetClientID(mqttClientID).
+		SetUsername(mqttUsername).
+		SetConnectRetry(true).
+		SetConnectTimeout(mqttConnectTimeout).
+		SetAutoReconnect(true)
+	if mqttClientID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		options.SetClientID("serialtcp-" + hostname)
+	}
+	if mqttPasswordFile != "" {
+		password, err := os.ReadFile(mqttPasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		options.SetPassword(strings.TrimRight(string(password), "\r\n"))
+	}
+	tlsConfig, err := mqttTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	options.SetTLSConfig(tlsConfig)
+	options.SetOnConnectHandler(func(client mqtt.Client) {
+		logger.Info("Connected to MQTT broker")
+		if mqttSubscribeTopic == "" {
+			return
+		}
+		// Subscribing again on every connection, as brokers may not keep sessions.
+		token := client.Subscribe(mqttSubscribeTopic, byte(mqttQoS), func(_ mqtt.Client, message mqtt.Message) {
+			payload := message.Payload()
+			if Framing(mqttFraming) == FramingLine {
+				payload = append(payload, '\n')
+			}
+			if _, err := port.Write(payload); err != nil {
+				logger.Error("Failed to write to serial port", "error", err)
+			}
+		})
+		go func() {
+			if token.Wait(); token.Error() != nil {
+				logger.Error("Failed to subscribe", "topic", mqttSubscribeTopic, "error", token.Error())
+			}
+		}()
+	})
+	options.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		logger.Warn("Lost connection to MQTT broker, reconnecting", "error", err)
+	})
+	return options, nil
+}
+
+// mqttPublish publishes serial output read from port until it fails, as chunks or lines, as given
+// by --framing. Messages published while the broker is unreachable are dropped.
+func mqttPublish(ctx context.Context, client mqtt.Client, port io.Reader) error {
+	logger := log.MustLogger(ctx)
+	publish := func(payload []byte) {
+		if !client.IsConnectionOpen() {
+			logger.Debug("Not connected to MQTT broker, dropping message", "length", len(payload))
+			return
+		}
+		// Not waiting for the token, so slow brokers do not hold up reading the port.
+		client.Publish(mqttPublishTopic, byte(mqttQoS), mqttRetain, payload)
+	}
+	return readMessages(port, Framing(mqttFraming), mqttMaxLine, publish)
+}
+
+var MQTTCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Bridge a serial port to an MQTT broker.",
+	Long:  "Publishes serial port output to an MQTT topic, as raw chunks or as lines, and writes messages received on another topic to the serial port, for IoT backends which already aggregate devices through MQTT. The broker connection is retried forever, while the serial port stays open; output read while disconnected is dropped.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx, logger := log.MustWithAttrs(
+			cmd.Context(),
+			"port-name", mqttPortName,
+			"baud-rate", mqttBaudRate,
+			"data-bits", mqttDataBits,
+			"parity", &mqttParity,
+			"stop-bits", &mqttStopBits,
+			"broker", mqttBroker,
+			"publish-topic", mqttPublishTopic,
+			"subscribe-topic", mqttSubscribeTopic,
+			"qos", mqttQoS,
+			"framing", &mqttFraming,
+		)
+		cmd.SetContext(ctx)
+		logger.Info("Running")
+
+		if mqttQoS < 0 || mqttQoS > 2 {
+			return fmt.Errorf("invalid QoS: %d", mqttQoS)
+		}
+
+		logger.Info("Opening serial port")
+		port, err := serialport.Open(mqttPortName, &serial.Mode{
+			BaudRate: mqttBaudRate,
+			DataBits: mqttDataBits,
+			Parity:   serial.Parity(mqttParity),
+			StopBits: serial.StopBits(mqttStopBits),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open: %s: %w", mqttPortName, err)
+		}
+		defer func() {
+			if closeErr := port.Close(); closeErr != nil && !errors.Is(closeErr, os.ErrClosed) {
+				err = errors.Join(err, fmt.Errorf("failed to close: %s: %w", mqttPortName, closeErr))
+			}
+		}()
+
+		options, err := mqttClientOptions(ctx, port)
+		if err != nil {
+			return err
+		}
+		client := mqtt.NewClient(options)
+		// Waiting for the broker, so early output is not dropped; connecting is retried forever.
+		token := client.Connect()
+		token.Wait()
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+		}
+		defer client.Disconnect(250)
+
+		return fmt.Errorf("failed to read from serial port: %w", mqttPublish(ctx, client, port))
+	}),
+}
+
+func init() {
+	MQTTCmd.PersistentFlags().StringVarP(&mqttPortName, "port-name", "p", mqttPortNameDefault, "Serial port name")
+	if err := MQTTCmd.MarkPersistentFlagRequired("port-name"); err != nil {
+		panic(err)
+	}
+	MQTTCmd.PersistentFlags().IntVarP(&mqttBaudRate, "baud-rate", "b", mqttBaudRateDefault, "Serial port baud rate")
+	MQTTCmd.PersistentFlags().IntVarP(&mqttDataBits, "data-bits", "d", mqttDataBitsDefault, "Serial port data bits (5, 6, 7, or 8)")
+	MQTTCmd.PersistentFlags().VarP(&mqttParity, "parity", "", "Serial port parity (no, odd, even, mark or space)")
+	MQTTCmd.PersistentFlags().VarP(&mqttStopBits, "stop-bits", "", "Serial port stop bits (1, 1.5, or 2)")
+	MQTTCmd.PersistentFlags().StringVarP(&mqttBroker, "broker", "", mqttBrokerDefault, "MQTT broker URL: tcp://host:1883, ssl://host:8883 for TLS, or ws:// and wss:// for MQTT over WebSocket")
+	if err := MQTTCmd.MarkPersistentFlagRequired("broker"); err != nil {
+		panic(err)
+	}
+	MQTTCmd.PersistentFlags().StringVarP(&mqttClientID, "client-id", "", mqttClientIDDefault, "MQTT client identifier (default serialtcp-HOSTNAME)")
+	MQTTCmd.PersistentFlags().StringVarP(&mqttUsername, "username", "", mqttUsernameDefault, "User name to authenticate to the broker with")
+	MQTTCmd.PersistentFlags().StringVarP(&mqttPasswordFile, "password-file", "", mqttPasswordFileDefault, "File with the password to authenticate to the broker with, kept off the command line")
+	MQTTCmd.PersistentFlags().StringVarP(&mqttPublishTopic, "publish-topic", "", mqttPublishTopicDefault, "Topic serial port output is published to")
+	if err := MQTTCmd.MarkPersistentFlagRequired("publish-topic"); err != nil {
+		panic(err)
+	}
+	MQTTCmd.PersistentFlags().StringVarP(&mqttSubscribeTopic, "subscribe-topic", "", mqttSubscribeTopicDefault, "Topic whose messages are written to the serial port; wildcards are allowed")
+	MQTTCmd.PersistentFlags().IntVarP(&mqttQoS, "qos", "", mqttQoSDefault, "MQTT quality of service for publishing and subscribing (0, 1 or 2)")
+	MQTTCmd.PersistentFlags().BoolVarP(&mqttRetain, "retain", "", mqttRetainDefault, "Have the broker retain the last published message, for subscribers connecting later")
+	MQTTCmd.PersistentFlags().VarP(&mqttFraming, "framing", "", "How serial output is split into messages: raw, each chunk as read, or line, each line without its line ending, with a newline appended to messages written to the serial port")
+	MQTTCmd.PersistentFlags().StringVarP(&mqttTLSCA, "tls-ca", "", mqttTLSCADefault, "Verify the broker TLS certificate against the CA certificates in this PEM file instead of the system ones")
+	MQTTCmd.PersistentFlags().StringVarP(&mqttTLSCert, "tls-cert", "", mqttTLSCertDefault, "PEM certificate file to authenticate to the broker with, along with --tls-key")
+	MQTTCmd.PersistentFlags().StringVarP(&mqttTLSKey, "tls-key", "", mqttTLSKeyDefault, "PEM private key file of --tls-cert")
+	MQTTCmd.PersistentFlags().BoolVarP(&mqttTLSInsecure, "tls-insecure", "", mqttTLSInsecureDefault, "Do not verify the broker TLS certificate")
+
+	RootCmd.AddCommand(MQTTCmd)
+}
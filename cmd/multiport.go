@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/mux"
+)
+
+var namedPorts []string
+var namedPortsDefault = []string{}
+
+// Sent by clients as their first line to multiplex named ports over the connection, see package
+// mux.
+const muxRequest = "MUX"
+
+// Sent by clients as their first line, followed by a port name, to use that port.
+const openRequest = "OPEN"
+
+// How long clients of named ports have to send their first line.
+const portRequestTimeout = 10 * time.Second
+
+// multiPort serves several serial ports by name over the same listener, each with a server of
+// its own. Ports are added and removed by config file reloads.
+type multiPort struct {
+	// How ports added by reloads are served, with the serial port mode changed by reloads.
+	config  ServerConfig
+	options []ServerOption
+
+	mu      sync.Mutex
+	servers map[string]*server
+	// Names of the ports with a session in progress.
+	inUse map[string]bool
+	// Set by serve, starts polling the serial port of a server, until the returned function is
+	// called.
+	poll  func(srv *server) func()
+	stops map[string]func()
+}
+
+// newMultiPort returns the multiPort of --named-port, with the servers of each port configured as
+// config, with options.
+func newMultiPort(config *ServerConfig, options []ServerOption) (*multiPort, error) {
+	configs, err := namedPortConfigs(config, namedPorts)
+	if err != nil {
+		return nil, err
+	}
+	m := &multiPort{
+		config:  *config,
+		options: options,
+		servers: map[string]*server{},
+		inUse:   map[string]bool{},
+		stops:   map[string]func(){},
+	}
+	for name, portConfig := range configs {
+		m.servers[name] = newServer(*portConfig, options...)
+	}
+	return m, nil
+}
+
+// namedPortConfigs returns the configuration of each of values, as given to --named-port, by
+// name, as config for its serial port.
+func namedPortConfigs(config *ServerConfig, values []string) (map[string]*ServerConfig, error) {
+	configs := map[string]*ServerConfig{}
+	for _, value := range values {
+		name, port, ok := strings.Cut(value, "=")
+		if !ok || name == "" || port == "" {
+			return nil, fmt.Errorf("invalid named port, expected NAME=PORT: %q", value)
+		}
+		if strings.ContainsAny(name, " \t\r\n") {
+			return nil, fmt.Errorf("invalid named port name, it must not contain spaces: %q", name)
+		}
+		if _, ok := configs[name]; ok {
+			return nil, fmt.Errorf("duplicate named port: %s", name)
+		}
+		portConfig := *config
+		portConfig.PortName = port
+		configs[name] = &portConfig
+	}
+	return configs, nil
+}
+
+// checkNamedPorts verifies the serial ports of --named-port can be opened, or, without it, the one
+// of config.
+func checkNamedPorts(ctx context.Context, config *ServerConfig) error {
+	if len(namedPorts) == 0 {
+		return checkPort(ctx, config)
+	}
+	configs, err := namedPortConfigs(config, namedPorts)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		if checkErr := checkPort(ctx, configs[name]); checkErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", name, checkErr))
+		}
+	}
+	return err
+}
+
+// checkMultiPort verifies the flags set work with --named-port, which only serves sessions: what
+// is bound to a single serial port, such as the control socket, is not available.
+func checkMultiPort() error {
+	if len(namedPorts) == 0 {
+		return nil
+	}
+	unsupported := map[string]bool{
+		"--stdio":           stdio,
+		"--ssh-address":     sshAddress != "",
+		"--exclusive":       exclusive,
+		"--token-auth":      tokenAuth,
+		"--allow-steal":     allowSteal,
+		"--control-socket":  controlSocket != "",
+		"--metrics-address": metricsAddress != "",
+		"--health-address":  healthAddress != "",
+		"--api-address":     apiAddress != "",
+		"--grpc-address":    grpcAddress != "",
+		"--sse-address":     sseAddress != "",
+		"--identify":        identifyEnabled,
+		"--mdns":            mdnsEnabled,
+		"--max-connections": maxConnections != 1,
+	}
+	var err error
+	for _, flag := range slices.Sorted(maps.Keys(unsupported)) {
+		if unsupported[flag] {
+			err = errors.Join(err, fmt.Errorf("%s is not supported with --named-port", flag))
+		}
+	}
+	return err
+}
+
+// names returns the port names, sorted.
+func (m *multiPort) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(maps.Keys(m.servers))
+}
+
+// server returns the server of the port of name, if there is one.
+func (m *multiPort) server(name string) (*server, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	srv, ok := m.servers[name]
+	return srv, ok
+}
+
+// list returns the servers of all ports.
+func (m *multiPort) list() []*server {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Collect(maps.Values(m.servers))
+}
+
+// update serves the ports of configs, by name, from now on, returning the names of the ports added
+// and removed, with ports whose serial port changed in both. Sessions in progress on removed or
+// changed ports go on until they end, and until then, acquire refuses new sessions of a changed
+// port as busy.
+func (m *multiPort) update(configs map[string]*ServerConfig) ([]string, []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var added, removed []string
+	for name, srv := range m.servers {
+		if config, ok := configs[name]; ok && config.PortName == srv.config.PortName {
+			continue
+		}
+		if stop, ok := m.stops[name]; ok {
+			stop()
+			delete(m.stops, name)
+		}
+		delete(m.servers, name)
+		removed = append(removed, name)
+	}
+	for name, config := range configs {
+		if _, ok := m.servers[name]; ok {
+			continue
+		}
+		srv := newServer(*config, m.options...)
+		m.servers[name] = srv
+		if m.poll != nil {
+			m.stops[name] = m.poll(srv)
+		}
+		added = append(added, name)
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	return added, removed
+}
+
+// SetMode changes the serial port mode of all ports, including the ones added later.
+func (m *multiPort) SetMode(update func(mode *serial.Mode)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	for _, name := range slices.Sorted(maps.Keys(m.servers)) {
+		if setErr := m.servers[name].SetMode(update); setErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", name, setErr))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	update(&m.config.Mode)
+	return nil
+}
+
+// acquire returns the server of the port of name, marking it in use until release is called, or
+// why it can not be used.
+func (m *multiPort) acquire(name string) (srv *server, release func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	srv, ok := m.servers[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown port: %s", name)
+	}
+	if m.inUse[name] {
+		return nil, nil, fmt.Errorf("port busy: %s", name)
+	}
+	m.inUse[name] = true
+	return srv, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.inUse, name)
+	}, nil
+}
+
+// serve accepts connections with accept, until it fails or ctx is done, serving the ports they
+// ask for.
+func (m *multiPort) serve(ctx context.Context, accept func(context.Context) (net.Conn, error)) error {
+	logger := log.MustLogger(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	m.mu.Lock()
+	m.poll = func(srv *server) func() {
+		ctx, cancel := context.WithCancel(ctx)
+		srv.setAccepting(true)
+		if srv.config.UARTStatsInterval > 0 {
+			wg.Go(func() { pollUARTCounters(ctx, srv, srv.config.UARTStatsInterval) })
+		}
+		if srv.config.ModemStatusInterval > 0 {
+			wg.Go(func() { pollModemStatus(ctx, srv, srv.config.ModemStatusInterval) })
+		}
+		return func() {
+			cancel()
+			srv.setAccepting(false)
+		}
+	}
+	for name, srv := range m.servers {
+		m.stops[name] = m.poll(srv)
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for name, stop := range m.stops {
+			stop()
+			delete(m.stops, name)
+		}
+		m.poll = nil
+	}()
+	for {
+		logger.Info("Accepting connection")
+		conn, err := accept(ctx)
+		if err != nil {
+			return err
+		}
+		ctx, logger := log.MustWithGroupAttrs(
+			ctx,
+			"Connection",
+			"LocalAddr", conn.LocalAddr(),
+			"RemoteAddr", conn.RemoteAddr(),
+		)
+		logger.Info("Accepted")
+		wg.Go(func() {
+			if err := m.handleConnection(ctx, conn); err != nil {
+				logger.Error("Failed to handle connection", "error", err)
+			}
+		})
+	}
+}
+
+// handleConnection serves conn the ports asked for: the one named by the first label of its TLS
+// server name, if any, or else by its first line, either an OPEN request for one port, the MUX
+// request multiplexing them or a WebSocket request, with the port as its path.
+func (m *multiPort) handleConnection(ctx context.Context, conn net.Conn) error {
+	// Streams from relays already name their port, see tunnel.
+	if stream, ok := conn.(*mux.Stream); ok {
+		ctx, _ := log.MustWithAttrs(ctx, "named-port", stream.Name())
+		return m.handleStream(ctx, stream)
+	}
+	if name, ok := m.serverNamePort(conn); ok {
+		log.MustLogger(ctx).Info("Selected port by TLS server name", "named-port", name)
+		return m.serveNamedPort(ctx, conn, name)
+	}
+	buffered, line, err := readPortRequest(conn)
+	if err != nil {
+		return err
+	}
+	conn = buffered
+	request := strings.TrimSpace(line)
+	switch {
+	case request == muxRequest:
+		if tcpConn, ok := baseConn(conn).(*net.TCPConn); ok {
+			if err := tcpConn.SetNoDelay(true); err != nil {
+				return errors.Join(fmt.Errorf("failed to set TCP no delay: %w", err), conn.Close())
+			}
+		}
+		if err := setKeepAlive(conn, m.config.KeepAlive); err != nil {
+			log.MustLogger(ctx).Warn("Failed to set TCP keepalive", "error", err)
+		}
+		return m.serveMux(ctx, conn)
+	case strings.HasPrefix(request, openRequest+" "):
+		return m.serveNamedPort(ctx, conn, strings.TrimSpace(strings.TrimPrefix(request, openRequest)))
+	case strings.HasPrefix(request, "GET ") && strings.Contains(request, " HTTP/"):
+		// The HTTP server reads the request line again.
+		buffered.reader = bufio.NewReader(io.MultiReader(strings.NewReader(line), buffered.reader))
+		return m.serveWebSocket(ctx, conn)
+	}
+	_, err = fmt.Fprintf(conn, "ERROR expected %s NAME or %s, serving named ports: %s\r\n", openRequest, muxRequest, strings.Join(m.names(), ", "))
+	return errors.Join(fmt.Errorf("invalid port request: %q", line), err, conn.Close())
+}
+
+// readPortRequest reads the first line of conn, returning the connection to use for further
+// reads. On failure, conn is closed.
+func readPortRequest(conn net.Conn) (*bufferedConn, string, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(portRequestTimeout)); err != nil {
+		return nil, "", errors.Join(err, conn.Close())
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, "", errors.Join(fmt.Errorf("failed to read port request: %w", err), conn.Close())
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, "", errors.Join(err, conn.Close())
+	}
+	return &bufferedConn{Conn: conn, reader: reader}, line, nil
+}
+
+// serverNamePort returns the named port of the first label of the TLS server name of conn, if it
+// names one.
+func (m *multiPort) serverNamePort(conn net.Conn) (string, bool) {
+	tlsConn, ok := baseConn(conn).(interface{ ServerName() string })
+	if !ok {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tlsConn.ServerName(), ".")
+	_, ok = m.server(name)
+	return name, ok
+}
+
+// serveNamedPort serves conn a session of the port of name, telling it why when it can not.
+func (m *multiPort) serveNamedPort(ctx context.Context, conn net.Conn, name string) error {
+	ctx, logger := log.MustWithAttrs(ctx, "named-port", name)
+	srv, release, err := m.acquire(name)
+	if err != nil {
+		logger.Info("Refusing connection", "reason", err)
+		_, writeErr := fmt.Fprintf(conn, "ERROR %s\r\n", err)
+		return errors.Join(writeErr, conn.Close())
+	}
+	defer release()
+	return handleConnection(ctx, conn, srv)
+}
+
+// serveMux serves the streams multiplexed over conn, each to the port it is opened to, until conn
+// fails or ctx is done.
+func (m *multiPort) serveMux(ctx context.Context, conn net.Conn) error {
+	logger := log.MustLogger(ctx)
+	logger.Info("Multiplexing")
+	session := mux.Server(conn)
+	stop := context.AfterFunc(ctx, func() { _ = session.Close() })
+	defer stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			// Failing the streams in progress, if the connection did not already.
+			_ = session.Close()
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		wg.Go(func() {
+			ctx, logger := log.MustWithAttrs(ctx, "named-port", stream.Name())
+			if err := m.handleStream(ctx, stream); err != nil {
+				logger.Error("Failed to handle stream", "error", err)
+			}
+		})
+	}
+}
+
+// handleStream serves stream a session of the port it is opened to, refusing it when unknown or
+// busy.
+func (m *multiPort) handleStream(ctx context.Context, stream *mux.Stream) error {
+	logger := log.MustLogger(ctx)
+	srv, release, err := m.acquire(stream.Name())
+	if err != nil {
+		logger.Info("Refusing stream", "reason", err)
+		return stream.Refuse(err.Error())
+	}
+	defer release()
+	if err := stream.Confirm(); err != nil {
+		return errors.Join(err, stream.Close())
+	}
+	return handleConnection(ctx, stream, srv)
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/nmea"
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var nmeaPortNames []string
+var nmeaPortNamesDefault = []string{}
+
+// Port 10110 is registered with IANA for NMEA 0183 over TCP.
+var nmeaAddress string
+var nmeaAddressDefault = "127.0.0.1:10110"
+
+var nmeaJSONAddress string
+var nmeaJSONAddressDefault = ""
+
+var nmeaBaudRate int
+var nmeaBaudRateDefault = 4800
+
+var nmeaMergeClients bool
+var nmeaMergeClientsDefault = false
+
+var nmeaRequireChecksum bool
+var nmeaRequireChecksumDefault = false
+
+var nmeaClientQueue int
+var nmeaClientQueueDefault = 256
+
+// nmeaPort is a serial port sentences are read from and, with --merge-clients, written to.
+type nmeaPort struct {
+	name string
+	// Serializes writes, so sentences from different clients are not interleaved.
+	mu   sync.Mutex
+	port serialport.Port
+}
+
+// nmeaObject is the JSON representation of a sentence, see nmea --json-address.
+type nmeaObject struct {
+	// When the sentence was received.
+	Time time.Time `json:"time"`
+	// Serial port name, or client address, the sentence was received from.
+	Source string   `json:"source"`
+	Talker string   `json:"talker,omitempty"`
+	Type   string   `json:"type"`
+	Fields []string `json:"fields"`
+	Raw    string   `json:"raw"`
+	// Position data, for sentences carrying it.
+	Fix *nmea.Fix `json:"fix,omitempty"`
+}
+
+// nmeaMessage is a sentence as sent to clients.
+type nmeaMessage struct {
+	// Sentence with line ending.
+	raw []byte
+	// JSON object with line ending, only when JSON clients are served.
+	json []byte
+}
+
+// nmeaClient is a connected client, with its queue of messages to send.
+type nmeaClient struct {
+	messages chan nmeaMessage
+	// Whether the client is sent JSON objects instead of sentences.
+	json bool
+	// Count of messages dropped because the queue was full.
+	dropped atomic.Uint64
+}
+
+// nmeaHub fans sentences out to all clients.
+type nmeaHub struct {
+	ports []*nmeaPort
+	// Whether JSON clients are served.
+	json bool
+
+	mu      sync.Mutex
+	clients map[*nmeaClient]struct{}
+
+	// Count of discarded invalid sentences.
+	invalid atomic.Uint64
+}
+
+func (h *nmeaHub) addClient(asJSON bool) *nmeaClient {
+	client := &nmeaClient{messages: make(chan nmeaMessage, nmeaClientQueue), json: asJSON}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[client] = struct{}{}
+	return client
+}
+
+func (h *nmeaHub) removeClient(client *nmeaClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, client)
+}
+
+// newMessage returns the message for sentence, received from source at received.
+func (h *nmeaHub) newMessage(source string, received time.Time, sentence nmea.Sentence) (nmeaMessage, error) {
+	message := nmeaMessage{raw: []byte(sentence.Raw + "\r\n")}
+	if !h.json {
+		return message, nil
+	}
+	object := nmeaObject{
+		Time:   received,
+		Source: source,
+		Talker: sentence.Talker,
+		Type:   sentence.Type,
+		Fields: sentence.Fields,
+		Raw:    sentence.Raw,
+	}
+	if fix, ok := sentence.Fix(); ok {
+		object.Fix = &fix
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return message, err
+	}
+	message.json = append(data, '\n')
+	return message, nil
+}
+
+// broadcast queues message to all clients but from, which is nil for sentences from serial ports.
+// Messages are dropped for clients not keeping up, rather than stalling everyone else.
+func (h *nmeaHub) broadcast(message nmeaMessage, from *nmeaClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client == from {
+			continue
+		}
+		select {
+		case client.messages <- message:
+		default:
+			client.dropped.Add(1)
+		}
+	}
+}
+
+// scan calls fn with each valid sentence read from source, logging and counting invalid ones.
+func (h *nmeaHub) scan(ctx context.Context, source string, r io.Reader, fn func(message nmeaMessage, sentence string) error) error {
+	logger := log.MustLogger(ctx)
+	scanner := nmea.NewScanner(r)
+	for scanner.Scan() {
+		received := time.Now()
+		sentence, err := scanner.Sentence()
+		if err == nil && nmeaRequireChecksum && !sentence.HasChecksum {
+			err = fmt.Errorf("%w: missing checksum: %q", nmea.ErrInvalid, sentence.Raw)
+		}
+		if err != nil {
+			h.invalid.Add(1)
+			logger.Debug("Discarding invalid sentence", "error", err)
+			continue
+		}
+		message, err := h.newMessage(source, received, sentence)
+		if err != nil {
+			return err
+		}
+		if err := fn(message, sentence.Raw); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readPort broadcasts sentences from port until it fails.
+func (h *nmeaHub) readPort(ctx context.Context, port *nmeaPort) error {
+	ctx, _ = log.MustWithAttrs(ctx, "port-name", port.name)
+	err := h.scan(ctx, port.name, port.port, func(message nmeaMessage, _ string) error {
+		h.broadcast(message, nil)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read: %s: %w", port.name, err)
+	}
+	return fmt.Errorf("failed to read: %s: %w", port.name, io.EOF)
+}
+
+// writePorts writes sentence to all serial ports.
+func (h *nmeaHub) writePorts(sentence string) error {
+	var err error
+	for _, port := range h.ports {
+		port.mu.Lock()
+		_, writeErr := io.WriteString(port.port, sentence+"\r\n")
+		port.mu.Unlock()
+		if writeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to write: %s: %w", port.name, writeErr))
+		}
+	}
+	return err
+}
+
+// readClient handles sentences sent by a client: with --merge-clients they are written to the
+// serial ports and relayed to other clients, otherwise, or for JSON clients, they are discarded.
+func (h *nmeaHub) readClient(ctx context.Context, conn net.Conn, client *nmeaClient) error {
+	if !nmeaMergeClients || client.json {
+		_, err := io.Copy(io.Discard, conn)
+		return err
+	}
+	return h.scan(ctx, conn.RemoteAddr().String(), conn, func(message nmeaMessage, sentence string) error {
+		h.broadcast(message, client)
+		return h.writePorts(sentence)
+	})
+}
+
+// serveClient sends messages to conn until either side fails or ctx is done.
+func (h *nmeaHub) serveClient(ctx context.Context, conn net.Conn, asJSON bool) {
+	logger := log.MustLogger(ctx)
+	client := h.addClient(asJSON)
+	// Unblocks writes to clients not reading.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	readErrCh := make(chan error, 1)
+	go func() {
+		readErrCh <- h.readClient(ctx, conn, client)
+	}()
+
+	var err error
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case err = <-readErrCh:
+			if err == nil {
+				err = io.EOF
+			}
+			readErrCh = nil
+		case message := <-client.messages:
+			data := message.raw
+			if client.json {
+				data = message.json
+			}
+			_, err = conn.Write(data)
+		}
+	}
+
+	h.removeClient(client)
+	if closeErr := conn.Close(); closeErr != nil {
+		logger.Error("Failed to close connection", "error", closeErr)
+	}
+	if readErrCh != nil {
+		<-readErrCh
+	}
+	if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		logger.Error("Connection failed", "error", err)
+	}
+	logger.Info("Disconnected", "dropped", client.dropped.Load())
+}
+
+// accept serves clients accepted from acceptor, sending them JSON objects when asJSON is set,
+// until accepting fails.
+func (h *nmeaHub) accept(ctx context.Context, acceptor *acceptor, asJSON bool, wg *sync.WaitGroup) error {
+	for {
+		conn, err := acceptor.Accept(ctx)
+		if err != nil {
+			return err
+		}
+		ctx, logger := log.MustWithGroupAttrs(
+			ctx,
+			"Connection",
+			"LocalAddr", conn.LocalAddr(),
+			"RemoteAddr", conn.RemoteAddr(),
+			"JSON", asJSON,
+		)
+		logger.Info("Accepted")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.serveClient(ctx, conn, asJSON)
+		}()
+	}
+}
+
+// newNMEAAcceptor listens on address, until ctx is done.
+func newNMEAAcceptor(ctx context.Context, address string) (*acceptor, error) {
+	logger := log.MustLogger(ctx)
+	logger.Info("Listening", "address", address)
+	listener, err := listen(address)
+	if err != nil {
+		return nil, err
+	}
+	// Unblocks Accept when ctx is done.
+	context.AfterFunc(ctx, func() { listener.Close() })
+	return &acceptor{
+		listener:       listener,
+		rebind:         func() (net.Listener, error) { return listen(address) },
+		failureTimeout: acceptFailureTimeoutDefault,
+	}, nil
+}
+
+// openNMEAPorts opens all serial ports, closing the ones already open on failure.
+func openNMEAPorts(ctx context.Context, mode *serial.Mode) ([]*nmeaPort, error) {
+	logger := log.MustLogger(ctx)
+	ports := make([]*nmeaPort, 0, len(nmeaPortNames))
+	for _, name := range nmeaPortNames {
+		logger.Info("Opening serial port", "port-name", name)
+		port, err := serialport.Open(name, mode)
+		if err != nil {
+			err = fmt.Errorf("failed to open: %s: %w", name, err)
+			return nil, errors.Join(err, closeNMEAPorts(ports))
+		}
+		ports = append(ports, &nmeaPort{name: name, port: port})
+	}
+	return ports, nil
+}
+
+func closeNMEAPorts(ports []*nmeaPort) error {
+	var err error
+	for _, port := range ports {
+		if closeErr := port.port.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close: %s: %w", port.name, closeErr))
+		}
+	}
+	return err
+}
+
+var NMEACmd = &cobra.Command{
+	Use:   "nmea",
+	Short: "Multiplex NMEA 0183 sentences to many TCP clients.",
+	Long:  "Reads NMEA 0183 sentences, as sent by GPS receivers and marine electronics, from one or more serial ports, and sends the ones with valid checksums to all connected clients, merged on sentence boundaries, optionally also as newline delimited JSON objects. Clients not keeping up miss sentences, instead of delaying everyone else. There's NO security implemented, this can only be used in secure networks at your own risk.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx, logger := log.MustWithAttrs(
+			cmd.Context(),
+			"port-names", nmeaPortNames,
+			"address", nmeaAddress,
+			"json-address", nmeaJSONAddress,
+			"baud-rate", nmeaBaudRate,
+			"merge-clients", nmeaMergeClients,
+			"require-checksum", nmeaRequireChecksum,
+			"client-queue", nmeaClientQueue,
+		)
+		cmd.SetContext(ctx)
+		logger.Info("Running")
+
+		if nmeaAddress == nmeaJSONAddress {
+			return errors.New("--address and --json-address must differ")
+		}
+		if nmeaClientQueue < 1 {
+			return fmt.Errorf("invalid client queue size: %d", nmeaClientQueue)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		ports, err := openNMEAPorts(ctx, &serial.Mode{BaudRate: nmeaBaudRate})
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, closeNMEAPorts(ports)) }()
+
+		hub := &nmeaHub{ports: ports, json: nmeaJSONAddress != "", clients: map[*nmeaClient]struct{}{}}
+		acceptors := map[*acceptor]bool{}
+		defer func() {
+			for acceptor := range acceptors {
+				err = errors.Join(err, acceptor.Close())
+			}
+		}()
+		for address, asJSON := range map[string]bool{nmeaAddress: false, nmeaJSONAddress: true} {
+			if address == "" {
+				continue
+			}
+			acceptor, err := newNMEAAcceptor(ctx, address)
+			if err != nil {
+				return err
+			}
+			acceptors[acceptor] = asJSON
+		}
+
+		// The first serial port or listener failure stops the server.
+		errCh := make(chan error, len(ports)+len(acceptors))
+		for _, port := range ports {
+			go func() { errCh <- hub.readPort(ctx, port) }()
+		}
+		var wg sync.WaitGroup
+		for acceptor, asJSON := range acceptors {
+			go func() { errCh <- hub.accept(ctx, acceptor, asJSON, &wg) }()
+		}
+		err = <-errCh
+		cancel()
+		wg.Wait()
+		logger.Info("Stopping", "invalid", hub.invalid.Load())
+		return err
+	}),
+}
+
+func init() {
+	NMEACmd.PersistentFlags().StringArrayVarP(&nmeaPortNames, "port-name", "p", nmeaPortNamesDefault, "Serial port to read sentences from; can be given multiple times, to merge sentences from all of them")
+	if err := NMEACmd.MarkPersistentFlagRequired("port-name"); err != nil {
+		panic(err)
+	}
+	NMEACmd.PersistentFlags().StringVarP(&nmeaAddress, "address", "a", nmeaAddressDefault, "Address to listen on: host:port for TCP, unix:///path for a Unix domain socket or \\\\.\\pipe\\name for a Windows named pipe")
+	NMEACmd.PersistentFlags().StringVarP(&nmeaJSONAddress, "json-address", "", nmeaJSONAddressDefault, "Also listen on this address, sending clients newline delimited JSON objects, one per sentence, with its parsed fields, position data for GGA, GLL and RMC sentences and receive timestamp")
+	NMEACmd.PersistentFlags().IntVarP(&nmeaBaudRate, "baud-rate", "b", nmeaBaudRateDefault, "Serial port baud rate (4800 is standard for NMEA 0183, 38400 for high speed devices such as AIS receivers)")
+	NMEACmd.PersistentFlags().BoolVarP(&nmeaMergeClients, "merge-clients", "", nmeaMergeClientsDefault, "Write valid sentences sent by clients to all serial ports and relay them to the other clients, instead of discarding them")
+	NMEACmd.PersistentFlags().BoolVarP(&nmeaRequireChecksum, "require-checksum", "", nmeaRequireChecksumDefault, "Discard sentences without a checksum, which is optional for some sentences in NMEA 0183")
+	NMEACmd.PersistentFlags().IntVarP(&nmeaClientQueue, "client-queue", "", nmeaClientQueueDefault, "Sentences queued for each client, past which sentences are dropped for that client")
+
+	RootCmd.AddCommand(NMEACmd)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/nullmodem"
+)
+
+var nullModemLinkA string
+var nullModemLinkADefault = ""
+
+var nullModemLinkB string
+var nullModemLinkBDefault = ""
+
+// linkNullModemEnd creates a symlink at link to the device name, replacing a stale symlink left
+// behind, and returns a function removing it.
+func linkNullModemEnd(link, name string) (func() error, error) {
+	if link == "" {
+		return func() error { return nil }, nil
+	}
+	if info, err := os.Lstat(link); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil, fmt.Errorf("refusing to replace, not a symlink: %s", link)
+		}
+		if err := os.Remove(link); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Symlink(name, link); err != nil {
+		return nil, err
+	}
+	return func() error { return os.Remove(link) }, nil
+}
+
+var NullModemCmd = &cobra.Command{
+	Use:   "nullmodem",
+	Short: "Create a software null modem.",
+	Long:  "Creates two pseudo terminals linked to each other, as two serial ports wired with a null modem cable, until interrupted, so that serve and other programs can be developed and tested without hardware. Their device names are printed, and can be given stable names with --link-a and --link-b; serve takes them relative to /dev, such as --port-name pts/3. Modem control lines, breaks and baud rates are not emulated.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx, logger := log.MustWithAttrs(
+			cmd.Context(),
+			"link-a", nullModemLinkA,
+			"link-b", nullModemLinkB,
+		)
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		logger.Info("Opening null modem")
+		nullModem, err := nullmodem.Open()
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, nullModem.Close()) }()
+
+		unlinkA, err := linkNullModemEnd(nullModemLinkA, nullModem.A.Name())
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, unlinkA()) }()
+		unlinkB, err := linkNullModemEnd(nullModemLinkB, nullModem.B.Name())
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, unlinkB()) }()
+
+		logger.Info("Null modem open", "a", nullModem.A.Name(), "b", nullModem.B.Name())
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n%s\n", nullModem.A.Name(), nullModem.B.Name())
+		<-ctx.Done()
+		logger.Info("Closing null modem")
+		return nil
+	}),
+}
+
+func init() {
+	NullModemCmd.PersistentFlags().StringVarP(&nullModemLinkA, "link-a", "", nullModemLinkADefault, "Create a symlink to the first pseudo terminal here, such as /tmp/ttyA")
+	NullModemCmd.PersistentFlags().StringVarP(&nullModemLinkB, "link-b", "", nullModemLinkBDefault, "Create a symlink to the second pseudo terminal here, such as /tmp/ttyB")
+	RootCmd.AddCommand(NullModemCmd)
+}
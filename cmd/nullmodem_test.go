@@ -0,0 +1,79 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fornellas/serialtcp/nullmodem"
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// TestHandleConnectionNullModem serves one end of a null modem, as a local serial port, with a
+// device simulated on the other end.
+func TestHandleConnectionNullModem(t *testing.T) {
+	ctx := testContext(t)
+	n, err := nullmodem.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	device, err := os.OpenFile(n.B.Name(), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+
+	srv, _, _ := newTestServer(t)
+	// Serial ports are named relative to /dev.
+	srv.config.PortName = strings.TrimPrefix(n.A.Name(), "/dev/")
+	client, done := startSession(t, ctx, srv)
+
+	if _, err := io.WriteString(client, "AT\r"); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 3)
+	if _, err := io.ReadFull(device, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "AT\r" {
+		t.Fatalf("device read %q, want %q", got, "AT\r")
+	}
+	if _, err := io.WriteString(device, "\r\nOK\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	readFull(t, client, "\r\nOK\r\n")
+
+	// Local serial ports hold breaks, rather than sending them for a duration.
+	srv.mu.Lock()
+	var port serialport.Port
+	for _, sess := range srv.sessions {
+		port = sess.port
+	}
+	srv.mu.Unlock()
+	for _, on := range []bool{true, false} {
+		if err := (breakPort{port}).SetBreak(on); err != nil {
+			t.Errorf("SetBreak(%v) = %v", on, err)
+		}
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Reads of the closed port fail, which does not fail the session.
+	if err := waitSessionEnd(t, done); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/fornellas/serialtcp/pipeline"
+)
+
+// pacingWriter writes one byte at a time, pausing after each character and after each line, for
+// devices that drop characters when data arrives at full speed.
+type pacingWriter struct {
+	io.Writer
+	charDelay time.Duration
+	lineDelay time.Duration
+	last      byte
+}
+
+func (w *pacingWriter) Write(p []byte) (int, error) {
+	for i, b := range p {
+		if _, err := w.Writer.Write([]byte{b}); err != nil {
+			return i, err
+		}
+		delay := w.charDelay
+		// CR LF is a single line end.
+		if b == '\r' || (b == '\n' && w.last != '\r') {
+			delay += w.lineDelay
+		}
+		w.last = b
+		time.Sleep(delay)
+	}
+	return len(p), nil
+}
+
+// pacingMiddleware paces writes, pausing charDelay after each character and lineDelay more after
+// each line.
+func pacingMiddleware(charDelay, lineDelay time.Duration) pipeline.Middleware {
+	return func(next io.Writer) io.Writer {
+		if charDelay == 0 && lineDelay == 0 {
+			return next
+		}
+		return &pacingWriter{Writer: next, charDelay: charDelay, lineDelay: lineDelay}
+	}
+}
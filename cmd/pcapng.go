@@ -0,0 +1,119 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// pcapng block types and options, see https://datatracker.ietf.org/doc/draft-ietf-opsawg-pcapng/.
+const (
+	pcapngSectionHeaderBlock        = 0x0a0d0d0a
+	pcapngInterfaceDescriptionBlock = 0x00000001
+	pcapngEnhancedPacketBlock       = 0x00000006
+	pcapngByteOrderMagic            = 0x1a2b3c4d
+
+	pcapngOptEndOfOpt = 0
+	pcapngOptComment  = 1
+	pcapngOptIfName   = 2
+	pcapngOptEPBFlags = 2
+
+	// epb_flags directions.
+	pcapngInbound  = 1
+	pcapngOutbound = 2
+)
+
+// Link type of captured data: LINKTYPE_USER0, which Wireshark decodes as the protocol mapped to it
+// in its DLT User preferences, such as Modbus RTU or NMEA 0183.
+const pcapngLinkType = 147
+
+// pcapngWriter writes a pcapng file with a single interface, the serial port, and each record as a
+// packet, in little endian byte order. Data read from the serial port is inbound, and data written
+// to it outbound, with the direction also as the packet comment.
+type pcapngWriter struct {
+	w io.Writer
+}
+
+// newPcapngWriter writes the pcapng section header and the description of the serial port
+// interface, name, to w.
+func newPcapngWriter(w io.Writer, name string) (*pcapngWriter, error) {
+	p := &pcapngWriter{w: w}
+
+	var shb bytes.Buffer
+	binary.Write(&shb, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+	binary.Write(&shb, binary.LittleEndian, uint16(1)) // Major version.
+	binary.Write(&shb, binary.LittleEndian, uint16(0)) // Minor version.
+	binary.Write(&shb, binary.LittleEndian, int64(-1)) // Section length, unspecified.
+	if err := p.writeBlock(pcapngSectionHeaderBlock, shb.Bytes(), nil); err != nil {
+		return nil, err
+	}
+
+	var idb bytes.Buffer
+	binary.Write(&idb, binary.LittleEndian, uint16(pcapngLinkType))
+	binary.Write(&idb, binary.LittleEndian, uint16(0)) // Reserved.
+	binary.Write(&idb, binary.LittleEndian, uint32(0)) // Snap length, unlimited.
+	if err := p.writeBlock(pcapngInterfaceDescriptionBlock, idb.Bytes(), pcapngOption(pcapngOptIfName, []byte(name))); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// pcapngOption encodes an option, padded to 32 bits.
+func pcapngOption(code uint16, value []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, code)
+	binary.Write(&b, binary.LittleEndian, uint16(len(value)))
+	b.Write(value)
+	b.Write(make([]byte, pcapngPadding(len(value))))
+	return b.Bytes()
+}
+
+func pcapngPadding(n int) int {
+	return (4 - n%4) % 4
+}
+
+// writeBlock writes a block of blockType, with body padded to 32 bits and options, if any.
+func (p *pcapngWriter) writeBlock(blockType uint32, body []byte, options []byte) error {
+	var b bytes.Buffer
+	length := 12 + len(body) + pcapngPadding(len(body))
+	if len(options) > 0 {
+		length += len(options) + 4
+	}
+	binary.Write(&b, binary.LittleEndian, blockType)
+	binary.Write(&b, binary.LittleEndian, uint32(length))
+	b.Write(body)
+	b.Write(make([]byte, pcapngPadding(len(body))))
+	if len(options) > 0 {
+		b.Write(options)
+		b.Write(pcapngOption(pcapngOptEndOfOpt, nil))
+	}
+	binary.Write(&b, binary.LittleEndian, uint32(length))
+	if _, err := p.w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	return nil
+}
+
+// encode writes record as an enhanced packet block.
+func (p *pcapngWriter) encode(record CaptureRecord) error {
+	var body bytes.Buffer
+	timestamp := uint64(record.Time.UnixMicro())
+	binary.Write(&body, binary.LittleEndian, uint32(0)) // Interface ID.
+	binary.Write(&body, binary.LittleEndian, uint32(timestamp>>32))
+	binary.Write(&body, binary.LittleEndian, uint32(timestamp))
+	binary.Write(&body, binary.LittleEndian, uint32(len(record.Data))) // Captured length.
+	binary.Write(&body, binary.LittleEndian, uint32(len(record.Data))) // Original length.
+	body.Write(record.Data)
+
+	flags := make([]byte, 4)
+	direction := uint32(pcapngOutbound)
+	if record.Direction == captureToClient {
+		direction = pcapngInbound
+	}
+	binary.LittleEndian.PutUint32(flags, direction)
+	options := append(pcapngOption(pcapngOptEPBFlags, flags), pcapngOption(pcapngOptComment, []byte(record.Direction))...)
+	return p.writeBlock(pcapngEnhancedPacketBlock, body.Bytes(), options)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+var errPipeUnsupported = errors.New("named pipes are only supported on Windows")
+
+func listenPipe(path string) (net.Listener, error) {
+	return nil, errPipeUnsupported
+}
+
+func dialPipe(path string) (net.Conn, error) {
+	return nil, errPipeUnsupported
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// setPortErr records the outcome of the last attempt to open the serial port.
+func (s *server) setPortErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.portErr = err
+}
+
+// acquirePort opens the serial port with open for a session, recording the outcome, and, once it
+// is open, that the session uses it, until releasePort. Health probes do not open the port while
+// sessions open or use it.
+func (s *server) acquirePort(open func() (serialport.Port, error)) (serialport.Port, error) {
+	s.portMu.Lock()
+	defer s.portMu.Unlock()
+	port, err := open()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.portErr = err
+	if err == nil {
+		s.portUsers++
+	}
+	return port, err
+}
+
+// releasePort records that a session of acquirePort closed the serial port.
+func (s *server) releasePort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.portUsers--
+}
+
+// portInUse returns whether sessions have the serial port open.
+func (s *server) portInUse() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.portUsers > 0
+}
+
+// deviceGone classifies err, of a session using the serial port, with serialport.DeviceGone,
+// recording removed devices for health checks, which then fail until the port opens again.
+func (s *server) deviceGone(err error) error {
+	err = serialport.DeviceGone(err)
+	if errors.Is(err, serialport.ErrDeviceGone) {
+		s.setPortErr(err)
+	}
+	return err
+}
+
+// setAccepting sets whether the server accepts connections.
+func (s *server) setAccepting(accepting bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accepting = accepting
+}
+
+// portHealth returns why the serial port is unusable, or nil. The port is healthy while sessions
+// have it open. Otherwise, it is unhealthy if its device is gone or, as the last attempt to open
+// it failed, opening it again fails: a port that is fine is not opened, as that may reset the
+// device on the other end.
+func (s *server) portHealth(ctx context.Context) error {
+	s.mu.Lock()
+	inUse := s.portUsers > 0
+	portErr := s.portErr
+	s.mu.Unlock()
+	if inUse || s.config.runsCommand() {
+		return nil
+	}
+	// Windows device namespace paths, such as \\.\COM10, can not be checked with os.Stat.
+	if filepath.IsAbs(s.config.PortName) && !strings.HasPrefix(s.config.PortName, `\\.\`) {
+		if _, err := os.Stat(s.config.PortName); err != nil {
+			return err
+		}
+	}
+	if portErr == nil {
+		return nil
+	}
+	return s.probePort(ctx)
+}
+
+// probePort opens and closes the serial port, recording the outcome, unless sessions have it open
+// or it is a command, which is only started for sessions. Sessions wait for probes to end before
+// opening the port, see acquirePort, so that probes do not make them fail, as with --exclusive.
+func (s *server) probePort(ctx context.Context) error {
+	if s.config.runsCommand() {
+		return nil
+	}
+	s.portMu.Lock()
+	defer s.portMu.Unlock()
+	if s.portInUse() {
+		return nil
+	}
+	err := checkPort(ctx, &s.config)
+	s.setPortErr(err)
+	return err
+}
+
+// readiness returns why the server should not be routed new clients, or nil.
+func (s *server) readiness() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.accepting {
+		return errors.New("not accepting connections")
+	}
+	if s.stats.Draining {
+		return errors.New("draining")
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+var runAsUser string
+var runAsUserDefault = ""
+
+var runAsGroup string
+var runAsGroupDefault = ""
+
+var chrootDir string
+var chrootDirDefault = ""
+
+// dropsPrivileges returns whether serve drops privileges once listening, see --user, --group and
+// --chroot.
+func dropsPrivileges() bool {
+	return runAsUser != "" || runAsGroup != "" || chrootDir != ""
+}
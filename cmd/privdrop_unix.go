@@ -0,0 +1,138 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// lookupUser looks up an account by name or numeric ID.
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+// lookupGroup looks up a group by name or numeric ID.
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+// privilegeIDs returns the user, group and supplementary group IDs to switch to, -1 for the ones
+// not to change: the --user account with its groups, and --group on top of them.
+func privilegeIDs() (int, int, []int, error) {
+	uid, gid := -1, -1
+	var groups []int
+	if runAsUser != "" {
+		u, err := lookupUser(runAsUser)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid --user: %w", err)
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+		groupIDs, err := u.GroupIds()
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to list groups of %s: %w", u.Username, err)
+		}
+		for _, groupID := range groupIDs {
+			id, _ := strconv.Atoi(groupID)
+			groups = append(groups, id)
+		}
+	}
+	if runAsGroup != "" {
+		g, err := lookupGroup(runAsGroup)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid --group: %w", err)
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+		groups = append(groups, gid)
+	}
+	return uid, gid, groups, nil
+}
+
+// checkPrivileges verifies the privileges dropPrivileges switches to can be looked up, and --chroot
+// is a directory, before anything is served.
+func checkPrivileges() error {
+	if !dropsPrivileges() {
+		return nil
+	}
+	if _, _, _, err := privilegeIDs(); err != nil {
+		return err
+	}
+	if chrootDir != "" {
+		info, err := os.Stat(chrootDir)
+		if err != nil {
+			return fmt.Errorf("invalid --chroot: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid --chroot: %s: not a directory", chrootDir)
+		}
+	}
+	return nil
+}
+
+// dropPrivileges changes the root directory to --chroot, and switches to --user and --group, for
+// once listeners are open.
+func dropPrivileges(ctx context.Context, config *ServerConfig) error {
+	if !dropsPrivileges() {
+		return nil
+	}
+	logger := log.MustLogger(ctx)
+	// Accounts are looked up before chroot, as their database is usually outside of it.
+	uid, gid, groups, err := privilegeIDs()
+	if err != nil {
+		return err
+	}
+	if chrootDir != "" {
+		if err := syscall.Chroot(chrootDir); err != nil {
+			return fmt.Errorf("failed to chroot: %s: %w", chrootDir, err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			return fmt.Errorf("failed to change directory after chroot: %w", err)
+		}
+	}
+	if gid >= 0 {
+		if err := syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("failed to set supplementary groups: %w", err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("failed to set group: %w", err)
+		}
+	}
+	if uid >= 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("failed to set user: %w", err)
+		}
+		if uid != 0 && syscall.Setuid(0) == nil {
+			return errors.New("privileges were not dropped: switching back to root succeeded")
+		}
+	}
+	logger.Info("Dropped privileges", "uid", os.Getuid(), "gid", os.Getgid(), "groups", groups, "chroot", chrootDir)
+	warnPortAccess(ctx, config)
+	return nil
+}
+
+// warnPortAccess warns if the serial port of config can not be opened for reading and writing, as
+// sessions would then fail to open it.
+func warnPortAccess(ctx context.Context, config *ServerConfig) {
+	if config.runsCommand() || !filepath.IsAbs(config.PortName) {
+		return
+	}
+	// Read and write access.
+	if err := syscall.Access(config.PortName, 0o6); err != nil {
+		log.MustLogger(ctx).Warn("Serial port can not be opened once privileges are dropped, give --group of its device (eg: dialout)", "port-name", config.PortName, "error", err)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// checkPrivileges fails as dropPrivileges does.
+func checkPrivileges() error {
+	return dropPrivileges(context.Background(), nil)
+}
+
+// dropPrivileges fails if asked to drop privileges, as --user, --group and --chroot are not
+// supported on Windows: run the service as an unprivileged account instead.
+func dropPrivileges(ctx context.Context, config *ServerConfig) error {
+	if !dropsPrivileges() {
+		return nil
+	}
+	return errors.New("--user, --group and --chroot are not supported on Windows")
+}
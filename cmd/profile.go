@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Profile is a named combination of serve options vetted for a kind of device.
+type Profile int
+
+const (
+	// No profile, options keep their defaults.
+	ProfileNone Profile = iota
+	// Radio adapters driven by a host stack, such as Zigbee2MQTT or Z-Wave JS: the path must be 8
+	// bit clean, without translation, pacing or banners, and with low latency.
+	ProfileRadio
+	// Serial consoles: a slow client loses old output instead of stalling the device, and stalled
+	// input is dropped instead of ending the session.
+	ProfileConsole
+	// Printers: jobs end with the client half closing, and a printer stalled by flow control, such
+	// as when out of paper, is waited on for a while.
+	ProfilePrinter
+)
+
+var profileNames = map[Profile]string{
+	ProfileNone:    "none",
+	ProfileRadio:   "radio",
+	ProfileConsole: "console",
+	ProfilePrinter: "printer",
+}
+
+// ProfileValue implements pflag.Value for Profile
+type ProfileValue Profile
+
+func (p *ProfileValue) String() string {
+	return profileNames[Profile(*p)]
+}
+
+func (p *ProfileValue) Set(s string) error {
+	for profile, name := range profileNames {
+		if strings.EqualFold(s, name) {
+			*p = ProfileValue(profile)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid profile: %s", s)
+}
+
+func (p *ProfileValue) Type() string {
+	return "profile"
+}
+
+var profile = ProfileValue(ProfileNone)
+
+// profileFlags holds the serve flags set by each profile. TCP no delay is always set.
+var profileFlags = map[Profile]map[string]string{
+	ProfileRadio: {
+		"data-bits":            "8",
+		"parity":               "no",
+		"stop-bits":            "1",
+		"crlf-to-port":         "raw",
+		"crlf-to-client":       "raw",
+		"char-delay":           "0",
+		"line-delay":           "0",
+		"banner":               "",
+		"low-latency":          "true",
+		"client-buffer-policy": "block",
+	},
+	ProfileConsole: {
+		"crlf-to-port":         "raw",
+		"crlf-to-client":       "raw",
+		"client-buffer-policy": "drop-oldest",
+		"write-timeout":        "5s",
+		"write-timeout-policy": "drop",
+	},
+	ProfilePrinter: {
+		"half-close":           "true",
+		"client-buffer-policy": "block",
+		"write-timeout":        "1m",
+		"write-timeout-policy": "disconnect",
+	},
+}
+
+// applyProfile sets the flags of --profile, unless set explicitly. It goes before the other
+// options deriving flags, such as --low-latency, so the profile flags count as set explicitly.
+func applyProfile(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	settings := profileFlags[Profile(profile)]
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if flags.Changed(name) {
+			continue
+		}
+		if err := flags.Set(name, settings[name]); err != nil {
+			return fmt.Errorf("failed to apply profile %s: --%s: %w", &profile, name, err)
+		}
+	}
+	return nil
+}
+
+// profileUsage describes the profiles, for the --profile usage.
+func profileUsage() string {
+	var descriptions []string
+	for _, p := range []Profile{ProfileRadio, ProfileConsole, ProfilePrinter} {
+		settings := profileFlags[p]
+		var args []string
+		for _, name := range slices.Sorted(maps.Keys(settings)) {
+			args = append(args, fmt.Sprintf("--%s %q", name, settings[name]))
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", profileNames[p], strings.Join(args, " ")))
+	}
+	return strings.Join(descriptions, "; ")
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var proxyProtocol bool
+var proxyProtocolDefault = false
+
+var proxyProtocolFrom []string
+var proxyProtocolFromDefault = []string{}
+
+// How long proxies may take to send the PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// Longest PROXY protocol version 1 header, including its line ending.
+const proxyV1MaxLength = 107
+
+// Signature starting PROXY protocol version 2 headers.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyConn is a connection accepted from a proxy, with the client address from its PROXY
+// protocol header.
+type proxyConn struct {
+	net.Conn
+	reader     io.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) { return c.reader.Read(p) }
+func (c *proxyConn) RemoteAddr() net.Addr       { return c.remoteAddr }
+
+// NetConn returns the connection to the proxy.
+func (c *proxyConn) NetConn() net.Conn { return c.Conn }
+
+// parseProxyV1 parses a PROXY protocol version 1 header, returning a nil address for UNKNOWN.
+func parseProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLength {
+			return nil, errors.New("PROXY protocol header too long")
+		}
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol header: %q", line)
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol source address: %w", err)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol source port: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// parseProxyV2 parses a PROXY protocol version 2 header, after its signature, returning a nil
+// address for LOCAL connections, such as health checks, and for families other than TCP.
+func parseProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[0]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version: %d", header[0]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	// LOCAL command.
+	if header[0]&0xf == 0 {
+		return nil, nil
+	}
+	switch header[1] {
+	// TCP over IPv4: source and destination addresses, then ports.
+	case 0x11:
+		if len(payload) < 12 {
+			return nil, errors.New("truncated PROXY protocol header")
+		}
+		ip := netip.AddrFrom4([4]byte(payload[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(payload[8:]))), nil
+	// TCP over IPv6.
+	case 0x21:
+		if len(payload) < 36 {
+			return nil, errors.New("truncated PROXY protocol header")
+		}
+		ip := netip.AddrFrom16([16]byte(payload[0:16]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(payload[32:]))), nil
+	}
+	return nil, nil
+}
+
+// readProxyHeader reads the PROXY protocol header, version 1 or 2, sent by a proxy at the start of
+// conn, returning conn with the client address from it.
+func readProxyHeader(conn net.Conn) (net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout)); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	signature, err := reader.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY protocol header: %w", err)
+	}
+	var remoteAddr net.Addr
+	switch {
+	case bytes.Equal(signature, proxyV2Signature):
+		if _, err := reader.Discard(len(proxyV2Signature)); err != nil {
+			return nil, err
+		}
+		remoteAddr, err = parseProxyV2(reader)
+	case bytes.HasPrefix(signature, []byte("PROXY ")):
+		remoteAddr, err = parseProxyV1(reader)
+	default:
+		return nil, errors.New("missing PROXY protocol header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY protocol header: %w", err)
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	if remoteAddr == nil {
+		remoteAddr = conn.RemoteAddr()
+	}
+	return &proxyConn{Conn: conn, reader: reader, remoteAddr: remoteAddr}, nil
+}
+
+// proxyListener is a net.Listener accepting connections from proxies speaking the PROXY
+// protocol. Connections from outside of the trusted networks are accepted as they are, and
+// connections with an invalid header are dropped.
+type proxyListener struct {
+	net.Listener
+	ctx context.Context
+}
+
+// trustedProxies holds the networks the PROXY protocol header is expected from, see
+// --proxy-protocol-from, which configuration reloads change.
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// isTrusted returns whether the PROXY protocol header is expected from addr, which is always the
+// case for non TCP connections, as those are local.
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	trusted := trustedProxies.Load()
+	if !ok || trusted == nil || len(*trusted) == 0 {
+		return true
+	}
+	ip := tcpAddr.AddrPort().Addr().Unmap()
+	for _, prefix := range *trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	logger := log.MustLogger(l.ctx)
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if !l.isTrusted(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		proxied, err := readProxyHeader(conn)
+		if err == nil {
+			return proxied, nil
+		}
+		logger.Warn("Dropping connection", "remote-addr", conn.RemoteAddr(), "error", err)
+		conn.Close()
+	}
+}
+
+// withProxyProtocol returns listen with its listeners expecting the PROXY protocol header, with
+// --proxy-protocol.
+func withProxyProtocol(ctx context.Context, listen func() (net.Listener, error)) (func() (net.Listener, error), error) {
+	if !proxyProtocol {
+		return listen, nil
+	}
+	if Transport(transport) == TransportQUIC {
+		return nil, errors.New("--proxy-protocol is not supported with --transport quic")
+	}
+	trusted, err := parseTrustedProxies(proxyProtocolFrom)
+	if err != nil {
+		return nil, err
+	}
+	trustedProxies.Store(&trusted)
+	return func() (net.Listener, error) {
+		listener, err := listen()
+		if err != nil {
+			return nil, err
+		}
+		return &proxyListener{Listener: listener, ctx: ctx}, nil
+	}, nil
+}
+
+// parseTrustedProxies parses --proxy-protocol-from addresses and networks.
+func parseTrustedProxies(from []string) ([]netip.Prefix, error) {
+	trusted := make([]netip.Prefix, 0, len(from))
+	for _, from := range from {
+		prefix, err := netip.ParsePrefix(from)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(from)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid --proxy-protocol-from: %w", err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	return trusted, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Largest chunk writeQueue writes at once.
+const writeQueueChunkSize = 4096
+
+// QueuePolicy defines what a writeQueue does when it is full.
+type QueuePolicy int
+
+const (
+	// Block writes until there is room.
+	QueueBlock QueuePolicy = iota
+	// Drop the oldest queued data to make room.
+	QueueDropOldest
+	// Fail writes.
+	QueueDisconnect
+)
+
+var queuePolicyNames = map[QueuePolicy]string{
+	QueueBlock:      "block",
+	QueueDropOldest: "drop-oldest",
+	QueueDisconnect: "disconnect",
+}
+
+// QueuePolicyValue implements pflag.Value for QueuePolicy
+type QueuePolicyValue QueuePolicy
+
+func (p *QueuePolicyValue) String() string {
+	return queuePolicyNames[QueuePolicy(*p)]
+}
+
+func (p *QueuePolicyValue) Set(s string) error {
+	for policy, name := range queuePolicyNames {
+		if strings.EqualFold(s, name) {
+			*p = QueuePolicyValue(policy)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid policy: %s", s)
+}
+
+func (p *QueuePolicyValue) Type() string {
+	return "policy"
+}
+
+var errQueueFull = errors.New("buffer full")
+
+// writeQueue decouples writes from the underlying writer: data is queued and written by a separate
+// goroutine, so that the writer side is not held up by it.
+//
+// Towards the serial port, commands following bulk data in the client stream (eg: RFC 2217 break,
+// control line or mode changes) are handled right away, instead of being stuck behind data which
+// is yet to be written. Towards clients, a slow client does not stall serial port reads.
+type writeQueue struct {
+	w      io.Writer
+	limit  int
+	policy QueuePolicy
+	// Count of bytes dropped by QueueDropOldest.
+	dropped *atomic.Uint64
+	// Called with true when the queue fills past its high watermark, and with false when it drains
+	// below its low watermark.
+	pressure func(bool)
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    []byte
+	err    error
+	closed bool
+	done   chan struct{}
+}
+
+// newWriteQueue returns a writeQueue writing to w, holding at most limit bytes. Dropped bytes are
+// counted at dropped, which may be nil unless policy is QueueDropOldest. pressure, if not nil, is
+// notified of the queue filling up and draining.
+func newWriteQueue(w io.Writer, limit int, policy QueuePolicy, dropped *atomic.Uint64, pressure func(bool)) *writeQueue {
+	q := &writeQueue{
+		w:        w,
+		limit:    limit,
+		policy:   policy,
+		dropped:  dropped,
+		pressure: pressure,
+		done:     make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+// notifyPressure calls pressure past the watermarks, at 3/4 and 1/4 of the limit.
+func (q *writeQueue) notifyPressure() {
+	if q.pressure == nil {
+		return
+	}
+	switch {
+	case len(q.buf) >= q.limit*3/4:
+		q.pressure(true)
+	case len(q.buf) <= q.limit/4:
+		q.pressure(false)
+	}
+}
+
+func (q *writeQueue) full(p []byte) bool {
+	return len(q.buf) > 0 && len(q.buf)+len(p) > q.limit
+}
+
+// Write queues p, applying the queue policy when it is full.
+func (q *writeQueue) Write(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch q.policy {
+	case QueueBlock:
+		for q.full(p) && q.err == nil {
+			q.cond.Wait()
+		}
+	case QueueDisconnect:
+		if q.full(p) {
+			return 0, errQueueFull
+		}
+	}
+	if q.err != nil {
+		return 0, q.err
+	}
+	q.buf = append(q.buf, p...)
+	if drop := len(q.buf) - q.limit; q.policy == QueueDropOldest && drop > 0 {
+		q.buf = q.buf[drop:]
+		q.dropped.Add(uint64(drop))
+	}
+	q.notifyPressure()
+	q.cond.Broadcast()
+	return len(p), nil
+}
+
+func (q *writeQueue) run() {
+	defer close(q.done)
+	chunk := make([]byte, writeQueueChunkSize)
+	for {
+		q.mu.Lock()
+		for len(q.buf) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.buf) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		n := copy(chunk, q.buf)
+		q.buf = q.buf[n:]
+		q.notifyPressure()
+		q.mu.Unlock()
+
+		_, err := q.w.Write(chunk[:n])
+
+		q.mu.Lock()
+		if err != nil {
+			q.err = err
+			q.buf = nil
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close waits for all queued data to be written, returning the error of the first failed write.
+func (q *writeQueue) Close() error {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+	return q.err
+}
+
+// Discard drops all queued data and stops the queue, without waiting for pending writes.
+func (q *writeQueue) Discard() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.buf = nil
+	q.cond.Broadcast()
+}
@@ -0,0 +1,199 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Sent by clients when opening the stream: QUIC only announces streams once data is sent on
+// them, while clients may not have anything to send until the user types.
+const quicStreamPreamble = 1
+
+// How long clients may take to open the stream, after connecting.
+const quicStreamTimeout = 10 * time.Second
+
+// How long closing waits for the peer to close the connection.
+const quicCloseTimeout = 5 * time.Second
+
+// How long dialing may take.
+const quicDialTimeout = 10 * time.Second
+
+var quicConfig = &quic.Config{
+	// Serial sessions are often idle for long.
+	KeepAlivePeriod: 10 * time.Second,
+}
+
+// quicConn is a net.Conn over the single stream of a QUIC connection.
+type quicConn struct {
+	*quic.Stream
+	conn   *quic.Conn
+	closed atomic.Bool
+}
+
+func (c *quicConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *quicConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// ServerName returns the server name the client asked for with TLS SNI.
+func (c *quicConn) ServerName() string { return c.conn.ConnectionState().TLS.ServerName }
+
+// mapError maps the peer closing the connection to io.EOF, and reads after Close to
+// net.ErrClosed, as for TCP.
+func (c *quicConn) mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if c.closed.Load() {
+		return net.ErrClosed
+	}
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) && appErr.Remote && appErr.ErrorCode == 0 {
+		return io.EOF
+	}
+	return err
+}
+
+func (c *quicConn) Read(p []byte) (int, error) {
+	n, err := c.Stream.Read(p)
+	return n, c.mapError(err)
+}
+
+func (c *quicConn) Write(p []byte) (int, error) {
+	n, err := c.Stream.Write(p)
+	return n, c.mapError(err)
+}
+
+// CloseWrite closes the sending side of the stream, which the peer reads as EOF.
+func (c *quicConn) CloseWrite() error {
+	return c.Stream.Close()
+}
+
+// Close closes the stream, unblocking reads. The connection is closed once the peer closes it in
+// turn, or after a timeout, so that buffered data is delivered.
+func (c *quicConn) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	// Closing only fails for streams canceled by the peer, which are over anyway.
+	c.Stream.Close()
+	c.Stream.CancelRead(0)
+	go func() {
+		timer := time.NewTimer(quicCloseTimeout)
+		defer timer.Stop()
+		select {
+		case <-c.conn.Context().Done():
+		case <-timer.C:
+		}
+		c.conn.CloseWithError(0, "")
+	}()
+	return nil
+}
+
+// quicListener is a net.Listener accepting QUIC connections. Connections are set up in the
+// background, so clients which are slow to open their stream do not hold up others.
+type quicListener struct {
+	listener *quic.Listener
+	conns    chan net.Conn
+	done     chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// listenQUIC listens for QUIC connections on address.
+func listenQUIC(address string, tlsConfig *tls.Config) (net.Listener, error) {
+	listener, err := quic.ListenAddr(address, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %s: %w", address, err)
+	}
+	l := &quicListener{listener: listener, conns: make(chan net.Conn), done: make(chan struct{})}
+	go l.run()
+	return l, nil
+}
+
+func (l *quicListener) run() {
+	for {
+		conn, err := l.listener.Accept(context.Background())
+		if err != nil {
+			l.mu.Lock()
+			l.err = err
+			l.mu.Unlock()
+			close(l.done)
+			return
+		}
+		go l.setup(conn)
+	}
+}
+
+// setup waits for the client to open its stream, and hands it to Accept.
+func (l *quicListener) setup(conn *quic.Conn) {
+	ctx, cancel := context.WithTimeout(conn.Context(), quicStreamTimeout)
+	defer cancel()
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		conn.CloseWithError(1, "no stream")
+		return
+	}
+	preamble := make([]byte, 1)
+	stream.SetReadDeadline(time.Now().Add(quicStreamTimeout))
+	if _, err := io.ReadFull(stream, preamble); err != nil || preamble[0] != quicStreamPreamble {
+		conn.CloseWithError(1, "invalid preamble")
+		return
+	}
+	stream.SetReadDeadline(time.Time{})
+	select {
+	case l.conns <- &quicConn{Stream: stream, conn: conn}:
+	case <-l.done:
+		conn.CloseWithError(0, "")
+	}
+}
+
+func (l *quicListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if errors.Is(l.err, quic.ErrServerClosed) {
+			return nil, net.ErrClosed
+		}
+		return nil, l.err
+	}
+}
+
+func (l *quicListener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *quicListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// dialQUIC connects to address over QUIC.
+func dialQUIC(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), quicDialTimeout)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, address, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open stream: %w", err), conn.CloseWithError(0, ""))
+	}
+	if _, err := stream.Write([]byte{quicStreamPreamble}); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open stream: %w", err), conn.CloseWithError(0, ""))
+	}
+	return &quicConn{Stream: stream, conn: conn}, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Capture directions.
+const (
+	captureToClient = "to-client"
+	captureToPort   = "to-port"
+)
+
+// Replacement for redacted data.
+var redactedMask = []byte("[REDACTED]")
+
+// LinePolicy defines how line framed processing handles lines longer than the maximum line
+// length, which bounds how much memory is used buffering a line.
+type LinePolicy int
+
+const (
+	// Split long lines, processing each part as a line.
+	LineSplit LinePolicy = iota
+	// Process the start of long lines, discarding the remainder.
+	LineTruncate
+	// Pass long lines through raw, without processing.
+	LineRaw
+)
+
+var linePolicyNames = map[LinePolicy]string{
+	LineSplit:    "split",
+	LineTruncate: "truncate",
+	LineRaw:      "raw",
+}
+
+// LinePolicyValue implements pflag.Value for LinePolicy
+type LinePolicyValue LinePolicy
+
+func (p *LinePolicyValue) String() string {
+	return linePolicyNames[LinePolicy(*p)]
+}
+
+func (p *LinePolicyValue) Set(s string) error {
+	for policy, name := range linePolicyNames {
+		if strings.EqualFold(s, name) {
+			*p = LinePolicyValue(policy)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid line policy: %s", s)
+}
+
+func (p *LinePolicyValue) Type() string {
+	return "policy"
+}
+
+// redactor applies redaction rules to capture data, line by line.
+type redactor struct {
+	// Matches are masked in both directions. When a pattern has subexpressions, only those are
+	// masked.
+	patterns []*regexp.Regexp
+	// When data sent to the client matches any of these, the next input line sent to the port
+	// is masked entirely (eg: after a "Password:" prompt).
+	inputAfter []*regexp.Regexp
+
+	// Lines longer than maxLineLength are handled according to linePolicy.
+	maxLineLength int
+	linePolicy    LinePolicy
+
+	buffers map[string][]byte
+	// Whether the remainder of a long line is being truncated or passed through raw.
+	longLine      map[string]bool
+	maskNextInput bool
+	recordLineFn  func(direction string, line []byte) error
+}
+
+func compilePatterns(values []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(values))
+	for _, value := range values {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern: %w", err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func newRedactor(
+	patterns, inputAfter []*regexp.Regexp,
+	maxLineLength int, linePolicy LinePolicy,
+	recordLineFn func(direction string, line []byte) error,
+) *redactor {
+	return &redactor{
+		patterns:      patterns,
+		inputAfter:    inputAfter,
+		maxLineLength: maxLineLength,
+		linePolicy:    linePolicy,
+		buffers:       map[string][]byte{},
+		longLine:      map[string]bool{},
+		recordLineFn:  recordLineFn,
+	}
+}
+
+func maskPattern(pattern *regexp.Regexp, line []byte) []byte {
+	if pattern.NumSubexp() == 0 {
+		return pattern.ReplaceAllLiteral(line, redactedMask)
+	}
+	var masked []byte
+	last := 0
+	for _, match := range pattern.FindAllSubmatchIndex(line, -1) {
+		for i := 2; i < len(match); i += 2 {
+			if match[i] < last {
+				continue
+			}
+			masked = append(masked, line[last:match[i]]...)
+			masked = append(masked, redactedMask...)
+			last = match[i+1]
+		}
+	}
+	return append(masked, line[last:]...)
+}
+
+func (r *redactor) redactLine(direction string, line []byte) []byte {
+	if direction == captureToPort && r.maskNextInput {
+		r.maskNextInput = false
+		content := bytes.TrimRight(line, "\r\n")
+		return append(append([]byte{}, redactedMask...), line[len(content):]...)
+	}
+	for _, pattern := range r.patterns {
+		line = maskPattern(pattern, line)
+	}
+	return line
+}
+
+func (r *redactor) promptMatches(data []byte) bool {
+	for _, pattern := range r.inputAfter {
+		if pattern.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) flushLine(direction string, line []byte) error {
+	if err := r.recordLineFn(direction, r.redactLine(direction, line)); err != nil {
+		return err
+	}
+	if direction == captureToClient && r.promptMatches(line) {
+		// Input typed before the prompt is not a response to it.
+		if pending := r.buffers[captureToPort]; len(pending) > 0 {
+			r.buffers[captureToPort] = nil
+			if err := r.recordLineFn(captureToPort, r.redactLine(captureToPort, pending)); err != nil {
+				return err
+			}
+		}
+		r.maskNextInput = true
+	}
+	return nil
+}
+
+// flushLongLine handles a line longer than the maximum line length according to the line policy.
+// complete tells whether line ends with a line terminator. Any part of line left to be buffered is
+// returned.
+func (r *redactor) flushLongLine(direction string, line []byte, complete bool) ([]byte, error) {
+	switch r.linePolicy {
+	case LineTruncate:
+		r.longLine[direction] = !complete
+		return nil, r.flushLine(direction, line[:r.maxLineLength])
+	case LineRaw:
+		r.longLine[direction] = !complete
+		return nil, r.recordLineFn(direction, line)
+	default:
+		for len(line) > r.maxLineLength {
+			if err := r.flushLine(direction, line[:r.maxLineLength]); err != nil {
+				return nil, err
+			}
+			line = line[r.maxLineLength:]
+		}
+		if complete {
+			return nil, r.flushLine(direction, line)
+		}
+		return line, nil
+	}
+}
+
+// flushLongLineRemainder handles the start of buf, up to a line terminator, as the remainder of
+// a long line, returning the rest.
+func (r *redactor) flushLongLineRemainder(direction string, buf []byte) ([]byte, error) {
+	end := len(buf)
+	if i := bytes.IndexAny(buf, "\r\n"); i >= 0 {
+		end = i + 1
+		r.longLine[direction] = false
+	}
+	if r.linePolicy == LineRaw {
+		if err := r.recordLineFn(direction, buf[:end]); err != nil {
+			return nil, err
+		}
+	}
+	return buf[end:], nil
+}
+
+// Write buffers data transferred in direction, recording each complete line after redaction.
+func (r *redactor) Write(direction string, data []byte) (err error) {
+	buf := append(r.buffers[direction], data...)
+	if r.longLine[direction] {
+		if buf, err = r.flushLongLineRemainder(direction, buf); err != nil {
+			return err
+		}
+	}
+	for {
+		i := bytes.IndexAny(buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := buf[:i+1]
+		if len(line) > r.maxLineLength {
+			_, err = r.flushLongLine(direction, line, true)
+		} else {
+			err = r.flushLine(direction, line)
+		}
+		if err != nil {
+			return err
+		}
+		buf = buf[i+1:]
+	}
+	if len(buf) > r.maxLineLength {
+		if buf, err = r.flushLongLine(direction, buf, false); err != nil {
+			return err
+		}
+	}
+	// Prompts are usually not followed by a line terminator.
+	if direction == captureToClient && len(buf) > 0 && r.promptMatches(buf) {
+		if err := r.flushLine(direction, buf); err != nil {
+			return err
+		}
+		buf = nil
+	}
+	r.buffers[direction] = append([]byte{}, buf...)
+	return nil
+}
+
+// Flush records any buffered partial lines.
+func (r *redactor) Flush() error {
+	for _, direction := range []string{captureToPort, captureToClient} {
+		if len(r.buffers[direction]) == 0 {
+			continue
+		}
+		if err := r.flushLine(direction, r.buffers[direction]); err != nil {
+			return err
+		}
+		r.buffers[direction] = nil
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+)
+
+var clientListen string
+var clientListenDefault = ""
+
+// relay copies data between local and remote until both directions end, propagating half
+// closes, or until one fails or ctx is done.
+func relay(ctx context.Context, local, remote net.Conn) error {
+	errCh := make(chan error, 2)
+	copyHalf := func(dst, src net.Conn) {
+		_, err := copyContext(ctx, dst, src)
+		if err == nil {
+			err = closeWrite(dst)
+		}
+		errCh <- err
+	}
+	go copyHalf(remote, local)
+	go copyHalf(local, remote)
+
+	var err error
+	pending := 2
+wait:
+	for pending > 0 {
+		select {
+		case err = <-errCh:
+			pending--
+			if err != nil {
+				break wait
+			}
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	err = errors.Join(err, local.Close(), remote.Close())
+	// Closing unblocks the other direction, failing it.
+	for ; pending > 0; pending-- {
+		<-errCh
+	}
+	return err
+}
+
+// relayConn connects local to the server with dial.
+func relayConn(ctx context.Context, local net.Conn, dial func() (net.Conn, error)) {
+	ctx, logger := log.MustWithAttrs(ctx, "local", local.RemoteAddr())
+	logger.Info("Accepted, connecting to server")
+	remote, err := dial()
+	if err != nil {
+		logger.Error("Failed to connect to server", "error", errors.Join(err, local.Close()))
+		return
+	}
+	if err := relay(ctx, local, remote); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Error("Failed to relay", "error", err)
+		return
+	}
+	logger.Info("Closed")
+}
+
+// runClientRelay listens on --listen, relaying each connection to its own connection to the
+// server, until interrupted.
+func runClientRelay(cmd *cobra.Command, args []string) (err error) {
+	ctx, logger := log.MustWithAttrs(cmd.Context(), "address", clientAddress, "listen", clientListen)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", clientListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	logger.Info("Listening", "local-address", listener.Addr())
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept: %w", err)
+		}
+		go relayConn(ctx, local, clientDial)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// reloadConfigOnSignal reloads the config file on every SIGHUP, until ctx is done.
+func reloadConfigOnSignal(ctx context.Context, reloader *configReloader, target *reloadTarget) {
+	logger := log.MustLogger(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			logger.Info("Reloading config file", "path", reloader.path)
+			reloaded, restart, err := reloader.reload(target)
+			if len(reloaded) > 0 {
+				logger.Info("Reloaded config file", "flags", reloaded)
+			}
+			if len(restart) > 0 {
+				logger.Warn("Config file changes take effect on restart", "flags", restart)
+			}
+			if err != nil {
+				logger.Error("Failed to reload config file", "error", err)
+			}
+		}
+	}
+}
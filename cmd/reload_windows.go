@@ -0,0 +1,7 @@
+package main
+
+import "context"
+
+// reloadConfigOnSignal does nothing, as there is no SIGHUP on Windows: restart to apply config
+// file changes instead.
+func reloadConfigOnSignal(ctx context.Context, reloader *configReloader, target *reloadTarget) {}
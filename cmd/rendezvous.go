@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/mux"
+)
+
+var rendezvousAddress string
+var rendezvousAddressDefault = ":7000"
+
+var rendezvousServerSecrets string
+var rendezvousServerSecretsDefault = ""
+
+var rendezvousClientTokens string
+var rendezvousClientTokensDefault = ""
+
+// Allows a client token to reach any server.
+const anyServerID = "*"
+
+// readCredentials reads a file of lines of a word followed by the words it goes with, ignoring
+// blank lines and lines starting with #.
+func readCredentials(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	credentials := map[string][]string{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected at least two words", path, lineNumber)
+		}
+		credentials[fields[0]] = append(credentials[fields[0]], fields[1:]...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// rendezvous pairs clients with the servers registered with it by ID, see serve --connect.
+type rendezvous struct {
+	// Secret of each server ID allowed to register.
+	serverSecrets map[string]string
+	// IDs of the servers each client token may reach, or nil when clients need no token.
+	clientTokens map[string][]string
+
+	mu sync.Mutex
+	// Multiplexed connection of each registered server.
+	servers map[string]*mux.Session
+}
+
+// newRendezvous returns the rendezvous of the relay flags.
+func newRendezvous() (*rendezvous, error) {
+	r := &rendezvous{serverSecrets: map[string]string{}, servers: map[string]*mux.Session{}}
+	secrets, err := readCredentials(rendezvousServerSecrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server secrets: %w", err)
+	}
+	// Read as "ID SECRET" lines.
+	for id, values := range secrets {
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%s: expected one secret for %s", rendezvousServerSecrets, id)
+		}
+		r.serverSecrets[id] = values[0]
+	}
+	if rendezvousClientTokens != "" {
+		r.clientTokens, err = readCredentials(rendezvousClientTokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client tokens: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// authenticateServer returns whether secret is the one of the server of id.
+func (r *rendezvous) authenticateServer(id, secret string) bool {
+	expected, ok := r.serverSecrets[id]
+	return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(secret)) == 1
+}
+
+// authorizeClient returns whether the client with token may reach the server of id.
+func (r *rendezvous) authorizeClient(token, id string) bool {
+	if r.clientTokens == nil {
+		return true
+	}
+	ids := r.clientTokens[token]
+	return slices.Contains(ids, id) || slices.Contains(ids, anyServerID)
+}
+
+// register serves the server of id over session until it is lost, replacing the connection it
+// registered before, if any, which is likely gone with a NAT mapping.
+func (r *rendezvous) register(ctx context.Context, id string, session *mux.Session) {
+	logger := log.MustLogger(ctx)
+	r.mu.Lock()
+	previous := r.servers[id]
+	r.servers[id] = session
+	r.mu.Unlock()
+	if previous != nil {
+		logger.Info("Replacing previous registration")
+		_ = previous.Close()
+	}
+	logger.Info("Registered")
+	select {
+	case <-session.Done():
+	case <-ctx.Done():
+		_ = session.Close()
+	}
+	r.mu.Lock()
+	if r.servers[id] == session {
+		delete(r.servers, id)
+	}
+	r.mu.Unlock()
+	logger.Info("Unregistered")
+}
+
+// open opens a connection to target, the ID of a registered server, followed by /NAME for its
+// named port NAME, for the client with token.
+func (r *rendezvous) open(token, target string) (net.Conn, error) {
+	id, name, _ := strings.Cut(target, "/")
+	if !r.authorizeClient(token, id) {
+		return nil, fmt.Errorf("not authorized: %s", id)
+	}
+	r.mu.Lock()
+	session, ok := r.servers[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("not registered: %s", id)
+	}
+	return session.Open(name)
+}
+
+// handleConnection serves conn, either a server registering or, after sending its token, if
+// needed, a client asking for a server with an OPEN or MUX request, as when serving --named-port.
+func (r *rendezvous) handleConnection(ctx context.Context, conn net.Conn) error {
+	buffered, line, err := readPortRequest(conn)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 0 && fields[0] == registerRequest {
+		return r.handleRegister(ctx, buffered, fields[1:])
+	}
+	var token string
+	if r.clientTokens != nil {
+		token = strings.TrimSpace(line)
+		if buffered, line, err = readPortRequest(buffered); err != nil {
+			return err
+		}
+	}
+	request := strings.TrimSpace(line)
+	switch {
+	case request == muxRequest:
+		return r.serveMux(ctx, buffered, token)
+	case strings.HasPrefix(request, openRequest+" "):
+		target := strings.TrimSpace(strings.TrimPrefix(request, openRequest))
+		ctx, logger := log.MustWithAttrs(ctx, "target", target)
+		remote, err := r.open(token, target)
+		if err != nil {
+			logger.Info("Refusing connection", "reason", err)
+			_, writeErr := fmt.Fprintf(buffered, "ERROR %s\r\n", err)
+			return errors.Join(writeErr, buffered.Close())
+		}
+		if err := relay(ctx, buffered, remote); !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		return nil
+	}
+	_, err = fmt.Fprintf(buffered, "ERROR expected %s ID or %s\r\n", openRequest, muxRequest)
+	return errors.Join(fmt.Errorf("invalid request: %q", line), err, buffered.Close())
+}
+
+// handleRegister serves the server registering over conn with args, its ID and secret.
+func (r *rendezvous) handleRegister(ctx context.Context, conn net.Conn, args []string) error {
+	var id, secret string
+	if len(args) > 0 {
+		id = args[0]
+	}
+	if len(args) > 1 {
+		secret = args[1]
+	}
+	ctx, logger := log.MustWithAttrs(ctx, "id", id)
+	if len(args) != 2 || !r.authenticateServer(id, secret) {
+		logger.Warn("Refusing registration, wrong ID or secret")
+		_, err := fmt.Fprintf(conn, "ERROR wrong ID or secret\n")
+		return errors.Join(err, conn.Close())
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", registerOK); err != nil {
+		return errors.Join(err, conn.Close())
+	}
+	r.register(ctx, id, mux.Client(conn))
+	return nil
+}
+
+// serveMux relays the streams multiplexed over conn by the client with token, each to the target
+// it is opened to, until conn fails or ctx is done.
+func (r *rendezvous) serveMux(ctx context.Context, conn net.Conn, token string) error {
+	session := mux.Server(conn)
+	stop := context.AfterFunc(ctx, func() { _ = session.Close() })
+	defer stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			_ = session.Close()
+			return nil
+		}
+		wg.Go(func() {
+			ctx, logger := log.MustWithAttrs(ctx, "target", stream.Name())
+			remote, err := r.open(token, stream.Name())
+			if err != nil {
+				logger.Info("Refusing stream", "reason", err)
+				if err := stream.Refuse(err.Error()); err != nil {
+					logger.Debug("Failed to refuse stream", "error", err)
+				}
+				return
+			}
+			if err := stream.Confirm(); err != nil {
+				logger.Error("Failed to accept stream", "error", errors.Join(err, remote.Close()))
+				return
+			}
+			if err := relay(ctx, stream, remote); err != nil && !errors.Is(err, net.ErrClosed) {
+				logger.Error("Failed to relay", "error", err)
+			}
+		})
+	}
+}
+
+var RelayCmd = &cobra.Command{
+	Use:   "relay",
+	Short: "Pair clients with servers connecting out to it.",
+	Long:  "Accepts servers registering with serve --connect and --id, such as from behind NAT, and clients asking for them by ID, relaying between them, so that a fleet of servers can be reached centrally. Clients ask for a server by sending OPEN ID as their first line, or over a multiplexed connection with client --port ID, followed by /NAME for named ports of servers running with --named-port (eg: client --address relay.example.com:7000 --port lab-bench-3).",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx, logger := log.MustWithAttrs(
+			cmd.Context(),
+			"address", rendezvousAddress,
+			"server-secrets", rendezvousServerSecrets,
+			"client-tokens", rendezvousClientTokens,
+		)
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		logger.Info("Running")
+
+		r, err := newRendezvous()
+		if err != nil {
+			return err
+		}
+		if r.clientTokens == nil {
+			logger.Warn("No --client-tokens, any client can reach registered servers")
+		}
+
+		listener, err := listen(rendezvousAddress)
+		if err != nil {
+			return err
+		}
+		stopListening := context.AfterFunc(ctx, func() { _ = listener.Close() })
+		defer stopListening()
+		logger.Info("Listening", "local-address", listener.Addr())
+
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		acceptor := newListenerAcceptor(listener)
+		for {
+			conn, err := acceptor.Accept(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					logger.Info("Stopped")
+					return nil
+				}
+				return err
+			}
+			ctx, logger := log.MustWithGroupAttrs(ctx, "Connection", "RemoteAddr", conn.RemoteAddr())
+			wg.Go(func() {
+				if err := r.handleConnection(ctx, conn); err != nil {
+					logger.Error("Failed to handle connection", "error", err)
+				}
+			})
+		}
+	}),
+}
+
+func init() {
+	RelayCmd.PersistentFlags().StringVarP(&rendezvousAddress, "address", "a", rendezvousAddressDefault, "Address to listen on for servers and clients: host:port for TCP or unix:///path for a Unix domain socket")
+	RelayCmd.PersistentFlags().StringVarP(&rendezvousServerSecrets, "server-secrets", "", rendezvousServerSecretsDefault, "File of the servers allowed to register, one \"ID SECRET\" per line, with SECRET as in their --connect-secret-file")
+	if err := RelayCmd.MarkPersistentFlagRequired("server-secrets"); err != nil {
+		panic(err)
+	}
+	RelayCmd.PersistentFlags().StringVarP(&rendezvousClientTokens, "client-tokens", "", rendezvousClientTokensDefault, "File of the tokens clients authenticate with, sending them as their first line, as client --token does, one \"TOKEN ID...\" per line, listing the server IDs the token reaches, or * for all of them; without it, any client can reach registered servers")
+
+	RootCmd.AddCommand(RelayCmd)
+}
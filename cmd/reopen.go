@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/rfc2217"
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var reopenTimeout time.Duration
+var reopenTimeoutDefault = time.Duration(0)
+
+// How often reopenPort tries opening the serial port again.
+const reopenInterval = 500 * time.Millisecond
+
+// reopenPort is a serial port opened again when its device goes away, such as USB adapters
+// unplugged, or gone across sleep and wake, for sessions to carry on once it is back. Reads and
+// writes failing as the device went away wait until it opens again, for up to timeout, with the
+// mode, modem lines and read timeout last set, and then carry on.
+type reopenPort struct {
+	ctx     context.Context
+	open    func(mode *serial.Mode) (serialport.Port, error)
+	timeout time.Duration
+	// Closed by Close, ending reopening.
+	closed    chan struct{}
+	closeOnce sync.Once
+	// Held while reopening, so that reads and writes failing together reopen once.
+	reopenMu sync.Mutex
+
+	mu   sync.Mutex
+	port serialport.Port
+	// Incremented each time the port is opened again.
+	generation  int
+	mode        serial.Mode
+	dtr, rts    *bool
+	readTimeout *time.Duration
+}
+
+// newReopenPort returns port, opened with open for mode, to be opened again with open for up to
+// timeout when its device goes away.
+func newReopenPort(ctx context.Context, port serialport.Port, mode *serial.Mode, timeout time.Duration, open func(mode *serial.Mode) (serialport.Port, error)) *reopenPort {
+	return &reopenPort{
+		ctx:     ctx,
+		open:    open,
+		timeout: timeout,
+		closed:  make(chan struct{}),
+		port:    port,
+		mode:    *mode,
+	}
+}
+
+// current returns the port in use, and how many times it was opened again.
+func (p *reopenPort) current() (serialport.Port, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.port, p.generation
+}
+
+// retry tells whether an operation on the port of generation which failed with err is to be
+// retried, on the port opened again.
+func (p *reopenPort) retry(generation int, err error) bool {
+	if _, current := p.current(); current != generation {
+		// Failed as it was closed, after being opened again.
+		return true
+	}
+	if !errors.Is(serialport.DeviceGone(err), serialport.ErrDeviceGone) {
+		return false
+	}
+	return p.reopen(generation, err) == nil
+}
+
+// reopen opens the port of generation again, failing with err once the port is closed or timeout
+// passes, unless it was already opened again.
+func (p *reopenPort) reopen(generation int, err error) error {
+	p.reopenMu.Lock()
+	defer p.reopenMu.Unlock()
+	if _, current := p.current(); current != generation {
+		return nil
+	}
+	logger := log.MustLogger(p.ctx)
+	logger.Warn("Serial port device removed, reopening", "error", err, "reopen-timeout", p.timeout)
+	deadline := time.Now().Add(p.timeout)
+	for {
+		select {
+		case <-p.closed:
+			return err
+		case <-time.After(reopenInterval):
+		}
+		openErr := p.replace()
+		if openErr == nil {
+			logger.Info("Serial port reopened")
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			logger.Warn("Serial port not back in time", "error", openErr)
+			return err
+		}
+		logger.Debug("Failed to reopen serial port", "error", openErr)
+	}
+}
+
+// replace opens the port again, restoring what was last set, and closes the one it replaces.
+func (p *reopenPort) replace() error {
+	p.mu.Lock()
+	mode := p.mode
+	p.mu.Unlock()
+	port, err := p.open(&mode)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+		return errors.Join(errors.New("closed while reopening"), port.Close())
+	default:
+	}
+	if err := p.restore(port); err != nil {
+		return errors.Join(err, port.Close())
+	}
+	if err := p.port.Close(); err != nil {
+		log.MustLogger(p.ctx).Debug("Failed to close removed serial port", "error", err)
+	}
+	p.port = port
+	p.generation++
+	return nil
+}
+
+// restore sets the modem lines and read timeout last set on port.
+func (p *reopenPort) restore(port serialport.Port) error {
+	if p.dtr != nil {
+		if err := port.SetDTR(*p.dtr); err != nil {
+			return err
+		}
+	}
+	if p.rts != nil {
+		if err := port.SetRTS(*p.rts); err != nil {
+			return err
+		}
+	}
+	if p.readTimeout != nil {
+		if err := port.SetReadTimeout(*p.readTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *reopenPort) Read(b []byte) (int, error) {
+	for {
+		port, generation := p.current()
+		n, err := port.Read(b)
+		if err == nil || n > 0 {
+			return n, err
+		}
+		if !p.retry(generation, err) {
+			return n, err
+		}
+	}
+}
+
+func (p *reopenPort) Write(b []byte) (int, error) {
+	written := 0
+	for {
+		port, generation := p.current()
+		n, err := port.Write(b[written:])
+		written += n
+		if err == nil || !p.retry(generation, err) {
+			return written, err
+		}
+	}
+}
+
+func (p *reopenPort) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.port.Close()
+}
+
+func (p *reopenPort) SetMode(mode *serial.Mode) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.port.SetMode(mode); err != nil {
+		return err
+	}
+	p.mode = *mode
+	return nil
+}
+
+func (p *reopenPort) Drain() error {
+	port, _ := p.current()
+	return port.Drain()
+}
+
+func (p *reopenPort) ResetInputBuffer() error {
+	port, _ := p.current()
+	return port.ResetInputBuffer()
+}
+
+func (p *reopenPort) ResetOutputBuffer() error {
+	port, _ := p.current()
+	return port.ResetOutputBuffer()
+}
+
+func (p *reopenPort) SetDTR(dtr bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.port.SetDTR(dtr); err != nil {
+		return err
+	}
+	p.dtr = &dtr
+	return nil
+}
+
+func (p *reopenPort) SetRTS(rts bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.port.SetRTS(rts); err != nil {
+		return err
+	}
+	p.rts = &rts
+	return nil
+}
+
+func (p *reopenPort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	port, _ := p.current()
+	return port.GetModemStatusBits()
+}
+
+func (p *reopenPort) SetReadTimeout(t time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.port.SetReadTimeout(t); err != nil {
+		return err
+	}
+	p.readTimeout = &t
+	return nil
+}
+
+func (p *reopenPort) Break(duration time.Duration) error {
+	port, _ := p.current()
+	return port.Break(duration)
+}
+
+// SetBreak starts or ends a break on the port in use, if it can, see serialport.BreakSetter.
+func (p *reopenPort) SetBreak(on bool) error {
+	port, _ := p.current()
+	setter, ok := port.(serialport.BreakSetter)
+	if !ok {
+		return rfc2217.ErrBreakUnsupported
+	}
+	return setter.SetBreak(on)
+}
+
+// Fd returns the file descriptor of the port in use, see serialport.Descriptor, or ^uintptr(0),
+// which is not valid, if it has none.
+func (p *reopenPort) Fd() uintptr {
+	port, _ := p.current()
+	descriptor, ok := port.(serialport.Descriptor)
+	if !ok {
+		return ^uintptr(0)
+	}
+	return descriptor.Fd()
+}
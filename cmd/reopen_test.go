@@ -0,0 +1,154 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kotaira/go-serial"
+	"golang.org/x/sys/unix"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// removableMock is a mock serial port which fails reads and writes as local serial ports do once
+// their device is removed.
+type removableMock struct {
+	*serialport.Mock
+	removed atomic.Bool
+}
+
+// remove fails reads and writes, including reads in progress.
+func (m *removableMock) remove() {
+	m.removed.Store(true)
+	m.Mock.Close()
+}
+
+func (m *removableMock) Read(p []byte) (int, error) {
+	n, err := m.Mock.Read(p)
+	if m.removed.Load() {
+		return 0, unix.ENXIO
+	}
+	return n, err
+}
+
+func (m *removableMock) Write(p []byte) (int, error) {
+	if m.removed.Load() {
+		return 0, unix.ENXIO
+	}
+	return m.Mock.Write(p)
+}
+
+// readAsync reads from port in the background, returning the channel its outcome is sent to.
+func readAsync(port serialport.Port) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 16)
+		n, err := port.Read(buf)
+		if err == nil && string(buf[:n]) != "back" {
+			err = errors.New("unexpected data: " + string(buf[:n]))
+		}
+		errs <- err
+	}()
+	return errs
+}
+
+// waitRead waits for the outcome of readAsync, failing t if it does not come in time.
+func waitRead(t *testing.T, errs <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("read did not return")
+		return nil
+	}
+}
+
+func TestReopenPort(t *testing.T) {
+	ctx := testContext(t)
+	mode := &serial.Mode{BaudRate: 9600, DataBits: 8}
+	removed := &removableMock{Mock: serialport.NewMock(mode)}
+	reopened := serialport.NewMock(mode)
+	var opens atomic.Int32
+	port := newReopenPort(ctx, removed, mode, time.Minute, func(mode *serial.Mode) (serialport.Port, error) {
+		// The device is back on the second attempt.
+		if opens.Add(1) < 2 {
+			return nil, unix.ENOENT
+		}
+		if err := reopened.SetMode(mode); err != nil {
+			return nil, err
+		}
+		return reopened, nil
+	})
+	defer port.Close()
+
+	changed := &serial.Mode{BaudRate: 115200, DataBits: 7}
+	if err := port.SetMode(changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := port.SetDTR(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := port.SetRTS(false); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := readAsync(port)
+	removed.remove()
+	// Written while reopening, once the device is back.
+	if _, err := port.Write([]byte("back")); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitRead(t, errs); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := opens.Load(); got != 2 {
+		t.Errorf("expected 2 attempts to open, got %d", got)
+	}
+	if got := reopened.Mode(); got != *changed {
+		t.Errorf("expected mode %+v, got %+v", *changed, got)
+	}
+	if !reopened.DTR() || reopened.RTS() {
+		t.Errorf("expected DTR set and RTS cleared, got DTR %v, RTS %v", reopened.DTR(), reopened.RTS())
+	}
+}
+
+func TestReopenPortTimeout(t *testing.T) {
+	ctx := testContext(t)
+	mode := &serial.Mode{BaudRate: 9600, DataBits: 8}
+	removed := &removableMock{Mock: serialport.NewMock(mode)}
+	port := newReopenPort(ctx, removed, mode, time.Millisecond, func(mode *serial.Mode) (serialport.Port, error) {
+		return nil, unix.ENOENT
+	})
+	defer port.Close()
+
+	errs := readAsync(port)
+	removed.remove()
+	if err := waitRead(t, errs); !errors.Is(err, unix.ENXIO) {
+		t.Fatalf("expected the device removed error, got %v", err)
+	}
+}
+
+func TestReopenPortClose(t *testing.T) {
+	ctx := testContext(t)
+	mode := &serial.Mode{BaudRate: 9600, DataBits: 8}
+	removed := &removableMock{Mock: serialport.NewMock(mode)}
+	port := newReopenPort(ctx, removed, mode, time.Minute, func(mode *serial.Mode) (serialport.Port, error) {
+		return nil, unix.ENOENT
+	})
+
+	errs := readAsync(port)
+	removed.remove()
+	time.Sleep(2 * reopenInterval)
+	if err := port.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitRead(t, errs); !errors.Is(err, unix.ENXIO) {
+		t.Fatalf("expected the device removed error, got %v", err)
+	}
+}
@@ -41,8 +41,12 @@ var RootCmd = &cobra.Command{
 			}
 		})
 
-		logger := slogxtCobra.GetLogger(cmd.OutOrStderr()).
-			WithGroup(getCmdChainStr(cmd))
+		logger, err := getLogger(cmd)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s\n", err)
+			Exit(1)
+		}
+		logger = logger.WithGroup(getCmdChainStr(cmd))
 		ctx := log.WithLogger(cmd.Context(), logger)
 		cmd.SetContext(ctx)
 	},
@@ -67,4 +71,12 @@ func ResetFlags() {
 
 func init() {
 	slogxtCobra.AddLoggerFlags(RootCmd)
+	RootCmd.PersistentFlags().VarP(&logOutput, "log-output", "", "Where to write logs: stderr, with --log-handler; syslog, to --log-syslog-address; or journald, with the native protocol; for syslog and journald, log levels map to severities, and records are formatted as text")
+	RootCmd.PersistentFlags().VarP(&logSyslogFacility, "log-syslog-facility", "", "Syslog facility of logs, for --log-output syslog or journald (kern, user, mail, daemon, auth, syslog, lpr, news, uucp, cron, authpriv, ftp or local0 to local7)")
+	RootCmd.PersistentFlags().StringVarP(&logSyslogTag, "log-syslog-tag", "", logSyslogTagDefault, "Syslog tag, or journald identifier, of logs, for --log-output syslog or journald")
+	RootCmd.PersistentFlags().StringVarP(&logSyslogAddress, "log-syslog-address", "", logSyslogAddressDefault, "Syslog daemon to send logs to, for --log-output syslog: local, or udp://host:port, tcp://host:port or unix:///path")
+	RootCmd.PersistentFlags().StringVarP(&logFile, "log-file", "", logFileDefault, "Also write logs to this file, as JSON")
+	RootCmd.PersistentFlags().Int64VarP(&logFileMaxSize, "log-file-max-size", "", logFileMaxSizeDefault, "Rotate the log file once it grows past this many bytes; 0 disables")
+	RootCmd.PersistentFlags().DurationVarP(&logFileMaxAge, "log-file-max-age", "", logFileMaxAgeDefault, "Rotate the log file once it has been written to for this long; 0 disables")
+	RootCmd.PersistentFlags().IntVarP(&logFileMaxBackups, "log-file-max-backups", "", logFileMaxBackupsDefault, "Rotated log files to keep; 0 keeps all")
 }
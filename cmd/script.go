@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/expect"
+)
+
+var clientScript string
+var clientScriptDefault = ""
+
+var clientScriptVars []string
+var clientScriptVarsDefault = []string{}
+
+var clientSend string
+var clientSendDefault = ""
+
+var clientExpect string
+var clientExpectDefault = ""
+
+var clientTimeout time.Duration
+var clientTimeoutDefault = expect.DefaultTimeout
+
+// Exit status of one shot commands and scripts when expect times out, telling it apart from
+// failures.
+const clientTimeoutExitStatus = 2
+
+// parseScriptVars parses script variables given as NAME=VALUE.
+func parseScriptVars(values []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, value := range values {
+		name, v, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid script variable, expected NAME=VALUE: %s", value)
+		}
+		vars[name] = v
+	}
+	return vars, nil
+}
+
+// runClientScript runs --script against the server, writing the device output to standard output.
+func runClientScript(cmd *cobra.Command, args []string) (err error) {
+	ctx, logger := log.MustWithAttrs(cmd.Context(), "address", clientAddress, "script", clientScript)
+
+	script, err := expect.ParseFile(clientScript)
+	if err != nil {
+		return err
+	}
+	vars, err := parseScriptVars(clientScriptVars)
+	if err != nil {
+		return err
+	}
+
+	conn, err := clientDial()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, conn.Close()) }()
+
+	logger.Info("Running script")
+	if err := script.Run(ctx, conn, cmd.OutOrStdout(), cmd.ErrOrStderr(), vars); err != nil {
+		return fmt.Errorf("%s: %w", clientScript, err)
+	}
+	return nil
+}
+
+// runClientOneShot sends --send, then waits for --expect, if given, or else for --timeout, writing
+// the device output to standard output.
+func runClientOneShot(cmd *cobra.Command, args []string) (err error) {
+	ctx, logger := log.MustWithAttrs(
+		cmd.Context(),
+		"address", clientAddress,
+		"send", clientSend,
+		"expect", clientExpect,
+		"timeout", clientTimeout,
+	)
+
+	send, err := strconv.Unquote(`"` + clientSend + `"`)
+	if err != nil {
+		return fmt.Errorf("invalid send: %#v: %w", clientSend, err)
+	}
+	script := &expect.Script{}
+	if send != "" {
+		script.Send(send)
+	}
+	if clientExpect != "" {
+		if err := script.Expect(clientExpect, clientTimeout); err != nil {
+			return fmt.Errorf("invalid expect: %w", err)
+		}
+	} else {
+		script.Sleep(clientTimeout)
+	}
+
+	conn, err := clientDial()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, conn.Close()) }()
+
+	logger.Info("Sending")
+	return script.Run(ctx, conn, cmd.OutOrStdout(), cmd.ErrOrStderr(), nil)
+}
+
+// runClientAutomation runs --script or the one shot command, exiting with clientTimeoutExitStatus
+// when expect times out.
+func runClientAutomation(cmd *cobra.Command, args []string) {
+	run := runClientOneShot
+	if clientScript != "" {
+		run = runClientScript
+	}
+	GetRunFn(func(cmd *cobra.Command, args []string) error {
+		err := run(cmd, args)
+		if errors.Is(err, expect.ErrTimeout) {
+			log.MustLogger(cmd.Context()).Error(err.Error())
+			Exit(clientTimeoutExitStatus)
+		}
+		return err
+	})(cmd, args)
+}
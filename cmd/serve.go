@@ -6,12 +6,22 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
 
 	"github.com/fornellas/slogxt/log"
 	"github.com/kotaira/go-serial"
 	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/framed"
+	"github.com/fornellas/serialtcp/mdns"
+	"github.com/fornellas/serialtcp/pipeline"
+	"github.com/fornellas/serialtcp/rfc2217"
+	"github.com/fornellas/serialtcp/serialport"
 )
 
 // ParityValue implements pflag.Value for serial.Parity
@@ -93,6 +103,12 @@ func (s *StopBitsValue) Type() string {
 var portName string
 var portNameDefault = ""
 
+var execCommand string
+var execCommandDefault = ""
+
+var shellProgram string
+var shellProgramDefault = ""
+
 var address string
 var addressDefault = "127.0.0.1:9999"
 
@@ -112,66 +128,865 @@ var disableRtsDefault = false
 var disableDtr bool
 var disableDtrDefault = false
 
-func handleConnection(ctx context.Context, conn net.Conn, mode *serial.Mode) (err error) {
+var accountingFile string
+var accountingFileDefault = ""
+
+var dryRun bool
+var dryRunDefault = false
+
+var stdio bool
+var stdioDefault = false
+
+var acceptFailureTimeout time.Duration
+var acceptFailureTimeoutDefault = time.Minute
+
+var maxLineLength int
+var maxLineLengthDefault = 4096
+
+var maxLineLengthPolicy = LinePolicyValue(LineSplit)
+
+var mdnsEnabled bool
+var mdnsEnabledDefault = false
+
+var mdnsInstance string
+var mdnsInstanceDefault = ""
+
+var charDelay time.Duration
+var charDelayDefault = time.Duration(0)
+
+var lineDelay time.Duration
+var lineDelayDefault = time.Duration(0)
+
+var crlfToPort = CRLFModeValue(CRLFRaw)
+
+var crlfToClient = CRLFModeValue(CRLFRaw)
+
+var sshAddress string
+var sshAddressDefault = ""
+
+var sshHostKey string
+var sshHostKeyDefault = ""
+
+var sshAuthorizedKeys string
+var sshAuthorizedKeysDefault = ""
+
+var identifyEnabled bool
+var identifyEnabledDefault = false
+
+var identifyProbe string
+var identifyProbeDefault = `\r`
+
+var identifyBytes int
+var identifyBytesDefault = 64
+
+var identifyTimeout time.Duration
+var identifyTimeoutDefault = 2 * time.Second
+
+var writeQueueSize int
+var writeQueueSizeDefault = 1 << 20
+
+var propagateBackpressure = BackpressureModeValue(BackpressureOff)
+
+var clientBufferSize int
+var clientBufferSizeDefault = 64 << 10
+
+var clientBufferPolicy = QueuePolicyValue(QueueBlock)
+
+var uartStatsInterval time.Duration
+var uartStatsIntervalDefault = 10 * time.Second
+
+var tokenAuth bool
+var tokenAuthDefault = false
+
+var halfClose bool
+var halfCloseDefault = false
+
+var rfc2217Enabled bool
+var rfc2217EnabledDefault = false
+
+var framedEnabled bool
+var framedEnabledDefault = false
+
+var heartbeatInterval time.Duration
+var heartbeatIntervalDefault = time.Duration(0)
+
+var controlSocket string
+var controlSocketDefault = ""
+
+var metricsAddress string
+var metricsAddressDefault = ""
+
+var pprofAddress string
+var pprofAddressDefault = ""
+
+var healthAddress string
+var healthAddressDefault = ""
+
+var sseAddress string
+var sseAddressDefault = ""
+
+var apiAddress string
+var apiAddressDefault = ""
+
+var apiTokenFile string
+var apiTokenFileDefault = ""
+
+var grpcAddress string
+var grpcAddressDefault = ""
+
+var grpcTokenFile string
+var grpcTokenFileDefault = ""
+
+var captureDir string
+var captureDirDefault = ""
+
+var captureRecipients []string
+var captureRecipientsDefault = []string{}
+
+var captureRedact []string
+var captureRedactDefault = []string{}
+
+var captureRedactInputAfter []string
+var captureRedactInputAfterDefault = []string{}
+
+// recordAccounting appends the accounting record for sess, of the backend of config, to store.
+func recordAccounting(ctx context.Context, config *ServerConfig, store accountingStore, sess *session) {
+	record := AccountingRecord{
+		PortName:      config.backendName(),
+		RemoteAddr:    sess.remoteAddr,
+		Start:         sess.start,
+		End:           time.Now(),
+		BytesToClient: sess.toClient.count.Load(),
+		BytesToPort:   sess.toPort.count.Load(),
+	}
+	if err := store.Append(context.WithoutCancel(ctx), record); err != nil {
+		logger := log.MustLogger(ctx)
+		logger.Error("Failed to record accounting", "error", err)
+	}
+}
+
+// copyToPort copies data from the client to the serial port through chain, until the client or ctx
+// is done. Data from read only clients is discarded, after going through chain.
+func copyToPort(ctx context.Context, config *ServerConfig, portWriter io.Writer, fromClient io.Reader, chain pipeline.Chain, readOnly bool) error {
+	if readOnly {
+		_, err := copyContext(ctx, chain.Writer(io.Discard), fromClient)
+		return err
+	}
+	if config.WriteQueueSize == 0 {
+		_, err := copyContext(ctx, chain.Writer(portWriter), fromClient)
+		return err
+	}
+	queue := newWriteQueue(portWriter, config.WriteQueueSize, QueueBlock, nil, nil)
+	_, err := copyContext(ctx, chain.Writer(queue), fromClient)
+	return errors.Join(err, queue.Close())
+}
+
+// copyToClient copies data from the serial port to the client through chain, until the port or ctx
+// is done. Data is buffered for the client according to config, counting bytes dropped at dropped.
+func copyToClient(ctx context.Context, config *ServerConfig, connWriter io.Writer, fromPort io.Reader, chain pipeline.Chain, dropped *atomic.Uint64, bp *backpressure) error {
+	if config.ClientBufferSize == 0 {
+		_, err := copyContext(ctx, chain.Writer(connWriter), fromPort)
+		return err
+	}
+	var pressure func(bool)
+	if bp != nil {
+		pressure = bp.Set
+		// Never leave the device paused.
+		defer bp.Set(false)
+	}
+	queue := newWriteQueue(connWriter, config.ClientBufferSize, config.ClientBufferPolicy, dropped, pressure)
+	defer queue.Discard()
+	_, err := copyContext(ctx, chain.Writer(queue), fromPort)
+	if errors.Is(err, errQueueFull) {
+		return fmt.Errorf("client too slow: %w", err)
+	}
+	// The session goes on with half closes, so the output is delivered before half closing.
+	if err == nil && config.HalfClose {
+		return queue.Close()
+	}
+	return err
+}
+
+// closeWrite shuts down the writing side of w, where supported, such as for TCP connections or
+// --exec commands, which read it as EOF.
+func closeWrite(w any) error {
+	if closer, ok := w.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return nil
+}
+
+// heartbeatClient pings conn every interval, closing it once the client stops responding, until
+// the session closes it.
+func heartbeatClient(ctx context.Context, conn *framed.ServerConn, interval time.Duration) {
+	if !errors.Is(conn.Heartbeat(ctx, interval), framed.ErrDeadPeer) {
+		return
+	}
 	logger := log.MustLogger(ctx)
+	logger.Warn("Client not responding, closing connection", "timeout", framed.HeartbeatMisses*interval)
+	if err := conn.Close(); err != nil {
+		logger.Error("Failed to close connection", "error", err)
+	}
+}
+
+// newClient returns the client side of the session described by info over conn, speaking RFC 2217
+// or the framed protocol if enabled, after sending it the banner, if any.
+func newClient(ctx context.Context, srv *server, conn net.Conn, port serialport.Port, info ConnectionInfo, mode serial.Mode) (io.ReadWriteCloser, error) {
+	config := &srv.config
+	var client io.ReadWriteCloser = conn
+	var controlPort rfc2217.Port = breakPort{port}
+	if info.ReadOnly {
+		controlPort = readOnlyPort{}
+	}
+	switch {
+	case config.RFC2217:
+		client = rfc2217.NewServerConn(ctx, conn, controlPort, mode)
+	case config.Framed:
+		framedConn := framed.NewServerConn(ctx, conn, controlPort, mode)
+		if config.HeartbeatInterval > 0 {
+			go heartbeatClient(ctx, framedConn, config.HeartbeatInterval)
+		}
+		client = framedConn
+	}
+	banner, err := srv.banner(info)
+	if err != nil {
+		return client, err
+	}
+	if _, err := client.Write(banner); err != nil {
+		return client, fmt.Errorf("failed to send banner: %w", err)
+	}
+	return client, nil
+}
+
+func handleConnection(ctx context.Context, conn net.Conn, srv *server) (err error) {
+	logger := log.MustLogger(ctx)
+
+	if draining, message := srv.Draining(); draining {
+		logger.Info("Draining, turning client away")
+		_, err := io.WriteString(conn, message)
+		return errors.Join(err, conn.Close())
+	}
 
 	logger.Info("Setting TCP no delay")
-	if tcpConn, ok := conn.(*net.TCPConn); ok {
+	if tcpConn, ok := baseConn(conn).(*net.TCPConn); ok {
 		if err := tcpConn.SetNoDelay(true); err != nil {
-			return fmt.Errorf("failed to set TCP no delay: %w", err)
+			return errors.Join(fmt.Errorf("failed to set TCP no delay: %w", err), conn.Close())
 		}
 	}
+	if err := setKeepAlive(conn, srv.config.KeepAlive); err != nil {
+		// Not all systems support all settings.
+		logger.Warn("Failed to set TCP keepalive", "error", err)
+	}
 
-	logger.Info("Opening serial port")
-	port, err := serial.Open(portName, mode)
+	ctx, span := srv.tracer.start(ctx, "session", spanKindServer, "client.address", conn.RemoteAddr().String())
+	defer func() { span.end(err) }()
+
+	conn, auth, err := handshake(ctx, conn, srv)
+	if err != nil {
+		return err
+	}
+
+	mode := srv.Mode()
+	config := &srv.config
+	info := newConnectionInfo(srv.newSessionID(), config.backendName(), conn.RemoteAddr().String(), auth, mode)
+
+	var sess *session
+	srv.emit(ctx, Event{Type: EventConnect, Session: info})
+	defer func() { srv.endSessionEvents(ctx, info, sess, err) }()
+
+	port, err := openSessionPort(ctx, srv, &mode, info)
+	if err != nil {
+		// Closing also releases its place under the per address limits.
+		return errors.Join(err, conn.Close())
+	}
+	srv.emit(ctx, Event{Type: EventPortOpen, Session: info})
+	// Both endSession and the failures below close the port.
+	defer func() {
+		srv.releasePort()
+		srv.emitSession(ctx, EventPortClose, info, sess)
+	}()
+	tuneLowLatency(ctx, config, port)
+
+	client, err := newClient(ctx, srv, conn, port, info, mode)
 	if err != nil {
-		return fmt.Errorf("failed to open: %s: %w", portName, err)
+		return errors.Join(err, client.Close(), port.Close())
 	}
 
 	errCh := make(chan error, 2)
 
+	connWriter := &countingWriter{Writer: client}
+	// Pacing goes after the write queue, so that it does not hold client commands behind data.
+	portWriter := &countingWriter{Writer: pipeline.Chain{
+		pacingMiddleware(config.CharDelay, config.LineDelay),
+	}.Writer(newWriteTimeoutWriter(ctx, port, config.WriteTimeout, config.WriteTimeoutPolicy))}
+	sess = srv.addSession(info, client, port, connWriter, portWriter)
+	defer func() {
+		srv.removeSession(sess)
+		logSessionStats(ctx, sess.info())
+	}()
+
+	pipe, sessionCapture, err := srv.sessionPipeline(ctx, info)
+	if err != nil {
+		return errors.Join(err, client.Close(), port.Close())
+	}
+	if sessionCapture != nil {
+		defer func() { err = errors.Join(err, sessionCapture.Close()) }()
+	}
+	if srv.accounting != nil {
+		defer recordAccounting(ctx, config, srv.accounting, sess)
+	}
+
 	logger.Info("Copying I/O")
 	go func() {
-		_, err := io.Copy(conn, port)
+		fromPort := newFrameGapReader(port, config.FrameGap, config.FrameMaxSize)
+		err := srv.deviceGone(copyToClient(ctx, config, connWriter, fromPort, pipe.Chain(pipeline.ToClient), &sess.dropped, newBackpressure(ctx, config.PropagateBackpressure, port, &sess.errors)))
+		if err == nil && config.HalfClose {
+			logger.Info("Serial port output ended, half closing connection")
+			err = closeWrite(baseConn(conn))
+		}
 		errCh <- err
 	}()
 
 	go func() {
-		_, err := io.Copy(port, conn)
+		err := srv.deviceGone(copyToPort(ctx, config, portWriter, client, pipe.Chain(pipeline.ToPort), auth.readOnly))
+		if err == nil && config.HalfClose {
+			logger.Info("Client half closed, half closing serial port")
+			err = closeWrite(port)
+		}
 		errCh <- err
 	}()
 
-	err = <-errCh
+	return endSession(ctx, errCh, config.HalfClose, sess, client, port)
+}
+
+// handshake authenticates conn and negotiates compression, returning the connection to use for
+// the session and how it authenticated. On failure, conn is closed.
+func handshake(ctx context.Context, conn net.Conn, srv *server) (_ net.Conn, _ authentication, err error) {
+	ctx, span := startSpan(ctx, "handshake")
+	defer func() { span.end(err) }()
+
+	authConn, auth, err := authenticateConn(ctx, conn, srv)
+	if err != nil {
+		return nil, authentication{}, errors.Join(err, conn.Close())
+	}
+	span.setAttributes("serialtcp.auth", auth.identity)
+
+	compressedConn, err := negotiateServerCompression(ctx, authConn, srv.config.Compress)
+	if err != nil {
+		return nil, authentication{}, errors.Join(err, authConn.Close())
+	}
+	return compressedConn, auth, nil
+}
+
+// openSessionPort opens the serial port for the session of info, see ServerConfig.openPort and
+// server.acquirePort, and identifies the device, see --identify. With
+// --reopen-timeout, the port is opened again when its device goes away, see reopenPort.
+func openSessionPort(ctx context.Context, srv *server, mode *serial.Mode, info ConnectionInfo) (_ serialport.Port, err error) {
+	config := &srv.config
+	_, span := startSpan(ctx, "serial.open", "serialtcp.port.name", info.PortName, "serialtcp.baud_rate", mode.BaudRate)
+	defer func() { span.end(err) }()
+
+	log.MustLogger(ctx).Info("Opening serial port")
+	port, err := srv.acquirePort(func() (serialport.Port, error) { return config.openPort(mode, info.Environ()) })
+	if err != nil {
+		return nil, err
+	}
+	if config.ReopenTimeout > 0 {
+		port = newReopenPort(ctx, port, mode, config.ReopenTimeout, func(mode *serial.Mode) (serialport.Port, error) {
+			port, err := config.openPort(mode, info.Environ())
+			if err == nil {
+				tuneLowLatency(ctx, config, port)
+			}
+			return port, err
+		})
+	}
+	srv.identifyPort(ctx, port)
+	return port, nil
+}
+
+// sessionPipeline returns the pipeline data of the session of info goes through: captures,
+// monitoring, tracing, line ending translation and high bits handling. The
+// capture to close once done is nil when captures are disabled.
+func (s *server) sessionPipeline(ctx context.Context, info ConnectionInfo) (*pipeline.Pipeline, io.Closer, error) {
+	logger := log.MustLogger(ctx)
+	pipe := &pipeline.Pipeline{}
+	sessionCapture, err := s.captureOptions.use(ctx, info, pipe)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.monitor(ctx, pipe, info)
+	pipe.Use(pipeline.ToClient, pipeline.Tee(&traceWriter{ctx: ctx, logger: logger, direction: captureToClient}))
+	pipe.Use(pipeline.ToPort, pipeline.Tee(&traceWriter{ctx: ctx, logger: logger, direction: captureToPort}))
+	pipe.Use(pipeline.ToPort, crlfMiddleware(s.config.CRLFToPort))
+	pipe.Use(pipeline.ToClient, crlfMiddleware(s.config.CRLFToClient))
+	pipe.Use(pipeline.ToPort, highBitsMiddleware(ctx, s.config.HighBits, info.DataBits, true))
+	pipe.Use(pipeline.ToClient, highBitsMiddleware(ctx, s.config.HighBits, info.DataBits, false))
+	return pipe, sessionCapture, nil
+}
+
+// endSession waits for the copy routines to return their errors to errCh, closing client and port
+// once the first returns or, with halfClose, once both return, unless the first fails. When ctx is
+// done first, they are closed right away, which unblocks the copy routines. Either way, it returns
+// only after both copy routines have, with the error which ended the session: the ones of copy
+// routines still running fail due to closing, or to ctx.
+func endSession(ctx context.Context, errCh <-chan error, halfClose bool, sess *session, client, port io.Closer) error {
+	logger := log.MustLogger(ctx)
+	pending, cancelled, err := waitSession(ctx, errCh, halfClose)
+	if cancelled {
+		logger.Info("Cancelled, ending session")
+	}
+	if err != nil {
+		// Only the first error ended the session, the other copy routine fails after closing.
+		sess.errors.Add(1)
+	}
 	logger.Info("Closing connection")
-	err = errors.Join(err, conn.Close())
+	err = errors.Join(err, client.Close())
 	logger.Info("Closing port")
 	err = errors.Join(err, port.Close())
-	logger.Info("Waiting for copy routine to return")
-	err = errors.Join(err, <-errCh)
+	if pending > 0 {
+		logger.Info("Waiting for copy routines to return", "pending", pending)
+	}
+	for range pending {
+		if copyErr := <-errCh; copyErr != nil {
+			logger.Debug("Copy routine ended after closing", "error", copyErr)
+		}
+	}
+	return err
+}
+
+// waitSession waits for the session to end, as endSession, returning how many copy routines are yet
+// to return, whether ctx ended it and the error which did otherwise.
+func waitSession(ctx context.Context, errCh <-chan error, halfClose bool) (pending int, cancelled bool, err error) {
+	pending = 2
+	select {
+	case err = <-errCh:
+		pending--
+	case <-ctx.Done():
+		return pending, true, nil
+	}
+	if err != nil || !halfClose {
+		return pending, false, err
+	}
+	log.MustLogger(ctx).Info("Waiting for the other direction to end")
+	select {
+	case err = <-errCh:
+		pending--
+	case <-ctx.Done():
+		return pending, true, nil
+	}
+	return pending, false, err
+}
+
+// addressListen returns what listens on address, with the PROXY protocol and per address limits,
+// if enabled.
+func addressListen(ctx context.Context, address string) (func() (net.Listener, error), error) {
+	listen, err := transportListen(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	listen, err = withProxyProtocol(ctx, listen)
+	if err != nil {
+		return nil, err
+	}
+	return withConnLimits(ctx, listen)
+}
+
+// newAcceptor returns an acceptor for the socket passed by systemd socket activation, if any, or
+// for a new listener on address.
+func newAcceptor(ctx context.Context) (*acceptor, error) {
+	logger := log.MustLogger(ctx)
+	listener, err := sdListener()
+	if err != nil {
+		return nil, err
+	}
+	if listener != nil {
+		logger.Info("Using systemd socket", "address", listener.Addr())
+		listen, err := withProxyProtocol(ctx, func() (net.Listener, error) { return listener, nil })
+		if err != nil {
+			return nil, err
+		}
+		listen, err = withConnLimits(ctx, listen)
+		if err != nil {
+			return nil, err
+		}
+		listener, err = listen()
+		if err != nil {
+			return nil, err
+		}
+		return &acceptor{listener: listener, failureTimeout: acceptFailureTimeout}, nil
+	}
+	listen, err := addressListen(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Listening")
+	listener, err = listen()
+	if err != nil {
+		return nil, err
+	}
+	return &acceptor{
+		listener:       listener,
+		rebind:         listen,
+		failureTimeout: acceptFailureTimeout,
+	}, nil
+}
+
+// printPlan writes the effective runtime plan to w.
+func printPlan(w io.Writer, listenAddress string, mode *serial.Mode) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	printBackendPlan(tw)
+	if configFile != "" {
+		fmt.Fprintf(tw, "Config file:\t%s\n", configFile)
+	}
+	fmt.Fprintf(tw, "Profile:\t%s\n", &profile)
+	fmt.Fprintf(tw, "Baud rate:\t%d\n", mode.BaudRate)
+	fmt.Fprintf(tw, "Data bits:\t%d\n", mode.DataBits)
+	fmt.Fprintf(tw, "Parity:\t%s\n", &parity)
+	fmt.Fprintf(tw, "High bits:\t%s\n", &highBits)
+	fmt.Fprintf(tw, "Stop bits:\t%s\n", &stopBits)
+	fmt.Fprintf(tw, "RTS:\t%v\n", !disableRts)
+	fmt.Fprintf(tw, "DTR:\t%v\n", !disableDtr)
+	fmt.Fprintf(tw, "Exclusive:\t%v\n", exclusive)
+	fmt.Fprintf(tw, "Low latency:\t%v\n", lowLatency)
+	printListenersPlan(tw, listenAddress)
+	if connLimitsEnabled() {
+		fmt.Fprintf(tw, "Connections per IP:\t%d at once, one per %s with bursts of %d\n", maxConnsPerIP, connIntervalPerIP, connBurstPerIP)
+	}
+	fmt.Fprintf(tw, "Max connections:\t%d, when busy %s\n", maxConnections, &busyPolicy)
+	if BusyPolicy(busyPolicy) == BusyQueue {
+		fmt.Fprintf(tw, "Max queue:\t%d\n", maxQueue)
+	}
+	fmt.Fprintf(tw, "Allow steal:\t%v\n", allowSteal)
+	if proxyProtocol {
+		fmt.Fprintf(tw, "PROXY protocol from:\t%s\n", strings.Join(proxyProtocolFrom, ", "))
+	}
+	fmt.Fprintf(tw, "RFC 2217:\t%v\n", rfc2217Enabled)
+	fmt.Fprintf(tw, "Framed:\t%v\n", framedEnabled)
+	if heartbeatInterval > 0 {
+		fmt.Fprintf(tw, "Heartbeat interval:\t%s\n", heartbeatInterval)
+	}
+	fmt.Fprintf(tw, "Compression:\t%s\n", &compress)
+	fmt.Fprintf(tw, "Token authentication:\t%v\n", tokenAuth)
+	if banner != "" {
+		fmt.Fprintf(tw, "Banner:\t%s\n", banner)
+	}
+	fmt.Fprintf(tw, "CR/LF to port:\t%s\n", crlfToPort.String())
+	fmt.Fprintf(tw, "CR/LF to client:\t%s\n", crlfToClient.String())
+	fmt.Fprintf(tw, "Write pacing:\t%s per character, %s per line\n", charDelay, lineDelay)
+	if frameGap > 0 {
+		fmt.Fprintf(tw, "Frames:\t%s gap, up to %d bytes\n", frameGap, frameMaxSize)
+	}
+	if writeTimeout > 0 {
+		fmt.Fprintf(tw, "Write timeout:\t%s, then %s\n", writeTimeout, &writeTimeoutPolicy)
+	}
+	if reopenTimeout > 0 {
+		fmt.Fprintf(tw, "Reopen timeout:\t%s\n", reopenTimeout)
+	}
+	fmt.Fprintf(tw, "Propagate backpressure:\t%s\n", propagateBackpressure.String())
+	printEventsPlan(tw)
+	if accountingFile != "" {
+		fmt.Fprintf(tw, "Accounting store:\t%s\n", accountingFile)
+	}
+	if auditLog != "" {
+		fmt.Fprintf(tw, "Audit log:\t%s\n", auditLog)
+	}
+	if auditSyslog != "" {
+		fmt.Fprintf(tw, "Audit syslog:\t%s\n", auditSyslog)
+	}
+	if captureDir != "" {
+		fmt.Fprintf(tw, "Capture location:\t%s\n", captureDir)
+		fmt.Fprintf(tw, "Capture format:\t%s\n", &captureFormat)
+		fmt.Fprintf(tw, "Capture recipients:\t%s\n", strings.Join(captureRecipients, ", "))
+		fmt.Fprintf(tw, "Capture redaction patterns:\t%s\n", strings.Join(captureRedact, ", "))
+		fmt.Fprintf(tw, "Capture input redaction prompts:\t%s\n", strings.Join(captureRedactInputAfter, ", "))
+	}
+	return tw.Flush()
+}
+
+// printBackendPlan writes the plan of what is served to w.
+func printBackendPlan(w io.Writer) {
+	switch {
+	case execCommand != "":
+		fmt.Fprintf(w, "Exec:\t%s\n", execCommand)
+	case shellProgram != "":
+		fmt.Fprintf(w, "Shell:\t%s\n", shellProgram)
+	case len(namedPorts) > 0:
+		fmt.Fprintf(w, "Named ports:\t%s\n", strings.Join(namedPorts, ", "))
+	default:
+		fmt.Fprintf(w, "Port name:\t%s\n", portName)
+	}
+}
+
+// printListenersPlan writes the plan of what is listened on to w.
+func printListenersPlan(w io.Writer, listenAddress string) {
+	fmt.Fprintf(w, "Listen address:\t%s\n", listenAddress)
+	if tcpKeepAlive > 0 {
+		fmt.Fprintf(w, "TCP keepalive:\tafter %s idle, %d probes %s apart\n", tcpKeepAlive, tcpKeepAliveCount, tcpKeepAliveInterval)
+	} else {
+		fmt.Fprintf(w, "TCP keepalive:\tdisabled\n")
+	}
+	if connectAddress != "" {
+		fmt.Fprintf(w, "Relay:\t%s, as %s\n", connectAddress, connectID)
+	}
+	if metricsAddress != "" {
+		fmt.Fprintf(w, "Metrics address:\t%s\n", metricsAddress)
+	}
+	if healthAddress != "" {
+		fmt.Fprintf(w, "Health address:\t%s\n", healthAddress)
+	}
+	if sseAddress != "" {
+		fmt.Fprintf(w, "Events address:\t%s\n", sseAddress)
+	}
+	if apiAddress != "" {
+		fmt.Fprintf(w, "API address:\t%s\n", apiAddress)
+	}
+	if grpcAddress != "" {
+		fmt.Fprintf(w, "gRPC address:\t%s\n", grpcAddress)
+	}
+	if pprofAddress != "" {
+		fmt.Fprintf(w, "pprof address:\t%s\n", pprofAddress)
+	}
+	if dropsPrivileges() {
+		fmt.Fprintf(w, "Run as:\tuser %q, group %q, chroot %q\n", runAsUser, runAsGroup, chrootDir)
+	}
+	fmt.Fprintf(w, "Transport:\t%s\n", transport.String())
+	if sshAddress != "" {
+		fmt.Fprintf(w, "SSH address:\t%s\n", sshAddress)
+	}
+}
 
-	return
+// printEventsPlan writes the plan of what reacts to events to w.
+func printEventsPlan(w io.Writer) {
+	fmt.Fprintf(w, "Boot events:\t%v\n", bootEventsEnabled)
+	if bootEventsWebhook != "" {
+		fmt.Fprintf(w, "Boot events webhook:\t%s\n", bootEventsWebhook)
+	}
+	if len(triggerValues) > 0 {
+		fmt.Fprintf(w, "Triggers:\t%s\n", strings.Join(triggerValues, ", "))
+		fmt.Fprintf(w, "Trigger cooldown:\t%s\n", triggerCooldown)
+	}
+	if hookScript != "" {
+		fmt.Fprintf(w, "Hook script:\t%s\n", hookScript)
+	}
+	if onConnect != "" {
+		fmt.Fprintf(w, "On connect:\t%s\n", onConnect)
+	}
+	if onDisconnect != "" {
+		fmt.Fprintf(w, "On disconnect:\t%s\n", onDisconnect)
+	}
+}
+
+// openPort opens the serial port with mode, or starts the exec or shell command in its place, with
+// env added to its environment.
+func (c *ServerConfig) openPort(mode *serial.Mode, env []string) (serialport.Port, error) {
+	if c.ExecCommand != "" {
+		port, err := startExec(c.ExecCommand, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start: %s: %w", c.ExecCommand, err)
+		}
+		return port, nil
+	}
+	if c.ShellCommand != "" {
+		port, err := startShell(c.ShellCommand, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start: %s: %w", c.ShellCommand, err)
+		}
+		return port, nil
+	}
+	port, err := serialport.Open(c.PortName, mode)
+	if err != nil {
+		return nil, openError(c.PortName, err)
+	}
+	return port, nil
+}
+
+// checkPort verifies the serial port can be opened.
+func checkPort(ctx context.Context, config *ServerConfig) error {
+	logger := log.MustLogger(ctx)
+	logger.Info("Opening serial port")
+	port, err := config.openPort(&config.Mode, nil)
+	if err != nil {
+		return err
+	}
+	logger.Info("Closing port")
+	if err := port.Close(); err != nil {
+		return fmt.Errorf("failed to close: %s: %w", config.PortName, err)
+	}
+	return nil
+}
+
+// localService returns the multicast DNS service of the server of name, listening on listener.
+func localService(listener net.Listener, name string) (mdns.Service, error) {
+	tcpAddr, ok := listener.Addr().(*net.TCPAddr)
+	if !ok {
+		return mdns.Service{}, fmt.Errorf("can not advertise non TCP listener: %s", listener.Addr())
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return mdns.Service{}, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	hostname, _, _ = strings.Cut(hostname, ".")
+
+	ips := []net.IP{tcpAddr.IP}
+	if tcpAddr.IP.IsUnspecified() {
+		ips, err = mdns.InterfaceIPs()
+		if err != nil {
+			return mdns.Service{}, fmt.Errorf("failed to get interface addresses: %w", err)
+		}
+	}
+
+	instance := mdnsInstance
+	if instance == "" {
+		instance = fmt.Sprintf("serialtcp %s on %s", name, hostname)
+	}
+
+	return mdns.Service{
+		Instance: instance,
+		Service:  mdnsService,
+		Domain:   mdnsDomain,
+		Host:     hostname,
+		IPs:      ips,
+		Port:     uint16(tcpAddr.Port),
+	}, nil
+}
+
+// advertise advertises the server of name via DNS-SD over multicast DNS until ctx is done.
+func advertise(ctx context.Context, listener net.Listener, name string) error {
+	logger := log.MustLogger(ctx)
+	service, err := localService(listener, name)
+	if err != nil {
+		return err
+	}
+	service.Text = []string{
+		"port-name=" + name,
+		fmt.Sprintf("baud-rate=%d", baudRate),
+	}
+	logger.Info("Advertising via multicast DNS", "instance", service.Instance)
+	return mdns.Advertise(ctx, service)
 }
 
 var ServeCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start a TCP server connected to a serial port.",
-	Long:  "Opens serial port and a TCP server, and pipe communication between both. There's NO security implemented, this can only be used in secure networks at your own risk.",
+	Long:  "Opens serial port and a TCP server, and pipe communication between both. There's NO security implemented, this can only be used in secure networks at your own risk.\n\nSessions are traced with OTLP over HTTP, JSON encoded, when OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, configured by the standard OTEL_* environment variables.",
 	Args:  cobra.NoArgs,
+	// The config file is applied before the flags are validated, so it can set required ones.
+	PreRun: func(cmd *cobra.Command, args []string) {
+		var err error
+		if serveConfigReloader, err = applyConfigFile(cmd); err != nil {
+			logger := log.MustLogger(cmd.Context())
+			logger.Error(err.Error())
+			Exit(1)
+		}
+	},
 	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		reloader := serveConfigReloader
+		if err := applyProfile(cmd); err != nil {
+			return err
+		}
+		if err := applyMinimal(cmd); err != nil {
+			return err
+		}
+		applyLowLatency(cmd)
 
 		ctx, logger := log.MustWithAttrs(
 			cmd.Context(),
 			"port-name", portName,
+			"exec", execCommand,
+			"shell", shellProgram,
+			"named-port", namedPorts,
 			"address", address,
+			"tcp-keepalive", tcpKeepAlive,
+			"tcp-keepalive-interval", tcpKeepAliveInterval,
+			"tcp-keepalive-count", tcpKeepAliveCount,
+			"stdio", stdio,
+			"config", configFile,
+			"profile", profile.String(),
+			"minimal", minimal,
 			"baud-rate", baudRate,
 			"data-bits", dataBits,
 			"parity", parity,
+			"high-bits", highBits.String(),
 			"stop-bits", stopBits,
 			"disable-rts", disableRts,
 			"disable-dtr", disableDtr,
+			"exclusive", exclusive,
+			"accounting-file", accountingFile,
+			"audit-log", auditLog,
+			"audit-syslog", auditSyslog,
+			"dry-run", dryRun,
+			"accept-failure-timeout", acceptFailureTimeout,
+			"transport", transport.String(),
+			"ssh-address", sshAddress,
+			"connect", connectAddress,
+			"id", connectID,
+			"connect-secret-file", connectSecretFile,
+			"proxy-protocol", proxyProtocol,
+			"proxy-protocol-from", proxyProtocolFrom,
+			"max-conns-per-ip", maxConnsPerIP,
+			"conn-interval-per-ip", connIntervalPerIP,
+			"conn-burst-per-ip", connBurstPerIP,
+			"max-connections", maxConnections,
+			"busy-policy", busyPolicy.String(),
+			"max-queue", maxQueue,
+			"allow-steal", allowSteal,
+			"rfc2217", rfc2217Enabled,
+			"framed", framedEnabled,
+			"heartbeat-interval", heartbeatInterval,
+			"compress", compress.String(),
+			"control-socket", controlSocket,
+			"capture-dir", captureDir,
+			"capture-format", captureFormat.String(),
+			"capture-recipients", captureRecipients,
+			"capture-redact", captureRedact,
+			"capture-redact-input-after", captureRedactInputAfter,
+			"max-line-length", maxLineLength,
+			"max-line-length-policy", maxLineLengthPolicy.String(),
+			"mdns", mdnsEnabled,
+			"mdns-instance", mdnsInstance,
+			"zigbee-radio-type", zigbeeRadioType.String(),
+			"token-auth", tokenAuth,
+			"banner", banner,
+			"identify", identifyEnabled,
+			"boot-events", bootEventsEnabled,
+			"boot-events-webhook", bootEventsWebhook,
+			"trigger", triggerValues,
+			"trigger-cooldown", triggerCooldown,
+			"hook-script", hookScript,
+			"on-connect", onConnect,
+			"on-disconnect", onDisconnect,
+			"low-latency", lowLatency,
+			"write-queue-size", writeQueueSize,
+			"client-buffer-size", clientBufferSize,
+			"client-buffer-policy", clientBufferPolicy.String(),
+			"propagate-backpressure", propagateBackpressure.String(),
+			"uart-stats-interval", uartStatsInterval,
+			"metrics-address", metricsAddress,
+			"health-address", healthAddress,
+			"pprof-address", pprofAddress,
+			"sse-address", sseAddress,
+			"api-address", apiAddress,
+			"api-token-file", apiTokenFile,
+			"grpc-address", grpcAddress,
+			"grpc-token-file", grpcTokenFile,
+			"user", runAsUser,
+			"group", runAsGroup,
+			"chroot", chrootDir,
+			"modem-status-interval", modemStatusInterval,
+			"char-delay", charDelay,
+			"write-timeout", writeTimeout,
+			"write-timeout-policy", &writeTimeoutPolicy,
+			"reopen-timeout", reopenTimeout,
+			"line-delay", lineDelay,
+			"frame-gap", frameGap,
+			"frame-max-size", frameMaxSize,
+			"crlf-to-port", crlfToPort.String(),
+			"crlf-to-client", crlfToClient.String(),
 		)
 		cmd.SetContext(ctx)
 		logger.Info("Running")
+		warnPortName(cmd)
 
 		mode := &serial.Mode{
 			BaudRate: baudRate,
@@ -184,47 +999,371 @@ var ServeCmd = &cobra.Command{
 			},
 		}
 
-		logger.Info("Listening")
-		listener, err := net.Listen("tcp", address)
+		config, err := newServeConfig(mode)
 		if err != nil {
-			return fmt.Errorf("failed to listen: %s: %w", address, err)
+			return err
+		}
+		if maxLineLength < 1 {
+			return fmt.Errorf("invalid maximum line length: %d", maxLineLength)
+		}
+		if err := checkKeepAlive(); err != nil {
+			return err
+		}
+		if err := checkAdmission(); err != nil {
+			return err
+		}
+		if err := checkMultiPort(); err != nil {
+			return err
+		}
+		if ZigbeeRadioType(zigbeeRadioType) != ZigbeeRadioNone && !mdnsEnabled {
+			return errors.New("--zigbee-radio-type requires --mdns")
+		}
+		if bootEventsWebhook != "" && !bootEventsEnabled {
+			return errors.New("--boot-events-webhook requires --boot-events")
+		}
+
+		if config.Exclusive && !config.runsCommand() {
+			lock, err := lockPort(config.PortName)
+			if err != nil {
+				return err
+			}
+			defer func() { err = errors.Join(err, lock.Unlock()) }()
+		}
+
+		listenAddress := "stdio"
+		var acceptor *acceptor
+		if !stdio {
+			acceptor, err = newAcceptor(ctx)
+			if err != nil {
+				return err
+			}
+			defer func() { err = errors.Join(err, acceptor.Close()) }()
+			listenAddress = acceptor.Addr().String()
+		}
+
+		var options []ServerOption
+		if auditLog != "" || auditSyslog != "" {
+			auditor, err := openAuditor(auditLog, auditSyslog)
+			if err != nil {
+				return err
+			}
+			defer func() { err = errors.Join(err, auditor.Close()) }()
+			options = append(options, WithEventHandler(auditor.handler()))
+		}
+		triggers, err := parseTriggers(triggerValues, triggerCooldown)
+		if err != nil {
+			return err
+		}
+		options = append(options, WithTriggers(triggers))
+		var capture captureOptions
+		if err := capture.setup(); err != nil {
+			return err
+		}
+		options = append(options, WithCapture(capture))
+		var keys *sshKeys
+		if sshAddress != "" {
+			keys, err = loadSSHKeys(ctx, config)
+			if err != nil {
+				return err
+			}
+		}
+		var apiToken string
+		if apiAddress != "" {
+			apiToken, err = readAPIToken()
+			if err != nil {
+				return err
+			}
+		}
+		var grpcToken string
+		if grpcAddress != "" {
+			grpcToken, err = readGRPCToken()
+			if err != nil {
+				return err
+			}
+		}
+
+		if accountingFile != "" {
+			store, err := openAccountingStore(accountingFile)
+			if err != nil {
+				return err
+			}
+			options = append(options, WithAccounting(store))
+		}
+		tracer, err := newTracerFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		if tracer != nil {
+			defer tracer.shutdown()
+			options = append(options, WithTracer(tracer))
+		}
+		if hookScript != "" {
+			options = append(options, WithEventHandler(hookScriptHandler(ctx, hookScript)))
+		}
+		if onConnect != "" {
+			options = append(options, WithEventHandler(hookScriptHandler(ctx, onConnect, EventConnect)))
+		}
+		if onDisconnect != "" {
+			options = append(options, WithEventHandler(hookScriptHandler(ctx, onDisconnect, EventDisconnect)))
+		}
+		if bootEventsEnabled {
+			options = append(options, WithBootEvents(newBootEvents(bootEventsWebhook)))
+		}
+		var sse *sseHub
+		if sseAddress != "" || grpcAddress != "" {
+			sse = newSSEHub()
+			options = append(options, WithSSE(sse))
+		}
+		srv := newServer(*config, options...)
+		var multi *multiPort
+		if len(namedPorts) > 0 {
+			multi, err = newMultiPort(config, options)
+			if err != nil {
+				return err
+			}
 		}
-		defer func() { errors.Join(err, listener.Close()) }()
 
-		for {
-			logger.Info("Accepting connection")
-			conn, err := listener.Accept()
+		// Everything is bound before --dry-run prints the plan, so it fails as starting would.
+		endpoints, err := listenEndpoints()
+		if err != nil {
+			return err
+		}
+		if endpoints.control != nil {
+			defer func() { err = errors.Join(err, endpoints.control.Close()) }()
+		}
+		var sshListener net.Listener
+		if sshAddress != "" {
+			sshListener, err = listenSSH(ctx, sshAddress, srv, keys)
+			if err != nil {
+				return err
+			}
+			defer func() { err = errors.Join(err, sshListener.Close()) }()
+			logger.Info("Listening for SSH", "address", sshListener.Addr())
+		}
+		var grpcListener net.Listener
+		if grpcAddress != "" {
+			grpcListener, err = listenGRPC(ctx, grpcAddress, srv, sse, grpcToken)
+			if err != nil {
+				return err
+			}
+			defer func() { err = errors.Join(err, grpcListener.Close()) }()
+			logger.Info("Listening for gRPC", "address", grpcListener.Addr())
+		}
+		var tunnel *tunnel
+		if connectAddress != "" {
+			tunnel, err = newTunnel(multi == nil)
 			if err != nil {
-				logger.Error("Failed to accept connection", "error", err)
-				continue
+				return err
+			}
+		}
+		if err := checkPrivileges(); err != nil {
+			return err
+		}
+
+		if dryRun {
+			if err := checkNamedPorts(ctx, config); err != nil {
+				return err
 			}
-			ctx, logger := log.MustWithGroupAttrs(
-				ctx,
-				"Connection",
-				"LocalAddr", conn.LocalAddr(),
-				"RemoteAddr", conn.RemoteAddr(),
-			)
-			logger.Info("Accepted")
+			return errors.Join(printPlan(cmd.OutOrStdout(), listenAddress, mode), endpoints.closeHTTP())
+		}
 
-			if err := handleConnection(ctx, conn, mode); err != nil {
-				logger.Error("Failed to handle connection", "error", err)
+		if endpoints.control != nil {
+			go serveControl(ctx, endpoints.control, srv)
+		}
+
+		if mdnsEnabled {
+			// Reloads changing --address are not advertised.
+			listener, _ := acceptor.current()
+			go func() {
+				if err := advertise(ctx, listener, config.backendName()); err != nil {
+					logger.Error("Failed to advertise via multicast DNS", "error", err)
+				}
+			}()
+			if ZigbeeRadioType(zigbeeRadioType) != ZigbeeRadioNone {
+				go func() {
+					if err := advertiseZigbee(ctx, listener, config.backendName()); err != nil {
+						logger.Error("Failed to advertise Zigbee coordinator via multicast DNS", "error", err)
+					}
+				}()
 			}
 		}
+
+		go toggleDebugOnSignal(ctx)
+		go dumpStatsOnSignal(ctx, srv)
+		target := &reloadTarget{ctx: ctx, srv: srv, multi: multi, acceptor: acceptor}
+		if reloader != nil {
+			go reloadConfigOnSignal(ctx, reloader, target)
+		}
+		if config.UARTStatsInterval > 0 {
+			go pollUARTCounters(ctx, srv, config.UARTStatsInterval)
+		}
+		if config.ModemStatusInterval > 0 {
+			go pollModemStatus(ctx, srv, config.ModemStatusInterval)
+		}
+		endpoints.serve(ctx, srv, sse, apiToken)
+
+		if stdio {
+			if err := dropPrivileges(ctx, config); err != nil {
+				return err
+			}
+			go sdReady(ctx, target.servers)
+			go sdWatchdog(ctx, target.servers)
+			return handleConnection(ctx, stdioConnection(), srv)
+		}
+
+		accept := acceptor.Accept
+		if sshListener != nil {
+			if connLimitsEnabled() {
+				sshListener = connLimits.listen(ctx, sshListener)
+			}
+			accept = mergeAccepts(ctx, accept, newListenerAcceptor(sshListener).Accept)
+		}
+		if grpcListener != nil {
+			if connLimitsEnabled() {
+				grpcListener = connLimits.listen(ctx, grpcListener)
+			}
+			accept = mergeAccepts(ctx, accept, newListenerAcceptor(grpcListener).Accept)
+		}
+		if tunnel != nil {
+			accept = mergeAccepts(ctx, accept, tunnel.Accept)
+		}
+
+		if err := dropPrivileges(ctx, config); err != nil {
+			return err
+		}
+
+		// Only once everything is listening.
+		go sdReady(ctx, target.servers)
+		go sdWatchdog(ctx, target.servers)
+
+		// Stop accepting once ctx is done, such as when the Windows service is stopped.
+		stopAccepting := context.AfterFunc(ctx, func() { _ = acceptor.Close() })
+		defer stopAccepting()
+		if multi != nil {
+			err = multi.serve(ctx, accept)
+		} else {
+			err = serveConnections(ctx, accept, srv)
+		}
+		if ctx.Err() != nil {
+			logger.Info("Stopped")
+			return nil
+		}
+		return err
 	}),
 }
 
 func init() {
-	ServeCmd.PersistentFlags().StringVarP(&portName, "port-name", "p", portNameDefault, "Port name")
-	if err := ServeCmd.MarkPersistentFlagRequired("port-name"); err != nil {
-		panic(err)
-	}
-	ServeCmd.PersistentFlags().StringVarP(&address, "address", "a", addressDefault, "TCP address to listen on (host:port)")
+	ServeCmd.PersistentFlags().StringVarP(&portName, "port-name", "p", portNameDefault, "Port name; pty:NAME opens the pseudo terminal NAME, such as pty:pts/3, and mock:loopback an in-memory port looping data back, for development without hardware")
+	ServeCmd.PersistentFlags().StringVarP(&execCommand, "exec", "", execCommandDefault, "Instead of a serial port, serve the standard input and output of this command, run by the system shell for each session with SERIALTCP_* environment variables describing the connection (eg: \"qemu-system-x86_64 -serial stdio ...\")")
+	ServeCmd.PersistentFlags().StringVarP(&shellProgram, "shell", "", shellProgramDefault, "Instead of a serial port, serve this command on a pseudo terminal, run by the system shell for each session with SERIALTCP_* environment variables describing the connection, as a minimal console server for hosts without serial hardware (eg: /bin/login)")
+	ServeCmd.PersistentFlags().StringArrayVarP(&namedPorts, "named-port", "", namedPortsDefault, "Instead of a single serial port, serve this one by name, as NAME=PORT, so a single listener serves several: clients pick one by sending OPEN NAME as their first line, by connecting to ws://HOST:PORT/NAME, or, with --transport quic, by the first label of the TLS server name (eg: NAME.lab.example), or carry several over a single connection with client --port NAME or --forward, such as when only one port can be reached through firewalls; can be given multiple times")
+	ServeCmd.MarkFlagsOneRequired("port-name", "exec", "shell", "named-port")
+	ServeCmd.MarkFlagsMutuallyExclusive("port-name", "exec", "shell", "named-port")
+	ServeCmd.PersistentFlags().StringVarP(&address, "address", "a", addressDefault, "Address to listen on: host:port for TCP, unix:///path for a Unix domain socket or \\\\.\\pipe\\name for a Windows named pipe")
+	ServeCmd.PersistentFlags().DurationVarP(&tcpKeepAlive, "tcp-keepalive", "", tcpKeepAliveDefault, "Send TCP keepalive probes on client connections idle this long, ending them when --tcp-keepalive-count probes go unanswered, so a crashed client, or one lost behind NAT, does not hold the serial port; 0 disables them")
+	ServeCmd.PersistentFlags().DurationVarP(&tcpKeepAliveInterval, "tcp-keepalive-interval", "", tcpKeepAliveIntervalDefault, "Time between unanswered TCP keepalive probes")
+	ServeCmd.PersistentFlags().IntVarP(&tcpKeepAliveCount, "tcp-keepalive-count", "", tcpKeepAliveCountDefault, "Unanswered TCP keepalive probes after which the connection is ended")
+	ServeCmd.PersistentFlags().VarP(&transport, "transport", "", "Transport clients connect with: tcp, which also covers Unix domain sockets and Windows named pipes, or quic, with TLS 1.3 over UDP, for lossy links such as WAN or cellular")
+	ServeCmd.PersistentFlags().StringVarP(&tlsCert, "tls-cert", "", tlsCertDefault, "TLS certificate PEM file, for --transport quic; without it, a self-signed certificate is generated, whose fingerprint is logged for clients to pin with --tls-fingerprint")
+	ServeCmd.PersistentFlags().StringVarP(&tlsKey, "tls-key", "", tlsKeyDefault, "TLS private key PEM file, for --transport quic")
+	ServeCmd.PersistentFlags().StringVarP(&sshAddress, "ssh-address", "", sshAddressDefault, "Also listen for SSH clients on this host:port, bridging each SSH session to the serial port, authenticated by --ssh-authorized-keys or, with --token-auth, by a guest token as password")
+	ServeCmd.PersistentFlags().StringVarP(&sshHostKey, "ssh-host-key", "", sshHostKeyDefault, "SSH host private key file; without it, a key is generated on every start, with its fingerprint logged")
+	ServeCmd.PersistentFlags().StringVarP(&sshAuthorizedKeys, "ssh-authorized-keys", "", sshAuthorizedKeysDefault, "File of public keys allowed to connect over SSH, in authorized_keys format")
+	ServeCmd.PersistentFlags().BoolVarP(&stdio, "stdio", "", stdioDefault, "Instead of listening, serve a single session over the standard input and output, as under inetd, SSH ForceCommand or ProxyCommand; logs still go to standard error, so consider --log-file")
+	ServeCmd.MarkFlagsMutuallyExclusive("stdio", "address")
+	ServeCmd.MarkFlagsMutuallyExclusive("stdio", "ssh-address")
+	ServeCmd.PersistentFlags().StringVarP(&connectAddress, "connect", "", connectAddressDefault, "Also connect out to the relay at this address, as host:port or a ws:// or wss:// URL, registering with --id, so that clients reach the server through it, such as from behind NAT; clients of the relay are served as clients of --address, which is still listened on, and the connection is made again whenever lost")
+	ServeCmd.PersistentFlags().StringVarP(&connectID, "id", "", connectIDDefault, "ID to register with the --connect relay, which clients ask the relay for (eg: lab-bench-3)")
+	ServeCmd.PersistentFlags().StringVarP(&connectSecretFile, "connect-secret-file", "", connectSecretFileDefault, "File with the secret authenticating --id to the --connect relay")
+	ServeCmd.MarkFlagsRequiredTogether("connect", "id")
+	ServeCmd.MarkFlagsMutuallyExclusive("stdio", "connect")
+	ServeCmd.PersistentFlags().BoolVarP(&proxyProtocol, "proxy-protocol", "", proxyProtocolDefault, "Expect a PROXY protocol header, version 1 or 2, on connections to --address, as sent by HAProxy or NGINX stream proxies, so the real client address is logged and passed on instead of the proxy's")
+	ServeCmd.PersistentFlags().StringSliceVarP(&proxyProtocolFrom, "proxy-protocol-from", "", proxyProtocolFromDefault, "Only expect the PROXY protocol header from these proxy addresses or networks (eg: 10.0.0.0/8), accepting other TCP clients directly; can be given multiple times; by default it is expected from all clients")
+	ServeCmd.PersistentFlags().IntVarP(&maxConnsPerIP, "max-conns-per-ip", "", maxConnsPerIPDefault, "Refuse connections from an IP address which already has this many open, including ones waiting for their session, so one client can not queue up ahead of everyone else; 0 disables")
+	ServeCmd.PersistentFlags().DurationVarP(&connIntervalPerIP, "conn-interval-per-ip", "", connIntervalPerIPDefault, "Refuse new connections from an IP address arriving more often than once per this interval, after --conn-burst-per-ip, so a script reconnecting in a loop can not flap the serial port; 0 disables")
+	ServeCmd.PersistentFlags().IntVarP(&connBurstPerIP, "conn-burst-per-ip", "", connBurstPerIPDefault, "New connections an IP address may open in a burst, before --conn-interval-per-ip applies")
+	ServeCmd.PersistentFlags().IntVarP(&maxConnections, "max-connections", "", maxConnectionsDefault, "Sessions served at once; above 1 requires --exec, running a command per session, as a serial port can only be open by one session at a time")
+	ServeCmd.PersistentFlags().VarP(&busyPolicy, "busy-policy", "", "What to do with connections arriving while --max-connections sessions are in progress: wait, leaving them unaccepted until a session ends; refuse them with a busy message; or queue them, telling them their position in line as it changes")
+	ServeCmd.PersistentFlags().IntVarP(&maxQueue, "max-queue", "", maxQueueDefault, "Connections queued with --busy-policy queue, beyond which they are refused")
+	ServeCmd.PersistentFlags().BoolVarP(&allowSteal, "allow-steal", "", allowStealDefault, "Let busy clients take over the session in progress by sending a STEAL line, as client --steal does, disconnecting the current holder, so a stale connection does not lock everyone out; with --token-auth, the line must carry a token minted with ctl token --steal; requires --busy-policy refuse or queue")
 	ServeCmd.PersistentFlags().IntVarP(&baudRate, "baud-rate", "b", baudRateDefault, "Serial port baud rate")
 	ServeCmd.PersistentFlags().IntVarP(&dataBits, "data-bits", "d", dataBitsDefault, "Serial port data bits (5, 6, 7, or 8)")
 	ServeCmd.PersistentFlags().VarP(&parity, "parity", "", "Serial port parity (no, odd, even, mark or space)")
+	ServeCmd.PersistentFlags().VarP(&highBits, "high-bits", "", "How to handle bits beyond --data-bits, which drivers may pass straight through: pass them; strip them, in both directions; drop sent bytes having them, stripping received ones; or even-parity or odd-parity, emulating 7 data bits with parity over 8 data bits without parity, for adapters lacking 7E1 or 7O1, setting the high bit of sent bytes to their parity and stripping it from received ones, unchecked")
 	ServeCmd.PersistentFlags().VarP(&stopBits, "stop-bits", "", "Serial port stop bits (1, 1.5, or 2)")
 	ServeCmd.PersistentFlags().BoolVarP(&disableRts, "disable-rts", "", disableRtsDefault, "Serial port RTS (Request To Send)")
 	ServeCmd.PersistentFlags().BoolVarP(&disableDtr, "disable-dtr", "", disableDtrDefault, "Serial port DTR (Data Terminal Ready)")
+	ServeCmd.PersistentFlags().BoolVarP(&exclusive, "exclusive", "", exclusiveDefault, "Lock the serial port with a UUCP style lockfile, honoring the ones of other programs, failing if it is already locked; serial ports are always opened with TIOCEXCL, which fails further opens of the device by others than root")
+	ServeCmd.PersistentFlags().StringVarP(&lockDir, "lock-dir", "", lockDirDefault, "Directory for --exclusive lockfiles")
+	ServeCmd.PersistentFlags().StringVarP(&accountingFile, "accounting-file", "", accountingFileDefault, "Append per session accounting records to this file, or to s3://bucket/prefix (see admin usage)")
+	ServeCmd.PersistentFlags().StringVarP(&auditLog, "audit-log", "", auditLogDefault, "Append an audit record of each session connect, error and disconnect to this file, one JSON object per line, synced to disk, apart from debug logs: client address, authenticated identity, whether it could write to the port, start, duration and bytes transferred")
+	ServeCmd.PersistentFlags().StringVarP(&auditSyslog, "audit-syslog", "", auditSyslogDefault, "Also send audit records to syslog, with the auth facility: local, for the local syslog daemon, or udp://host:port, tcp://host:port or unix:///path")
+	ServeCmd.PersistentFlags().BoolVarP(&halfClose, "half-close", "", halfCloseDefault, "When the client shuts down its sending side, stop writing to the serial port, closing the standard input of --exec commands, but keep sending output until the client closes; when the output ends, such as when an --exec command exits, shut down the sending side to the client, but keep writing to the port until the client closes. By default, either ending closes the session")
+	ServeCmd.PersistentFlags().BoolVarP(&rfc2217Enabled, "rfc2217", "", rfc2217EnabledDefault, "Speak Telnet with the Com Port Control Option (RFC 2217), allowing clients to change serial port settings for the duration of their session")
+	ServeCmd.PersistentFlags().BoolVarP(&framedEnabled, "framed", "", framedEnabledDefault, "Speak the serialtcp framed protocol, as client connect --framed does, carrying data in frames with a CRC-32, dropping corrupt ones over flaky links, along with breaks, serial port settings, DTR, RTS and pings")
+	ServeCmd.MarkFlagsMutuallyExclusive("rfc2217", "framed")
+	ServeCmd.PersistentFlags().DurationVarP(&heartbeatInterval, "heartbeat-interval", "", heartbeatIntervalDefault, "With --framed, ping clients this often, ending sessions when nothing is received from them for 3 intervals, even when TCP keepalives are disabled or mangled by middleboxes, so a dead client does not hold the serial port; 0 disables")
+	ServeCmd.PersistentFlags().VarP(&compress, "compress", "", "Compress the stream with clients asking for it with client --compress, flushing each write to keep latency low, for verbose consoles over slow links, such as cellular out of band management (none or gzip); clients must then all run with client --compress")
+	ServeCmd.PersistentFlags().StringVarP(&controlSocket, "control-socket", "", controlSocketDefault, "Unix socket path to serve control requests on (see ctl)")
+	ServeCmd.PersistentFlags().StringVarP(&captureDir, "capture-dir", "", captureDirDefault, "Record the data transferred during each session to a capture file, named after the session start, serial port and session ID, in this directory, or in s3://bucket/prefix, configured by the standard AWS_* environment variables")
+	ServeCmd.PersistentFlags().VarP(&captureFormat, "capture-format", "", "Capture file format: json, one JSON record per line; asciicast, for asciinema to replay, in a terminal or a browser, with output sent to clients and input from them; or pcapng, for Wireshark, with one packet per chunk of data, inbound from the serial port and outbound to it, in the LINKTYPE_USER0 link type, which Wireshark's DLT User preferences map to a protocol, such as Modbus RTU or NMEA 0183")
+	ServeCmd.PersistentFlags().StringSliceVarP(&captureRecipients, "capture-recipient", "", captureRecipientsDefault, "Encrypt capture files at rest to this age X25519 recipient (age1...); can be given multiple times")
+	ServeCmd.PersistentFlags().StringArrayVarP(&captureRedact, "capture-redact", "", captureRedactDefault, "Mask matches of this regular expression in capture files (only its subexpressions, if it has any); can be given multiple times")
+	ServeCmd.PersistentFlags().StringArrayVarP(&captureRedactInputAfter, "capture-redact-input-after", "", captureRedactInputAfterDefault, "Mask the next input line in capture files after output matches this regular expression (eg: 'Password:'); can be given multiple times")
+	ServeCmd.PersistentFlags().IntVarP(&maxLineLength, "max-line-length", "", maxLineLengthDefault, "Maximum line length for line framed processing (capture redaction), bounding memory used buffering lines")
+	ServeCmd.PersistentFlags().VarP(&maxLineLengthPolicy, "max-line-length-policy", "", "What to do with lines longer than --max-line-length: split them, truncate them or pass them through raw, without processing")
+	ServeCmd.PersistentFlags().BoolVarP(&mdnsEnabled, "mdns", "", mdnsEnabledDefault, "Advertise the server on the local network via DNS-SD over multicast DNS (see discover)")
+	ServeCmd.MarkFlagsMutuallyExclusive("stdio", "mdns")
+	ServeCmd.PersistentFlags().StringVarP(&mdnsInstance, "mdns-instance", "", mdnsInstanceDefault, "Multicast DNS instance name (default \"serialtcp $PORT_NAME on $HOSTNAME\")")
+	ServeCmd.PersistentFlags().VarP(&zigbeeRadioType, "zigbee-radio-type", "", "With --mdns, also advertise the served adapter as a network Zigbee coordinator of this radio type (none, ezsp, znp, deconz, zigate or xbee), for Home Assistant's Zigbee Home Automation integration to discover; clients connect with raw TCP, as to an ESPHome stream server, conventionally on port 6638")
+	ServeCmd.PersistentFlags().DurationVarP(&charDelay, "char-delay", "", charDelayDefault, "Delay after each character written to the serial port, for devices that drop characters when pasting at full speed")
+	ServeCmd.PersistentFlags().DurationVarP(&lineDelay, "line-delay", "", lineDelayDefault, "Delay after each line written to the serial port")
+	ServeCmd.PersistentFlags().DurationVarP(&frameGap, "frame-gap", "", frameGapDefault, "Buffer serial port data until the line stays quiet this long, or --frame-max-size is reached, sending each frame to clients in one write, preserving the frame boundaries of protocols such as Modbus RTU (3.5 characters, eg: 2ms at 19200 baud) and avoiding tiny packets; USB adapters deliver data in bursts, so set it above their latency timer, or use --low-latency; 0 disables")
+	ServeCmd.PersistentFlags().IntVarP(&frameMaxSize, "frame-max-size", "", frameMaxSizeDefault, "Maximum size of --frame-gap frames")
+	ServeCmd.PersistentFlags().DurationVarP(&writeTimeout, "write-timeout", "", writeTimeoutDefault, "How long a write to the serial port may block, eg: while hardware flow control holds transmission, before --write-timeout-policy applies; 0 disables it")
+	ServeCmd.PersistentFlags().VarP(&writeTimeoutPolicy, "write-timeout-policy", "", "What to do when a serial port write times out: disconnect ends the session, drop discards the output pending transmission")
+	ServeCmd.PersistentFlags().DurationVarP(&reopenTimeout, "reopen-timeout", "", reopenTimeoutDefault, "When the serial port device goes away during a session, eg: a USB adapter unplugged, or gone across sleep and wake, keep the session and wait this long for it to open again, with the same settings; 0 ends the session instead")
+	ServeCmd.PersistentFlags().VarP(&crlfToPort, "crlf-to-port", "", "Line ending translation for data sent to the serial port (raw, cr-to-lf, lf-to-cr, cr-to-crlf, lf-to-crlf, strip-cr or strip-lf)")
+	ServeCmd.PersistentFlags().VarP(&crlfToClient, "crlf-to-client", "", "Line ending translation for data sent to clients (raw, cr-to-lf, lf-to-cr, cr-to-crlf, lf-to-crlf, strip-cr or strip-lf)")
+	ServeCmd.PersistentFlags().StringVarP(&banner, "banner", "", bannerDefault, "Send this banner to each client on connect, with Go string escapes, or the contents of @FILE, as a Go template of the session, such as {{.PortName}}, {{.BaudRate}}, {{.DataBits}}, {{.Parity}}, {{.StopBits}}, {{.RemoteAddr}}, {{.ReadOnly}}, {{.Identity}} (see --identify), {{.Sessions}}, other sessions in progress, and {{.Recorded}}, whether it is captured (eg: \"Console of router1, {{.BaudRate}} baud\\r\\n\")")
+	ServeCmd.PersistentFlags().BoolVarP(&identifyEnabled, "identify", "", identifyEnabledDefault, "When a session opens the serial port, at most once a minute, send a probe to it and record the start of the response as the device identity banner (see ctl ports), before the session starts")
+	ServeCmd.PersistentFlags().StringVarP(&identifyProbe, "identify-probe", "", identifyProbeDefault, "Probe to send for --identify, with Go string escapes")
+	ServeCmd.PersistentFlags().IntVarP(&identifyBytes, "identify-bytes", "", identifyBytesDefault, "Maximum length of the identity banner")
+	ServeCmd.PersistentFlags().DurationVarP(&identifyTimeout, "identify-timeout", "", identifyTimeoutDefault, "How long to wait for the identity banner")
+	ServeCmd.PersistentFlags().BoolVarP(&bootEventsEnabled, "boot-events", "", bootEventsEnabledDefault, "Recognize common boot console events in serial port output, such as the U-Boot autoboot prompt, kernel start, kernel panics and oopses and login prompts, logging them and counting them in statistics (see ctl events and ctl stats)")
+	ServeCmd.PersistentFlags().StringVarP(&bootEventsWebhook, "boot-events-webhook", "", bootEventsWebhookDefault, "POST each boot console event as JSON to this URL")
+	ServeCmd.PersistentFlags().BoolVarP(&lowLatency, "low-latency", "", lowLatencyDefault, "Tune the serial port for latency over throughput, for interactive use and timing sensitive protocols: sets the kernel low latency flag, the FTDI latency timer to 1ms, and disables the write queue and client buffer")
+	ServeCmd.PersistentFlags().IntVarP(&writeQueueSize, "write-queue-size", "", writeQueueSizeDefault, "Bytes of client data queued for the serial port, so client commands such as RFC 2217 break are not stuck behind it; 0 disables the queue")
+	ServeCmd.PersistentFlags().IntVarP(&clientBufferSize, "client-buffer-size", "", clientBufferSizeDefault, "Bytes of serial port data buffered for each client, so slow clients do not stall serial port reads; 0 disables the buffer")
+	ServeCmd.PersistentFlags().VarP(&propagateBackpressure, "propagate-backpressure", "", "Pause the device transmitting while the client buffer is filling up: off, rts (deassert RTS, for hardware flow control) or xon-xoff (send XOFF, for software flow control)")
+	ServeCmd.PersistentFlags().VarP(&clientBufferPolicy, "client-buffer-policy", "", "What to do when a client buffer is full: block serial port reads, drop-oldest buffered data or disconnect the client")
+	ServeCmd.PersistentFlags().StringVarP(&metricsAddress, "metrics-address", "", metricsAddressDefault, "Serve Prometheus metrics at http://ADDRESS/metrics: sessions, bytes transferred and, with --uart-stats-interval, serial port driver counters of framing, parity and overrun errors and breaks")
+	ServeCmd.PersistentFlags().StringVarP(&healthAddress, "health-address", "", healthAddressDefault, "Serve health checks at http://ADDRESS/healthz, failing while the serial port can not be opened, and http://ADDRESS/readyz, failing until connections are accepted and while draining (eg: for Kubernetes liveness and readiness probes)")
+	ServeCmd.PersistentFlags().StringVarP(&sseAddress, "sse-address", "", sseAddressDefault, "Also serve serial port output as Server-Sent Events at http://ADDRESS/events, one per line, as a JSON object with the line, without its line ending, and the time it ended, so dashboards and browsers can follow the console (eg: new EventSource(\"http://ADDRESS/events\")); only output read during sessions is sent, and subscribers not keeping up miss lines. There's NO security implemented, bind it to localhost or a secure network")
+	ServeCmd.PersistentFlags().StringVarP(&apiAddress, "api-address", "", apiAddressDefault, "Also serve an HTTP API controlling the server at http://ADDRESS/, authenticated with the token of --api-token-file as bearer token: GET /status, GET /sessions, DELETE /sessions/ID, POST /break {\"duration\": \"250ms\"}, POST /mode {\"baud_rate\": 115200, \"data_bits\", \"parity\", \"stop_bits\"} and POST /lines {\"dtr\": true, \"rts\": false}, answering with JSON, as the control socket does, with 400 Bad Request for malformed requests and 409 Conflict when break and lines requests find no session with the serial port open, or mode requests can not be applied (eg: curl -H \"Authorization: Bearer $TOKEN\" -X POST http://ADDRESS/break); it is plain HTTP, so put a TLS reverse proxy in front of it outside secure networks")
+	ServeCmd.PersistentFlags().StringVarP(&apiTokenFile, "api-token-file", "", apiTokenFileDefault, "File with the token authenticating --api-address requests")
+	ServeCmd.MarkFlagsRequiredTogether("api-address", "api-token-file")
+	ServeCmd.PersistentFlags().StringVarP(&grpcAddress, "grpc-address", "", grpcAddressDefault, "Also serve the gRPC API of the grpcapi package (serialtcp.proto) at ADDRESS, authenticated with the token of --grpc-token-file as \"authorization: Bearer TOKEN\" metadata: Open streams a session, as TCP clients have, Read streams serial port output line by line, as --sse-address does, Write writes to the serial port of sessions in progress, and SetMode, SendBreak and Status act as the control socket does; only in builds with the grpc tag (eg: go build -tags grpc), and without TLS of its own")
+	ServeCmd.PersistentFlags().StringVarP(&grpcTokenFile, "grpc-token-file", "", grpcTokenFileDefault, "File with the token authenticating --grpc-address calls")
+	ServeCmd.MarkFlagsRequiredTogether("grpc-address", "grpc-token-file")
+	ServeCmd.MarkFlagsMutuallyExclusive("stdio", "grpc-address")
+	ServeCmd.PersistentFlags().StringVarP(&pprofAddress, "pprof-address", "", pprofAddressDefault, "Serve runtime profiling data at http://ADDRESS/debug/pprof/, for diagnosing CPU usage or goroutine leaks (eg: go tool pprof http://ADDRESS/debug/pprof/goroutine); it exposes internals, so bind it to localhost")
+	ServeCmd.PersistentFlags().StringVarP(&runAsUser, "user", "", runAsUserDefault, "Once listening, switch to this user, by name or ID, with its groups, so serve can start as root to listen on low ports and drop to an unprivileged account before accepting connections; the serial port is opened per session, so the account must be able to open it, such as through --group")
+	ServeCmd.PersistentFlags().StringVarP(&runAsGroup, "group", "", runAsGroupDefault, "Once listening, switch to this group, by name or ID, such as the group of the serial port device (eg: dialout)")
+	ServeCmd.PersistentFlags().StringVarP(&chrootDir, "chroot", "", chrootDirDefault, "Once listening, change the root directory to this one, in which the serial port, --exec commands and capture directories are then looked up")
+	ServeCmd.PersistentFlags().DurationVarP(&uartStatsInterval, "uart-stats-interval", "", uartStatsIntervalDefault, "How often to read serial port driver counters (overruns, parity errors, breaks...) while the port is open, where supported (Linux); 0 disables")
+	ServeCmd.PersistentFlags().DurationVarP(&modemStatusInterval, "modem-status-interval", "", modemStatusIntervalDefault, "How often to read the modem status lines (CTS, DSR, RI and DCD) while the port is open, logging changes, such as DCD drops on device reboots or cable issues, showing them in ctl stats and notifying RFC 2217 clients; 0 disables")
+	ServeCmd.PersistentFlags().StringArrayVarP(&triggerValues, "trigger", "", triggerValuesDefault, "When serial port output matches a regular expression, run a command with the system shell, with SERIALTCP_TRIGGER_* environment variables describing the match, or POST the match as JSON to an http:// or https:// URL, given as regex=command (eg: 'Kernel panic=notify-send panic'); may be given multiple times")
+	ServeCmd.PersistentFlags().DurationVarP(&triggerCooldown, "trigger-cooldown", "", triggerCooldownDefault, "Minimum time between runs of each trigger, so repeated matches do not flood")
+	ServeCmd.PersistentFlags().StringVarP(&onConnect, "on-connect", "", onConnectDefault, "When a client connects, run this command in the background with the system shell, with SERIALTCP_* environment variables describing the session, such as SERIALTCP_REMOTE_ADDR, SERIALTCP_PORT_NAME and SERIALTCP_SESSION_ID (eg: to power on a PDU outlet)")
+	ServeCmd.PersistentFlags().StringVarP(&onDisconnect, "on-disconnect", "", onDisconnectDefault, "When a client disconnects, run this command in the background with the system shell, with the --on-connect environment variables plus SERIALTCP_BYTES_TO_CLIENT, SERIALTCP_BYTES_TO_PORT, SERIALTCP_BYTES_DROPPED and SERIALTCP_DURATION, in seconds (eg: to log usage)")
+	ServeCmd.PersistentFlags().StringVarP(&hookScript, "hook-script", "", hookScriptDefault, "On session events, run this command with the system shell, with SERIALTCP_EVENT set to connect, disconnect, port-open, port-close or error, SERIALTCP_ERROR to the error and other SERIALTCP_* environment variables describing the session (eg: to update an inventory, alert or control power)")
+	ServeCmd.PersistentFlags().BoolVarP(&tokenAuth, "token-auth", "", tokenAuthDefault, "Require clients to send a single use guest token as their first line (see ctl token)")
+	ServeCmd.PersistentFlags().DurationVarP(&acceptFailureTimeout, "accept-failure-timeout", "", acceptFailureTimeoutDefault, "Exit when accepting connections keeps failing for this long, after backing off and rebinding the listener")
+	ServeCmd.PersistentFlags().StringVarP(&configFile, "config", "", configFileDefault, "Read serve flags from this file, one \"name = value\" per line, which flags given on the command line override; on SIGHUP, it is read again, changing the serial port mode, --address, --named-port, --proxy-protocol-from and the per IP connection limits without disconnecting sessions, while other changes take effect on restart")
+	ServeCmd.PersistentFlags().VarP(&profile, "profile", "", "Set a vetted combination of options for a kind of device, which options given explicitly override: "+profileUsage())
+	ServeCmd.PersistentFlags().BoolVarP(&minimal, "minimal", "", minimalDefault, "Keep memory use low, for routers and other constrained devices: disables captures, multicast DNS, identification, UART statistics and the metrics, pprof, health check, events, API and gRPC endpoints, and shrinks buffers not set explicitly; the default for builds with the minimal tag, which also leave captures, remote storage and the HTTP endpoints out of the binary")
+	ServeCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", dryRunDefault, "Open the serial port, bind all listeners, check accounting, tracing and privilege settings, print the effective runtime plan and exit")
 
 	RootCmd.AddCommand(ServeCmd)
 }
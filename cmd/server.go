@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/bootevent"
+	"github.com/fornellas/serialtcp/pipeline"
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// Longest break sent on request, as the serial port is held down for the whole break.
+const maxBreakDuration = 10 * time.Second
+
+// session is a client connection bridged to the serial port.
+type session struct {
+	id         uint64
+	remoteAddr string
+	start      time.Time
+	client     io.Closer
+	port       serialport.Port
+	// Bytes read from the serial port and sent to the client.
+	toClient *countingWriter
+	// Bytes received from the client and written to the serial port.
+	toPort *countingWriter
+	// Bytes read from the serial port and dropped, as the client was too slow.
+	dropped atomic.Uint64
+	// Errors during the session, including the one ending it, if any.
+	errors atomic.Uint64
+}
+
+// SessionInfo describes a session for the control socket.
+type SessionInfo struct {
+	ID            uint64    `json:"id"`
+	RemoteAddr    string    `json:"remote_addr"`
+	Start         time.Time `json:"start"`
+	BytesToClient uint64    `json:"bytes_to_client"`
+	BytesToPort   uint64    `json:"bytes_to_port"`
+	BytesDropped  uint64    `json:"bytes_dropped"`
+	Errors        uint64    `json:"errors"`
+}
+
+func (s *session) info() SessionInfo {
+	return SessionInfo{
+		ID:            s.id,
+		RemoteAddr:    s.remoteAddr,
+		Start:         s.start,
+		BytesToClient: s.toClient.count.Load(),
+		BytesToPort:   s.toPort.count.Load(),
+		BytesDropped:  s.dropped.Load(),
+		Errors:        s.errors.Load(),
+	}
+}
+
+// Stats holds server wide statistics.
+type Stats struct {
+	Start          time.Time `json:"start"`
+	ActiveSessions int       `json:"active_sessions"`
+	TotalSessions  uint64    `json:"total_sessions"`
+	BytesToClient  uint64    `json:"bytes_to_client"`
+	BytesToPort    uint64    `json:"bytes_to_port"`
+	BytesDropped   uint64    `json:"bytes_dropped"`
+	Errors         uint64    `json:"errors"`
+	// Last read serial port driver counters, if any.
+	UART *UARTCounters `json:"uart,omitempty"`
+	// Last read modem status lines, if any, see serve --modem-status-interval.
+	Modem *ModemStatus `json:"modem,omitempty"`
+	// Count of boot console events recognized by kind, see serve --boot-events.
+	BootEvents map[bootevent.Kind]uint64 `json:"boot_events,omitempty"`
+	// Whether new clients are turned away, see admin drain.
+	Draining bool `json:"draining,omitempty"`
+}
+
+// PortInfo describes the serial port for the control socket.
+type PortInfo struct {
+	Name     string `json:"name"`
+	BaudRate int    `json:"baud_rate"`
+	DataBits int    `json:"data_bits"`
+	Parity   string `json:"parity"`
+	StopBits string `json:"stop_bits"`
+	// Identity banner, see serve --identify.
+	Identity     string    `json:"identity,omitempty"`
+	IdentifiedAt time.Time `json:"identified_at,omitzero"`
+}
+
+// server holds the state of a running serve command, shared between connections and the control
+// socket.
+type server struct {
+	// How sessions are handled.
+	config         ServerConfig
+	captureOptions captureOptions
+	// Where accounting records are stored, if enabled.
+	accounting accountingStore
+	// Boot console events, if enabled.
+	bootEvents *bootEvents
+	// Run on serial port output matches, see serve --trigger.
+	triggers []*trigger
+	// Server-Sent Events subscribers to serial port output, if enabled.
+	sse *sseHub
+	// Called on session lifecycle events.
+	eventHandlers []EventHandler
+	// Traces sessions, if enabled.
+	tracer *tracer
+
+	// Held while opening the serial port, so that health probes do not open it as sessions do.
+	portMu sync.Mutex
+
+	mu       sync.Mutex
+	mode     serial.Mode
+	nextID   uint64
+	sessions map[uint64]*session
+	stats    Stats
+	tokens   map[string]tokenGrant
+
+	identity     string
+	identifiedAt time.Time
+	// Last attempt to identify the device, see identifyDue.
+	identifyAttemptAt time.Time
+
+	// Message sent to clients turned away while draining.
+	drainMessage string
+
+	// Outcome of the last attempt to open the serial port, see serve --health-address.
+	portErr error
+	// Sessions with the serial port open, from opening it until closing it.
+	portUsers int
+	// Whether connections are accepted.
+	accepting bool
+}
+
+// newServer returns a server handling sessions according to config, with options applied.
+func newServer(config ServerConfig, options ...ServerOption) *server {
+	s := &server{
+		config:   config,
+		mode:     config.Mode,
+		nextID:   1,
+		sessions: map[uint64]*session{},
+		stats:    Stats{Start: time.Now()},
+		tokens:   map[string]tokenGrant{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// SetIdentity records the device identity banner.
+func (s *server) SetIdentity(identity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identity = identity
+	s.identifiedAt = time.Now()
+}
+
+// SetDraining sets whether new clients are turned away with message, while existing sessions are
+// left alone.
+func (s *server) SetDraining(draining bool, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Draining = draining
+	s.drainMessage = message
+}
+
+// Draining returns whether new clients are turned away, and the message to send them.
+func (s *server) Draining() (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats.Draining, s.drainMessage
+}
+
+// Ports describes the served serial ports.
+func (s *server) Ports() []PortInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parity := ParityValue(s.mode.Parity)
+	stopBits := StopBitsValue(s.mode.StopBits)
+	return []PortInfo{{
+		Name:         s.config.backendName(),
+		BaudRate:     s.mode.BaudRate,
+		DataBits:     s.mode.DataBits,
+		Parity:       parity.String(),
+		StopBits:     stopBits.String(),
+		Identity:     s.identity,
+		IdentifiedAt: s.identifiedAt,
+	}}
+}
+
+// Mode returns the serial port mode new sessions use.
+func (s *server) Mode() serial.Mode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode
+}
+
+// newSessionID allocates an id for a new session.
+func (s *server) newSessionID() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+func (s *server) addSession(info ConnectionInfo, client io.Closer, port serialport.Port, toClient, toPort *countingWriter) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := &session{
+		id:         info.ID,
+		remoteAddr: info.RemoteAddr,
+		start:      info.Start,
+		client:     client,
+		port:       port,
+		toClient:   toClient,
+		toPort:     toPort,
+	}
+	s.sessions[sess.id] = sess
+	s.stats.TotalSessions++
+	return sess
+}
+
+func (s *server) removeSession(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sess.id)
+	s.stats.BytesToClient += sess.toClient.count.Load()
+	s.stats.BytesToPort += sess.toPort.count.Load()
+	s.stats.BytesDropped += sess.dropped.Load()
+	s.stats.Errors += sess.errors.Load()
+}
+
+// Sessions returns information on all active sessions, ordered by id.
+func (s *server) Sessions() []SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]SessionInfo, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		infos = append(infos, sess.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Stats returns server wide statistics, including active sessions.
+func (s *server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.ActiveSessions = len(s.sessions)
+	for _, sess := range s.sessions {
+		stats.BytesToClient += sess.toClient.count.Load()
+		stats.BytesToPort += sess.toPort.count.Load()
+		stats.BytesDropped += sess.dropped.Load()
+		stats.Errors += sess.errors.Load()
+	}
+	if s.bootEvents != nil {
+		stats.BootEvents = s.bootEvents.Counts()
+	}
+	return stats
+}
+
+// monitor adds to pipe the recognition of boot events, matching of triggers and Server-Sent Events
+// of serial port output, if enabled.
+func (s *server) monitor(ctx context.Context, pipe *pipeline.Pipeline, info ConnectionInfo) {
+	if s.bootEvents != nil {
+		pipe.Use(pipeline.ToClient, pipeline.Tee(s.bootEvents.Decoder(ctx, s.config.MaxLineLength)))
+	}
+	if len(s.triggers) > 0 {
+		pipe.Use(pipeline.ToClient, pipeline.Tee(newTriggerWriter(ctx, s.triggers, info, s.config.MaxLineLength)))
+	}
+	if s.sse != nil {
+		pipe.Use(pipeline.ToClient, pipeline.Tee(s.sse.Writer(s.config.MaxLineLength)))
+	}
+}
+
+// BootEvents returns the most recent boot console events.
+func (s *server) BootEvents() ([]bootevent.Event, error) {
+	if s.bootEvents == nil {
+		return nil, errors.New("boot events are not enabled")
+	}
+	return s.bootEvents.Recent(), nil
+}
+
+// setUARTCounters records the last read serial port driver counters, returning the previous ones.
+func (s *server) setUARTCounters(counters *UARTCounters) *UARTCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.stats.UART
+	s.stats.UART = counters
+	return previous
+}
+
+// setModemStatus records the last read modem status lines.
+func (s *server) setModemStatus(status *ModemStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Modem = status
+}
+
+// modemNotifier is implemented by clients which are notified of modem status line changes, such
+// as RFC 2217 clients.
+type modemNotifier interface {
+	NotifyModemState(status, previous *serial.ModemStatusBits) error
+}
+
+// notifyModemStatus notifies clients of the modem status lines, which changed from previous, if
+// known. Clients are written to without holding the server lock, so a stalled client does not
+// hold up other sessions.
+func (s *server) notifyModemStatus(status, previous *serial.ModemStatusBits) error {
+	var notifiers []modemNotifier
+	s.mu.Lock()
+	for _, sess := range s.sessions {
+		if notifier, ok := sess.client.(modemNotifier); ok {
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	s.mu.Unlock()
+	var err error
+	for _, notifier := range notifiers {
+		err = errors.Join(err, notifier.NotifyModemState(status, previous))
+	}
+	return err
+}
+
+// Kick disconnects the session with the given id.
+func (s *server) Kick(id uint64) error {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("session not found: %d", id)
+	}
+	return sess.client.Close()
+}
+
+// withPorts calls fn for each open serial port, without holding the server lock, as fn may block,
+// such as while sending a break.
+func (s *server) withPorts(fn func(serialport.Port) error) error {
+	s.mu.Lock()
+	ports := make([]serialport.Port, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		ports = append(ports, sess.port)
+	}
+	s.mu.Unlock()
+	if len(ports) == 0 {
+		return errors.New("serial port is not open")
+	}
+	var err error
+	for _, port := range ports {
+		err = errors.Join(err, fn(port))
+	}
+	return err
+}
+
+// checkBreakDuration verifies duration is positive, and at most maxBreakDuration.
+func checkBreakDuration(duration time.Duration) error {
+	if duration <= 0 || duration > maxBreakDuration {
+		return fmt.Errorf("invalid break duration: %s: it must be positive and at most %s", duration, maxBreakDuration)
+	}
+	return nil
+}
+
+// Break sends a break to the open serial port.
+func (s *server) Break(duration time.Duration) error {
+	if err := checkBreakDuration(duration); err != nil {
+		return err
+	}
+	return s.withPorts(func(port serialport.Port) error { return port.Break(duration) })
+}
+
+// SetDTR sets DTR on the open serial port.
+func (s *server) SetDTR(dtr bool) error {
+	return s.withPorts(func(port serialport.Port) error { return port.SetDTR(dtr) })
+}
+
+// SetRTS sets RTS on the open serial port.
+func (s *server) SetRTS(rts bool) error {
+	return s.withPorts(func(port serialport.Port) error { return port.SetRTS(rts) })
+}
+
+// SetBaudRate changes the baud rate of the open serial port, and of future sessions.
+func (s *server) SetBaudRate(baudRate int) error {
+	return s.SetMode(func(mode *serial.Mode) { mode.BaudRate = baudRate })
+}
+
+// SetMode changes the mode of the open serial port, and of future sessions, as done by update,
+// keeping sessions connected. It fails, changing nothing, if the baud rate is not positive.
+func (s *server) SetMode(update func(mode *serial.Mode)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mode := s.mode
+	update(&mode)
+	if mode.BaudRate <= 0 {
+		return fmt.Errorf("invalid baud rate: %d", mode.BaudRate)
+	}
+	var err error
+	for _, sess := range s.sessions {
+		err = errors.Join(err, sess.port.SetMode(&mode))
+	}
+	if err != nil {
+		return err
+	}
+	s.mode = mode
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+)
+
+var serviceName string
+var serviceNameDefault = "serialtcp"
+
+// runServe runs serve with args, until ctx is done.
+func runServe(ctx context.Context, args []string) error {
+	RootCmd.SetArgs(append([]string{"serve"}, args...))
+	return RootCmd.ExecuteContext(ctx)
+}
+
+var ServiceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run as a Windows service.",
+	Long:  "Installs, uninstalls and runs serve as a Windows service, started at boot without a logged in user. Stopping the service stops serve gracefully. Elsewhere, use the service manager of the system, such as systemd, which serve supports with socket activation and notifications.",
+}
+
+var ServiceInstallCmd = &cobra.Command{
+	Use:   "install [flags] -- [serve flags]",
+	Short: "Install the Windows service.",
+	Long:  "Installs the Windows service, started automatically at boot and restarted if it fails, running serve with the given serve flags (eg: serialtcp service install -- --port-name COM3 --address :2217 --log-file C:\\serialtcp.log). As services have no console, use --log-file for logs.",
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		return installService(cmd.Context(), serviceName, args)
+	}),
+}
+
+var ServiceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Uninstall the Windows service.",
+	Long:  "Stops the Windows service, if running, and uninstalls it.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		return uninstallService(cmd.Context(), serviceName)
+	}),
+}
+
+var ServiceRunCmd = &cobra.Command{
+	Use:   "run [flags] -- [serve flags]",
+	Short: "Run serve as the Windows service.",
+	Long:  "Runs serve with the given serve flags, reporting to the Windows service manager, as done by the installed service. Run from a console, it runs serve until interrupted, for trying the service flags out.",
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) error {
+		return runService(cmd.Context(), serviceName, args)
+	}),
+}
+
+func init() {
+	ServiceCmd.PersistentFlags().StringVarP(&serviceName, "service-name", "", serviceNameDefault, "Name of the Windows service, so that several serial ports can be served by services of their own")
+
+	ServiceCmd.AddCommand(ServiceInstallCmd)
+	ServiceCmd.AddCommand(ServiceUninstallCmd)
+	ServiceCmd.AddCommand(ServiceRunCmd)
+
+	RootCmd.AddCommand(ServiceCmd)
+}
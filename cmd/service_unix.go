@@ -0,0 +1,22 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+var errServiceUnavailable = errors.New("services are only available on Windows: use the service manager of the system, such as a systemd unit running serve")
+
+func installService(ctx context.Context, name string, args []string) error {
+	return errServiceUnavailable
+}
+
+func uninstallService(ctx context.Context, name string) error {
+	return errServiceUnavailable
+}
+
+func runService(ctx context.Context, name string, args []string) error {
+	return errServiceUnavailable
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// How long after failing the service is restarted.
+const serviceRestartDelay = 5 * time.Second
+
+// How long without failing resets the failure count, in seconds.
+const serviceFailureResetPeriod = 24 * 60 * 60
+
+// installService installs the service name, running serve with args.
+func installService(ctx context.Context, name string, args []string) (err error) {
+	logger := log.MustLogger(ctx)
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer func() { err = errors.Join(err, m.Disconnect()) }()
+
+	runArgs := append([]string{"service", "run", "--service-name", name, "--"}, args...)
+	s, err := m.CreateService(name, exePath, mgr.Config{
+		StartType:   mgr.StartAutomatic,
+		DisplayName: "serialtcp " + name,
+		Description: "Serves a serial port over TCP.",
+	}, runArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to install service: %s: %w", name, err)
+	}
+	defer func() { err = errors.Join(err, s.Close()) }()
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: serviceRestartDelay},
+	}, serviceFailureResetPeriod); err != nil {
+		return fmt.Errorf("failed to set service recovery actions: %w", err)
+	}
+	logger.Info("Installed service", "name", name, "args", runArgs)
+	return nil
+}
+
+// uninstallService stops the service name, if running, and uninstalls it.
+func uninstallService(ctx context.Context, name string) (err error) {
+	logger := log.MustLogger(ctx)
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer func() { err = errors.Join(err, m.Disconnect()) }()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("failed to open service: %s: %w", name, err)
+	}
+	defer func() { err = errors.Join(err, s.Close()) }()
+	if _, err := s.Control(svc.Stop); err != nil {
+		logger.Debug("Service not stopped", "error", err)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to uninstall service: %s: %w", name, err)
+	}
+	logger.Info("Uninstalled service", "name", name)
+	return nil
+}
+
+// serviceHandler runs serve as a service, stopping it gracefully on stop and shutdown requests.
+type serviceHandler struct {
+	ctx  context.Context
+	args []string
+	// Error serve ended with.
+	err error
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- runServe(ctx, h.args) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case h.err = <-errCh:
+			if h.err != nil {
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// runService runs serve with args as the service name or, outside of the service manager, until
+// interrupted.
+func runService(ctx context.Context, name string, args []string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to tell whether running as a service: %w", err)
+	}
+	if !isService {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		return runServe(ctx, args)
+	}
+	handler := &serviceHandler{ctx: ctx, args: args}
+	if err := svc.Run(name, handler); err != nil {
+		return fmt.Errorf("failed to run service: %s: %w", name, err)
+	}
+	return handler.err
+}
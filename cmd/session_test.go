@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// testPorts are the mock serial ports of tests, opened as test:NAME.
+var testPorts sync.Map
+
+func init() {
+	serialport.Register("test", func(name string, mode *serial.Mode) (serialport.Port, error) {
+		port, ok := testPorts.Load(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown test serial port: %s", name)
+		}
+		return port.(*serialport.Mock), nil
+	})
+}
+
+// newTestServer returns a server with the serve flag defaults for a mock serial port, which it
+// also returns, recording the types of the events it emits.
+func newTestServer(t *testing.T) (*server, *serialport.Mock, func() []EventType) {
+	t.Helper()
+	mode := &serial.Mode{BaudRate: 9600, DataBits: 8}
+	config, err := newServeConfig(mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := serialport.NewMock(mode)
+	testPorts.Store(t.Name(), mock)
+	t.Cleanup(func() { testPorts.Delete(t.Name()) })
+	config.PortName = "test:" + t.Name()
+
+	var mu sync.Mutex
+	var events []EventType
+	srv := newServer(*config, WithEventHandler(func(ctx context.Context, event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event.Type)
+	}))
+	return srv, mock, func() []EventType {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(events)
+	}
+}
+
+// testContext returns a context with a logger discarding logs, cancelled when t ends.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(log.WithLogger(context.Background(), slog.New(slog.DiscardHandler)))
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// startSession handles the server side of a TCP connection to srv in the background, returning
+// the client side, and the channel handleConnection returns its error to.
+func startSession(t *testing.T, ctx context.Context, srv *server) (net.Conn, <-chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- handleConnection(ctx, conn, srv) }()
+	return client, done
+}
+
+// waitSessionEnd waits for handleConnection to return, failing t if it does not in time.
+func waitSessionEnd(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("session did not end")
+		return nil
+	}
+}
+
+// readFull reads len(want) bytes from conn, failing t if they differ or do not arrive in time.
+func readFull(t *testing.T, conn net.Conn, want string) {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("read %q: %v", got, err)
+	}
+	if string(got) != want {
+		t.Fatalf("read %q, want %q", got, want)
+	}
+}
+
+// waitSessions waits for srv to have want sessions, failing t if it does not in time.
+func waitSessions(t *testing.T, srv *server, want int) []SessionInfo {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		sessions := srv.Sessions()
+		if len(sessions) == want {
+			return sessions
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d sessions, want %d", len(sessions), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleConnection(t *testing.T) {
+	ctx := testContext(t)
+	srv, mock, events := newTestServer(t)
+	client, done := startSession(t, ctx, srv)
+
+	// The mock loops data written to it back.
+	if _, err := io.WriteString(client, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	readFull(t, client, "ping\n")
+
+	mock.Receive([]byte("from the line"))
+	readFull(t, client, "from the line")
+
+	sessions := waitSessions(t, srv, 1)
+	if sessions[0].BytesToPort != 5 {
+		t.Errorf("%d bytes to port, want 5", sessions[0].BytesToPort)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitSessionEnd(t, done); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+	waitSessions(t, srv, 0)
+	if _, err := mock.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("port not closed: write returned %v", err)
+	}
+	stats := srv.Stats()
+	if stats.TotalSessions != 1 || stats.BytesToPort != 5 || stats.BytesToClient != 18 {
+		t.Errorf("stats: %d sessions, %d bytes to port, %d bytes to client, want 1, 5 and 18", stats.TotalSessions, stats.BytesToPort, stats.BytesToClient)
+	}
+	want := []EventType{EventConnect, EventPortOpen, EventPortClose, EventDisconnect}
+	if got := events(); !slices.Equal(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
+
+func TestHandleConnectionPortOpenFailure(t *testing.T) {
+	ctx := testContext(t)
+	srv, _, events := newTestServer(t)
+	srv.config.PortName = "test:missing"
+	client, done := startSession(t, ctx, srv)
+
+	if err := waitSessionEnd(t, done); err == nil {
+		t.Error("session did not fail")
+	}
+	// The connection is closed.
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("read from the client: %v, want EOF", err)
+	}
+	waitSessions(t, srv, 0)
+	if srv.Stats().TotalSessions != 0 {
+		t.Errorf("%d sessions started", srv.Stats().TotalSessions)
+	}
+	want := []EventType{EventConnect, EventError, EventDisconnect}
+	if got := events(); !slices.Equal(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
+
+func TestProbePortInUse(t *testing.T) {
+	ctx := testContext(t)
+	srv, _, _ := newTestServer(t)
+	client, done := startSession(t, ctx, srv)
+	if _, err := io.WriteString(client, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	readFull(t, client, "ping\n")
+
+	// Probing would close the mock, which the test backend opens for both, ending the session.
+	srv.setPortErr(errors.New("earlier failure"))
+	if err := srv.portHealth(ctx); err != nil {
+		t.Errorf("port health: %v", err)
+	}
+	if err := srv.probePort(ctx); err != nil {
+		t.Errorf("probe: %v", err)
+	}
+	if _, err := io.WriteString(client, "pong\n"); err != nil {
+		t.Fatal(err)
+	}
+	readFull(t, client, "pong\n")
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitSessionEnd(t, done); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+	if srv.portInUse() {
+		t.Error("port in use after the session ended")
+	}
+	if err := srv.probePort(ctx); err != nil {
+		t.Errorf("probe after the session ended: %v", err)
+	}
+}
+
+func TestHandleConnectionDraining(t *testing.T) {
+	ctx := testContext(t)
+	srv, _, events := newTestServer(t)
+	srv.SetDraining(true, "maintenance\n")
+	client, done := startSession(t, ctx, srv)
+
+	got, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "maintenance\n" {
+		t.Errorf("read %q, want the drain message", got)
+	}
+	if err := waitSessionEnd(t, done); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+	if got := events(); len(got) > 0 {
+		t.Errorf("events %v, want none", got)
+	}
+}
+
+func TestHandleConnectionCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(testContext(t))
+	srv, mock, events := newTestServer(t)
+	client, done := startSession(t, ctx, srv)
+
+	if _, err := io.WriteString(client, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	readFull(t, client, "ping")
+	waitSessions(t, srv, 1)
+
+	cancel()
+	if err := waitSessionEnd(t, done); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+	// Client, port and session slot are released.
+	if err := client.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("read from the client: %v, want EOF", err)
+	}
+	if _, err := mock.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("port not closed: write returned %v", err)
+	}
+	waitSessions(t, srv, 0)
+	if active := srv.Stats().ActiveSessions; active != 0 {
+		t.Errorf("%d active sessions", active)
+	}
+	want := []EventType{EventConnect, EventPortOpen, EventPortClose, EventDisconnect}
+	if got := events(); !slices.Equal(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
+
+// closer sends err to errCh when closed, as the copy routines fail once what they copy from is.
+type closer struct {
+	errCh  chan error
+	err    error
+	closed bool
+}
+
+func (c *closer) Close() error {
+	c.closed = true
+	c.errCh <- c.err
+	return nil
+}
+
+func TestEndSession(t *testing.T) {
+	errBoom := errors.New("boom")
+	for _, test := range []struct {
+		name      string
+		halfClose bool
+		cancel    bool
+		// Errors the copy routines return by themselves, before closing.
+		returned []error
+		want     error
+	}{
+		{name: "client done", returned: []error{nil}},
+		{name: "copy failed", returned: []error{errBoom}, want: errBoom},
+		{name: "half close", halfClose: true, returned: []error{nil, nil}},
+		{name: "half close, other direction failed", halfClose: true, returned: []error{nil, errBoom}, want: errBoom},
+		{name: "half close, waiting for the other direction", halfClose: true, cancel: true, returned: []error{nil}},
+		{name: "cancelled", cancel: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(testContext(t))
+			defer cancel()
+			errCh := make(chan error, 2)
+			for _, err := range test.returned {
+				errCh <- err
+			}
+			// Copy routines still running fail once closed.
+			pending := 2 - len(test.returned)
+			client := &closer{errCh: make(chan error, 1), err: errors.New("use of closed connection")}
+			port := &closer{errCh: make(chan error, 1), err: errors.New("port has been closed")}
+			go func() {
+				for range pending {
+					select {
+					case err := <-client.errCh:
+						errCh <- err
+					case err := <-port.errCh:
+						errCh <- err
+					}
+				}
+			}()
+			if test.cancel {
+				cancel()
+			}
+			sess := &session{}
+
+			err := endSession(ctx, errCh, test.halfClose, sess, client, port)
+			if !errors.Is(err, test.want) || (test.want == nil && err != nil) {
+				t.Errorf("endSession() = %v, want %v", err, test.want)
+			}
+			if !client.closed || !port.closed {
+				t.Errorf("client closed %v, port closed %v, want both", client.closed, port.closed)
+			}
+			if len(errCh) > 0 {
+				t.Error("returned before the copy routines")
+			}
+			wantErrors := uint64(0)
+			if test.want != nil {
+				wantErrors = 1
+			}
+			if got := sess.errors.Load(); got != wantErrors {
+				t.Errorf("%d session errors, want %d", got, wantErrors)
+			}
+		})
+	}
+}
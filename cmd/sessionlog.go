@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Session log line timestamp format.
+const sessionLogTimeFormat = "2006-01-02 15:04:05.000"
+
+// Lines longer than this are split in the session log.
+const sessionLogMaxLineLength = 4096
+
+// Direction markers of session log lines, with --log-input.
+const (
+	sessionLogReceived byte = '<'
+	sessionLogSent     byte = '>'
+)
+
+// sessionLogLine is a line being logged.
+type sessionLogLine struct {
+	start time.Time
+	data  []byte
+}
+
+// sessionLog appends a session to a file while enabled, one timestamped line at a time, as
+// conserver does. Received output and sent input are buffered into lines separately, so that echoes
+// do not break lines apart.
+type sessionLog struct {
+	path string
+	out  io.Writer
+
+	mu    sync.Mutex
+	file  *os.File
+	lines map[byte]*sessionLogLine
+}
+
+// writeLine writes a line, disabling logging on failure, without interrupting the session.
+func (l *sessionLog) writeLine(direction byte, line *sessionLogLine) {
+	prefix := line.start.Format(sessionLogTimeFormat)
+	if connectLogInput {
+		prefix += " " + string(direction)
+	}
+	if _, err := fmt.Fprintf(l.file, "%s %s\n", prefix, line.data); err != nil {
+		fmt.Fprintf(l.out, "\r\n[serialtcp] Session log disabled: %s\r\n", err)
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+func (l *sessionLog) write(direction byte, p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range p {
+		if l.file == nil {
+			return
+		}
+		if c == '\r' {
+			continue
+		}
+		line, ok := l.lines[direction]
+		if !ok {
+			line = &sessionLogLine{start: time.Now()}
+			l.lines[direction] = line
+		}
+		if c != '\n' {
+			line.data = append(line.data, c)
+		}
+		if c == '\n' || len(line.data) >= sessionLogMaxLineLength {
+			l.writeLine(direction, line)
+			delete(l.lines, direction)
+		}
+	}
+}
+
+// flush writes partial lines.
+func (l *sessionLog) flush() {
+	for _, direction := range []byte{sessionLogReceived, sessionLogSent} {
+		if line, ok := l.lines[direction]; ok && l.file != nil {
+			l.writeLine(direction, line)
+		}
+	}
+	l.lines = nil
+}
+
+// Received returns a writer logging received output, if enabled.
+func (l *sessionLog) Received() io.Writer {
+	return sessionLogWriter{l}
+}
+
+// Sent logs sent input, if enabled.
+func (l *sessionLog) Sent(p []byte) {
+	l.write(sessionLogSent, p)
+}
+
+// Toggle enables or disables logging.
+func (l *sessionLog) Toggle() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.flush()
+		if l.file == nil {
+			return false, nil
+		}
+		err := l.file.Close()
+		l.file = nil
+		return false, err
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return false, err
+	}
+	l.file = file
+	l.lines = map[byte]*sessionLogLine{}
+	return true, nil
+}
+
+// Close disables logging.
+func (l *sessionLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	l.flush()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// sessionLogWriter logs received output.
+type sessionLogWriter struct {
+	log *sessionLog
+}
+
+func (w sessionLogWriter) Write(p []byte) (int, error) {
+	w.log.write(sessionLogReceived, p)
+	return len(p), nil
+}
@@ -0,0 +1,103 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/kotaira/go-serial"
+)
+
+// Window size of shell pseudo terminals, as clients do not tell theirs.
+const (
+	shellRows = 24
+	shellCols = 80
+)
+
+// ptyPort is a serialport.Port backed by a program running on a pseudo terminal, such as a login
+// shell: reads come from what it writes to its terminal and writes are typed into it. Mode changes
+// are accepted and ignored, as there is no serial line, and modem control lines are not supported.
+type ptyPort struct {
+	cmd       *exec.Cmd
+	ptm       *os.File
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// startShell starts command with the system shell on a new pseudo terminal, with env added to its
+// environment.
+func startShell(command string, env []string) (*ptyPort, error) {
+	cmd := shellCommand(command, env)
+	// The pseudo terminal is its standard error too.
+	cmd.Stderr = nil
+	if os.Getenv("TERM") == "" {
+		cmd.Env = append(cmd.Env, "TERM=vt100")
+	}
+	ptm, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: shellRows, Cols: shellCols})
+	if err != nil {
+		return nil, err
+	}
+	return &ptyPort{cmd: cmd, ptm: ptm}, nil
+}
+
+func (p *ptyPort) SetMode(mode *serial.Mode) error { return nil }
+
+func (p *ptyPort) Read(b []byte) (int, error) {
+	n, err := p.ptm.Read(b)
+	// Linux fails reads with EIO once the program, and all others on the terminal, exited.
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EIO) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (p *ptyPort) Write(b []byte) (int, error) { return p.ptm.Write(b) }
+
+func (p *ptyPort) Drain() error { return nil }
+
+func (p *ptyPort) ResetInputBuffer() error { return nil }
+
+func (p *ptyPort) ResetOutputBuffer() error { return nil }
+
+func (p *ptyPort) SetDTR(dtr bool) error { return errExecUnsupported }
+
+func (p *ptyPort) SetRTS(rts bool) error { return errExecUnsupported }
+
+func (p *ptyPort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return &serial.ModemStatusBits{}, nil
+}
+
+func (p *ptyPort) SetReadTimeout(t time.Duration) error { return errExecUnsupported }
+
+func (p *ptyPort) Break(time.Duration) error { return errExecUnsupported }
+
+// CloseWrite types the end of file character, which programs reading lines take as the end of
+// their input.
+func (p *ptyPort) CloseWrite() error {
+	_, err := p.ptm.Write([]byte{0x04})
+	return err
+}
+
+// Close hangs up the terminal and terminates the program.
+func (p *ptyPort) Close() error {
+	p.closeOnce.Do(func() {
+		if err := p.ptm.Close(); err != nil {
+			p.closeErr = err
+		}
+		if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			p.closeErr = errors.Join(p.closeErr, err)
+		}
+		var exitErr *exec.ExitError
+		if err := p.cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+			p.closeErr = errors.Join(p.closeErr, err)
+		}
+	})
+	return p.closeErr
+}
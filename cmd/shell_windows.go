@@ -0,0 +1,13 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// startShell fails, as pseudo terminals, through ConPTY, are not supported on Windows: use --exec
+// instead.
+func startShell(command string, env []string) (serialport.Port, error) {
+	return nil, errors.New("--shell is not supported on Windows: use --exec instead")
+}
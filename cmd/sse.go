@@ -0,0 +1,181 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// Events queued for each subscriber, past which events are dropped for that subscriber.
+const sseClientQueue = 256
+
+// How often a comment is sent to idle subscribers, so proxies do not time out the stream.
+const sseKeepAlive = 15 * time.Second
+
+// sseEvent is a line of serial port output, as sent to subscribers.
+type sseEvent struct {
+	// When the line ended.
+	Time time.Time `json:"time"`
+	// Line, without its line ending.
+	Line string `json:"line"`
+}
+
+// sseSubscriber is a subscriber to the events of a hub.
+type sseSubscriber struct {
+	events chan []byte
+	// Count of events dropped because the queue was full.
+	dropped uint64
+}
+
+// sseHub fans lines of serial port output out to Server-Sent Events subscribers, see serve
+// --sse-address.
+type sseHub struct {
+	mu          sync.Mutex
+	subscribers map[*sseSubscriber]struct{}
+}
+
+func newSSEHub() *sseHub {
+	return &sseHub{subscribers: map[*sseSubscriber]struct{}{}}
+}
+
+func (h *sseHub) subscribe() *sseSubscriber {
+	subscriber := &sseSubscriber{events: make(chan []byte, sseClientQueue)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+// unsubscribe removes subscriber, returning how many events it missed.
+func (h *sseHub) unsubscribe(subscriber *sseSubscriber) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, subscriber)
+	return subscriber.dropped
+}
+
+// broadcast queues line to all subscribers, dropping it for those not keeping up.
+func (h *sseHub) broadcast(line []byte) {
+	data, err := json.Marshal(sseEvent{Time: time.Now(), Line: string(line)})
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscriber := range h.subscribers {
+		select {
+		case subscriber.events <- data:
+		default:
+			subscriber.dropped++
+		}
+	}
+}
+
+// Writer returns a writer broadcasting the lines of serial port output written to it, split at
+// maxLineLength.
+func (h *sseHub) Writer(maxLineLength int) *sseWriter {
+	return &sseWriter{hub: h, maxLineLength: maxLineLength}
+}
+
+// sseWriter splits serial port output into lines for a hub.
+type sseWriter struct {
+	hub           *sseHub
+	maxLineLength int
+	// Incomplete line.
+	line []byte
+}
+
+func (w *sseWriter) Write(p []byte) (int, error) {
+	data := p
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			w.line = append(w.line, data...)
+			break
+		}
+		w.line = append(w.line, data[:i]...)
+		w.hub.broadcast(bytes.TrimSuffix(w.line, []byte("\r")))
+		w.line = w.line[:0]
+		data = data[i+1:]
+	}
+	for len(w.line) >= w.maxLineLength {
+		w.hub.broadcast(w.line[:w.maxLineLength])
+		w.line = append(w.line[:0], w.line[w.maxLineLength:]...)
+	}
+	return len(p), nil
+}
+
+// streamEvents sends the events of hub to w, until the client goes away or ctx is done.
+func streamEvents(ctx context.Context, w http.ResponseWriter, r *http.Request, hub *sseHub) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming not supported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Dashboards are usually served from elsewhere.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	subscriber := hub.subscribe()
+	defer func() {
+		if dropped := hub.unsubscribe(subscriber); dropped > 0 {
+			log.MustLogger(ctx).Warn("Subscriber missed events", "dropped", dropped)
+		}
+	}()
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.Context().Done():
+			return nil
+		case data := <-subscriber.events:
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+	}
+}
+
+// serveSSE serves serial port output of hub as Server-Sent Events on listener at /events, until
+// ctx is done.
+func serveSSE(ctx context.Context, listener net.Listener, hub *sseHub) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		ctx, logger := log.MustWithGroupAttrs(ctx, "Subscriber", "RemoteAddr", r.RemoteAddr)
+		logger.Info("Subscribed")
+		if err := streamEvents(ctx, w, r, hub); err != nil {
+			logger.Debug("Failed to stream events", "error", err)
+		}
+		logger.Info("Unsubscribed")
+	})
+	httpServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
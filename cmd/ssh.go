@@ -0,0 +1,294 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// How long SSH clients may take to authenticate.
+const sshHandshakeTimeout = 10 * time.Second
+
+// Permissions extension marking sessions authenticated by a read only guest token.
+const sshReadOnlyExtension = "read-only"
+
+// Permissions extension recording how sessions authenticated: the public key fingerprint, or
+// tokenIdentity.
+const sshAuthExtension = "auth"
+
+var errSSHDeadline = errors.New("deadlines are not supported over SSH")
+
+// sshConn is a net.Conn over an SSH session channel.
+type sshConn struct {
+	ssh.Channel
+	conn     *ssh.ServerConn
+	readOnly bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (c *sshConn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *sshConn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *sshConn) SetDeadline(t time.Time) error      { return errSSHDeadline }
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return errSSHDeadline }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return errSSHDeadline }
+func (c *sshConn) ReadOnly() bool                     { return c.readOnly }
+
+func (c *sshConn) AuthIdentity() string {
+	return fmt.Sprintf("ssh:%s %s", c.conn.User(), c.conn.Permissions.Extensions[sshAuthExtension])
+}
+
+// Close ends the session with a zero exit status, so ssh clients exit cleanly.
+func (c *sshConn) Close() error {
+	c.closeOnce.Do(func() {
+		status := ssh.Marshal(struct{ Status uint32 }{0})
+		_, err := c.SendRequest("exit-status", false, status)
+		c.closeErr = errors.Join(err, c.Channel.Close())
+		if errors.Is(c.closeErr, net.ErrClosed) {
+			c.closeErr = nil
+		}
+	})
+	return c.closeErr
+}
+
+// sshListener is a net.Listener accepting SSH sessions, each bridged to the serial port as a
+// connection. Clients authenticate with a public key from --ssh-authorized-keys or, with
+// --token-auth, with a guest token as password.
+type sshListener struct {
+	ctx      context.Context
+	listener net.Listener
+	config   *ssh.ServerConfig
+	conns    chan net.Conn
+	done     chan struct{}
+}
+
+// loadSSHHostKey loads the host key from --ssh-host-key, or generates one, whose fingerprint is
+// logged for clients to verify.
+func loadSSHHostKey(ctx context.Context) (ssh.Signer, error) {
+	if sshHostKey != "" {
+		pem, err := os.ReadFile(sshHostKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH host key: %s: %w", sshHostKey, err)
+		}
+		return signer, nil
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	logger := log.MustLogger(ctx)
+	logger.Warn("Using a generated SSH host key, which changes on every start", "ssh-host-key-fingerprint", ssh.FingerprintSHA256(signer.PublicKey()))
+	return signer, nil
+}
+
+// loadSSHAuthorizedKeys loads public keys from an authorized_keys file.
+func loadSSHAuthorizedKeys(path string) ([]ssh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse authorized keys: %s: %w", path, err)
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	return keys, nil
+}
+
+// sshKeys holds the keys of the SSH server, loaded up front so that errors in them are found
+// before serving.
+type sshKeys struct {
+	hostKey ssh.Signer
+	// Keys from --ssh-authorized-keys, if given.
+	authorizedKeys []ssh.PublicKey
+}
+
+// loadSSHKeys loads the keys of the SSH server, for serving config.
+func loadSSHKeys(ctx context.Context, config *ServerConfig) (*sshKeys, error) {
+	if sshAuthorizedKeys == "" && !config.TokenAuth {
+		return nil, errors.New("--ssh-address requires --ssh-authorized-keys or --token-auth")
+	}
+	keys := &sshKeys{}
+	if sshAuthorizedKeys != "" {
+		var err error
+		keys.authorizedKeys, err = loadSSHAuthorizedKeys(sshAuthorizedKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hostKey, err := loadSSHHostKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys.hostKey = hostKey
+	return keys, nil
+}
+
+// sshServerConfig returns the configuration of the SSH server, with keys.
+func sshServerConfig(srv *server, keys *sshKeys) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{}
+	if sshAuthorizedKeys != "" {
+		config.PublicKeyCallback = func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, authorized := range keys.authorizedKeys {
+				if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+					return &ssh.Permissions{Extensions: map[string]string{
+						sshAuthExtension: ssh.FingerprintSHA256(key),
+					}}, nil
+				}
+			}
+			return nil, errors.New("unauthorized public key")
+		}
+	}
+	if srv.config.TokenAuth {
+		config.PasswordCallback = func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			grant, err := srv.redeemToken(string(password))
+			if err != nil {
+				return nil, err
+			}
+			permissions := &ssh.Permissions{Extensions: map[string]string{sshAuthExtension: tokenIdentity}}
+			if grant.readOnly {
+				permissions.Extensions[sshReadOnlyExtension] = "true"
+			}
+			return permissions, nil
+		}
+	}
+	config.AddHostKey(keys.hostKey)
+	return config
+}
+
+// listenSSH listens for SSH clients on address, with keys.
+func listenSSH(ctx context.Context, address string, srv *server, keys *sshKeys) (net.Listener, error) {
+	config := sshServerConfig(srv, keys)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %s: %w", address, err)
+	}
+	l := &sshListener{
+		ctx:      ctx,
+		listener: listener,
+		config:   config,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *sshListener) run() {
+	defer close(l.done)
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake authenticates the client, and serves its session channels.
+func (l *sshListener) handshake(conn net.Conn) {
+	logger := log.MustLogger(l.ctx)
+	if err := conn.SetDeadline(time.Now().Add(sshHandshakeTimeout)); err != nil {
+		conn.Close()
+		return
+	}
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, l.config)
+	if err != nil {
+		logger.Info("SSH handshake failed", "remote-addr", conn.RemoteAddr(), "error", err)
+		conn.Close()
+		return
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		serverConn.Close()
+		return
+	}
+	logger.Info("SSH authenticated", "remote-addr", conn.RemoteAddr(), "user", serverConn.User())
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go l.session(&sshConn{
+			Channel:  channel,
+			conn:     serverConn,
+			readOnly: serverConn.Permissions.Extensions[sshReadOnlyExtension] == "true",
+		}, channelRequests)
+	}
+}
+
+// session handles the requests of a session channel, handing it to Accept once a shell is
+// requested.
+func (l *sshListener) session(conn *sshConn, requests <-chan *ssh.Request) {
+	started := false
+	for request := range requests {
+		ok := false
+		switch request.Type {
+		case "shell":
+			ok = !started
+			if ok {
+				started = true
+				go l.deliver(conn)
+			}
+		case "pty-req", "env", "window-change":
+			ok = true
+		}
+		if request.WantReply {
+			request.Reply(ok, nil)
+		}
+	}
+}
+
+func (l *sshListener) deliver(conn *sshConn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *sshListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *sshListener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *sshListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
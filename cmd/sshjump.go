@@ -0,0 +1,197 @@
+//go:build !minimal
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// How long connecting to the jump host may take.
+const sshJumpTimeout = 15 * time.Second
+
+// Identity files tried when --ssh-identity is not given, as ssh does.
+var sshDefaultIdentities = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshJumpConn is a connection tunneled through a jump host, closing the SSH connection with it.
+type sshJumpConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *sshJumpConn) Close() error {
+	err := c.Conn.Close()
+	if clientErr := c.client.Close(); clientErr != nil && !errors.Is(clientErr, net.ErrClosed) {
+		err = errors.Join(err, clientErr)
+	}
+	return err
+}
+
+// parseSSHTarget parses [user@]host[:port], defaulting to the local user and port 22.
+func parseSSHTarget(target string) (string, string, error) {
+	name, hostPort, ok := strings.Cut(target, "@")
+	if !ok {
+		hostPort = target
+		current, err := user.Current()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get user name: %w", err)
+		}
+		// Windows user names include the domain.
+		_, name, _ = strings.Cut(current.Username, `\`)
+		if name == "" {
+			name = current.Username
+		}
+	}
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(hostPort, "22")
+	}
+	return name, hostPort, nil
+}
+
+// sshSigner loads a private key, asking for its passphrase on the terminal, if needed.
+func sshSigner(path string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%s is encrypted, and there is no terminal to ask for its passphrase", path)
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", path)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(pem, passphrase)
+}
+
+// sshAuthMethods returns the agent, if running, and the identity files: --ssh-identity, or the
+// default ones which exist and are not encrypted.
+func sshAuthMethods() ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if clientSSHIdentity != "" {
+		signer, err := sshSigner(clientSSHIdentity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH identity: %w", err)
+		}
+		return append(methods, ssh.PublicKeys(signer)), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return methods, nil
+	}
+	var signers []ssh.Signer
+	for _, name := range sshDefaultIdentities {
+		pem, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(pem); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods, nil
+}
+
+// sshHostKeyCallback verifies host keys against --ssh-known-hosts, returning the key algorithms
+// known for hostPort, so that the server is asked for a key which can be verified.
+func sshHostKeyCallback(hostPort string) (ssh.HostKeyCallback, []string, error) {
+	path := clientSSHKnownHosts
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load SSH known hosts: %w", err)
+	}
+	// Looking up a key which can not match returns the known ones.
+	var algorithms []string
+	var keyErr *knownhosts.KeyError
+	placeholder := &net.TCPAddr{IP: net.IPv4zero}
+	if err := callback(hostPort, placeholder, sshPlaceholderKey{}); errors.As(err, &keyErr) {
+		for _, known := range keyErr.Want {
+			// RSA keys sign with SHA-2 as well.
+			if known.Key.Type() == ssh.KeyAlgoRSA {
+				algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+			}
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil, nil, fmt.Errorf("%s is not in %s, connect to it with ssh first to verify its host key", hostPort, path)
+	}
+	return callback, algorithms, nil
+}
+
+// sshPlaceholderKey is a public key matching no known host.
+type sshPlaceholderKey struct{}
+
+func (sshPlaceholderKey) Type() string                        { return "placeholder" }
+func (sshPlaceholderKey) Marshal() []byte                     { return []byte("placeholder") }
+func (sshPlaceholderKey) Verify([]byte, *ssh.Signature) error { return errors.New("placeholder") }
+
+// dialSSHJump connects to address, either host:port or a Unix domain socket, through the jump host
+// given by --ssh.
+func dialSSHJump(address string) (net.Conn, error) {
+	network, addr := splitAddress(address)
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("only host:port and Unix domain socket addresses can be reached through SSH: %s", address)
+	}
+	name, hostPort, err := parseSSHTarget(clientSSH)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, algorithms, err := sshHostKeyCallback(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := sshAuthMethods()
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", hostPort, &ssh.ClientConfig{
+		User:              name,
+		Auth:              methods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: algorithms,
+		Timeout:           sshJumpTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH jump host %s: %w", hostPort, err)
+	}
+	conn, err := client.Dial(network, addr)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to connect through SSH jump host: %w", err), client.Close())
+	}
+	return &sshJumpConn{Conn: conn, client: client}, nil
+}
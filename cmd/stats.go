@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// throughput returns the average bytes per second transferred over duration.
+func throughput(bytes uint64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(bytes) / duration.Seconds()
+}
+
+// logSessionStats logs statistics of a session.
+func logSessionStats(ctx context.Context, info SessionInfo) {
+	logger := log.MustLogger(ctx)
+	duration := time.Since(info.Start)
+	logger.Info(
+		"Session statistics",
+		"id", info.ID,
+		"remote-addr", info.RemoteAddr,
+		"duration", duration,
+		"bytes-to-client", info.BytesToClient,
+		"bytes-to-port", info.BytesToPort,
+		"bytes-dropped", info.BytesDropped,
+		"bytes-per-second-to-client", throughput(info.BytesToClient, duration),
+		"bytes-per-second-to-port", throughput(info.BytesToPort, duration),
+		"errors", info.Errors,
+	)
+}
+
+// logStats logs server wide statistics, followed by statistics of each active session.
+func logStats(ctx context.Context, srv *server) {
+	logger := log.MustLogger(ctx)
+	stats := srv.Stats()
+	duration := time.Since(stats.Start)
+	logger.Info(
+		"Server statistics",
+		"uptime", duration,
+		"active-sessions", stats.ActiveSessions,
+		"total-sessions", stats.TotalSessions,
+		"bytes-to-client", stats.BytesToClient,
+		"bytes-to-port", stats.BytesToPort,
+		"bytes-dropped", stats.BytesDropped,
+		"bytes-per-second-to-client", throughput(stats.BytesToClient, duration),
+		"bytes-per-second-to-port", throughput(stats.BytesToPort, duration),
+		"errors", stats.Errors,
+	)
+	for _, info := range srv.Sessions() {
+		logSessionStats(ctx, info)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// dumpStatsOnSignal logs statistics on every SIGUSR1, until ctx is done.
+func dumpStatsOnSignal(ctx context.Context, srv *server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			logStats(ctx, srv)
+		}
+	}
+}
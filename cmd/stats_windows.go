@@ -0,0 +1,6 @@
+package main
+
+import "context"
+
+// dumpStatsOnSignal does nothing, as there is no SIGUSR1 on Windows: use ctl stats instead.
+func dumpStatsOnSignal(ctx context.Context, srv *server) {}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// stdioAddr is the address of a stdioConn.
+type stdioAddr string
+
+func (a stdioAddr) Network() string { return "stdio" }
+func (a stdioAddr) String() string  { return string(a) }
+
+// stdioConn is a net.Conn over the standard input and output, such as pipes from an SSH server.
+type stdioConn struct {
+	in  *os.File
+	out *os.File
+}
+
+func (c stdioConn) Read(p []byte) (int, error)  { return c.in.Read(p) }
+func (c stdioConn) Write(p []byte) (int, error) { return c.out.Write(p) }
+func (c stdioConn) Close() error                { return errors.Join(c.in.Close(), c.out.Close()) }
+func (c stdioConn) CloseWrite() error           { return c.out.Close() }
+func (c stdioConn) LocalAddr() net.Addr         { return stdioAddr("stdio") }
+
+// RemoteAddr returns the SSH client address, when run by an SSH server, or "stdio".
+func (c stdioConn) RemoteAddr() net.Addr {
+	// SSH_CLIENT holds the client address, client port and server port.
+	if fields := strings.Fields(os.Getenv("SSH_CLIENT")); len(fields) == 3 {
+		return stdioAddr(net.JoinHostPort(fields[0], fields[1]))
+	}
+	return stdioAddr("stdio")
+}
+
+func (c stdioConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.in.SetReadDeadline(t), c.out.SetWriteDeadline(t))
+}
+func (c stdioConn) SetReadDeadline(t time.Time) error  { return c.in.SetReadDeadline(t) }
+func (c stdioConn) SetWriteDeadline(t time.Time) error { return c.out.SetWriteDeadline(t) }
+
+// stdioConnection returns the connection at the standard input and output. Under inetd, it is a
+// socket, which is used directly so the client address is known.
+func stdioConnection() net.Conn {
+	// Only sockets, as net.FileConn makes the file non blocking, breaking reads from os.Stdin.
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.FileConn(os.Stdin); err == nil {
+			return conn
+		}
+	}
+	return stdioConn{in: os.Stdin, out: os.Stdout}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var allowSteal bool
+var allowStealDefault = false
+
+var clientSteal bool
+var clientStealDefault = false
+
+// stealRequest starts the line busy clients send to take over the session, followed, with
+// --token-auth, by a token minted with ctl token --steal.
+const stealRequest = "STEAL"
+
+// Sent to busy clients with --allow-steal, after the busy message or their position in line.
+const stealHint = "Send STEAL to take over the session\r\n"
+
+// How long clients turned away by a full queue, or by --busy-policy refuse, have to send a steal
+// request.
+const stealTimeout = 10 * time.Second
+
+// How long clients with --steal wait for the server to tell them it is busy.
+const stealWait = 2 * time.Second
+
+// stealConn is a connection whose steal request redeemed a token, so it is not authenticated again.
+type stealConn struct {
+	*bufferedConn
+	readOnly bool
+}
+
+func (c *stealConn) ReadOnly() bool       { return c.readOnly }
+func (c *stealConn) AuthIdentity() string { return tokenIdentity }
+
+// stealWatch watches a busy connection for a steal request.
+type stealWatch struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// Closed once watching ends, with the fields below set.
+	done chan struct{}
+	// Whether a valid steal request was received.
+	stole bool
+	// Whether the steal request redeemed a token, granting the session.
+	redeemed bool
+	grant    tokenGrant
+	err      error
+}
+
+// watchSteal starts watching conn for a steal request, until data other than a steal request is
+// received, or stop is called. With --token-auth, the request must carry a token granting it.
+func watchSteal(conn net.Conn, srv *server) *stealWatch {
+	w := &stealWatch{conn: conn, reader: bufio.NewReader(conn), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		// Peek, so that other data is left for the session.
+		prefix, err := w.reader.Peek(len(stealRequest))
+		if err != nil || string(prefix) != stealRequest {
+			return
+		}
+		line, err := w.reader.ReadString('\n')
+		if err != nil {
+			w.err = fmt.Errorf("failed to read steal request: %w", err)
+			return
+		}
+		w.stole, w.grant, w.err = redeemSteal(strings.Fields(line)[1:], srv)
+		w.redeemed = w.stole && srv.config.TokenAuth
+	}()
+	return w
+}
+
+// redeemSteal checks the arguments of a steal request, redeeming its token with --token-auth.
+func redeemSteal(args []string, srv *server) (bool, tokenGrant, error) {
+	if !srv.config.TokenAuth {
+		return true, tokenGrant{}, nil
+	}
+	if len(args) != 1 {
+		return false, tokenGrant{}, errors.New("steal request without a token")
+	}
+	grant, err := srv.redeemToken(args[0])
+	if err != nil {
+		return false, tokenGrant{}, err
+	}
+	if !grant.steal {
+		return false, tokenGrant{}, errors.New("token does not grant taking over sessions")
+	}
+	return true, grant, nil
+}
+
+// stop stops watching, and returns the connection to use for further reads, which is
+// authenticated if the steal request redeemed a token.
+func (w *stealWatch) stop() (net.Conn, error) {
+	// Interrupt the pending read.
+	if err := w.conn.SetReadDeadline(time.Now()); err != nil {
+		return nil, err
+	}
+	<-w.done
+	if err := w.conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	conn := &bufferedConn{Conn: w.conn, reader: w.reader}
+	if w.redeemed {
+		return &stealConn{bufferedConn: conn, readOnly: w.grant.readOnly}, nil
+	}
+	return conn, nil
+}
+
+// takeOver disconnects the sessions in progress, telling them who took over.
+func (s *server) takeOver(ctx context.Context, by string) []string {
+	logger := log.MustLogger(ctx)
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	holders := make([]string, 0, len(sessions))
+	for _, sess := range sessions {
+		holders = append(holders, sess.remoteAddr)
+		_, err := fmt.Fprintf(sess.toClient, "\r\nSession taken over by %s\r\n", by)
+		if err := errors.Join(err, sess.client.Close()); err != nil {
+			logger.Debug("Failed to disconnect session taken over", "id", sess.id, "error", err)
+		}
+	}
+	return holders
+}
+
+// requestSteal waits briefly for the server on conn to tell it is busy, then asks to take over
+// the session, with token, if set. It returns the connection to use, with what the server sent
+// left to be read, and whether a steal request was sent.
+func requestSteal(conn net.Conn, token string) (net.Conn, bool, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(stealWait)); err != nil {
+		return nil, false, err
+	}
+	var received []byte
+	buf := make([]byte, 512)
+	for !bytes.Contains(received, []byte(stealHint)) {
+		n, err := conn.Read(buf)
+		received = append(received, buf[:n]...)
+		// Timing out means the server is not busy; other errors are left for the session.
+		if err != nil {
+			break
+		}
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, false, err
+	}
+	requested := bytes.Contains(received, []byte(stealHint))
+	if requested {
+		request := stealRequest
+		if token != "" {
+			request += " " + token
+		}
+		if _, err := fmt.Fprintf(conn, "%s\n", request); err != nil {
+			return nil, false, fmt.Errorf("failed to send steal request: %w", err)
+		}
+	}
+	reader := bufio.NewReader(io.MultiReader(bytes.NewReader(received), conn))
+	return &bufferedConn{Conn: conn, reader: reader}, requested, nil
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+)
+
+// openAuditSyslog connects to the syslog daemon at address, see parseSyslogAddress, sending audit
+// records with the auth facility.
+func openAuditSyslog(address string) (io.WriteCloser, error) {
+	network, addr, err := parseSyslogAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := syslog.Dial(network, addr, syslog.LOG_AUTH|syslog.LOG_INFO, "serialtcp-audit")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return writer, nil
+}
+
+// newSyslogHandler returns a slog.Handler sending records to the syslog daemon at address, see
+// parseSyslogAddress, with facility and tag, and their level mapped to a severity.
+func newSyslogHandler(address string, facility SyslogFacility, tag string, addSource bool) (slog.Handler, error) {
+	network, addr, err := parseSyslogAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := syslog.Dial(network, addr, syslog.Priority(facility<<3)|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return newSeverityHandler(addSource, func(level slog.Level, message []byte) error {
+		switch syslog.Priority(syslogSeverity(level)) {
+		case syslog.LOG_ERR:
+			return writer.Err(string(message))
+		case syslog.LOG_WARNING:
+			return writer.Warning(string(message))
+		case syslog.LOG_INFO:
+			return writer.Info(string(message))
+		default:
+			return writer.Debug(string(message))
+		}
+	}), nil
+}
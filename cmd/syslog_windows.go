@@ -0,0 +1,19 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+)
+
+var errSyslogWindows = errors.New("syslog is not supported on Windows")
+
+// openAuditSyslog fails, as there is no syslog on Windows: use --audit-log instead.
+func openAuditSyslog(address string) (io.WriteCloser, error) {
+	return nil, errSyslogWindows
+}
+
+// newSyslogHandler fails, as there is no syslog on Windows: use --log-file instead.
+func newSyslogHandler(address string, facility SyslogFacility, tag string, addSource bool) (slog.Handler, error) {
+	return nil, errSyslogWindows
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// First file descriptor passed by systemd socket activation, see sd_listen_fds(3).
+const sdListenFdsStart = 3
+
+// sdListener returns the listener passed by systemd socket activation, or nil if the process was
+// not socket activated.
+func sdListener() (net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %w", err)
+	}
+	if fds != 1 {
+		return nil, fmt.Errorf("expected exactly 1 socket from systemd, got %d", fds)
+	}
+
+	f := os.NewFile(sdListenFdsStart, "LISTEN_FD_3")
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to use systemd socket: %w", err), f.Close())
+	}
+	return listener, f.Close()
+}
+
+// sdNotify sends state to the systemd notification socket, see sd_notify(3). It is a no-op when
+// not running under systemd with Type=notify.
+func sdNotify(state string) (err error) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd notify socket: %w", err)
+	}
+	defer func() { err = errors.Join(err, conn.Close()) }()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// sdWatchdogInterval returns the interval at which the systemd watchdog must be fed, or 0 if the
+// watchdog is not enabled, see sd_watchdog_enabled(3).
+func sdWatchdogInterval() time.Duration {
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid != os.Getpid() {
+			return 0
+		}
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// How often the serial ports are probed again before notifying systemd of readiness.
+const sdReadyRetry = 5 * time.Second
+
+// sdReady notifies systemd of readiness once the serial port of each of servers, as changed by
+// reloads, opens, retrying until it does or ctx is done, so that a missing device fails the start
+// of Type=notify units by their timeout. It returns immediately when not running under systemd.
+func sdReady(ctx context.Context, servers func() []*server) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	logger := log.MustLogger(ctx)
+	for {
+		var err error
+		for _, srv := range servers() {
+			err = errors.Join(err, srv.probePort(ctx))
+		}
+		if err == nil {
+			break
+		}
+		logger.Error("Serial port not ready, not notifying systemd", "error", err)
+		if sleep(ctx, sdReadyRetry) != nil {
+			return
+		}
+	}
+	if err := sdNotify("READY=1"); err != nil {
+		logger.Error("Failed to notify systemd", "error", err)
+	}
+}
+
+// sdWatchdog feeds the systemd watchdog while the serial port of each of servers, as changed by
+// reloads, is healthy, see portHealth, until ctx is done, so that systemd restarts the service
+// once a device is gone. It returns immediately when the watchdog is not enabled.
+func sdWatchdog(ctx context.Context, servers func() []*server) {
+	logger := log.MustLogger(ctx)
+
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var err error
+			for _, srv := range servers() {
+				err = errors.Join(err, srv.portHealth(ctx))
+			}
+			if err != nil {
+				logger.Warn("Serial port unhealthy, not feeding systemd watchdog", "error", err)
+				continue
+			}
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				logger.Error("Failed to feed systemd watchdog", "error", err)
+			}
+		}
+	}
+}
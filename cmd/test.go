@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+)
+
+var testLatencyCount int
+var testLatencyCountDefault = 100
+
+var testLatencyInterval time.Duration
+var testLatencyIntervalDefault = 100 * time.Millisecond
+
+var testLatencyTimeout time.Duration
+var testLatencyTimeoutDefault = time.Second
+
+var testLatencySize int
+var testLatencySizeDefault = 0
+
+// Marks latency probe frames, so that other data received is ignored.
+const latencyProbeMarker = "serialtcp-probe"
+
+var TestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Test a server and the serial link behind it.",
+	Long:  "Measures the path through a server to the serial port. These expect the data sent to the serial port to be echoed back, with a loopback plug (TX jumped to RX) or a device echoing what it receives.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cmd.Help(); err != nil {
+			logger := log.MustLogger(cmd.Context())
+			logger.Error("Failed to display help", "err", err)
+		}
+		Exit(1)
+	},
+}
+
+// latencyEcho is a latency probe received back.
+type latencyEcho struct {
+	seq  int
+	sent time.Time
+}
+
+// readLatencyEchoes sends the probes read from r to echoes, until it fails.
+func readLatencyEchoes(r io.Reader, echoes chan<- latencyEcho) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		_, frame, ok := strings.Cut(scanner.Text(), latencyProbeMarker+" ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(frame)
+		if len(fields) < 2 {
+			continue
+		}
+		seq, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		sent, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		echoes <- latencyEcho{seq: seq, sent: time.Unix(0, sent)}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// latencyPercentile returns the p percentile of the sorted rtts.
+func latencyPercentile(rtts []time.Duration, p float64) time.Duration {
+	return rtts[max(0, int(math.Ceil(p*float64(len(rtts))))-1)]
+}
+
+// printLatency prints the round trip times of count probes sent.
+func printLatency(w io.Writer, count int, rtts []time.Duration) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Sent:\t%d\n", count)
+	fmt.Fprintf(tw, "Received:\t%d\n", len(rtts))
+	fmt.Fprintf(tw, "Lost:\t%d\n", count-len(rtts))
+	if len(rtts) > 0 {
+		slices.Sort(rtts)
+		var total time.Duration
+		for _, rtt := range rtts {
+			total += rtt
+		}
+		fmt.Fprintf(tw, "Min:\t%s\n", rtts[0])
+		fmt.Fprintf(tw, "Avg:\t%s\n", total/time.Duration(len(rtts)))
+		fmt.Fprintf(tw, "P99:\t%s\n", latencyPercentile(rtts, 0.99))
+		fmt.Fprintf(tw, "Max:\t%s\n", rtts[len(rtts)-1])
+	}
+	return tw.Flush()
+}
+
+// waitLatencyEcho waits for the echo of probe seq, returning its round trip time, or false when it
+// timed out.
+func waitLatencyEcho(ctx context.Context, echoes <-chan latencyEcho, readErr <-chan error, seq int) (time.Duration, bool, error) {
+	timer := time.NewTimer(testLatencyTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case echo := <-echoes:
+			// Echoes of probes which timed out are late, not lost.
+			if echo.seq == seq {
+				return time.Since(echo.sent), true, nil
+			}
+		case <-timer.C:
+			return 0, false, nil
+		case err := <-readErr:
+			return 0, false, fmt.Errorf("failed to read: %w", err)
+		case <-ctx.Done():
+			return 0, false, ctx.Err()
+		}
+	}
+}
+
+var TestLatencyCmd = &cobra.Command{
+	Use:   "latency",
+	Short: "Measure round trip latency.",
+	Long:  "Sends timestamped probe frames, one at a time, and reports the round trip time of their echoes. Compare runs to choose between serve settings such as --low-latency, --write-queue-size and --client-buffer-size.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx, logger := log.MustWithAttrs(
+			cmd.Context(),
+			"address", clientAddress,
+			"count", testLatencyCount,
+			"interval", testLatencyInterval,
+			"timeout", testLatencyTimeout,
+			"size", testLatencySize,
+		)
+		if testLatencyCount < 1 {
+			return fmt.Errorf("invalid count: %d", testLatencyCount)
+		}
+		if testLatencySize < 0 {
+			return fmt.Errorf("invalid size: %d", testLatencySize)
+		}
+
+		conn, err := clientDial()
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, conn.Close()) }()
+
+		echoes := make(chan latencyEcho, 1)
+		readErr := make(chan error, 1)
+		go func() { readErr <- readLatencyEchoes(conn, echoes) }()
+
+		logger.Info("Sending probes")
+		padding := strings.Repeat("x", testLatencySize)
+		rtts := make([]time.Duration, 0, testLatencyCount)
+		for seq := range testLatencyCount {
+			if seq > 0 {
+				select {
+				case <-time.After(testLatencyInterval):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if _, err := fmt.Fprintf(conn, "%s %d %d %s\n", latencyProbeMarker, seq, time.Now().UnixNano(), padding); err != nil {
+				return fmt.Errorf("failed to send probe: %w", err)
+			}
+			rtt, ok, err := waitLatencyEcho(ctx, echoes, readErr, seq)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				logger.Warn("Probe lost", "seq", seq)
+				continue
+			}
+			rtts = append(rtts, rtt)
+		}
+		return printLatency(cmd.OutOrStdout(), testLatencyCount, rtts)
+	}),
+}
+
+func init() {
+	addClientFlags(TestCmd.PersistentFlags())
+
+	TestLatencyCmd.PersistentFlags().IntVarP(&testLatencyCount, "count", "c", testLatencyCountDefault, "Number of probes to send")
+	TestLatencyCmd.PersistentFlags().DurationVarP(&testLatencyInterval, "interval", "i", testLatencyIntervalDefault, "Delay between probes")
+	TestLatencyCmd.PersistentFlags().DurationVarP(&testLatencyTimeout, "timeout", "", testLatencyTimeoutDefault, "How long to wait for the echo of each probe, before counting it lost")
+	TestLatencyCmd.PersistentFlags().IntVarP(&testLatencySize, "size", "s", testLatencySizeDefault, "Bytes of padding added to each probe, to measure larger frames")
+	TestCmd.AddCommand(TestLatencyCmd)
+
+	RootCmd.AddCommand(TestCmd)
+}
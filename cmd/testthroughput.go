@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/spf13/cobra"
+
+	"github.com/fornellas/serialtcp/rfc2217"
+)
+
+var testThroughputDuration time.Duration
+var testThroughputDurationDefault = 10 * time.Second
+
+var testThroughputBaudRates []int
+var testThroughputBaudRatesDefault = []int{}
+
+var testThroughputRFC2217 bool
+var testThroughputRFC2217Default = false
+
+var testThroughputWindow int
+var testThroughputWindowDefault = 4096
+
+var testThroughputTimeout time.Duration
+var testThroughputTimeoutDefault = 2 * time.Second
+
+// prbs15 generates the PRBS15 pseudo random bit sequence (x^15 + x^14 + 1), as used by bit error
+// rate testers.
+type prbs15 struct {
+	state uint16
+}
+
+func newPRBS15() *prbs15 {
+	return &prbs15{state: 0x7fff}
+}
+
+func (p *prbs15) next() byte {
+	bit := (p.state>>14 ^ p.state>>13) & 1
+	p.state = (p.state<<1 | bit) & 0x7fff
+	return byte(bit)
+}
+
+// fill fills b with the next bytes of the sequence, most significant bit first.
+func (p *prbs15) fill(b []byte) {
+	for i := range b {
+		var v byte
+		for range 8 {
+			v = v<<1 | p.next()
+		}
+		b[i] = v
+	}
+}
+
+// prbs15Checker counts bit errors in a received PRBS15 sequence. It is self synchronizing,
+// predicting each bit from the 15 received before it, so it recovers right after lost bytes, at
+// the cost of a flipped bit counting up to three times: when received, and when each tap reaches
+// it.
+type prbs15Checker struct {
+	state  uint16
+	bits   uint64
+	errors uint64
+}
+
+func (c *prbs15Checker) Write(p []byte) (int, error) {
+	for _, b := range p {
+		for i := 7; i >= 0; i-- {
+			bit := uint16(b>>i) & 1
+			if c.bits >= 15 && bit != (c.state>>14^c.state>>13)&1 {
+				c.errors++
+			}
+			c.state = (c.state<<1 | bit) & 0x7fff
+			c.bits++
+		}
+	}
+	return len(p), nil
+}
+
+// throughputResult is the outcome of testing throughput at a baud rate.
+type throughputResult struct {
+	baudRate int
+	sent     int64
+	received int64
+	// Bytes given up on, after not receiving anything for --timeout.
+	lost        int64
+	first, last time.Time
+	checker     prbs15Checker
+}
+
+func (r *throughputResult) receive(chunk []byte) {
+	now := time.Now()
+	if r.first.IsZero() {
+		r.first = now
+	}
+	r.last = now
+	r.received += int64(len(chunk))
+	if _, err := r.checker.Write(chunk); err != nil {
+		panic(err)
+	}
+}
+
+// inflight returns the bytes sent and not received nor lost yet.
+func (r *throughputResult) inflight() int64 {
+	return max(0, r.sent-r.received-r.lost)
+}
+
+// throughput returns the bytes per second received, or 0, if too little was received to tell.
+func (r *throughputResult) throughput() float64 {
+	elapsed := r.last.Sub(r.first)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(r.received) / elapsed.Seconds()
+}
+
+// measureThroughput streams the PRBS15 sequence to w for --duration, with at most --window
+// bytes unechoed, checking the echoes received at chunks.
+func measureThroughput(ctx context.Context, w io.Writer, chunks <-chan []byte, readErr <-chan error, baudRate int) (*throughputResult, error) {
+	logger := log.MustLogger(ctx)
+	result := &throughputResult{baudRate: baudRate}
+	generator := newPRBS15()
+	buf := make([]byte, 256)
+	deadline := time.Now().Add(testThroughputDuration)
+	for {
+		sending := time.Now().Before(deadline)
+		if sending && result.inflight() < int64(testThroughputWindow) {
+			select {
+			case chunk := <-chunks:
+				result.receive(chunk)
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+				n := min(int64(len(buf)), int64(testThroughputWindow)-result.inflight())
+				generator.fill(buf[:n])
+				if _, err := w.Write(buf[:n]); err != nil {
+					return nil, fmt.Errorf("failed to send: %w", err)
+				}
+				result.sent += n
+			}
+			continue
+		}
+		if !sending && result.inflight() == 0 {
+			break
+		}
+		select {
+		case chunk := <-chunks:
+			result.receive(chunk)
+		case <-time.After(testThroughputTimeout):
+			logger.Warn("Nothing received, counting bytes in flight as lost", "bytes", result.inflight())
+			result.lost += result.inflight()
+		case err := <-readErr:
+			return nil, fmt.Errorf("failed to read: %w", err)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	result.lost = max(0, result.sent-result.received)
+	return result, nil
+}
+
+// printThroughput prints the throughput test results.
+func printThroughput(w io.Writer, results []*throughputResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "BAUD RATE\tSENT\tRECEIVED\tLOST\tTHROUGHPUT\tBIT ERRORS\tBER\n")
+	for _, result := range results {
+		baudRate := "current"
+		if result.baudRate > 0 {
+			baudRate = strconv.Itoa(result.baudRate)
+		}
+		ber := "-"
+		if result.checker.bits > 0 {
+			ber = fmt.Sprintf("%.2e", float64(result.checker.errors)/float64(result.checker.bits))
+		}
+		fmt.Fprintf(
+			tw, "%s\t%d\t%d\t%d\t%.0f B/s\t%d\t%s\n",
+			baudRate, result.sent, result.received, result.lost, result.throughput(), result.checker.errors, ber,
+		)
+	}
+	return tw.Flush()
+}
+
+// readChunks sends copies of what is read from r to chunks, until it fails.
+func readChunks(r io.Reader, chunks chan<- []byte) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunks <- append([]byte(nil), buf[:n]...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var TestThroughputCmd = &cobra.Command{
+	Use:   "throughput",
+	Short: "Measure throughput and bit errors.",
+	Long:  "Streams a PRBS15 pseudo random bit sequence, as bit error rate testers do, and reports the throughput and bit errors of its echoes, to validate cabling and adapters. With --baud-rate, each baud rate is tested in turn, which requires the server running with --rfc2217; the port is left at the last one.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx, logger := log.MustWithAttrs(
+			cmd.Context(),
+			"address", clientAddress,
+			"duration", testThroughputDuration,
+			"baud-rate", testThroughputBaudRates,
+			"rfc2217", testThroughputRFC2217,
+			"window", testThroughputWindow,
+			"timeout", testThroughputTimeout,
+		)
+		if testThroughputWindow < 1 {
+			return fmt.Errorf("invalid window: %d", testThroughputWindow)
+		}
+		if len(testThroughputBaudRates) > 0 && !testThroughputRFC2217 {
+			return errors.New("--baud-rate requires --rfc2217")
+		}
+
+		conn, err := clientDial()
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, conn.Close()) }()
+
+		var link io.ReadWriter = conn
+		var control *rfc2217.ClientConn
+		if testThroughputRFC2217 {
+			control, err = rfc2217.NewClientConn(conn)
+			if err != nil {
+				return fmt.Errorf("failed to negotiate RFC 2217: %w", err)
+			}
+			link = control
+		}
+
+		chunks := make(chan []byte, 16)
+		readErr := make(chan error, 1)
+		go func() { readErr <- readChunks(link, chunks) }()
+
+		baudRates := testThroughputBaudRates
+		if len(baudRates) == 0 {
+			baudRates = []int{0}
+		}
+		var results []*throughputResult
+		for _, baudRate := range baudRates {
+			if baudRate > 0 {
+				logger.Info("Setting baud rate", "baud-rate", baudRate)
+				if err := control.SetBaudRate(baudRate); err != nil {
+					return fmt.Errorf("failed to set baud rate: %w", err)
+				}
+			}
+			logger.Info("Testing", "baud-rate", baudRate)
+			result, err := measureThroughput(ctx, link, chunks, readErr, baudRate)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+		}
+		return printThroughput(cmd.OutOrStdout(), results)
+	}),
+}
+
+func init() {
+	TestThroughputCmd.PersistentFlags().DurationVarP(&testThroughputDuration, "duration", "d", testThroughputDurationDefault, "How long to send for, at each baud rate")
+	TestThroughputCmd.PersistentFlags().IntSliceVarP(&testThroughputBaudRates, "baud-rate", "b", testThroughputBaudRatesDefault, "Baud rates to test, in turn; may be given multiple times (default the current one)")
+	TestThroughputCmd.PersistentFlags().BoolVarP(&testThroughputRFC2217, "rfc2217", "", testThroughputRFC2217Default, "Speak Telnet with the RFC 2217 Com Port Control Option, to set the baud rate; the server must be running with --rfc2217")
+	TestThroughputCmd.PersistentFlags().IntVarP(&testThroughputWindow, "window", "", testThroughputWindowDefault, "Bytes sent and not echoed yet at most, so that what is sent does not outpace the port")
+	TestThroughputCmd.PersistentFlags().DurationVarP(&testThroughputTimeout, "timeout", "", testThroughputTimeoutDefault, "How long to wait for echoes, before counting the bytes in flight as lost")
+	TestCmd.AddCommand(TestThroughputCmd)
+}
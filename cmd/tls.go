@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var tlsCert string
+var tlsCertDefault = ""
+
+var tlsKey string
+var tlsKeyDefault = ""
+
+var clientTLSCA string
+var clientTLSCADefault = ""
+
+var clientTLSFingerprint string
+var clientTLSFingerprintDefault = ""
+
+var clientTLSInsecure bool
+var clientTLSInsecureDefault = false
+
+// Application protocol negotiated over TLS.
+const tlsALPN = "serialtcp"
+
+// How long self-signed certificates are valid for.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// certificateFingerprint returns the SHA-256 fingerprint of a DER encoded certificate, as hex.
+func certificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// selfSignedCertificate generates a self-signed certificate for this host.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "serialtcp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// serverTLSConfig returns the TLS configuration of serve, from --tls-cert and --tls-key, or with a
+// self-signed certificate, whose fingerprint is logged, for clients to pin.
+func serverTLSConfig(ctx context.Context) (*tls.Config, error) {
+	logger := log.MustLogger(ctx)
+	var certificate tls.Certificate
+	var err error
+	switch {
+	case tlsCert != "" && tlsKey != "":
+		certificate, err = tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+	case tlsCert != "" || tlsKey != "":
+		return nil, errors.New("--tls-cert and --tls-key must be given together")
+	default:
+		certificate, err = selfSignedCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate self-signed TLS certificate: %w", err)
+		}
+		logger.Warn("Using a self-signed TLS certificate, clients must pin it with --tls-fingerprint", "tls-fingerprint", certificateFingerprint(certificate.Certificate[0]))
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{tlsALPN},
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// clientTLSConfig returns the TLS configuration of clients connecting to serverName, verifying the
+// server certificate against --tls-ca or the system roots, pinning it with --tls-fingerprint, or
+// not at all with --tls-insecure.
+func clientTLSConfig(serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverName,
+		NextProtos: []string{tlsALPN},
+		MinVersion: tls.VersionTLS13,
+	}
+	switch {
+	case clientTLSFingerprint != "":
+		fingerprint := strings.ToLower(strings.ReplaceAll(clientTLSFingerprint, ":", ""))
+		// Pinning replaces chain verification.
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || certificateFingerprint(rawCerts[0]) != fingerprint {
+				return errors.New("server TLS certificate does not match --tls-fingerprint")
+			}
+			return nil
+		}
+	case clientTLSInsecure:
+		config.InsecureSkipVerify = true
+	case clientTLSCA != "":
+		pem, err := os.ReadFile(clientTLSCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientTLSCA)
+		}
+	}
+	return config, nil
+}
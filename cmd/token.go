@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+)
+
+// How long clients have to send their token after connecting.
+const tokenTimeout = 10 * time.Second
+
+// tokenGrant is the access granted by a guest token.
+type tokenGrant struct {
+	expires  time.Time
+	readOnly bool
+	// Whether it may take over sessions in progress, with --allow-steal.
+	steal bool
+}
+
+// MintToken creates a single use token valid for ttl, granting read only or read write access, and
+// optionally taking over sessions in progress.
+func (s *server) MintToken(ttl time.Duration, readOnly, steal bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := rand.Text()
+	s.tokens[token] = tokenGrant{
+		expires:  time.Now().Add(ttl),
+		readOnly: readOnly,
+		steal:    steal,
+	}
+	return token
+}
+
+// redeemToken consumes token, returning the access it grants.
+func (s *server) redeemToken(token string) (tokenGrant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for t, grant := range s.tokens {
+		if now.After(grant.expires) {
+			delete(s.tokens, t)
+		}
+	}
+	grant, ok := s.tokens[token]
+	if !ok {
+		return tokenGrant{}, errors.New("invalid or expired token")
+	}
+	delete(s.tokens, token)
+	return grant, nil
+}
+
+// bufferedConn is a net.Conn which reads through a bufio.Reader, so data buffered while reading
+// the token is not lost.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// NetConn returns the buffered connection.
+func (c *bufferedConn) NetConn() net.Conn { return c.Conn }
+
+// authenticate reads a token line from conn and redeems it. The returned connection must be used
+// for further reads.
+func authenticate(conn net.Conn, srv *server) (net.Conn, tokenGrant, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(tokenTimeout)); err != nil {
+		return nil, tokenGrant{}, err
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, tokenGrant{}, fmt.Errorf("failed to read token: %w", err)
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, tokenGrant{}, err
+	}
+
+	grant, err := srv.redeemToken(strings.TrimSpace(line))
+	if err != nil {
+		if _, writeErr := fmt.Fprintf(conn, "ERROR %s\r\n", err); writeErr != nil {
+			err = errors.Join(err, writeErr)
+		}
+		return nil, tokenGrant{}, err
+	}
+	return &bufferedConn{Conn: conn, reader: reader}, grant, nil
+}
+
+// Identity of clients authenticated by a guest token, see ConnectionInfo.Auth.
+const tokenIdentity = "token"
+
+// preauthenticatedConn is a connection authenticated by its transport, such as SSH.
+type preauthenticatedConn interface {
+	net.Conn
+	// ReadOnly returns whether the session is read only.
+	ReadOnly() bool
+	// AuthIdentity returns who the client authenticated as, see ConnectionInfo.Auth.
+	AuthIdentity() string
+}
+
+// authentication is how a client authenticated.
+type authentication struct {
+	// Whether the session is read only.
+	readOnly bool
+	// Who the client authenticated as, see ConnectionInfo.Auth.
+	identity string
+}
+
+// authenticateConn authenticates conn with --token-auth, unless its transport already did,
+// returning the connection to use for further reads and how it authenticated.
+func authenticateConn(ctx context.Context, conn net.Conn, srv *server) (net.Conn, authentication, error) {
+	if conn, ok := conn.(preauthenticatedConn); ok {
+		return conn, authentication{readOnly: conn.ReadOnly(), identity: conn.AuthIdentity()}, nil
+	}
+	if !srv.config.TokenAuth {
+		return conn, authentication{}, nil
+	}
+	logger := log.MustLogger(ctx)
+	logger.Info("Authenticating")
+	authConn, grant, err := authenticate(conn, srv)
+	if err != nil {
+		return nil, authentication{}, err
+	}
+	logger.Info("Authenticated", "read-only", grant.readOnly)
+	return authConn, authentication{readOnly: grant.readOnly, identity: tokenIdentity}, nil
+}
+
+var errReadOnly = errors.New("read only session")
+
+// readOnlyPort rejects all RFC 2217 control operations.
+type readOnlyPort struct{}
+
+func (readOnlyPort) SetMode(*serial.Mode) error { return errReadOnly }
+func (readOnlyPort) SetDTR(bool) error          { return errReadOnly }
+func (readOnlyPort) SetRTS(bool) error          { return errReadOnly }
+func (readOnlyPort) Break(time.Duration) error  { return errReadOnly }
+func (readOnlyPort) ResetInputBuffer() error    { return errReadOnly }
+func (readOnlyPort) ResetOutputBuffer() error   { return errReadOnly }
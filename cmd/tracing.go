@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// Spans buffered for export at most, beyond which they are dropped.
+const traceQueueSize = 2048
+
+// Spans sent per export request at most.
+const traceBatchSize = 512
+
+// How often buffered spans are exported.
+const traceExportInterval = 5 * time.Second
+
+// OTLP span kinds.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+)
+
+// tracer records spans of sessions and serial port operations, exporting them with OTLP over
+// HTTP, JSON encoded, configured by the standard OTEL_* environment variables. A nil *tracer
+// records nothing.
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	timeout  time.Duration
+	// Resource attributes, including service.name.
+	resource []otlpAttribute
+	client   *http.Client
+	queue    chan otlpSpan
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// newTracerFromEnv returns a tracer configured by the OTEL_* environment variables, or nil if
+// tracing is not configured: it is enabled by OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, unless OTEL_SDK_DISABLED is true or OTEL_TRACES_EXPORTER is
+// none. Spans are exported until ctx is done or shutdown is called.
+func newTracerFromEnv(ctx context.Context) (*tracer, error) {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return nil, nil
+	}
+	if exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter == "none" {
+		return nil, nil
+	} else if exporter != "" && exporter != "otlp" {
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER: %s: only otlp is supported", exporter)
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil, nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid OTLP traces endpoint: %w", err)
+	}
+	protocol := otelEnv("PROTOCOL")
+	if protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol: %s: only http/json is supported", protocol)
+	}
+	headers, err := parseOTELList(otelEnv("HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP headers: %w", err)
+	}
+	timeout := 10 * time.Second
+	if value := otelEnv("TIMEOUT"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP timeout: %w", err)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	resource, err := otelResource()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t := &tracer{
+		endpoint: endpoint,
+		headers:  headers,
+		timeout:  timeout,
+		resource: resource,
+		client:   &http.Client{Timeout: timeout},
+		queue:    make(chan otlpSpan, traceQueueSize),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go t.run(ctx)
+	return t, nil
+}
+
+// otelEnv returns the OTEL_EXPORTER_OTLP_TRACES_ variable of name, or else the
+// OTEL_EXPORTER_OTLP_ one.
+func otelEnv(name string) string {
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_" + name); value != "" {
+		return value
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
+
+// parseOTELList parses a list of URL encoded key=value pairs, separated by commas, as used by
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_RESOURCE_ATTRIBUTES.
+func parseOTELList(list string) (map[string]string, error) {
+	values := map[string]string{}
+	for item := range strings.SplitSeq(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing '=': %s", item)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, nil
+}
+
+// otelResource returns the resource attributes, from OTEL_RESOURCE_ATTRIBUTES and
+// OTEL_SERVICE_NAME, which defaults to serialtcp.
+func otelResource() ([]otlpAttribute, error) {
+	attributes, err := parseOTELList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		attributes["service.name"] = name
+	} else if _, ok := attributes["service.name"]; !ok {
+		attributes["service.name"] = "serialtcp"
+	}
+	resource := make([]otlpAttribute, 0, len(attributes))
+	for key, value := range attributes {
+		resource = append(resource, newOTLPAttribute(key, value))
+	}
+	return resource, nil
+}
+
+// run exports queued spans in batches, every traceExportInterval, until ctx is done, then exports
+// the remaining ones.
+func (t *tracer) run(ctx context.Context) {
+	defer close(t.done)
+	logger := log.MustLogger(ctx)
+	ticker := time.NewTicker(traceExportInterval)
+	defer ticker.Stop()
+	var batch []otlpSpan
+	export := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(ctx, batch); err != nil {
+			logger.Error("Failed to export traces", "error", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				export(ctx)
+			}
+		case <-ticker.C:
+			export(ctx)
+		case <-ctx.Done():
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					export(context.WithoutCancel(ctx))
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown stops exporting, once spans ended so far are exported.
+func (t *tracer) shutdown() {
+	if t == nil {
+		return
+	}
+	t.cancel()
+	<-t.done
+}
+
+// export sends spans to the OTLP endpoint.
+func (t *tracer) export(ctx context.Context, spans []otlpSpan) (err error) {
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: t.resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "serialtcp"}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		request.Header.Set(key, value)
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, response.Body.Close()) }()
+	if response.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("%s: %s: %s", t.endpoint, response.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+type spanContextKey struct{}
+
+// span is an operation, within a trace. A nil *span records nothing.
+type span struct {
+	tracer  *tracer
+	traceID [16]byte
+	id      [8]byte
+	parent  [8]byte
+	name    string
+	kind    int
+	start   time.Time
+
+	mu         sync.Mutex
+	attributes []otlpAttribute
+	events     []otlpEvent
+}
+
+// start starts a span named name, as a child of the span in ctx, if any, returning a context
+// holding it. Attributes are given as alternating keys and values.
+func (t *tracer) start(ctx context.Context, name string, kind int, attributes ...any) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.traceID = parent.traceID
+		s.parent = parent.id
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.id[:])
+	s.setAttributes(attributes...)
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// spanFromContext returns the span in ctx, or nil.
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanContextKey{}).(*span)
+	return s
+}
+
+// startSpan starts a span as a child of the one in ctx, if any.
+func startSpan(ctx context.Context, name string, attributes ...any) (context.Context, *span) {
+	parent := spanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.start(ctx, name, spanKindInternal, attributes...)
+}
+
+// setAttributes sets attributes, given as alternating keys and values.
+func (s *span) setAttributes(attributes ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, otlpAttributes(attributes)...)
+}
+
+// addEvent records an event named name, with attributes given as alternating keys and values.
+func (s *span) addEvent(name string, attributes ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, otlpEvent{
+		TimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		Name:         name,
+		Attributes:   otlpAttributes(attributes),
+	})
+}
+
+// end ends the span, failed if err is not nil, queueing it for export.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	ended := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.id[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:        s.attributes,
+		Events:            s.events,
+	}
+	s.mu.Unlock()
+	if s.parent != ([8]byte{}) {
+		ended.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if err != nil {
+		ended.Status = &otlpStatus{Code: otlpStatusError, Message: err.Error()}
+	}
+	select {
+	case s.tracer.queue <- ended:
+	default:
+	}
+}
+
+// WithTracer traces sessions with t.
+func WithTracer(t *tracer) ServerOption {
+	return func(s *server) {
+		s.tracer = t
+		s.Subscribe(t.handler())
+	}
+}
+
+// handler returns an EventHandler recording events in the span of their session.
+func (t *tracer) handler() EventHandler {
+	return func(ctx context.Context, event Event) {
+		span := spanFromContext(ctx)
+		switch event.Type {
+		case EventConnect:
+			span.setAttributes(
+				"serialtcp.session.id", event.Session.ID,
+				"serialtcp.port.name", event.Session.PortName,
+				"serialtcp.auth", event.Session.Auth,
+				"serialtcp.write", !event.Session.ReadOnly,
+			)
+		case EventError:
+			span.addEvent("exception", "exception.message", event.Err.Error())
+		case EventDisconnect:
+			if event.Stats != nil {
+				span.setAttributes(
+					"serialtcp.bytes_to_client", event.Stats.BytesToClient,
+					"serialtcp.bytes_to_port", event.Stats.BytesToPort,
+					"serialtcp.bytes_dropped", event.Stats.BytesDropped,
+				)
+			}
+		default:
+			span.addEvent(event.Type.String())
+		}
+	}
+}
+
+// OTLP/JSON encoding of traces, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+const otlpStatusError = 2
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newOTLPAttribute(key string, value any) otlpAttribute {
+	attribute := otlpAttribute{Key: key}
+	switch value := value.(type) {
+	case string:
+		attribute.Value.StringValue = &value
+	case bool:
+		attribute.Value.BoolValue = &value
+	case int:
+		intValue := strconv.Itoa(value)
+		attribute.Value.IntValue = &intValue
+	case uint64:
+		intValue := strconv.FormatUint(value, 10)
+		attribute.Value.IntValue = &intValue
+	case float64:
+		attribute.Value.DoubleValue = &value
+	default:
+		stringValue := fmt.Sprint(value)
+		attribute.Value.StringValue = &stringValue
+	}
+	return attribute
+}
+
+// otlpAttributes converts alternating keys and values to attributes.
+func otlpAttributes(keyValues []any) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(keyValues)/2)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		attributes = append(attributes, newOTLPAttribute(fmt.Sprint(keyValues[i]), keyValues[i+1]))
+	}
+	return attributes
+}
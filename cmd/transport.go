@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Transport is how the serial stream is carried between clients and the server.
+type Transport int
+
+const (
+	// Plain TCP, or Unix domain sockets, Windows named pipes or WebSocket, as given by the address.
+	TransportTCP Transport = iota
+	// QUIC, with TLS 1.3, over UDP.
+	TransportQUIC
+)
+
+var transportNames = map[Transport]string{
+	TransportTCP:  "tcp",
+	TransportQUIC: "quic",
+}
+
+// TransportValue implements pflag.Value for Transport
+type TransportValue Transport
+
+func (t *TransportValue) String() string {
+	return transportNames[Transport(*t)]
+}
+
+func (t *TransportValue) Set(s string) error {
+	for transport, name := range transportNames {
+		if strings.EqualFold(s, name) {
+			*t = TransportValue(transport)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid transport: %s", s)
+}
+
+func (t *TransportValue) Type() string {
+	return "transport"
+}
+
+var transport = TransportValue(TransportTCP)
+
+var clientTransport = TransportValue(TransportTCP)
+
+// checkQUICAddress verifies address is a host:port, as QUIC runs over UDP only.
+func checkQUICAddress(address string) error {
+	if network, _ := splitAddress(address); network != "tcp" {
+		return fmt.Errorf("QUIC requires a host:port address: %s", address)
+	}
+	return nil
+}
+
+// transportListen returns a function listening on address with the --transport of serve.
+func transportListen(ctx context.Context, address string) (func() (net.Listener, error), error) {
+	if Transport(transport) != TransportQUIC {
+		return func() (net.Listener, error) { return listen(address) }, nil
+	}
+	if err := checkQUICAddress(address); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := serverTLSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func() (net.Listener, error) { return listenQUIC(address, tlsConfig) }, nil
+}
+
+// transportDial connects to address with the --transport of clients, through the --ssh jump host,
+// if any.
+func transportDial(address string) (net.Conn, error) {
+	if Transport(clientTransport) != TransportQUIC {
+		if clientSSH != "" {
+			return dialSSHJump(address)
+		}
+		return dial(address)
+	}
+	if clientSSH != "" {
+		return nil, errors.New("QUIC can not be tunneled through SSH")
+	}
+	if err := checkQUICAddress(address); err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := clientTLSConfig(host)
+	if err != nil {
+		return nil, err
+	}
+	return dialQUIC(address, tlsConfig)
+}
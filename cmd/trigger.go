@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+var triggerValues []string
+var triggerValuesDefault = []string{}
+
+var triggerCooldown time.Duration
+var triggerCooldownDefault = 5 * time.Second
+
+// TriggerMatch describes a trigger pattern matching serial port output, as posted to webhooks.
+type TriggerMatch struct {
+	Time    time.Time `json:"time"`
+	Pattern string    `json:"pattern"`
+	// Matched text, and the text of its subexpressions.
+	Match  string   `json:"match"`
+	Groups []string `json:"groups,omitempty"`
+	// Line matched, without line ending, which may be incomplete, such as for prompts.
+	Line      string `json:"line"`
+	PortName  string `json:"port_name"`
+	SessionID uint64 `json:"session_id"`
+}
+
+// Environ returns m as environment variables, in the form "key=value".
+func (m TriggerMatch) Environ() []string {
+	env := []string{
+		"SERIALTCP_TRIGGER_PATTERN=" + m.Pattern,
+		"SERIALTCP_TRIGGER_MATCH=" + m.Match,
+		"SERIALTCP_TRIGGER_LINE=" + m.Line,
+	}
+	for i, group := range m.Groups {
+		env = append(env, fmt.Sprintf("SERIALTCP_TRIGGER_GROUP_%d=%s", i+1, group))
+	}
+	return env
+}
+
+// trigger runs an action when its pattern matches serial port output, see serve --trigger.
+type trigger struct {
+	pattern *regexp.Regexp
+	// Command run by the system shell, or http:// or https:// URL to post matches to.
+	action string
+	// Minimum time between runs of the action.
+	cooldown time.Duration
+
+	mu sync.Mutex
+	// When the action last ran, for the cooldown.
+	last time.Time
+}
+
+// parseTriggers parses triggers given as regex=action, running at most once per cooldown.
+func parseTriggers(values []string, cooldown time.Duration) ([]*trigger, error) {
+	triggers := make([]*trigger, 0, len(values))
+	for _, value := range values {
+		expr, action, ok := strings.Cut(value, "=")
+		if !ok || expr == "" || action == "" {
+			return nil, fmt.Errorf("invalid trigger, expected regex=command: %s", value)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger pattern: %s: %w", expr, err)
+		}
+		triggers = append(triggers, &trigger{pattern: pattern, action: action, cooldown: cooldown})
+	}
+	return triggers, nil
+}
+
+func (t *trigger) isWebhook() bool {
+	lower := strings.ToLower(t.action)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// cool returns whether the cooldown since the last run is over, starting a new one if so.
+func (t *trigger) cool(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.last.IsZero() && now.Sub(t.last) < t.cooldown {
+		return false
+	}
+	t.last = now
+	return true
+}
+
+// run runs the action for match, with env describing the session added to commands environment.
+func (t *trigger) run(ctx context.Context, match TriggerMatch, env []string) error {
+	if t.isWebhook() {
+		return postJSON(ctx, t.action, match)
+	}
+	cmd := shellCommand(t.action, append(env, match.Environ()...))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run: %s: %w", t.action, err)
+	}
+	return nil
+}
+
+// fire runs the action for match in the background, unless cooling down.
+func (t *trigger) fire(ctx context.Context, match TriggerMatch, env []string) {
+	logger := log.MustLogger(ctx)
+	if !t.cool(match.Time) {
+		logger.Debug("Trigger cooling down", "pattern", match.Pattern, "match", strconv.Quote(match.Match))
+		return
+	}
+	logger.Info("Trigger", "pattern", match.Pattern, "match", strconv.Quote(match.Match))
+	// Actions must not stall serial port reads.
+	go func() {
+		if err := t.run(context.WithoutCancel(ctx), match, env); err != nil {
+			logger.Error("Failed to run trigger", "pattern", match.Pattern, "error", err)
+		}
+	}()
+}
+
+// triggerWriter matches triggers against serial port output written to it, line by line. As
+// prompts are not followed by a line ending, incomplete lines are matched as well, with each
+// trigger firing at most once per line.
+type triggerWriter struct {
+	ctx      context.Context
+	triggers []*trigger
+	info     ConnectionInfo
+	// Lines longer than this are ended, see --max-line-length.
+	maxLineLength int
+
+	line  []byte
+	fired map[*trigger]bool
+}
+
+func newTriggerWriter(ctx context.Context, triggers []*trigger, info ConnectionInfo, maxLineLength int) *triggerWriter {
+	return &triggerWriter{ctx: ctx, triggers: triggers, info: info, maxLineLength: maxLineLength, fired: map[*trigger]bool{}}
+}
+
+func (w *triggerWriter) match(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	for _, t := range w.triggers {
+		if w.fired[t] {
+			continue
+		}
+		submatches := t.pattern.FindSubmatch(line)
+		if submatches == nil {
+			continue
+		}
+		w.fired[t] = true
+		match := TriggerMatch{
+			Time:      time.Now(),
+			Pattern:   t.pattern.String(),
+			Match:     string(submatches[0]),
+			Line:      string(line),
+			PortName:  w.info.PortName,
+			SessionID: w.info.ID,
+		}
+		for _, group := range submatches[1:] {
+			match.Groups = append(match.Groups, string(group))
+		}
+		t.fire(w.ctx, match, w.info.Environ())
+	}
+}
+
+func (w *triggerWriter) endLine() {
+	w.line = w.line[:0]
+	clear(w.fired)
+}
+
+// Write matches triggers in p. It never fails.
+func (w *triggerWriter) Write(p []byte) (int, error) {
+	data := p
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			w.line = append(w.line, data...)
+			break
+		}
+		w.line = append(w.line, data[:i]...)
+		data = data[i+1:]
+		w.match(w.line)
+		w.endLine()
+	}
+	if len(w.line) > 0 {
+		w.match(w.line)
+	}
+	if len(w.line) > w.maxLineLength {
+		w.endLine()
+	}
+	return len(p), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+
+	"github.com/fornellas/serialtcp/mux"
+)
+
+var connectAddress string
+var connectAddressDefault = ""
+
+var connectID string
+var connectIDDefault = ""
+
+var connectSecretFile string
+var connectSecretFileDefault = ""
+
+// Sent by servers as their first line to a relay, followed by their ID and secret, if any, to
+// register with it.
+const registerRequest = "REGISTER"
+
+// Replied by relays to accepted registrations, others getting an ERROR line.
+const registerOK = "OK"
+
+// How long relays have to reply to registrations.
+const registerTimeout = 10 * time.Second
+
+// Bounds of the delay between attempts to connect to the relay.
+const (
+	tunnelMinBackoff = time.Second
+	tunnelMaxBackoff = time.Minute
+)
+
+// tunnel accepts connections of clients through a relay, which opens them as streams multiplexed
+// over a connection to it, made by the server, such as from behind NAT. The relay names the port
+// each stream is for, which is empty unless serving --named-port.
+type tunnel struct {
+	address string
+	id      string
+	secret  string
+	// Whether streams are accepted as they come, rather than by the named port they are for.
+	confirm bool
+	session *mux.Session
+}
+
+// newTunnel returns the tunnel of --connect. With confirm, streams are accepted before being
+// returned, and streams naming a port refused.
+func newTunnel(confirm bool) (*tunnel, error) {
+	if strings.ContainsAny(connectID, " \t\r\n") || connectID == "" {
+		return nil, fmt.Errorf("invalid relay ID, it must be set and not contain spaces: %q", connectID)
+	}
+	t := &tunnel{address: connectAddress, id: connectID, confirm: confirm}
+	if connectSecretFile != "" {
+		secret, err := os.ReadFile(connectSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read relay secret: %w", err)
+		}
+		t.secret = strings.TrimSpace(string(secret))
+		if t.secret == "" || strings.ContainsAny(t.secret, " \t\r\n") {
+			return nil, fmt.Errorf("invalid relay secret in %s: it must be a single word", connectSecretFile)
+		}
+	}
+	return t, nil
+}
+
+// register connects to the relay and registers with it.
+func (t *tunnel) register() (*mux.Session, error) {
+	conn, err := dial(t.address)
+	if err != nil {
+		return nil, err
+	}
+	request := registerRequest + " " + t.id
+	if t.secret != "" {
+		request += " " + t.secret
+	}
+	if err := conn.SetDeadline(time.Now().Add(registerTimeout)); err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", request); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to register: %w", err), conn.Close())
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read registration reply: %w", err), conn.Close())
+	}
+	if reply := strings.TrimSpace(line); reply != registerOK {
+		return nil, errors.Join(fmt.Errorf("registration refused: %s", reply), conn.Close())
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+	return mux.Server(&bufferedConn{Conn: conn, reader: reader}), nil
+}
+
+// Accept waits for the next client connection through the relay, connecting to it as needed,
+// backing off exponentially while that fails. It returns an error only when ctx is done.
+func (t *tunnel) Accept(ctx context.Context) (net.Conn, error) {
+	ctx, logger := log.MustWithGroupAttrs(ctx, "Relay", "Address", t.address, "ID", t.id)
+	backoff := tunnelMinBackoff
+	for {
+		if t.session == nil {
+			session, err := t.register()
+			if err != nil {
+				logger.Warn("Failed to connect to relay, retrying", "error", err, "delay", backoff)
+				if err := sleep(ctx, backoff); err != nil {
+					return nil, err
+				}
+				backoff = min(2*backoff, tunnelMaxBackoff)
+				continue
+			}
+			logger.Info("Registered with relay")
+			context.AfterFunc(ctx, func() { _ = session.Close() })
+			t.session = session
+			backoff = tunnelMinBackoff
+		}
+		stream, err := t.session.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.Warn("Lost connection to relay", "error", err)
+			t.session = nil
+			continue
+		}
+		if !t.confirm {
+			return stream, nil
+		}
+		if stream.Name() != "" {
+			logger.Info("Refusing connection for a named port", "named-port", stream.Name())
+			if err := stream.Refuse("not serving named ports"); err != nil {
+				logger.Debug("Failed to refuse connection", "error", err)
+			}
+			continue
+		}
+		if err := stream.Confirm(); err != nil {
+			logger.Debug("Failed to accept connection", "error", err)
+			continue
+		}
+		return stream, nil
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var errUARTCountersUnsupported = errors.New("UART counters are not supported")
+
+// UARTCounters are the serial port driver counters. They are cumulative since the driver was
+// loaded, not since the port was opened.
+type UARTCounters struct {
+	Time          time.Time `json:"time"`
+	RX            uint64    `json:"rx"`
+	TX            uint64    `json:"tx"`
+	Frame         uint64    `json:"frame"`
+	Overrun       uint64    `json:"overrun"`
+	Parity        uint64    `json:"parity"`
+	Break         uint64    `json:"break"`
+	BufferOverrun uint64    `json:"buffer_overrun"`
+}
+
+// errors returns the sum of all error counters.
+func (c *UARTCounters) errors() uint64 {
+	return c.Frame + c.Overrun + c.Parity + c.BufferOverrun
+}
+
+// pollUARTCounters periodically reads the driver counters of the open serial port, until ctx is
+// done. Errors and breaks are logged when they increase.
+func pollUARTCounters(ctx context.Context, srv *server, interval time.Duration) {
+	logger := log.MustLogger(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var counters *UARTCounters
+		if err := srv.withPorts(func(port serialport.Port) error {
+			var err error
+			counters, err = readUARTCounters(port)
+			return err
+		}); err != nil {
+			if errors.Is(err, errUARTCountersUnsupported) {
+				logger.Warn("Not polling UART counters", "error", err)
+				return
+			}
+			continue
+		}
+		previous := srv.setUARTCounters(counters)
+		if previous == nil {
+			continue
+		}
+		if counters.errors() > previous.errors() {
+			logger.Warn(
+				"Serial port errors",
+				"frame", counters.Frame-previous.Frame,
+				"overrun", counters.Overrun-previous.Overrun,
+				"parity", counters.Parity-previous.Parity,
+				"buffer-overrun", counters.BufferOverrun-previous.BufferOverrun,
+			)
+		}
+		if counters.Break > previous.Break {
+			logger.Info("Serial port breaks received", "breaks", counters.Break-previous.Break)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+// serialIcounter is struct serial_icounter_struct from linux/serial.h.
+type serialIcounter struct {
+	cts, dsr, rng, dcd int32
+	rx, tx             int32
+	frame, overrun     int32
+	parity, brk        int32
+	bufOverrun         int32
+	reserved           [9]int32
+}
+
+// readUARTCounters reads the driver counters of port with TIOCGICOUNT.
+func readUARTCounters(port serialport.Port) (*UARTCounters, error) {
+	descriptor, ok := port.(serialport.Descriptor)
+	if !ok {
+		return nil, errUARTCountersUnsupported
+	}
+
+	var icount serialIcounter
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL, descriptor.Fd(), unix.TIOCGICOUNT, uintptr(unsafe.Pointer(&icount)),
+	)
+	if errno == unix.ENOTTY || errno == unix.EINVAL {
+		return nil, fmt.Errorf("%w: %w", errUARTCountersUnsupported, errno)
+	}
+	if errno != 0 {
+		return nil, fmt.Errorf("failed to read UART counters: %w", errno)
+	}
+	return &UARTCounters{
+		Time:          time.Now(),
+		RX:            uint64(uint32(icount.rx)),
+		TX:            uint64(uint32(icount.tx)),
+		Frame:         uint64(uint32(icount.frame)),
+		Overrun:       uint64(uint32(icount.overrun)),
+		Parity:        uint64(uint32(icount.parity)),
+		Break:         uint64(uint32(icount.brk)),
+		BufferOverrun: uint64(uint32(icount.bufOverrun)),
+	}, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "github.com/fornellas/serialtcp/serialport"
+
+func readUARTCounters(port serialport.Port) (*UARTCounters, error) {
+	return nil, errUARTCountersUnsupported
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/fornellas/serialtcp/serialport"
+)
+
+var udpPortName string
+var udpPortNameDefault = ""
+
+var udpBaudRate int
+var udpBaudRateDefault = 9600
+
+var udpDataBits int
+var udpDataBitsDefault = 8
+
+var udpParity ParityValue
+
+var udpStopBits StopBitsValue
+
+var udpDestinations []string
+var udpDestinationsDefault = []string{}
+
+var udpListen string
+var udpListenDefault = ""
+
+var udpInterface string
+var udpInterfaceDefault = ""
+
+var udpTTL int
+var udpTTLDefault = 1
+
+var udpFraming = FramingValue(FramingRaw)
+
+var udpSequence bool
+var udpSequenceDefault = false
+
+// 1500 bytes Ethernet MTU, less IPv4 and UDP headers, so datagrams are not fragmented.
+var udpMaxDatagram int
+var udpMaxDatagramDefault = 1472
+
+// Length of the sequence number prefixed to datagrams with --sequence.
+const udpSequenceSize = 4
+
+// Datagrams at most this far behind the next expected one are taken as reordered or duplicated,
+// and dropped; further behind, the sender is taken as restarted.
+const udpReorderWindow = 1024
+
+// udpInterfaceByName returns the interface of --interface, or nil, for the system default.
+func udpInterfaceByName() (*net.Interface, error) {
+	if udpInterface == "" {
+		return nil, nil
+	}
+	iface, err := net.InterfaceByName(udpInterface)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interface: %w", err)
+	}
+	return iface, nil
+}
+
+// dialUDPDestination returns a connection sending datagrams to address, which may be a multicast
+// group, sent with --ttl through --interface.
+func dialUDPDestination(address string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	if !addr.IP.IsMulticast() {
+		return conn, nil
+	}
+	iface, err := udpInterfaceByName()
+	if err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+	if addr.IP.To4() != nil {
+		packetConn := ipv4.NewPacketConn(conn)
+		err = packetConn.SetMulticastTTL(udpTTL)
+		if err == nil && iface != nil {
+			err = packetConn.SetMulticastInterface(iface)
+		}
+	} else {
+		packetConn := ipv6.NewPacketConn(conn)
+		err = packetConn.SetMulticastHopLimit(udpTTL)
+		if err == nil && iface != nil {
+			err = packetConn.SetMulticastInterface(iface)
+		}
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to set up multicast: %w", err), conn.Close())
+	}
+	return conn, nil
+}
+
+// udpSend sends serial output read from port to each of conns, until reading fails, as chunks or
+// lines, as given by --framing, prefixed with a sequence number with --sequence. Datagrams which
+// can not be sent, such as to unicast destinations with nothing listening, are dropped.
+func udpSend(cmd *cobra.Command, port serialport.Port, conns []*net.UDPConn) error {
+	logger := log.MustLogger(cmd.Context())
+	maxLength := udpMaxDatagram
+	if udpSequence {
+		maxLength -= udpSequenceSize
+	}
+	var sequence uint32
+	send := func(message []byte) {
+		datagram := message
+		if udpSequence {
+			datagram = binary.BigEndian.AppendUint32(make([]byte, 0, udpSequenceSize+len(message)), sequence)
+			datagram = append(datagram, message...)
+			sequence++
+		}
+		for _, conn := range conns {
+			if _, err := conn.Write(datagram); err != nil {
+				logger.Debug("Failed to send datagram", "destination", conn.RemoteAddr(), "error", err)
+			}
+		}
+	}
+	return readMessages(port, Framing(udpFraming), maxLength, send)
+}
+
+// udpGaps detects datagrams lost from each sender, by their sequence numbers.
+type udpGaps struct {
+	// Next sequence number expected from each sender.
+	next map[string]uint32
+	// Counts of lost and of reordered or duplicated datagrams.
+	lost    uint64
+	dropped uint64
+}
+
+// check returns how many datagrams were lost from source before the one with sequence, and
+// whether it is to be used, rather than dropped as reordered or duplicated.
+func (g *udpGaps) check(source string, sequence uint32) (lost uint32, use bool) {
+	next, ok := g.next[source]
+	if !ok {
+		g.next[source] = sequence + 1
+		return 0, true
+	}
+	ahead := sequence - next
+	if behind := next - sequence; behind > 0 && behind <= udpReorderWindow {
+		g.dropped++
+		return 0, false
+	}
+	g.next[source] = sequence + 1
+	if ahead > 1<<31 {
+		// Restarted.
+		return 0, true
+	}
+	g.lost += uint64(ahead)
+	return ahead, true
+}
+
+// listenUDP returns a connection receiving datagrams on address, joining it through --interface
+// when it is a multicast group.
+func listenUDP(address string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if !addr.IP.IsMulticast() {
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen: %w", err)
+		}
+		return conn, nil
+	}
+	iface, err := udpInterfaceByName()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp", iface, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join multicast group: %w", err)
+	}
+	return conn, nil
+}
+
+// udpLines joins the pieces of lines longer than --max-datagram, split by udpSend, from each
+// sender: a piece as long as can be sent is followed by more of its line, and a line as long as
+// can be sent, by an empty datagram.
+type udpLines struct {
+	// Longest message sent, without the sequence number.
+	maxLength int
+	// Pieces of the line in progress from each sender.
+	pending map[string][]byte
+}
+
+// join returns the line received from source, with its line ending, if payload completes it.
+func (l *udpLines) join(source string, payload []byte) (line []byte, ok bool) {
+	line = append(l.pending[source], payload...)
+	if len(payload) >= l.maxLength {
+		l.pending[source] = line
+		return nil, false
+	}
+	delete(l.pending, source)
+	return append(line, '\n'), true
+}
+
+// discard drops the pieces of the line in progress from source, and returns how long they were.
+func (l *udpLines) discard(source string) int {
+	n := len(l.pending[source])
+	delete(l.pending, source)
+	return n
+}
+
+// udpReceive writes the datagrams received on --listen to standard output, joining it when it is
+// a multicast group, until receiving fails. With --sequence, their sequence number is removed, and
+// lost datagrams are logged. With --framing line, pieces of lines split for being longer than
+// --max-datagram are joined back, and incomplete lines, with pieces lost, are dropped.
+func udpReceive(cmd *cobra.Command) error {
+	logger := log.MustLogger(cmd.Context())
+	conn, err := listenUDP(udpListen)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	logger.Info("Listening", "local-address", conn.LocalAddr())
+
+	gaps := &udpGaps{next: map[string]uint32{}}
+	lines := &udpLines{maxLength: udpMaxDatagram, pending: map[string][]byte{}}
+	if udpSequence {
+		lines.maxLength -= udpSequenceSize
+	}
+	defer func() { logger.Info("Stopping", "lost", gaps.lost, "dropped", gaps.dropped) }()
+	buf := make([]byte, 64<<10)
+	for {
+		n, source, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return fmt.Errorf("failed to receive: %w", err)
+		}
+		payload := buf[:n]
+		if udpSequence {
+			if len(payload) < udpSequenceSize {
+				logger.Debug("Dropping datagram without sequence number", "source", source)
+				continue
+			}
+			lost, use := gaps.check(source.String(), binary.BigEndian.Uint32(payload))
+			if lost > 0 {
+				logger.Warn("Lost datagrams", "source", source, "count", lost)
+				if n := lines.discard(source.String()); n > 0 {
+					logger.Debug("Dropping incomplete line", "source", source, "length", n)
+				}
+			}
+			if !use {
+				logger.Debug("Dropping reordered or duplicated datagram", "source", source)
+				continue
+			}
+			payload = payload[udpSequenceSize:]
+		}
+		if Framing(udpFraming) == FramingLine {
+			var ok bool
+			if payload, ok = lines.join(source.String(), payload); !ok {
+				continue
+			}
+		}
+		if _, err := os.Stdout.Write(payload); err != nil {
+			return err
+		}
+	}
+}
+
+var UDPCmd = &cobra.Command{
+	Use:   "udp",
+	Short: "Send serial output as UDP datagrams, to many listeners.",
+	Long:  "Sends serial port output as UDP datagrams to each --destination, unicast addresses or multicast groups, for read-mostly telemetry, such as from GPS receivers or sensors, where occasional loss is acceptable and many listeners are wanted. Datagrams can be prefixed with a 32 bit big endian sequence number, with --sequence, so listeners can detect gaps. With --listen, datagrams are received instead, and written to standard output (eg: serialtcp udp --listen 239.1.2.3:5000 --sequence). Nothing is written to the serial port. There's NO security implemented, this can only be used in secure networks at your own risk.",
+	Args:  cobra.NoArgs,
+	Run: GetRunFn(func(cmd *cobra.Command, args []string) (err error) {
+		ctx, logger := log.MustWithAttrs(
+			cmd.Context(),
+			"port-name", udpPortName,
+			"baud-rate", udpBaudRate,
+			"data-bits", udpDataBits,
+			"parity", &udpParity,
+			"stop-bits", &udpStopBits,
+			"destination", udpDestinations,
+			"listen", udpListen,
+			"interface", udpInterface,
+			"ttl", udpTTL,
+			"framing", &udpFraming,
+			"sequence", udpSequence,
+			"max-datagram", udpMaxDatagram,
+		)
+		cmd.SetContext(ctx)
+		logger.Info("Running")
+
+		if udpMaxDatagram <= udpSequenceSize || udpMaxDatagram > 65507 {
+			return fmt.Errorf("invalid maximum datagram size: %d", udpMaxDatagram)
+		}
+		if udpListen != "" {
+			return udpReceive(cmd)
+		}
+		if len(udpDestinations) == 0 {
+			return errors.New("--destination is required to send")
+		}
+		if udpTTL < 0 || udpTTL > 255 {
+			return fmt.Errorf("invalid TTL: %d", udpTTL)
+		}
+
+		conns := make([]*net.UDPConn, 0, len(udpDestinations))
+		defer func() {
+			for _, conn := range conns {
+				err = errors.Join(err, conn.Close())
+			}
+		}()
+		for _, destination := range udpDestinations {
+			conn, err := dialUDPDestination(destination)
+			if err != nil {
+				return fmt.Errorf("%s: %w", destination, err)
+			}
+			conns = append(conns, conn)
+		}
+
+		logger.Info("Opening serial port")
+		port, err := serialport.Open(udpPortName, &serial.Mode{
+			BaudRate: udpBaudRate,
+			DataBits: udpDataBits,
+			Parity:   serial.Parity(udpParity),
+			StopBits: serial.StopBits(udpStopBits),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open: %s: %w", udpPortName, err)
+		}
+		defer func() {
+			if closeErr := port.Close(); closeErr != nil && !errors.Is(closeErr, os.ErrClosed) {
+				err = errors.Join(err, fmt.Errorf("failed to close: %s: %w", udpPortName, closeErr))
+			}
+		}()
+
+		return fmt.Errorf("failed to read from serial port: %w", udpSend(cmd, port, conns))
+	}),
+}
+
+func init() {
+	UDPCmd.PersistentFlags().StringVarP(&udpPortName, "port-name", "p", udpPortNameDefault, "Serial port name")
+	UDPCmd.PersistentFlags().IntVarP(&udpBaudRate, "baud-rate", "b", udpBaudRateDefault, "Serial port baud rate")
+	UDPCmd.PersistentFlags().IntVarP(&udpDataBits, "data-bits", "d", udpDataBitsDefault, "Serial port data bits (5, 6, 7, or 8)")
+	UDPCmd.PersistentFlags().VarP(&udpParity, "parity", "", "Serial port parity (no, odd, even, mark or space)")
+	UDPCmd.PersistentFlags().VarP(&udpStopBits, "stop-bits", "", "Serial port stop bits (1, 1.5, or 2)")
+	UDPCmd.PersistentFlags().StringArrayVarP(&udpDestinations, "destination", "", udpDestinationsDefault, "Address to send datagrams to, as host:port, which may be a multicast group (eg: 239.1.2.3:5000); can be given multiple times")
+	UDPCmd.PersistentFlags().StringVarP(&udpListen, "listen", "", udpListenDefault, "Instead of sending, receive datagrams on this address, as host:port, joining it when it is a multicast group, and write them to standard output")
+	UDPCmd.PersistentFlags().StringVarP(&udpInterface, "interface", "", udpInterfaceDefault, "Network interface to send to or join multicast groups on (default chosen by the system)")
+	UDPCmd.PersistentFlags().IntVarP(&udpTTL, "ttl", "", udpTTLDefault, "Time to live, or hop limit, of multicast datagrams: 1 keeps them in the local network")
+	UDPCmd.PersistentFlags().VarP(&udpFraming, "framing", "", "How serial output is split into datagrams: raw, each chunk as read, or line, each line without its line ending, which is added back when receiving")
+	UDPCmd.PersistentFlags().BoolVarP(&udpSequence, "sequence", "", udpSequenceDefault, "Prefix datagrams with a 32 bit big endian sequence number, so that listeners can detect lost ones; must also be given with --listen")
+	UDPCmd.PersistentFlags().IntVarP(&udpMaxDatagram, "max-datagram", "", udpMaxDatagramDefault, "Largest datagram sent, including the sequence number; longer chunks or lines are split, and with --framing line, must also be given with --listen, to join lines back")
+	UDPCmd.MarkFlagsOneRequired("port-name", "listen")
+	UDPCmd.MarkFlagsMutuallyExclusive("port-name", "listen")
+	UDPCmd.MarkFlagsMutuallyExclusive("destination", "listen")
+
+	RootCmd.AddCommand(UDPCmd)
+}
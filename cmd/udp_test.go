@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUDPLines(t *testing.T) {
+	const maxLength = 8
+	for _, tc := range []struct {
+		name  string
+		input string
+	}{
+		{"short", "abc\n"},
+		{"empty", "\n"},
+		{"one less than max", "abcdefg\n"},
+		{"max", "abcdefgh\n"},
+		{"one more than max", "abcdefghi\n"},
+		{"twice max", "abcdefghabcdefgh\n"},
+		{"many", "a\nabcdefghijklmnopq\n\nabcdefgh\nxyz\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var datagrams [][]byte
+			if err := readMessages(strings.NewReader(tc.input), FramingLine, maxLength, func(message []byte) {
+				if len(message) > maxLength {
+					t.Errorf("datagram longer than %d: %q", maxLength, message)
+				}
+				datagrams = append(datagrams, message)
+			}); err == nil {
+				t.Fatal("expected an error at end of input")
+			}
+
+			lines := &udpLines{maxLength: maxLength, pending: map[string][]byte{}}
+			var output bytes.Buffer
+			for _, datagram := range datagrams {
+				if line, ok := lines.join("source", datagram); ok {
+					output.Write(line)
+				}
+			}
+			if output.String() != tc.input {
+				t.Errorf("expected %q, got %q, from %q", tc.input, output.String(), datagrams)
+			}
+			if n := lines.discard("source"); n != 0 {
+				t.Errorf("expected no line in progress, got %d bytes", n)
+			}
+		})
+	}
+}
+
+func TestUDPLinesDiscard(t *testing.T) {
+	lines := &udpLines{maxLength: 4, pending: map[string][]byte{}}
+	if _, ok := lines.join("a", []byte("abcd")); ok {
+		t.Fatal("expected line in progress")
+	}
+	if line, ok := lines.join("b", []byte("xy")); !ok || string(line) != "xy\n" {
+		t.Fatalf("expected line from other source, got %q, %v", line, ok)
+	}
+	if n := lines.discard("a"); n != 4 {
+		t.Fatalf("expected 4 bytes discarded, got %d", n)
+	}
+	if line, ok := lines.join("a", []byte("ef")); !ok || string(line) != "ef\n" {
+		t.Fatalf("expected line without discarded piece, got %q, %v", line, ok)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// oneConnListener is a net.Listener accepting only conn, then blocking until done is closed.
+type oneConnListener struct {
+	conn     net.Conn
+	done     <-chan struct{}
+	accepted bool
+}
+
+func (l *oneConnListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *oneConnListener) Close() error   { return nil }
+func (l *oneConnListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+// webSocketConn is a WebSocket connection over conn, with its addresses, rather than the WebSocket
+// origin and location.
+type webSocketConn struct {
+	*websocket.Conn
+	conn net.Conn
+}
+
+func (c *webSocketConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *webSocketConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// serveWebSocket serves conn, which sent an HTTP request, a session of the named port of the
+// WebSocket request path, as clients connecting to ws://HOST:PORT/NAME ask for, with data
+// exchanged as binary messages.
+func (m *multiPort) serveWebSocket(ctx context.Context, conn net.Conn) error {
+	done := make(chan struct{})
+	var once sync.Once
+	finish := func() { once.Do(func() { close(done) }) }
+	var sessionErr error
+	webSocketServer := websocket.Server{
+		// Clients are not browsers, so any origin is accepted.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer finish()
+			ws.PayloadType = websocket.BinaryFrame
+			sessionErr = m.serveNamedPort(ctx, &webSocketConn{Conn: ws, conn: conn}, strings.TrimPrefix(ws.Request().URL.Path, "/"))
+		},
+	}
+	httpServer := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := m.server(strings.TrimPrefix(r.URL.Path, "/")); !ok {
+				http.Error(w, "unknown port, serving named ports: "+strings.Join(m.names(), ", "), http.StatusNotFound)
+				return
+			}
+			webSocketServer.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: portRequestTimeout,
+		// Connections not upgraded end here, as there are no keep-alives.
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed {
+				finish()
+			}
+		},
+	}
+	httpServer.SetKeepAlivesEnabled(false)
+	if err := httpServer.Serve(&oneConnListener{conn: conn, done: done}); !errors.Is(err, net.ErrClosed) {
+		return errors.Join(err, sessionErr)
+	}
+	return sessionErr
+}
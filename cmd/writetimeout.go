@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+)
+
+// WriteTimeoutPolicy defines what happens when a serial port write times out.
+type WriteTimeoutPolicy int
+
+const (
+	// End the session.
+	WriteTimeoutDisconnect WriteTimeoutPolicy = iota
+	// Discard the data pending transmission, and carry on.
+	WriteTimeoutDrop
+)
+
+var writeTimeoutPolicyNames = map[WriteTimeoutPolicy]string{
+	WriteTimeoutDisconnect: "disconnect",
+	WriteTimeoutDrop:       "drop",
+}
+
+// WriteTimeoutPolicyValue implements pflag.Value for WriteTimeoutPolicy
+type WriteTimeoutPolicyValue WriteTimeoutPolicy
+
+func (p *WriteTimeoutPolicyValue) String() string {
+	return writeTimeoutPolicyNames[WriteTimeoutPolicy(*p)]
+}
+
+func (p *WriteTimeoutPolicyValue) Set(s string) error {
+	for policy, name := range writeTimeoutPolicyNames {
+		if strings.EqualFold(s, name) {
+			*p = WriteTimeoutPolicyValue(policy)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid policy: %s", s)
+}
+
+func (p *WriteTimeoutPolicyValue) Type() string {
+	return "policy"
+}
+
+var writeTimeout time.Duration
+var writeTimeoutDefault = time.Duration(0)
+
+var writeTimeoutPolicy = WriteTimeoutPolicyValue(WriteTimeoutDisconnect)
+
+var errWriteTimeout = errors.New("serial port write timed out")
+
+// outputResetter is a writer which can discard the data pending transmission, such as a
+// serialport.Port.
+type outputResetter interface {
+	io.Writer
+	ResetOutputBuffer() error
+}
+
+// writeTimeoutWriter bounds how long writes to a serial port may block, as they do indefinitely
+// while hardware flow control holds transmission.
+type writeTimeoutWriter struct {
+	ctx     context.Context
+	port    outputResetter
+	timeout time.Duration
+	policy  WriteTimeoutPolicy
+}
+
+// newWriteTimeoutWriter returns port with writes bounded by timeout, if not 0, handled according
+// to policy.
+func newWriteTimeoutWriter(ctx context.Context, port outputResetter, timeout time.Duration, policy WriteTimeoutPolicy) io.Writer {
+	if timeout == 0 {
+		return port
+	}
+	return &writeTimeoutWriter{ctx: ctx, port: port, timeout: timeout, policy: policy}
+}
+
+type writeResult struct {
+	n   int
+	err error
+}
+
+// Write writes p to the port. When it times out, it fails with WriteTimeoutDisconnect, leaving the
+// blocked write to fail once the session closes the port, or, with WriteTimeoutDrop, discards the
+// data pending transmission, which unblocks it, as many times as needed.
+func (w *writeTimeoutWriter) Write(p []byte) (int, error) {
+	logger := log.MustLogger(w.ctx)
+	done := make(chan writeResult, 1)
+	go func() {
+		n, err := w.port.Write(p)
+		done <- writeResult{n: n, err: err}
+	}()
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case result := <-done:
+			return result.n, result.err
+		case <-timer.C:
+		}
+		if w.policy == WriteTimeoutDisconnect {
+			return 0, fmt.Errorf("%w after %s, flow control may be stalled (eg: CTS deasserted) or the device wedged", errWriteTimeout, w.timeout)
+		}
+		logger.Warn("Serial port write timed out, dropping output pending transmission", "write-timeout", w.timeout)
+		if err := w.port.ResetOutputBuffer(); err != nil {
+			return 0, fmt.Errorf("failed to drop output pending transmission: %w", err)
+		}
+		timer.Reset(w.timeout)
+	}
+}
@@ -0,0 +1,184 @@
+// Package expect implements a small expect style scripting language, to drive interactive devices,
+// such as logging into a console, running commands and collecting their output.
+//
+// Scripts hold one command per line. Empty lines and lines starting with # are ignored. Arguments
+// are separated by spaces, and may be double quoted, with Go escape sequences such as \r, or back
+// quoted, without escapes. ${NAME} in arguments expands to a variable or, if unset, to an
+// environment variable, such as for passwords.
+//
+//	timeout DURATION         sets how long expect waits, 10s by default
+//	set NAME VALUE           sets a variable
+//	send TEXT                sends TEXT
+//	sendline TEXT            sends TEXT followed by a carriage return
+//	expect REGEXP [DURATION] waits for output matching REGEXP, setting the variables 0 to the match
+//	                         and 1, 2 and so on to its subexpressions
+//	sleep DURATION           waits
+//	echo TEXT                writes TEXT, followed by a new line, to the messages output
+//	fail TEXT                ends the script with TEXT as error
+//
+// expect only matches output received after the previous match.
+package expect
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long expect waits for output, unless set by timeout.
+const DefaultTimeout = 10 * time.Second
+
+// command is a parsed script line.
+type command struct {
+	line int
+	name string
+	args []string
+	// Compiled pattern of expect commands without variables.
+	pattern *regexp.Regexp
+}
+
+// Script is a script, parsed or built by its methods, starting from the zero value.
+type Script struct {
+	commands []command
+}
+
+// argCounts holds the minimum and maximum argument counts of each command.
+var argCounts = map[string][2]int{
+	"timeout":  {1, 1},
+	"set":      {2, 2},
+	"send":     {1, 1},
+	"sendline": {1, 1},
+	"expect":   {1, 2},
+	"sleep":    {1, 1},
+	"echo":     {1, 1},
+	"fail":     {1, 1},
+}
+
+// splitArgs splits line into its space separated, optionally quoted, arguments.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return args, nil
+		}
+		var arg string
+		switch line[0] {
+		case '"', '`':
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted argument, back quote regular expressions with backslashes: %s", line)
+			}
+			arg, err = strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted argument: %s: %w", quoted, err)
+			}
+			line = line[len(quoted):]
+		default:
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			arg, line = line[:end], line[end:]
+		}
+		args = append(args, arg)
+	}
+}
+
+// Parse parses a script from r.
+func Parse(r io.Reader) (*Script, error) {
+	script := &Script{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args, err := splitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		cmd := command{line: n, name: args[0], args: args[1:]}
+		counts, ok := argCounts[cmd.name]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown command: %s", n, cmd.name)
+		}
+		if len(cmd.args) < counts[0] || len(cmd.args) > counts[1] {
+			return nil, fmt.Errorf("line %d: %s: invalid number of arguments: %d", n, cmd.name, len(cmd.args))
+		}
+		if err := cmd.check(); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, cmd.name, err)
+		}
+		script.commands = append(script.commands, cmd)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// check validates the arguments of c which do not hold variables, so that errors are reported
+// before running.
+func (c *command) check() error {
+	var duration string
+	switch c.name {
+	case "timeout", "sleep":
+		duration = c.args[0]
+	case "expect":
+		if !strings.Contains(c.args[0], "${") {
+			pattern, err := regexp.Compile(c.args[0])
+			if err != nil {
+				return err
+			}
+			c.pattern = pattern
+		}
+		if len(c.args) > 1 {
+			duration = c.args[1]
+		}
+	}
+	if duration != "" && !strings.Contains(duration, "${") {
+		if _, err := time.ParseDuration(duration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseFile parses the script at path.
+func ParseFile(path string) (script *Script, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	script, err = Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return script, nil
+}
+
+// Send appends a send command for text to s.
+func (s *Script) Send(text string) {
+	s.commands = append(s.commands, command{name: "send", args: []string{text}})
+}
+
+// Expect appends an expect command for pattern, waiting up to timeout, to s.
+func (s *Script) Expect(pattern string, timeout time.Duration) error {
+	cmd := command{name: "expect", args: []string{pattern, timeout.String()}}
+	if err := cmd.check(); err != nil {
+		return err
+	}
+	s.commands = append(s.commands, cmd)
+	return nil
+}
+
+// Sleep appends a sleep command for duration to s.
+func (s *Script) Sleep(duration time.Duration) {
+	s.commands = append(s.commands, command{name: "sleep", args: []string{duration.String()}})
+}
@@ -0,0 +1,251 @@
+package expect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ErrTimeout is returned when expect times out.
+var ErrTimeout = errors.New("timed out")
+
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// runner holds the state of a running script.
+type runner struct {
+	ctx      context.Context
+	w        io.Writer
+	output   io.Writer
+	messages io.Writer
+	vars     map[string]string
+	timeout  time.Duration
+	// Output received and not matched by expect yet.
+	buf    []byte
+	chunks <-chan []byte
+	// Why reading ended, sent before chunks is closed.
+	readErrCh <-chan error
+	// Why reading ended, once chunks is closed.
+	readErr error
+}
+
+// expand expands ${NAME} in s.
+func (r *runner) expand(s string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := match[2 : len(match)-1]
+		if value, ok := r.vars[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
+
+// receive handles a chunk of output, or the end of output, when not ok.
+func (r *runner) receive(chunk []byte, ok bool) error {
+	if !ok {
+		select {
+		case r.readErr = <-r.readErrCh:
+		default:
+			r.readErr = io.EOF
+		}
+		return nil
+	}
+	r.buf = append(r.buf, chunk...)
+	if _, err := r.output.Write(chunk); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// wait receives output until done returns true or duration passes, returning whether done did.
+func (r *runner) wait(duration time.Duration, done func() bool) (bool, error) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		if done() {
+			return true, nil
+		}
+		if r.readErr != nil {
+			// Let sleep pass without output.
+			select {
+			case <-timer.C:
+				return false, nil
+			case <-r.ctx.Done():
+				return false, r.ctx.Err()
+			}
+		}
+		select {
+		case chunk, ok := <-r.chunks:
+			if err := r.receive(chunk, ok); err != nil {
+				return false, err
+			}
+		case <-timer.C:
+			return false, nil
+		case <-r.ctx.Done():
+			return false, r.ctx.Err()
+		}
+	}
+}
+
+// match matches pattern against the output received, consuming it up to the end of the match and
+// setting the match variables.
+func (r *runner) match(pattern *regexp.Regexp) bool {
+	loc := pattern.FindSubmatchIndex(r.buf)
+	if loc == nil {
+		return false
+	}
+	for i := 0; i < len(loc)/2; i++ {
+		value := ""
+		if loc[2*i] >= 0 {
+			value = string(r.buf[loc[2*i]:loc[2*i+1]])
+		}
+		r.vars[strconv.Itoa(i)] = value
+	}
+	r.buf = r.buf[loc[1]:]
+	return true
+}
+
+func (r *runner) expect(cmd command, args []string) error {
+	pattern := cmd.pattern
+	if pattern == nil {
+		var err error
+		pattern, err = regexp.Compile(args[0])
+		if err != nil {
+			return err
+		}
+	}
+	timeout := r.timeout
+	if len(args) > 1 {
+		var err error
+		timeout, err = time.ParseDuration(args[1])
+		if err != nil {
+			return err
+		}
+	}
+	matched := false
+	ended, err := r.wait(timeout, func() bool {
+		matched = r.match(pattern)
+		return matched || r.readErr != nil
+	})
+	if err != nil {
+		return err
+	}
+	if !ended {
+		return fmt.Errorf("%w after %s waiting for %q", ErrTimeout, timeout, args[0])
+	}
+	if !matched {
+		return fmt.Errorf("output ended waiting for %q: %w", args[0], r.readErr)
+	}
+	return nil
+}
+
+func (r *runner) run(cmd command) error {
+	args := make([]string, len(cmd.args))
+	for i, arg := range cmd.args {
+		args[i] = r.expand(arg)
+	}
+	switch cmd.name {
+	case "timeout":
+		timeout, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		r.timeout = timeout
+	case "set":
+		r.vars[args[0]] = args[1]
+	case "send", "sendline":
+		data := args[0]
+		if cmd.name == "sendline" {
+			data += "\r"
+		}
+		if _, err := io.WriteString(r.w, data); err != nil {
+			return fmt.Errorf("failed to send: %w", err)
+		}
+	case "expect":
+		return r.expect(cmd, args)
+	case "sleep":
+		duration, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = r.wait(duration, func() bool { return false })
+		return err
+	case "echo":
+		if _, err := fmt.Fprintln(r.messages, args[0]); err != nil {
+			return err
+		}
+	case "fail":
+		return errors.New(args[0])
+	}
+	return nil
+}
+
+// Run runs the script against rw, writing the output read from it to output, and echo messages to
+// messages. vars holds the initial variables. Once Run returns, rw must be closed, to end reading
+// from it.
+func (s *Script) Run(ctx context.Context, rw io.ReadWriter, output, messages io.Writer, vars map[string]string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan []byte, 64)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, 4096)
+		for {
+			n, err := rw.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- append([]byte(nil), buf[:n]...):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	r := &runner{
+		ctx:       ctx,
+		w:         rw,
+		output:    output,
+		messages:  messages,
+		vars:      map[string]string{},
+		timeout:   DefaultTimeout,
+		chunks:    chunks,
+		readErrCh: readErr,
+	}
+	for name, value := range vars {
+		r.vars[name] = value
+	}
+	for _, cmd := range s.commands {
+		if err := r.run(cmd); err != nil {
+			// Commands built by methods have no line.
+			if cmd.line == 0 {
+				return fmt.Errorf("%s: %w", cmd.name, err)
+			}
+			return fmt.Errorf("line %d: %s: %w", cmd.line, cmd.name, err)
+		}
+	}
+	// Deliver output already received.
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return nil
+			}
+			if err := r.receive(chunk, ok); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
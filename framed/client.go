@@ -0,0 +1,158 @@
+package framed
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+// ClientConn is the client side of a framed connection. Reading from it returns data from the
+// serial port, while pongs are delivered to Ping. Writes are sent in data frames.
+type ClientConn struct {
+	conn   io.ReadWriteCloser
+	reader *Reader
+	// Data of the last data frame not read yet.
+	data []byte
+	// Corrupt frames dropped.
+	corrupt atomic.Uint64
+	// When the last frame was received, in Unix nanoseconds, for Heartbeat.
+	received atomic.Int64
+
+	writeMu sync.Mutex
+
+	pingMu   sync.Mutex
+	pingSeq  uint64
+	pingWait map[uint64]chan struct{}
+}
+
+// NewClientConn creates a new ClientConn for conn.
+func NewClientConn(conn io.ReadWriteCloser) *ClientConn {
+	return &ClientConn{conn: conn, reader: NewReader(conn), pingWait: map[uint64]chan struct{}{}}
+}
+
+// Read reads data from the serial port, handling pings and pongs in between. Corrupt frames are
+// dropped, see Corrupt.
+func (c *ClientConn) Read(p []byte) (int, error) {
+	for len(c.data) == 0 {
+		frame, err := c.reader.Next()
+		if errors.Is(err, ErrCorrupt) {
+			c.corrupt.Add(1)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.received.Store(time.Now().UnixNano())
+		if frame.Direction != ToClient {
+			return 0, errors.New("received frame towards the serial port, is the connection looped back?")
+		}
+		switch frame.Type {
+		case TypeData:
+			c.data = frame.Payload
+		case TypePing:
+			if err := c.writeFrame(Frame{Type: TypePong, Direction: ToPort, Payload: frame.Payload}); err != nil {
+				return 0, err
+			}
+		case TypePong:
+			c.pong(frame.Payload)
+		}
+	}
+	n := copy(p, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+// pong wakes up the Ping waiting for payload, if any.
+func (c *ClientConn) pong(payload []byte) {
+	if len(payload) != 8 {
+		return
+	}
+	c.pingMu.Lock()
+	defer c.pingMu.Unlock()
+	seq := binary.BigEndian.Uint64(payload)
+	if ch, ok := c.pingWait[seq]; ok {
+		close(ch)
+		delete(c.pingWait, seq)
+	}
+}
+
+func (c *ClientConn) writeFrame(frame Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(appendFrame(nil, frame))
+	return err
+}
+
+// Write sends data to the serial port.
+func (c *ClientConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(encodeData(ToPort, p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying connection.
+func (c *ClientConn) Close() error {
+	return c.conn.Close()
+}
+
+// Corrupt returns how many corrupt frames were dropped.
+func (c *ClientConn) Corrupt() uint64 {
+	return c.corrupt.Load()
+}
+
+// SetMode sets the serial port mode. Initial status bits are ignored.
+func (c *ClientConn) SetMode(mode serial.Mode) error {
+	return c.writeFrame(Frame{Type: TypeMode, Direction: ToPort, Payload: encodeMode(mode)})
+}
+
+// SetDTR sets the serial port DTR line.
+func (c *ClientConn) SetDTR(dtr bool) error {
+	return c.writeFrame(Frame{Type: TypeDTR, Direction: ToPort, Payload: encodeBool(dtr)})
+}
+
+// SetRTS sets the serial port RTS line.
+func (c *ClientConn) SetRTS(rts bool) error {
+	return c.writeFrame(Frame{Type: TypeRTS, Direction: ToPort, Payload: encodeBool(rts)})
+}
+
+// Break sends a break for duration, with millisecond resolution.
+func (c *ClientConn) Break(duration time.Duration) error {
+	payload := binary.BigEndian.AppendUint32(nil, uint32(duration.Milliseconds()))
+	return c.writeFrame(Frame{Type: TypeBreak, Direction: ToPort, Payload: payload})
+}
+
+// Ping sends a ping, and waits for its pong, returning the round trip time. Pongs are received by
+// Read, so it must be called concurrently.
+func (c *ClientConn) Ping(ctx context.Context) (time.Duration, error) {
+	c.pingMu.Lock()
+	c.pingSeq++
+	seq := c.pingSeq
+	ch := make(chan struct{})
+	c.pingWait[seq] = ch
+	c.pingMu.Unlock()
+	defer func() {
+		c.pingMu.Lock()
+		delete(c.pingWait, seq)
+		c.pingMu.Unlock()
+	}()
+
+	start := time.Now()
+	if err := c.writeFrame(Frame{Type: TypePing, Direction: ToPort, Payload: binary.BigEndian.AppendUint64(nil, seq)}); err != nil {
+		return 0, err
+	}
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,191 @@
+// Package framed implements a framed wire protocol between serialtcp clients and servers, in place
+// of a raw byte stream, carrying data along with control messages (break, serial port mode, DTR,
+// RTS and pings) and detecting corruption over flaky links.
+//
+// Each frame is:
+//
+//	magic     2 bytes  "SF"
+//	type      1 byte   see Type
+//	direction 1 byte   0 towards the serial port, 1 towards the client
+//	length    2 bytes  payload length, big endian
+//	payload   length bytes
+//	crc       4 bytes  CRC-32 (IEEE) of type, direction, length and payload, big endian
+//
+// Corrupt frames are dropped, and the stream resynchronized at the next magic. Either side may send
+// pings, answered with pongs, as heartbeats detecting dead peers.
+package framed
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+// Magic starts each frame.
+var Magic = [2]byte{'S', 'F'}
+
+// MaxPayload is the maximum payload length of a frame.
+const MaxPayload = 0xffff
+
+const (
+	headerSize = 6
+	crcSize    = 4
+)
+
+// Type is a frame type.
+type Type byte
+
+const (
+	// Serial port data.
+	TypeData Type = iota
+	// Break, with its duration in milliseconds as a 32 bit big endian payload.
+	TypeBreak
+	// Serial port mode change, see encodeMode.
+	TypeMode
+	// DTR line change, with 1 or 0 as payload.
+	TypeDTR
+	// RTS line change, with 1 or 0 as payload.
+	TypeRTS
+	// Ping, answered with a pong of the same payload.
+	TypePing
+	// Pong, answering a ping.
+	TypePong
+)
+
+// Direction is the direction frames flow in.
+type Direction byte
+
+const (
+	// From the client towards the serial port.
+	ToPort Direction = iota
+	// From the serial port towards the client.
+	ToClient
+)
+
+// ErrCorrupt is returned for corrupt frames, after which reading can go on.
+var ErrCorrupt = errors.New("corrupt frame")
+
+// Frame is a frame.
+type Frame struct {
+	Type      Type
+	Direction Direction
+	Payload   []byte
+}
+
+// Port is the subset of serial port operations driven by control frames. It is satisfied by
+// serial.Port.
+type Port interface {
+	SetMode(mode *serial.Mode) error
+	SetDTR(dtr bool) error
+	SetRTS(rts bool) error
+	Break(time.Duration) error
+}
+
+// appendFrame appends frame, with a payload up to MaxPayload, encoded to buf.
+func appendFrame(buf []byte, frame Frame) []byte {
+	start := len(buf)
+	buf = append(buf, Magic[:]...)
+	buf = append(buf, byte(frame.Type), byte(frame.Direction))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(frame.Payload)))
+	buf = append(buf, frame.Payload...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start+len(Magic):]))
+}
+
+// encodeData encodes data in as many data frames as needed.
+func encodeData(direction Direction, data []byte) []byte {
+	buf := make([]byte, 0, len(data)+(len(data)/MaxPayload+1)*(headerSize+crcSize))
+	for len(data) > 0 {
+		n := min(len(data), MaxPayload)
+		buf = appendFrame(buf, Frame{Type: TypeData, Direction: direction, Payload: data[:n]})
+		data = data[n:]
+	}
+	return buf
+}
+
+// encodeBool encodes b as a payload.
+func encodeBool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encodeMode encodes mode as a payload: baud rate as 32 bit big endian, data bits, parity and stop
+// bits as go-serial values.
+func encodeMode(mode serial.Mode) []byte {
+	payload := binary.BigEndian.AppendUint32(nil, uint32(mode.BaudRate))
+	return append(payload, byte(mode.DataBits), byte(mode.Parity), byte(mode.StopBits))
+}
+
+// decodeMode decodes a mode payload into mode, keeping its initial status bits.
+func decodeMode(payload []byte, mode *serial.Mode) error {
+	if len(payload) != 7 {
+		return fmt.Errorf("invalid mode payload length: %d", len(payload))
+	}
+	mode.BaudRate = int(binary.BigEndian.Uint32(payload))
+	mode.DataBits = int(payload[4])
+	mode.Parity = serial.Parity(payload[5])
+	mode.StopBits = serial.StopBits(payload[6])
+	return nil
+}
+
+// Reader reads frames.
+type Reader struct {
+	reader *bufio.Reader
+}
+
+// NewReader returns a Reader reading frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReaderSize(r, headerSize+MaxPayload+crcSize)}
+}
+
+// Next returns the next frame. Data before it not starting with Magic is skipped. When the frame is
+// corrupt, it returns ErrCorrupt, and the next call resynchronizes after its magic.
+func (r *Reader) Next() (Frame, error) {
+	for {
+		header, err := r.reader.Peek(headerSize)
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(header) > 0 {
+				return Frame{}, io.ErrUnexpectedEOF
+			}
+			return Frame{}, err
+		}
+		if header[0] != Magic[0] || header[1] != Magic[1] {
+			if _, err := r.reader.Discard(1); err != nil {
+				return Frame{}, err
+			}
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		raw, err := r.reader.Peek(headerSize + length + crcSize)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return Frame{}, io.ErrUnexpectedEOF
+			}
+			return Frame{}, err
+		}
+		body := raw[len(Magic) : headerSize+length]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(raw[headerSize+length:]) {
+			// The magic may have been data, so resynchronize right after it.
+			if _, err := r.reader.Discard(len(Magic)); err != nil {
+				return Frame{}, err
+			}
+			return Frame{}, ErrCorrupt
+		}
+		frame := Frame{
+			Type:      Type(raw[2]),
+			Direction: Direction(raw[3]),
+			Payload:   append([]byte(nil), raw[headerSize:headerSize+length]...),
+		}
+		if _, err := r.reader.Discard(len(raw)); err != nil {
+			return Frame{}, err
+		}
+		return frame, nil
+	}
+}
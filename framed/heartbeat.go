@@ -0,0 +1,56 @@
+package framed
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDeadPeer is returned by heartbeats when the other side stops sending frames.
+var ErrDeadPeer = errors.New("peer not responding")
+
+// HeartbeatMisses is how many heartbeat intervals may pass without receiving any frame before the
+// peer is considered dead.
+const HeartbeatMisses = 3
+
+// heartbeat sends a ping with ping every interval, until ctx is done, sending fails, or no frame
+// was received, as recorded in last, for HeartbeatMisses intervals.
+func heartbeat(ctx context.Context, interval time.Duration, last *atomic.Int64, ping func() error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, last.Load())) > HeartbeatMisses*interval {
+			return ErrDeadPeer
+		}
+		if err := ping(); err != nil {
+			return err
+		}
+	}
+}
+
+// Heartbeat pings the client every interval, so that it detects a dead server, returning
+// ErrDeadPeer when no frame is received from the client for HeartbeatMisses intervals. It returns
+// when ctx is done, or when pinging fails, such as once the connection is closed.
+func (c *ServerConn) Heartbeat(ctx context.Context, interval time.Duration) error {
+	c.received.Store(time.Now().UnixNano())
+	return heartbeat(ctx, interval, &c.received, func() error {
+		return c.writeFrame(Frame{Type: TypePing, Direction: ToClient})
+	})
+}
+
+// Heartbeat pings the server every interval, so that it detects a dead client, returning
+// ErrDeadPeer when no frame is received from the server for HeartbeatMisses intervals. It returns
+// when ctx is done, or when pinging fails, such as once the connection is closed. Frames are
+// received by Read, so it must be called concurrently.
+func (c *ClientConn) Heartbeat(ctx context.Context, interval time.Duration) error {
+	c.received.Store(time.Now().UnixNano())
+	return heartbeat(ctx, interval, &c.received, func() error {
+		return c.writeFrame(Frame{Type: TypePing, Direction: ToPort})
+	})
+}
@@ -0,0 +1,141 @@
+package framed
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+)
+
+// ServerConn is the server side of a framed connection. Reading from it returns data sent by the
+// client, while control frames are applied to the serial port and pings answered. Writes are sent
+// in data frames.
+type ServerConn struct {
+	ctx    context.Context
+	conn   io.ReadWriteCloser
+	port   Port
+	reader *Reader
+	// Data of the last data frame not read yet.
+	data []byte
+	// When the last frame was received, in Unix nanoseconds, for Heartbeat.
+	received atomic.Int64
+
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	mode serial.Mode
+}
+
+// NewServerConn creates a new ServerConn for conn, which controls port. mode must be the mode port
+// is currently set to.
+func NewServerConn(ctx context.Context, conn io.ReadWriteCloser, port Port, mode serial.Mode) *ServerConn {
+	return &ServerConn{ctx: ctx, conn: conn, port: port, reader: NewReader(conn), mode: mode}
+}
+
+// Read reads data sent by the client, handling control frames in between. Corrupt frames are
+// logged and dropped.
+func (c *ServerConn) Read(p []byte) (int, error) {
+	for len(c.data) == 0 {
+		frame, err := c.reader.Next()
+		if errors.Is(err, ErrCorrupt) {
+			log.MustLogger(c.ctx).Warn("Dropping corrupt frame from client")
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.received.Store(time.Now().UnixNano())
+		if frame.Direction != ToPort {
+			return 0, errors.New("received frame towards the client, is the connection looped back?")
+		}
+		if err := c.handle(frame); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+// handle handles frame, keeping the data of data frames to be read.
+func (c *ServerConn) handle(frame Frame) error {
+	logger := log.MustLogger(c.ctx)
+	switch frame.Type {
+	case TypeData:
+		c.data = frame.Payload
+	case TypeBreak:
+		if len(frame.Payload) != 4 {
+			return fmt.Errorf("invalid break payload length: %d", len(frame.Payload))
+		}
+		duration := time.Duration(binary.BigEndian.Uint32(frame.Payload)) * time.Millisecond
+		logger.Info("Sending break", "duration", duration)
+		return c.port.Break(duration)
+	case TypeMode:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		mode := c.mode
+		if err := decodeMode(frame.Payload, &mode); err != nil {
+			return err
+		}
+		logger.Info("Setting mode", "baud-rate", mode.BaudRate, "data-bits", mode.DataBits, "parity", mode.Parity, "stop-bits", mode.StopBits)
+		if err := c.port.SetMode(&mode); err != nil {
+			return err
+		}
+		c.mode = mode
+	case TypeDTR, TypeRTS:
+		if len(frame.Payload) != 1 {
+			return fmt.Errorf("invalid control line payload length: %d", len(frame.Payload))
+		}
+		on := frame.Payload[0] != 0
+		if frame.Type == TypeDTR {
+			logger.Info("Setting DTR", "dtr", on)
+			return c.port.SetDTR(on)
+		}
+		logger.Info("Setting RTS", "rts", on)
+		return c.port.SetRTS(on)
+	case TypePing:
+		return c.writeFrame(Frame{Type: TypePong, Direction: ToClient, Payload: frame.Payload})
+	case TypePong:
+		// Answering Heartbeat, which only needs it received.
+	default:
+		// From newer clients.
+		logger.Debug("Ignoring unknown frame type", "type", frame.Type)
+	}
+	return nil
+}
+
+func (c *ServerConn) writeFrame(frame Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(appendFrame(nil, frame))
+	return err
+}
+
+// Write sends data to the client.
+func (c *ServerConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(encodeData(ToClient, p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying connection.
+func (c *ServerConn) Close() error {
+	return c.conn.Close()
+}
+
+// Mode returns the current serial port mode.
+func (c *ServerConn) Mode() serial.Mode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mode
+}
@@ -0,0 +1,7 @@
+// Package grpcapi is the gRPC API of serialtcp serve (see serve --grpc-address), generated from
+// serialtcp.proto, which other languages generate their clients from.
+//
+// After changing serialtcp.proto, regenerate it with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative serialtcp.proto
+package grpcapi
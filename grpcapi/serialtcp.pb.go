@@ -0,0 +1,971 @@
+// gRPC API of serialtcp serve, see serve --grpc-address.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: serialtcp.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type OpenRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Data to write to the serial port.
+	Data          []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpenRequest) Reset() {
+	*x = OpenRequest{}
+	mi := &file_serialtcp_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpenRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpenRequest) ProtoMessage() {}
+
+func (x *OpenRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpenRequest.ProtoReflect.Descriptor instead.
+func (*OpenRequest) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *OpenRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type OpenResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Data read from the serial port.
+	Data          []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpenResponse) Reset() {
+	*x = OpenResponse{}
+	mi := &file_serialtcp_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpenResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpenResponse) ProtoMessage() {}
+
+func (x *OpenResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpenResponse.ProtoReflect.Descriptor instead.
+func (*OpenResponse) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *OpenResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ReadRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadRequest) Reset() {
+	*x = ReadRequest{}
+	mi := &file_serialtcp_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadRequest) ProtoMessage() {}
+
+func (x *ReadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadRequest.ProtoReflect.Descriptor instead.
+func (*ReadRequest) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{2}
+}
+
+type ReadResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Line, without its line ending.
+	Line []byte `protobuf:"bytes,1,opt,name=line,proto3" json:"line,omitempty"`
+	// When the line ended.
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadResponse) Reset() {
+	*x = ReadResponse{}
+	mi := &file_serialtcp_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadResponse) ProtoMessage() {}
+
+func (x *ReadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadResponse.ProtoReflect.Descriptor instead.
+func (*ReadResponse) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ReadResponse) GetLine() []byte {
+	if x != nil {
+		return x.Line
+	}
+	return nil
+}
+
+func (x *ReadResponse) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+type WriteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteRequest) Reset() {
+	*x = WriteRequest{}
+	mi := &file_serialtcp_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteRequest) ProtoMessage() {}
+
+func (x *WriteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteRequest.ProtoReflect.Descriptor instead.
+func (*WriteRequest) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *WriteRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type WriteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteResponse) Reset() {
+	*x = WriteResponse{}
+	mi := &file_serialtcp_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteResponse) ProtoMessage() {}
+
+func (x *WriteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteResponse.ProtoReflect.Descriptor instead.
+func (*WriteResponse) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{5}
+}
+
+type SetModeRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	BaudRate uint32                 `protobuf:"varint,1,opt,name=baud_rate,json=baudRate,proto3" json:"baud_rate,omitempty"`
+	// 5 to 8.
+	DataBits uint32 `protobuf:"varint,2,opt,name=data_bits,json=dataBits,proto3" json:"data_bits,omitempty"`
+	// no, odd, even, mark or space.
+	Parity string `protobuf:"bytes,3,opt,name=parity,proto3" json:"parity,omitempty"`
+	// 1, 1.5 or 2.
+	StopBits      string `protobuf:"bytes,4,opt,name=stop_bits,json=stopBits,proto3" json:"stop_bits,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetModeRequest) Reset() {
+	*x = SetModeRequest{}
+	mi := &file_serialtcp_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetModeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetModeRequest) ProtoMessage() {}
+
+func (x *SetModeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetModeRequest.ProtoReflect.Descriptor instead.
+func (*SetModeRequest) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SetModeRequest) GetBaudRate() uint32 {
+	if x != nil {
+		return x.BaudRate
+	}
+	return 0
+}
+
+func (x *SetModeRequest) GetDataBits() uint32 {
+	if x != nil {
+		return x.DataBits
+	}
+	return 0
+}
+
+func (x *SetModeRequest) GetParity() string {
+	if x != nil {
+		return x.Parity
+	}
+	return ""
+}
+
+func (x *SetModeRequest) GetStopBits() string {
+	if x != nil {
+		return x.StopBits
+	}
+	return ""
+}
+
+type SetModeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetModeResponse) Reset() {
+	*x = SetModeResponse{}
+	mi := &file_serialtcp_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetModeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetModeResponse) ProtoMessage() {}
+
+func (x *SetModeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetModeResponse.ProtoReflect.Descriptor instead.
+func (*SetModeResponse) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{7}
+}
+
+type SendBreakRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Break duration, at most 10s, or 250ms, if not given.
+	Duration      *durationpb.Duration `protobuf:"bytes,1,opt,name=duration,proto3" json:"duration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendBreakRequest) Reset() {
+	*x = SendBreakRequest{}
+	mi := &file_serialtcp_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendBreakRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendBreakRequest) ProtoMessage() {}
+
+func (x *SendBreakRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendBreakRequest.ProtoReflect.Descriptor instead.
+func (*SendBreakRequest) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SendBreakRequest) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+type SendBreakResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendBreakResponse) Reset() {
+	*x = SendBreakResponse{}
+	mi := &file_serialtcp_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendBreakResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendBreakResponse) ProtoMessage() {}
+
+func (x *SendBreakResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendBreakResponse.ProtoReflect.Descriptor instead.
+func (*SendBreakResponse) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{9}
+}
+
+type StatusRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// How often to send the status, or only once, if not given.
+	Interval      *durationpb.Duration `protobuf:"bytes,1,opt,name=interval,proto3" json:"interval,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusRequest) Reset() {
+	*x = StatusRequest{}
+	mi := &file_serialtcp_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusRequest) ProtoMessage() {}
+
+func (x *StatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusRequest.ProtoReflect.Descriptor instead.
+func (*StatusRequest) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StatusRequest) GetInterval() *durationpb.Duration {
+	if x != nil {
+		return x.Interval
+	}
+	return nil
+}
+
+type StatusResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Start          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	ActiveSessions uint32                 `protobuf:"varint,2,opt,name=active_sessions,json=activeSessions,proto3" json:"active_sessions,omitempty"`
+	TotalSessions  uint64                 `protobuf:"varint,3,opt,name=total_sessions,json=totalSessions,proto3" json:"total_sessions,omitempty"`
+	BytesToClient  uint64                 `protobuf:"varint,4,opt,name=bytes_to_client,json=bytesToClient,proto3" json:"bytes_to_client,omitempty"`
+	BytesToPort    uint64                 `protobuf:"varint,5,opt,name=bytes_to_port,json=bytesToPort,proto3" json:"bytes_to_port,omitempty"`
+	BytesDropped   uint64                 `protobuf:"varint,6,opt,name=bytes_dropped,json=bytesDropped,proto3" json:"bytes_dropped,omitempty"`
+	Errors         uint64                 `protobuf:"varint,7,opt,name=errors,proto3" json:"errors,omitempty"`
+	// Whether new clients are turned away, see serialtcp admin drain.
+	Draining      bool       `protobuf:"varint,8,opt,name=draining,proto3" json:"draining,omitempty"`
+	Ports         []*Port    `protobuf:"bytes,9,rep,name=ports,proto3" json:"ports,omitempty"`
+	Sessions      []*Session `protobuf:"bytes,10,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusResponse) Reset() {
+	*x = StatusResponse{}
+	mi := &file_serialtcp_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusResponse) ProtoMessage() {}
+
+func (x *StatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusResponse.ProtoReflect.Descriptor instead.
+func (*StatusResponse) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StatusResponse) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *StatusResponse) GetActiveSessions() uint32 {
+	if x != nil {
+		return x.ActiveSessions
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetTotalSessions() uint64 {
+	if x != nil {
+		return x.TotalSessions
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetBytesToClient() uint64 {
+	if x != nil {
+		return x.BytesToClient
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetBytesToPort() uint64 {
+	if x != nil {
+		return x.BytesToPort
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetBytesDropped() uint64 {
+	if x != nil {
+		return x.BytesDropped
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetErrors() uint64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetDraining() bool {
+	if x != nil {
+		return x.Draining
+	}
+	return false
+}
+
+func (x *StatusResponse) GetPorts() []*Port {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+func (x *StatusResponse) GetSessions() []*Session {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+// Port describes the serial port.
+type Port struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Name     string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	BaudRate uint32                 `protobuf:"varint,2,opt,name=baud_rate,json=baudRate,proto3" json:"baud_rate,omitempty"`
+	DataBits uint32                 `protobuf:"varint,3,opt,name=data_bits,json=dataBits,proto3" json:"data_bits,omitempty"`
+	Parity   string                 `protobuf:"bytes,4,opt,name=parity,proto3" json:"parity,omitempty"`
+	StopBits string                 `protobuf:"bytes,5,opt,name=stop_bits,json=stopBits,proto3" json:"stop_bits,omitempty"`
+	// Identity banner, see serve --identify.
+	Identity      string                 `protobuf:"bytes,6,opt,name=identity,proto3" json:"identity,omitempty"`
+	IdentifiedAt  *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=identified_at,json=identifiedAt,proto3" json:"identified_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Port) Reset() {
+	*x = Port{}
+	mi := &file_serialtcp_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Port) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Port) ProtoMessage() {}
+
+func (x *Port) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Port.ProtoReflect.Descriptor instead.
+func (*Port) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Port) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Port) GetBaudRate() uint32 {
+	if x != nil {
+		return x.BaudRate
+	}
+	return 0
+}
+
+func (x *Port) GetDataBits() uint32 {
+	if x != nil {
+		return x.DataBits
+	}
+	return 0
+}
+
+func (x *Port) GetParity() string {
+	if x != nil {
+		return x.Parity
+	}
+	return ""
+}
+
+func (x *Port) GetStopBits() string {
+	if x != nil {
+		return x.StopBits
+	}
+	return ""
+}
+
+func (x *Port) GetIdentity() string {
+	if x != nil {
+		return x.Identity
+	}
+	return ""
+}
+
+func (x *Port) GetIdentifiedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.IdentifiedAt
+	}
+	return nil
+}
+
+// Session describes a session in progress.
+type Session struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	RemoteAddr    string                 `protobuf:"bytes,2,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`
+	Start         *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	BytesToClient uint64                 `protobuf:"varint,4,opt,name=bytes_to_client,json=bytesToClient,proto3" json:"bytes_to_client,omitempty"`
+	BytesToPort   uint64                 `protobuf:"varint,5,opt,name=bytes_to_port,json=bytesToPort,proto3" json:"bytes_to_port,omitempty"`
+	BytesDropped  uint64                 `protobuf:"varint,6,opt,name=bytes_dropped,json=bytesDropped,proto3" json:"bytes_dropped,omitempty"`
+	Errors        uint64                 `protobuf:"varint,7,opt,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Session) Reset() {
+	*x = Session{}
+	mi := &file_serialtcp_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Session) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Session) ProtoMessage() {}
+
+func (x *Session) ProtoReflect() protoreflect.Message {
+	mi := &file_serialtcp_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Session.ProtoReflect.Descriptor instead.
+func (*Session) Descriptor() ([]byte, []int) {
+	return file_serialtcp_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Session) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Session) GetRemoteAddr() string {
+	if x != nil {
+		return x.RemoteAddr
+	}
+	return ""
+}
+
+func (x *Session) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *Session) GetBytesToClient() uint64 {
+	if x != nil {
+		return x.BytesToClient
+	}
+	return 0
+}
+
+func (x *Session) GetBytesToPort() uint64 {
+	if x != nil {
+		return x.BytesToPort
+	}
+	return 0
+}
+
+func (x *Session) GetBytesDropped() uint64 {
+	if x != nil {
+		return x.BytesDropped
+	}
+	return 0
+}
+
+func (x *Session) GetErrors() uint64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+var File_serialtcp_proto protoreflect.FileDescriptor
+
+const file_serialtcp_proto_rawDesc = "" +
+	"\n" +
+	"\x0fserialtcp.proto\x12\fserialtcp.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"!\n" +
+	"\vOpenRequest\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\"\n" +
+	"\fOpenResponse\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\r\n" +
+	"\vReadRequest\"R\n" +
+	"\fReadResponse\x12\x12\n" +
+	"\x04line\x18\x01 \x01(\fR\x04line\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"\"\n" +
+	"\fWriteRequest\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\x0f\n" +
+	"\rWriteResponse\"\x7f\n" +
+	"\x0eSetModeRequest\x12\x1b\n" +
+	"\tbaud_rate\x18\x01 \x01(\rR\bbaudRate\x12\x1b\n" +
+	"\tdata_bits\x18\x02 \x01(\rR\bdataBits\x12\x16\n" +
+	"\x06parity\x18\x03 \x01(\tR\x06parity\x12\x1b\n" +
+	"\tstop_bits\x18\x04 \x01(\tR\bstopBits\"\x11\n" +
+	"\x0fSetModeResponse\"I\n" +
+	"\x10SendBreakRequest\x125\n" +
+	"\bduration\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\bduration\"\x13\n" +
+	"\x11SendBreakResponse\"F\n" +
+	"\rStatusRequest\x125\n" +
+	"\binterval\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\binterval\"\x94\x03\n" +
+	"\x0eStatusResponse\x120\n" +
+	"\x05start\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12'\n" +
+	"\x0factive_sessions\x18\x02 \x01(\rR\x0eactiveSessions\x12%\n" +
+	"\x0etotal_sessions\x18\x03 \x01(\x04R\rtotalSessions\x12&\n" +
+	"\x0fbytes_to_client\x18\x04 \x01(\x04R\rbytesToClient\x12\"\n" +
+	"\rbytes_to_port\x18\x05 \x01(\x04R\vbytesToPort\x12#\n" +
+	"\rbytes_dropped\x18\x06 \x01(\x04R\fbytesDropped\x12\x16\n" +
+	"\x06errors\x18\a \x01(\x04R\x06errors\x12\x1a\n" +
+	"\bdraining\x18\b \x01(\bR\bdraining\x12(\n" +
+	"\x05ports\x18\t \x03(\v2\x12.serialtcp.v1.PortR\x05ports\x121\n" +
+	"\bsessions\x18\n" +
+	" \x03(\v2\x15.serialtcp.v1.SessionR\bsessions\"\xe6\x01\n" +
+	"\x04Port\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1b\n" +
+	"\tbaud_rate\x18\x02 \x01(\rR\bbaudRate\x12\x1b\n" +
+	"\tdata_bits\x18\x03 \x01(\rR\bdataBits\x12\x16\n" +
+	"\x06parity\x18\x04 \x01(\tR\x06parity\x12\x1b\n" +
+	"\tstop_bits\x18\x05 \x01(\tR\bstopBits\x12\x1a\n" +
+	"\bidentity\x18\x06 \x01(\tR\bidentity\x12?\n" +
+	"\ridentified_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\fidentifiedAt\"\xf5\x01\n" +
+	"\aSession\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x1f\n" +
+	"\vremote_addr\x18\x02 \x01(\tR\n" +
+	"remoteAddr\x120\n" +
+	"\x05start\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12&\n" +
+	"\x0fbytes_to_client\x18\x04 \x01(\x04R\rbytesToClient\x12\"\n" +
+	"\rbytes_to_port\x18\x05 \x01(\x04R\vbytesToPort\x12#\n" +
+	"\rbytes_dropped\x18\x06 \x01(\x04R\fbytesDropped\x12\x16\n" +
+	"\x06errors\x18\a \x01(\x04R\x06errors2\xaf\x03\n" +
+	"\n" +
+	"SerialPort\x12A\n" +
+	"\x04Open\x12\x19.serialtcp.v1.OpenRequest\x1a\x1a.serialtcp.v1.OpenResponse(\x010\x01\x12?\n" +
+	"\x04Read\x12\x19.serialtcp.v1.ReadRequest\x1a\x1a.serialtcp.v1.ReadResponse0\x01\x12@\n" +
+	"\x05Write\x12\x1a.serialtcp.v1.WriteRequest\x1a\x1b.serialtcp.v1.WriteResponse\x12F\n" +
+	"\aSetMode\x12\x1c.serialtcp.v1.SetModeRequest\x1a\x1d.serialtcp.v1.SetModeResponse\x12L\n" +
+	"\tSendBreak\x12\x1e.serialtcp.v1.SendBreakRequest\x1a\x1f.serialtcp.v1.SendBreakResponse\x12E\n" +
+	"\x06Status\x12\x1b.serialtcp.v1.StatusRequest\x1a\x1c.serialtcp.v1.StatusResponse0\x01B(Z&github.com/fornellas/serialtcp/grpcapib\x06proto3"
+
+var (
+	file_serialtcp_proto_rawDescOnce sync.Once
+	file_serialtcp_proto_rawDescData []byte
+)
+
+func file_serialtcp_proto_rawDescGZIP() []byte {
+	file_serialtcp_proto_rawDescOnce.Do(func() {
+		file_serialtcp_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_serialtcp_proto_rawDesc), len(file_serialtcp_proto_rawDesc)))
+	})
+	return file_serialtcp_proto_rawDescData
+}
+
+var file_serialtcp_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_serialtcp_proto_goTypes = []any{
+	(*OpenRequest)(nil),           // 0: serialtcp.v1.OpenRequest
+	(*OpenResponse)(nil),          // 1: serialtcp.v1.OpenResponse
+	(*ReadRequest)(nil),           // 2: serialtcp.v1.ReadRequest
+	(*ReadResponse)(nil),          // 3: serialtcp.v1.ReadResponse
+	(*WriteRequest)(nil),          // 4: serialtcp.v1.WriteRequest
+	(*WriteResponse)(nil),         // 5: serialtcp.v1.WriteResponse
+	(*SetModeRequest)(nil),        // 6: serialtcp.v1.SetModeRequest
+	(*SetModeResponse)(nil),       // 7: serialtcp.v1.SetModeResponse
+	(*SendBreakRequest)(nil),      // 8: serialtcp.v1.SendBreakRequest
+	(*SendBreakResponse)(nil),     // 9: serialtcp.v1.SendBreakResponse
+	(*StatusRequest)(nil),         // 10: serialtcp.v1.StatusRequest
+	(*StatusResponse)(nil),        // 11: serialtcp.v1.StatusResponse
+	(*Port)(nil),                  // 12: serialtcp.v1.Port
+	(*Session)(nil),               // 13: serialtcp.v1.Session
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 15: google.protobuf.Duration
+}
+var file_serialtcp_proto_depIdxs = []int32{
+	14, // 0: serialtcp.v1.ReadResponse.time:type_name -> google.protobuf.Timestamp
+	15, // 1: serialtcp.v1.SendBreakRequest.duration:type_name -> google.protobuf.Duration
+	15, // 2: serialtcp.v1.StatusRequest.interval:type_name -> google.protobuf.Duration
+	14, // 3: serialtcp.v1.StatusResponse.start:type_name -> google.protobuf.Timestamp
+	12, // 4: serialtcp.v1.StatusResponse.ports:type_name -> serialtcp.v1.Port
+	13, // 5: serialtcp.v1.StatusResponse.sessions:type_name -> serialtcp.v1.Session
+	14, // 6: serialtcp.v1.Port.identified_at:type_name -> google.protobuf.Timestamp
+	14, // 7: serialtcp.v1.Session.start:type_name -> google.protobuf.Timestamp
+	0,  // 8: serialtcp.v1.SerialPort.Open:input_type -> serialtcp.v1.OpenRequest
+	2,  // 9: serialtcp.v1.SerialPort.Read:input_type -> serialtcp.v1.ReadRequest
+	4,  // 10: serialtcp.v1.SerialPort.Write:input_type -> serialtcp.v1.WriteRequest
+	6,  // 11: serialtcp.v1.SerialPort.SetMode:input_type -> serialtcp.v1.SetModeRequest
+	8,  // 12: serialtcp.v1.SerialPort.SendBreak:input_type -> serialtcp.v1.SendBreakRequest
+	10, // 13: serialtcp.v1.SerialPort.Status:input_type -> serialtcp.v1.StatusRequest
+	1,  // 14: serialtcp.v1.SerialPort.Open:output_type -> serialtcp.v1.OpenResponse
+	3,  // 15: serialtcp.v1.SerialPort.Read:output_type -> serialtcp.v1.ReadResponse
+	5,  // 16: serialtcp.v1.SerialPort.Write:output_type -> serialtcp.v1.WriteResponse
+	7,  // 17: serialtcp.v1.SerialPort.SetMode:output_type -> serialtcp.v1.SetModeResponse
+	9,  // 18: serialtcp.v1.SerialPort.SendBreak:output_type -> serialtcp.v1.SendBreakResponse
+	11, // 19: serialtcp.v1.SerialPort.Status:output_type -> serialtcp.v1.StatusResponse
+	14, // [14:20] is the sub-list for method output_type
+	8,  // [8:14] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_serialtcp_proto_init() }
+func file_serialtcp_proto_init() {
+	if File_serialtcp_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_serialtcp_proto_rawDesc), len(file_serialtcp_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_serialtcp_proto_goTypes,
+		DependencyIndexes: file_serialtcp_proto_depIdxs,
+		MessageInfos:      file_serialtcp_proto_msgTypes,
+	}.Build()
+	File_serialtcp_proto = out.File
+	file_serialtcp_proto_goTypes = nil
+	file_serialtcp_proto_depIdxs = nil
+}
@@ -0,0 +1,346 @@
+// gRPC API of serialtcp serve, see serve --grpc-address.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: serialtcp.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SerialPort_Open_FullMethodName      = "/serialtcp.v1.SerialPort/Open"
+	SerialPort_Read_FullMethodName      = "/serialtcp.v1.SerialPort/Read"
+	SerialPort_Write_FullMethodName     = "/serialtcp.v1.SerialPort/Write"
+	SerialPort_SetMode_FullMethodName   = "/serialtcp.v1.SerialPort/SetMode"
+	SerialPort_SendBreak_FullMethodName = "/serialtcp.v1.SerialPort/SendBreak"
+	SerialPort_Status_FullMethodName    = "/serialtcp.v1.SerialPort/Status"
+)
+
+// SerialPortClient is the client API for SerialPort service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SerialPort serves the serial port of a serialtcp server. Requests authenticate with the token of
+// serve --grpc-token-file, as "authorization: Bearer TOKEN" metadata.
+type SerialPortClient interface {
+	// Open starts a session, as TCP clients do: data sent is written to the serial port, and serial
+	// port output is sent back, until either side ends its stream. The session goes through the
+	// same admission, authentication and negotiation as TCP sessions, so with serve --token-auth,
+	// the first data sent must be the token line.
+	Open(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[OpenRequest, OpenResponse], error)
+	// Read streams serial port output of sessions in progress, line by line, as serve --sse-address
+	// does; lines are dropped for callers not keeping up.
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadResponse], error)
+	// Write writes data to the serial port of sessions in progress, failing with FAILED_PRECONDITION
+	// while no session has it open.
+	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error)
+	// SetMode changes the mode of the open serial port, and of future sessions, leaving settings
+	// not given as they are; invalid settings fail with FAILED_PRECONDITION.
+	SetMode(ctx context.Context, in *SetModeRequest, opts ...grpc.CallOption) (*SetModeResponse, error)
+	// SendBreak sends a break to the open serial port, failing with FAILED_PRECONDITION while no
+	// session has it open.
+	SendBreak(ctx context.Context, in *SendBreakRequest, opts ...grpc.CallOption) (*SendBreakResponse, error)
+	// Status streams the server status: once, or every interval, if given.
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StatusResponse], error)
+}
+
+type serialPortClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSerialPortClient(cc grpc.ClientConnInterface) SerialPortClient {
+	return &serialPortClient{cc}
+}
+
+func (c *serialPortClient) Open(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[OpenRequest, OpenResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SerialPort_ServiceDesc.Streams[0], SerialPort_Open_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[OpenRequest, OpenResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SerialPort_OpenClient = grpc.BidiStreamingClient[OpenRequest, OpenResponse]
+
+func (c *serialPortClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SerialPort_ServiceDesc.Streams[1], SerialPort_Read_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReadRequest, ReadResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SerialPort_ReadClient = grpc.ServerStreamingClient[ReadResponse]
+
+func (c *serialPortClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteResponse)
+	err := c.cc.Invoke(ctx, SerialPort_Write_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serialPortClient) SetMode(ctx context.Context, in *SetModeRequest, opts ...grpc.CallOption) (*SetModeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetModeResponse)
+	err := c.cc.Invoke(ctx, SerialPort_SetMode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serialPortClient) SendBreak(ctx context.Context, in *SendBreakRequest, opts ...grpc.CallOption) (*SendBreakResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendBreakResponse)
+	err := c.cc.Invoke(ctx, SerialPort_SendBreak_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serialPortClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StatusResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SerialPort_ServiceDesc.Streams[2], SerialPort_Status_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StatusRequest, StatusResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SerialPort_StatusClient = grpc.ServerStreamingClient[StatusResponse]
+
+// SerialPortServer is the server API for SerialPort service.
+// All implementations must embed UnimplementedSerialPortServer
+// for forward compatibility.
+//
+// SerialPort serves the serial port of a serialtcp server. Requests authenticate with the token of
+// serve --grpc-token-file, as "authorization: Bearer TOKEN" metadata.
+type SerialPortServer interface {
+	// Open starts a session, as TCP clients do: data sent is written to the serial port, and serial
+	// port output is sent back, until either side ends its stream. The session goes through the
+	// same admission, authentication and negotiation as TCP sessions, so with serve --token-auth,
+	// the first data sent must be the token line.
+	Open(grpc.BidiStreamingServer[OpenRequest, OpenResponse]) error
+	// Read streams serial port output of sessions in progress, line by line, as serve --sse-address
+	// does; lines are dropped for callers not keeping up.
+	Read(*ReadRequest, grpc.ServerStreamingServer[ReadResponse]) error
+	// Write writes data to the serial port of sessions in progress, failing with FAILED_PRECONDITION
+	// while no session has it open.
+	Write(context.Context, *WriteRequest) (*WriteResponse, error)
+	// SetMode changes the mode of the open serial port, and of future sessions, leaving settings
+	// not given as they are; invalid settings fail with FAILED_PRECONDITION.
+	SetMode(context.Context, *SetModeRequest) (*SetModeResponse, error)
+	// SendBreak sends a break to the open serial port, failing with FAILED_PRECONDITION while no
+	// session has it open.
+	SendBreak(context.Context, *SendBreakRequest) (*SendBreakResponse, error)
+	// Status streams the server status: once, or every interval, if given.
+	Status(*StatusRequest, grpc.ServerStreamingServer[StatusResponse]) error
+	mustEmbedUnimplementedSerialPortServer()
+}
+
+// UnimplementedSerialPortServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSerialPortServer struct{}
+
+func (UnimplementedSerialPortServer) Open(grpc.BidiStreamingServer[OpenRequest, OpenResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Open not implemented")
+}
+func (UnimplementedSerialPortServer) Read(*ReadRequest, grpc.ServerStreamingServer[ReadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Read not implemented")
+}
+func (UnimplementedSerialPortServer) Write(context.Context, *WriteRequest) (*WriteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Write not implemented")
+}
+func (UnimplementedSerialPortServer) SetMode(context.Context, *SetModeRequest) (*SetModeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMode not implemented")
+}
+func (UnimplementedSerialPortServer) SendBreak(context.Context, *SendBreakRequest) (*SendBreakResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendBreak not implemented")
+}
+func (UnimplementedSerialPortServer) Status(*StatusRequest, grpc.ServerStreamingServer[StatusResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedSerialPortServer) mustEmbedUnimplementedSerialPortServer() {}
+func (UnimplementedSerialPortServer) testEmbeddedByValue()                    {}
+
+// UnsafeSerialPortServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SerialPortServer will
+// result in compilation errors.
+type UnsafeSerialPortServer interface {
+	mustEmbedUnimplementedSerialPortServer()
+}
+
+func RegisterSerialPortServer(s grpc.ServiceRegistrar, srv SerialPortServer) {
+	// If the following call pancis, it indicates UnimplementedSerialPortServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SerialPort_ServiceDesc, srv)
+}
+
+func _SerialPort_Open_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SerialPortServer).Open(&grpc.GenericServerStream[OpenRequest, OpenResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SerialPort_OpenServer = grpc.BidiStreamingServer[OpenRequest, OpenResponse]
+
+func _SerialPort_Read_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SerialPortServer).Read(m, &grpc.GenericServerStream[ReadRequest, ReadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SerialPort_ReadServer = grpc.ServerStreamingServer[ReadResponse]
+
+func _SerialPort_Write_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SerialPortServer).Write(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SerialPort_Write_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SerialPortServer).Write(ctx, req.(*WriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SerialPort_SetMode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetModeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SerialPortServer).SetMode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SerialPort_SetMode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SerialPortServer).SetMode(ctx, req.(*SetModeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SerialPort_SendBreak_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendBreakRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SerialPortServer).SendBreak(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SerialPort_SendBreak_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SerialPortServer).SendBreak(ctx, req.(*SendBreakRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SerialPort_Status_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SerialPortServer).Status(m, &grpc.GenericServerStream[StatusRequest, StatusResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SerialPort_StatusServer = grpc.ServerStreamingServer[StatusResponse]
+
+// SerialPort_ServiceDesc is the grpc.ServiceDesc for SerialPort service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SerialPort_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "serialtcp.v1.SerialPort",
+	HandlerType: (*SerialPortServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Write",
+			Handler:    _SerialPort_Write_Handler,
+		},
+		{
+			MethodName: "SetMode",
+			Handler:    _SerialPort_SetMode_Handler,
+		},
+		{
+			MethodName: "SendBreak",
+			Handler:    _SerialPort_SendBreak_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Open",
+			Handler:       _SerialPort_Open_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Read",
+			Handler:       _SerialPort_Read_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Status",
+			Handler:       _SerialPort_Status_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "serialtcp.proto",
+}
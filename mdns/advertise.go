@@ -0,0 +1,138 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func (s Service) answers(question dnsmessage.Question) bool {
+	name := strings.ToLower(question.Name.String())
+	switch name {
+	case strings.ToLower(s.serviceName()):
+		return question.Type == dnsmessage.TypePTR || question.Type == dnsmessage.TypeALL
+	case strings.ToLower(s.instanceName()):
+		return question.Type == dnsmessage.TypeSRV || question.Type == dnsmessage.TypeTXT || question.Type == dnsmessage.TypeALL
+	case strings.ToLower(s.hostName()):
+		return question.Type == dnsmessage.TypeA || question.Type == dnsmessage.TypeALL
+	}
+	return false
+}
+
+func packResponse(id uint16, questions []dnsmessage.Question, answers []dnsmessage.Resource) ([]byte, error) {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, Response: true, Authoritative: true},
+		Questions: questions,
+		Answers:   answers,
+	}
+	return msg.Pack()
+}
+
+// announce multicasts the records of s with the given ttl.
+func announce(conn *net.UDPConn, s Service, ttl uint32) error {
+	answers, err := s.records(ttl)
+	if err != nil {
+		return err
+	}
+	packet, err := packResponse(0, nil, answers)
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteToUDP(packet, groupAddr)
+	return err
+}
+
+// respond answers a query received from addr, if it concerns s.
+func respond(conn *net.UDPConn, s Service, packet []byte, addr *net.UDPAddr) error {
+	var query dnsmessage.Message
+	if err := query.Unpack(packet); err != nil {
+		return nil
+	}
+	if query.Header.Response {
+		return nil
+	}
+
+	var matched []dnsmessage.Question
+	for _, question := range query.Questions {
+		question.Class &^= unicastResponse
+		if s.answers(question) {
+			matched = append(matched, question)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	answers, err := s.records(ttl)
+	if err != nil {
+		return err
+	}
+
+	// Legacy unicast queries, RFC 6762 section 6.7.
+	if addr.Port != groupAddr.Port {
+		response, err := packResponse(query.Header.ID, matched, answers)
+		if err != nil {
+			return err
+		}
+		_, err = conn.WriteToUDP(response, addr)
+		return err
+	}
+
+	response, err := packResponse(0, nil, answers)
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteToUDP(response, groupAddr)
+	return err
+}
+
+// Advertise announces s on the local network and answers queries for it until ctx is done, when a
+// goodbye is sent.
+func Advertise(ctx context.Context, s Service) (err error) {
+	logger := log.MustLogger(ctx)
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for multicast DNS: %w", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		if err := announce(conn, s, 0); err != nil {
+			logger.Error("Failed to send multicast DNS goodbye", "error", err)
+		}
+		conn.Close()
+	}()
+
+	for _, delay := range []time.Duration{0, time.Second} {
+		time.Sleep(delay)
+		if err := announce(conn, s, ttl); err != nil {
+			return fmt.Errorf("failed to announce: %w", err)
+		}
+	}
+
+	buf := make([]byte, 9000)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to read multicast DNS: %w", err)
+		}
+		if err := respond(conn, s, buf[:n], addr); err != nil {
+			logger.Error("Failed to respond multicast DNS query", "error", err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestServiceAnswers(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		qname string
+		qtype dnsmessage.Type
+		want  bool
+	}{
+		{"service PTR", "_serialtcp._tcp.local.", dnsmessage.TypePTR, true},
+		{"service PTR case insensitive", "_SerialTCP._TCP.Local.", dnsmessage.TypePTR, true},
+		{"service ANY", "_serialtcp._tcp.local.", dnsmessage.TypeALL, true},
+		{"service SRV", "_serialtcp._tcp.local.", dnsmessage.TypeSRV, false},
+		{"instance SRV", "serialtcp ttyUSB0 on host-example._serialtcp._tcp.local.", dnsmessage.TypeSRV, true},
+		{"instance TXT", "serialtcp ttyUSB0 on host-example._serialtcp._tcp.local.", dnsmessage.TypeTXT, true},
+		{"instance A", "serialtcp ttyUSB0 on host-example._serialtcp._tcp.local.", dnsmessage.TypeA, false},
+		{"host A", "myhost.local.", dnsmessage.TypeA, true},
+		{"host AAAA", "myhost.local.", dnsmessage.TypeAAAA, false},
+		{"other service", "_http._tcp.local.", dnsmessage.TypePTR, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			question := dnsmessage.Question{Name: dnsmessage.MustNewName(tc.qname), Type: tc.qtype, Class: dnsmessage.ClassINET}
+			if got := testService.answers(question); got != tc.want {
+				t.Errorf("answers %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// listenLoopback returns a UDP connection on a loopback port, closed when t ends.
+func listenLoopback(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestRespond(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		question dnsmessage.Question
+		response bool
+		answered bool
+	}{
+		{
+			name:     "PTR",
+			question: dnsmessage.Question{Name: dnsmessage.MustNewName("_serialtcp._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+			answered: true,
+		},
+		{
+			name:     "PTR with unicast response bit",
+			question: dnsmessage.Question{Name: dnsmessage.MustNewName("_serialtcp._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET | unicastResponse},
+			answered: true,
+		},
+		{
+			name:     "SRV",
+			question: dnsmessage.Question{Name: dnsmessage.MustNewName("serialtcp ttyUSB0 on host-example._serialtcp._tcp.local."), Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET},
+			answered: true,
+		},
+		{
+			name:     "other service",
+			question: dnsmessage.Question{Name: dnsmessage.MustNewName("_http._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+		},
+		{
+			name:     "response",
+			question: dnsmessage.Question{Name: dnsmessage.MustNewName("_serialtcp._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+			response: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := listenLoopback(t)
+			client := listenLoopback(t)
+			query := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: 1234, Response: tc.response},
+				Questions: []dnsmessage.Question{tc.question},
+			}
+			packet, err := query.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Queries not from port 5353 are legacy unicast ones, answered to their source.
+			if err := respond(server, testService, packet, client.LocalAddr().(*net.UDPAddr)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := client.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 9000)
+			n, _, err := client.ReadFromUDP(buf)
+			if !tc.answered {
+				if err == nil {
+					t.Fatalf("unexpected response of %d bytes", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil {
+				t.Fatal(err)
+			}
+			if !msg.Header.Response || !msg.Header.Authoritative || msg.Header.ID != 1234 {
+				t.Errorf("header %v, want an authoritative response with the query ID", msg.Header)
+			}
+			question := tc.question
+			question.Class &^= unicastResponse
+			if len(msg.Questions) != 1 || msg.Questions[0] != question {
+				t.Errorf("questions %v, want %v", msg.Questions, question)
+			}
+			checkRecords(t, msg.Answers, ttl)
+		})
+	}
+}
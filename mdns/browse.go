@@ -0,0 +1,140 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Entry is a service instance found by Browse.
+type Entry struct {
+	Instance string
+	Host     string
+	IPs      []net.IP
+	Port     uint16
+	Text     []string
+}
+
+type browseResults struct {
+	serviceName string
+	instances   map[string]*Entry
+	hosts       map[string][]net.IP
+}
+
+func (r *browseResults) instance(name string) *Entry {
+	key := strings.ToLower(name)
+	entry, ok := r.instances[key]
+	if !ok {
+		entry = &Entry{Instance: name[:len(name)-len(r.serviceName)-1]}
+		r.instances[key] = entry
+	}
+	return entry
+}
+
+func (r *browseResults) add(resources []dnsmessage.Resource) {
+	for _, resource := range resources {
+		name := resource.Header.Name.String()
+		lowerName := strings.ToLower(name)
+		isInstance := strings.HasSuffix(lowerName, "."+r.serviceName)
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if lowerName == r.serviceName && strings.HasSuffix(strings.ToLower(body.PTR.String()), "."+r.serviceName) {
+				r.instance(body.PTR.String())
+			}
+		case *dnsmessage.SRVResource:
+			if isInstance {
+				entry := r.instance(name)
+				entry.Host = strings.ToLower(body.Target.String())
+				entry.Port = body.Port
+			}
+		case *dnsmessage.TXTResource:
+			if isInstance {
+				r.instance(name).Text = body.TXT
+			}
+		case *dnsmessage.AResource:
+			name = lowerName
+			ip := net.IP(body.A[:])
+			for _, known := range r.hosts[name] {
+				if known.Equal(ip) {
+					ip = nil
+					break
+				}
+			}
+			if ip != nil {
+				r.hosts[name] = append(r.hosts[name], ip)
+			}
+		}
+	}
+}
+
+func (r *browseResults) entries() []Entry {
+	entries := make([]Entry, 0, len(r.instances))
+	for _, entry := range r.instances {
+		entry.IPs = r.hosts[entry.Host]
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Instance < entries[j].Instance })
+	return entries
+}
+
+// Browse queries the local network for instances of service (eg: "_serialtcp._tcp") at domain
+// (usually "local"), collecting responses until ctx is done.
+func Browse(ctx context.Context, service, domain string) (entries []Entry, err error) {
+	serviceName := strings.ToLower(fmt.Sprintf("%s.%s.", service, domain))
+	name, err := dnsmessage.NewName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	defer func() { err = errors.Join(err, conn.Close()) }()
+
+	query := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(packet, groupAddr); err != nil {
+		return nil, fmt.Errorf("failed to send query: %w", err)
+	}
+
+	results := &browseResults{
+		serviceName: serviceName,
+		instances:   map[string]*Entry{},
+		hosts:       map[string][]net.IP{},
+	}
+	buf := make([]byte, 9000)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+			return nil, err
+		}
+		n, _, err := conn.ReadFromUDP(buf)
+		if ctx.Err() != nil {
+			return results.entries(), nil
+		}
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		var response dnsmessage.Message
+		if err := response.Unpack(buf[:n]); err != nil || !response.Header.Response {
+			continue
+		}
+		results.add(response.Answers)
+		results.add(response.Additionals)
+	}
+}
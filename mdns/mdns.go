@@ -0,0 +1,122 @@
+// Package mdns implements minimal DNS Service Discovery (RFC 6763) over Multicast DNS (RFC 6762),
+// enough to advertise a service on the local network and to browse for it.
+package mdns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Multicast DNS IPv4 group address.
+var groupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Cache flush bit of the resource record class, RFC 6762 section 10.2.
+const cacheFlush = 1 << 15
+
+// Unicast response bit of the question class, RFC 6762 section 5.4.
+const unicastResponse = 1 << 15
+
+// Default TTL for records, in seconds.
+const ttl = 120
+
+// Service describes an advertised service instance.
+type Service struct {
+	// Instance name, eg: "serialtcp ttyUSB0 on myhost". Dots are replaced by dashes, as they can
+	// not be represented.
+	Instance string
+	// Service type, eg: "_serialtcp._tcp".
+	Service string
+	// Domain, usually "local".
+	Domain string
+	// Host name of the target, without domain.
+	Host string
+	// Addresses of the host.
+	IPs []net.IP
+	// Port the service is available at.
+	Port uint16
+	// TXT record strings, usually key=value pairs.
+	Text []string
+}
+
+func (s Service) serviceName() string {
+	return fmt.Sprintf("%s.%s.", s.Service, s.Domain)
+}
+
+func (s Service) instanceName() string {
+	return fmt.Sprintf("%s.%s", strings.ReplaceAll(s.Instance, ".", "-"), s.serviceName())
+}
+
+func (s Service) hostName() string {
+	return fmt.Sprintf("%s.%s.", s.Host, s.Domain)
+}
+
+// records returns the resource records advertising s, with the given ttl.
+func (s Service) records(ttl uint32) (answers []dnsmessage.Resource, err error) {
+	serviceName, err := dnsmessage.NewName(s.serviceName())
+	if err != nil {
+		return nil, err
+	}
+	instanceName, err := dnsmessage.NewName(s.instanceName())
+	if err != nil {
+		return nil, err
+	}
+	hostName, err := dnsmessage.NewName(s.hostName())
+	if err != nil {
+		return nil, err
+	}
+
+	answers = append(answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: serviceName, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: instanceName},
+	})
+	answers = append(answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: instanceName, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Target: hostName, Port: s.Port},
+	})
+	text := s.Text
+	if len(text) == 0 {
+		text = []string{""}
+	}
+	answers = append(answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: instanceName, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+		Body:   &dnsmessage.TXTResource{TXT: text},
+	})
+	for _, ip := range s.IPs {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			continue
+		}
+		answers = append(answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: hostName, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: [4]byte(ip4)},
+		})
+	}
+	return answers, nil
+}
+
+// InterfaceIPs returns the IPv4 addresses of all multicast capable, up, non loopback interfaces.
+func InterfaceIPs() ([]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	return ips, nil
+}
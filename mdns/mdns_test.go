@@ -0,0 +1,119 @@
+package mdns
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testService is advertised by the tests.
+var testService = Service{
+	Instance: "serialtcp ttyUSB0 on host.example",
+	Service:  "_serialtcp._tcp",
+	Domain:   "local",
+	Host:     "myhost",
+	IPs:      []net.IP{net.IPv4(192, 168, 1, 10), net.ParseIP("fe80::1"), net.IPv4(10, 0, 0, 1)},
+	Port:     8086,
+	Text:     []string{"port=ttyUSB0", "baud=9600"},
+}
+
+// Names of the records of testService.
+const (
+	testServiceName  = "_serialtcp._tcp.local."
+	testInstanceName = "serialtcp ttyUSB0 on host-example._serialtcp._tcp.local."
+	testHostName     = "myhost.local."
+)
+
+// checkRecords checks that answers are the records of testService, with ttl.
+func checkRecords(t *testing.T, answers []dnsmessage.Resource, ttl uint32) {
+	t.Helper()
+	if len(answers) != 5 {
+		t.Fatalf("%d records, want PTR, SRV, TXT and 2 A: %v", len(answers), answers)
+	}
+	for i, answer := range answers {
+		if answer.Header.TTL != ttl {
+			t.Errorf("record %d: TTL %d, want %d", i, answer.Header.TTL, ttl)
+		}
+	}
+	// The PTR record is shared by all instances, and the others are unique to this one.
+	if answers[0].Header.Class != dnsmessage.ClassINET {
+		t.Errorf("PTR record class %v, want IN without cache flush", answers[0].Header.Class)
+	}
+	for _, answer := range answers[1:] {
+		if answer.Header.Class != dnsmessage.ClassINET|cacheFlush {
+			t.Errorf("%v record class %v, want IN with cache flush", answer.Header.Type, answer.Header.Class)
+		}
+	}
+	checkInstanceRecords(t, answers[:3])
+	checkAddressRecords(t, answers[3:])
+}
+
+// checkInstanceRecords checks the PTR, SRV and TXT records of testService.
+func checkInstanceRecords(t *testing.T, answers []dnsmessage.Resource) {
+	t.Helper()
+	ptr, ok := answers[0].Body.(*dnsmessage.PTRResource)
+	if !ok || answers[0].Header.Name.String() != testServiceName || ptr.PTR.String() != testInstanceName {
+		t.Errorf("PTR record: %v", answers[0])
+	}
+	srv, ok := answers[1].Body.(*dnsmessage.SRVResource)
+	if !ok || answers[1].Header.Name.String() != testInstanceName || srv.Target.String() != testHostName || srv.Port != 8086 {
+		t.Errorf("SRV record: %v", answers[1])
+	}
+	txt, ok := answers[2].Body.(*dnsmessage.TXTResource)
+	if !ok || answers[2].Header.Name.String() != testInstanceName || !slices.Equal(txt.TXT, testService.Text) {
+		t.Errorf("TXT record: %v", answers[2])
+	}
+}
+
+// checkAddressRecords checks the A records of testService, which only has IPv4 ones.
+func checkAddressRecords(t *testing.T, answers []dnsmessage.Resource) {
+	t.Helper()
+	for i, want := range [][4]byte{{192, 168, 1, 10}, {10, 0, 0, 1}} {
+		a, ok := answers[i].Body.(*dnsmessage.AResource)
+		if !ok || answers[i].Header.Name.String() != testHostName || a.A != want {
+			t.Errorf("A record %d: %v, want %v", i, answers[i], want)
+		}
+	}
+}
+
+func TestServiceRecords(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ttl  uint32
+	}{
+		{"announcement", ttl},
+		{"goodbye", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			answers, err := testService.records(tc.ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Records are as received once packed and unpacked.
+			packet, err := packResponse(0, nil, answers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(packet); err != nil {
+				t.Fatal(err)
+			}
+			checkRecords(t, msg.Answers, tc.ttl)
+		})
+	}
+}
+
+func TestServiceRecordsEmptyText(t *testing.T) {
+	service := testService
+	service.Text = nil
+	answers, err := service.records(ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt, ok := answers[2].Body.(*dnsmessage.TXTResource)
+	if !ok || !slices.Equal(txt.TXT, []string{""}) {
+		t.Errorf("TXT record %v, want one empty string, as TXT records can not be empty", answers[2])
+	}
+}
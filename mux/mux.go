@@ -0,0 +1,281 @@
+// Package mux multiplexes streams over one connection, so that a single connection can carry
+// several serialtcp sessions, each with a serial port of its own, such as when only one port can
+// be reached through firewalls.
+//
+// Each frame is:
+//
+//	stream  4 bytes  stream ID, big endian, chosen by the client
+//	type    1 byte   see Type
+//	length  2 bytes  payload length, big endian
+//	payload length bytes
+//
+// Clients open streams with an open frame, naming what to connect to as payload, which servers
+// answer with an accept frame, or with a refuse frame with the reason as payload. Data frames then
+// carry data both ways. Each side may send up to InitialWindow bytes of data it was not granted
+// more room for with window frames, so that a stalled stream does not stall the others. A
+// close-write frame ends the data sent by a side, and a reset frame ends the stream.
+package mux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// MaxPayload is the maximum payload length of a frame.
+const MaxPayload = 0xffff
+
+// InitialWindow is how much data may be sent on a stream before being granted more room.
+const InitialWindow = 256 * 1024
+
+// Opened streams waiting to be accepted at most, beyond which they are refused.
+const acceptBacklog = 64
+
+const headerSize = 7
+
+// Type is a frame type.
+type Type byte
+
+const (
+	// Opens a stream, with what to connect to as payload.
+	TypeOpen Type = iota
+	// Accepts an opened stream.
+	TypeAccept
+	// Refuses an opened stream, with the reason as payload.
+	TypeRefuse
+	// Stream data.
+	TypeData
+	// Grants room for more data, in bytes, as a 32 bit big endian payload.
+	TypeWindow
+	// Ends the data sent by a side.
+	TypeCloseWrite
+	// Ends the stream.
+	TypeReset
+)
+
+// ErrReset is returned writing to streams reset by the peer.
+var ErrReset = errors.New("stream reset by peer")
+
+// frame is a frame.
+type frame struct {
+	stream  uint32
+	typ     Type
+	payload []byte
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{
+		stream:  binary.BigEndian.Uint32(header[:]),
+		typ:     Type(header[4]),
+		payload: make([]byte, binary.BigEndian.Uint16(header[5:])),
+	}
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return frame{}, err
+	}
+	return f, nil
+}
+
+// Session is one side of a multiplexed connection.
+type Session struct {
+	conn   net.Conn
+	client bool
+	// Streams opened by the client, for servers to accept.
+	accepts chan *Stream
+	// Closed once the connection fails, with err set.
+	done chan struct{}
+	err  error
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+}
+
+func newSession(conn net.Conn, client bool) *Session {
+	s := &Session{
+		conn:    conn,
+		client:  client,
+		accepts: make(chan *Stream, acceptBacklog),
+		done:    make(chan struct{}),
+		streams: map[uint32]*Stream{},
+	}
+	go s.readFrames()
+	return s
+}
+
+// Client returns the client side of a multiplexed connection over conn, which opens streams.
+func Client(conn net.Conn) *Session {
+	return newSession(conn, true)
+}
+
+// Server returns the server side of a multiplexed connection over conn, which accepts streams.
+func Server(conn net.Conn) *Session {
+	return newSession(conn, false)
+}
+
+// Open opens a stream to name, returning once the server accepts it.
+func (s *Session) Open(name string) (*Stream, error) {
+	if !s.client {
+		return nil, errors.New("only clients open streams")
+	}
+	if len(name) > MaxPayload {
+		return nil, fmt.Errorf("stream name too long: %d bytes", len(name))
+	}
+	s.mu.Lock()
+	s.nextID++
+	st := newStream(s, s.nextID, name)
+	st.opened = make(chan error, 1)
+	s.streams[st.id] = st
+	s.mu.Unlock()
+	if err := s.writeFrame(st.id, TypeOpen, []byte(name)); err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-st.opened:
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return st, nil
+	case <-s.done:
+		return nil, s.err
+	}
+}
+
+// Accept waits for the client to open a stream, which must then be confirmed with Confirm or
+// refused with Refuse.
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-s.accepts:
+		return st, nil
+	case <-s.done:
+		return nil, s.err
+	}
+}
+
+// Close closes the connection, failing all streams. The connection is also closed once it fails.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// Done returns a channel closed once the connection fails or is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Session) writeFrame(stream uint32, typ Type, payload []byte) error {
+	buf := make([]byte, headerSize, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf, stream)
+	buf[4] = byte(typ)
+	binary.BigEndian.PutUint16(buf[5:], uint16(len(payload)))
+	buf = append(buf, payload...)
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err := s.conn.Write(buf)
+	return err
+}
+
+// readFrames handles received frames, until the connection fails.
+func (s *Session) readFrames() {
+	reader := bufio.NewReader(s.conn)
+	var err error
+	for err == nil {
+		var f frame
+		f, err = readFrame(reader)
+		if err == nil {
+			err = s.handle(f)
+		}
+	}
+	// Unblocking writes, on protocol errors.
+	_ = s.conn.Close()
+	s.mu.Lock()
+	s.err = fmt.Errorf("multiplexed connection lost: %w", err)
+	streams := s.streams
+	s.streams = map[uint32]*Stream{}
+	s.mu.Unlock()
+	close(s.done)
+	for _, st := range streams {
+		st.fail(s.err)
+	}
+}
+
+// handle handles f, failing on protocol errors.
+func (s *Session) handle(f frame) error {
+	if f.typ == TypeOpen {
+		return s.handleOpen(f)
+	}
+	s.mu.Lock()
+	st, ok := s.streams[f.stream]
+	if ok && (f.typ == TypeRefuse || f.typ == TypeReset) {
+		delete(s.streams, f.stream)
+	}
+	s.mu.Unlock()
+	if !ok {
+		// Frames in flight when the stream was reset.
+		return nil
+	}
+	switch f.typ {
+	case TypeAccept, TypeRefuse:
+		if st.opened == nil {
+			return fmt.Errorf("unexpected frame type %d from client", f.typ)
+		}
+		if f.typ == TypeRefuse {
+			st.opened <- fmt.Errorf("refused: %s", f.payload)
+		} else {
+			st.opened <- nil
+		}
+	case TypeData:
+		return st.receive(f.payload)
+	case TypeWindow:
+		if len(f.payload) != 4 {
+			return fmt.Errorf("invalid window payload length: %d", len(f.payload))
+		}
+		st.grant(binary.BigEndian.Uint32(f.payload))
+	case TypeCloseWrite:
+		st.peerClosed(false)
+	case TypeReset:
+		st.peerClosed(true)
+	default:
+		// From newer peers.
+	}
+	return nil
+}
+
+// handleOpen queues a stream opened by the client to be accepted.
+func (s *Session) handleOpen(f frame) error {
+	if s.client {
+		return errors.New("unexpected open frame from server")
+	}
+	s.mu.Lock()
+	if _, ok := s.streams[f.stream]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("stream %d opened twice", f.stream)
+	}
+	st := newStream(s, f.stream, string(f.payload))
+	s.streams[f.stream] = st
+	s.mu.Unlock()
+	select {
+	case s.accepts <- st:
+		return nil
+	default:
+		return st.Refuse("too many streams opening")
+	}
+}
+
+// remove forgets the stream of id.
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
@@ -0,0 +1,280 @@
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stream is a stream of a multiplexed connection. It implements net.Conn, with the addresses of
+// the connection.
+type Stream struct {
+	session *Session
+	id      uint32
+	name    string
+	// For streams opened by clients, receives nil once accepted, or why it was refused.
+	opened chan error
+
+	mu sync.Mutex
+	// Closed and replaced on every change of the fields below, waking up blocked reads and writes.
+	changed chan struct{}
+	// Received data not read yet.
+	buf []byte
+	// Data read, which the peer was not granted room for again yet.
+	consumed uint32
+	// Room left to send data.
+	window uint32
+	// Whether the peer ended its data, and whether it reset the stream.
+	readClosed, reset bool
+	// Whether this side ended its data, or closed the stream.
+	writeClosed, closed bool
+	// Why the stream failed, with the connection.
+	err                         error
+	readDeadline, writeDeadline time.Time
+}
+
+func newStream(session *Session, id uint32, name string) *Stream {
+	return &Stream{
+		session: session,
+		id:      id,
+		name:    name,
+		changed: make(chan struct{}),
+		window:  InitialWindow,
+	}
+}
+
+// Name returns what the stream was opened to.
+func (st *Stream) Name() string {
+	return st.name
+}
+
+// Confirm accepts a stream opened by the client.
+func (st *Stream) Confirm() error {
+	return st.session.writeFrame(st.id, TypeAccept, nil)
+}
+
+// Refuse refuses a stream opened by the client, telling it reason.
+func (st *Stream) Refuse(reason string) error {
+	st.session.remove(st.id)
+	if len(reason) > MaxPayload {
+		reason = reason[:MaxPayload]
+	}
+	return st.session.writeFrame(st.id, TypeRefuse, []byte(reason))
+}
+
+// broadcast wakes up blocked reads and writes, with mu held.
+func (st *Stream) broadcast() {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+// wait waits, with mu held, for a change or for deadline, if set, failing with
+// os.ErrDeadlineExceeded once it passed.
+func (st *Stream) wait(deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	changed := st.changed
+	st.mu.Unlock()
+	defer st.mu.Lock()
+	select {
+	case <-changed:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// receive queues data received from the peer to be read.
+func (st *Stream) receive(data []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.buf)+len(data) > InitialWindow {
+		return fmt.Errorf("stream %d sent beyond its window", st.id)
+	}
+	if st.closed {
+		return nil
+	}
+	st.buf = append(st.buf, data...)
+	st.broadcast()
+	return nil
+}
+
+// grant gives room to send n more bytes.
+func (st *Stream) grant(n uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.window += n
+	st.broadcast()
+}
+
+// peerClosed records the peer ending its data, or resetting the stream.
+func (st *Stream) peerClosed(reset bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.readClosed = true
+	st.reset = st.reset || reset
+	st.broadcast()
+}
+
+// fail fails the stream with err, as the connection failed.
+func (st *Stream) fail(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.err = err
+	st.broadcast()
+	if st.opened != nil {
+		select {
+		case st.opened <- err:
+		default:
+		}
+	}
+}
+
+// Read reads data sent by the peer, returning io.EOF once it ended it.
+func (st *Stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for len(st.buf) == 0 {
+		switch {
+		case st.closed:
+			return 0, net.ErrClosed
+		case st.readClosed:
+			return 0, io.EOF
+		case st.err != nil:
+			return 0, st.err
+		}
+		if err := st.wait(st.readDeadline); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, st.buf)
+	st.buf = st.buf[n:]
+	st.consumed += uint32(n)
+	if st.consumed < InitialWindow/2 || st.readClosed {
+		return n, nil
+	}
+	grant := st.consumed
+	st.consumed = 0
+	// Not holding mu while writing, which may block until the peer reads.
+	st.mu.Unlock()
+	err := st.session.writeFrame(st.id, TypeWindow, binary.BigEndian.AppendUint32(nil, grant))
+	st.mu.Lock()
+	return n, err
+}
+
+// Write sends p, blocking while the peer has not granted room for it.
+func (st *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		st.mu.Lock()
+		n, err := st.reserve(len(p))
+		st.mu.Unlock()
+		if err != nil {
+			return written, err
+		}
+		if err := st.session.writeFrame(st.id, TypeData, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// reserve waits, with mu held, for room to send up to n bytes, returning how much was reserved.
+func (st *Stream) reserve(n int) (int, error) {
+	for {
+		switch {
+		case st.closed || st.writeClosed:
+			return 0, net.ErrClosed
+		case st.reset:
+			return 0, ErrReset
+		case st.err != nil:
+			return 0, st.err
+		}
+		if st.window > 0 {
+			n = min(n, int(st.window), MaxPayload)
+			st.window -= uint32(n)
+			return n, nil
+		}
+		if err := st.wait(st.writeDeadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// CloseWrite ends the data sent to the peer, which reads it as io.EOF.
+func (st *Stream) CloseWrite() error {
+	st.mu.Lock()
+	if st.closed || st.writeClosed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.writeClosed = true
+	st.broadcast()
+	st.mu.Unlock()
+	return st.session.writeFrame(st.id, TypeCloseWrite, nil)
+}
+
+// Close resets the stream, after the data written so far.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	st.buf = nil
+	failed := st.err != nil
+	st.broadcast()
+	st.mu.Unlock()
+	st.session.remove(st.id)
+	if failed {
+		return nil
+	}
+	if err := st.session.writeFrame(st.id, TypeReset, nil); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (st *Stream) LocalAddr() net.Addr  { return st.session.conn.LocalAddr() }
+func (st *Stream) RemoteAddr() net.Addr { return st.session.conn.RemoteAddr() }
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.readDeadline = t
+	st.writeDeadline = t
+	st.broadcast()
+	return nil
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.readDeadline = t
+	st.broadcast()
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.writeDeadline = t
+	st.broadcast()
+	return nil
+}
@@ -0,0 +1,138 @@
+package nmea
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Fix holds position data decoded from GGA, GLL and RMC sentences. Fields not carried by the
+// sentence, or empty in it, are nil.
+type Fix struct {
+	// UTC time of the fix, as hhmmss.ss.
+	Time *string `json:"time,omitempty"`
+	// UTC date of the fix, as ddmmyy (RMC only).
+	Date *string `json:"date,omitempty"`
+	// Whether the receiver reports the data as valid (GLL and RMC only).
+	Valid *bool `json:"valid,omitempty"`
+	// Latitude and longitude in decimal degrees, negative for south and west.
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// Fix quality: 0 invalid, 1 GPS, 2 DGPS, 4 RTK fixed, 5 RTK float... (GGA only).
+	Quality *int `json:"quality,omitempty"`
+	// Satellites in use (GGA only).
+	Satellites *int `json:"satellites,omitempty"`
+	// Horizontal dilution of precision (GGA only).
+	HDOP *float64 `json:"hdop,omitempty"`
+	// Altitude above mean sea level, in meters (GGA only).
+	Altitude *float64 `json:"altitude,omitempty"`
+	// Speed over ground in knots and true course in degrees (RMC only).
+	SpeedKnots *float64 `json:"speed_knots,omitempty"`
+	Course     *float64 `json:"course,omitempty"`
+}
+
+func field(fields []string, i int) string {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return ""
+}
+
+func stringField(fields []string, i int) *string {
+	if s := field(fields, i); s != "" {
+		return &s
+	}
+	return nil
+}
+
+func floatField(fields []string, i int) *float64 {
+	f, err := strconv.ParseFloat(field(fields, i), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+func intField(fields []string, i int) *int {
+	n, err := strconv.Atoi(field(fields, i))
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func statusField(fields []string, i int) *bool {
+	switch field(fields, i) {
+	case "A":
+		valid := true
+		return &valid
+	case "V":
+		valid := false
+		return &valid
+	}
+	return nil
+}
+
+// coordinateField decodes a (d)ddmm.mmmm coordinate at fields[i] and its hemisphere at
+// fields[i+1].
+func coordinateField(fields []string, i int) *float64 {
+	value := field(fields, i)
+	dot := strings.IndexByte(value, '.')
+	if dot < 0 {
+		dot = len(value)
+	}
+	if dot < 3 {
+		return nil
+	}
+	degrees, err := strconv.ParseFloat(value[:dot-2], 64)
+	if err != nil {
+		return nil
+	}
+	minutes, err := strconv.ParseFloat(value[dot-2:], 64)
+	if err != nil {
+		return nil
+	}
+	coordinate := degrees + minutes/60
+	switch field(fields, i+1) {
+	case "N", "E":
+	case "S", "W":
+		coordinate = -coordinate
+	default:
+		return nil
+	}
+	return &coordinate
+}
+
+// Fix decodes position data from GGA, GLL and RMC sentences, returning false for other types.
+func (s Sentence) Fix() (Fix, bool) {
+	f := s.Fields
+	switch s.Type {
+	case "GGA":
+		return Fix{
+			Time:       stringField(f, 0),
+			Latitude:   coordinateField(f, 1),
+			Longitude:  coordinateField(f, 3),
+			Quality:    intField(f, 5),
+			Satellites: intField(f, 6),
+			HDOP:       floatField(f, 7),
+			Altitude:   floatField(f, 8),
+		}, true
+	case "GLL":
+		return Fix{
+			Latitude:  coordinateField(f, 0),
+			Longitude: coordinateField(f, 2),
+			Time:      stringField(f, 4),
+			Valid:     statusField(f, 5),
+		}, true
+	case "RMC":
+		return Fix{
+			Time:       stringField(f, 0),
+			Valid:      statusField(f, 1),
+			Latitude:   coordinateField(f, 2),
+			Longitude:  coordinateField(f, 4),
+			SpeedKnots: floatField(f, 6),
+			Course:     floatField(f, 7),
+			Date:       stringField(f, 8),
+		}, true
+	}
+	return Fix{}, false
+}
@@ -0,0 +1,151 @@
+// Package nmea parses NMEA 0183 sentences, as spoken by GPS receivers and marine electronics.
+package nmea
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Longest sentence accepted. The standard limits sentences to 82 characters, but some devices
+// exceed it.
+const MaxSentenceLength = 1024
+
+var (
+	// ErrInvalid is returned for lines which are not NMEA sentences.
+	ErrInvalid = errors.New("invalid NMEA sentence")
+	// ErrChecksum is returned for sentences whose checksum does not match.
+	ErrChecksum = errors.New("NMEA sentence checksum mismatch")
+)
+
+// Sentence is a parsed NMEA 0183 sentence.
+type Sentence struct {
+	// Raw sentence, without line ending.
+	Raw string
+	// Start delimiter: '$' for parametric sentences, '!' for encapsulated ones (eg: AIS).
+	Start byte
+	// Talker identifier, such as "GP" for GPS, empty for proprietary sentences.
+	Talker string
+	// Sentence type, such as "RMC", or the manufacturer code and type of proprietary sentences,
+	// such as "PGRME".
+	Type string
+	// Fields following the address field.
+	Fields []string
+	// Whether the sentence had a checksum, which is always verified when present.
+	HasChecksum bool
+}
+
+// Checksum returns the checksum of a sentence body, the characters between the start delimiter
+// and '*'.
+func Checksum(body string) byte {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return sum
+}
+
+// Parse parses a sentence, without line ending, verifying its checksum when present.
+func Parse(raw string) (Sentence, error) {
+	if len(raw) < 2 || (raw[0] != '$' && raw[0] != '!') {
+		return Sentence{}, fmt.Errorf("%w: %q", ErrInvalid, raw)
+	}
+	if len(raw) > MaxSentenceLength {
+		return Sentence{}, fmt.Errorf("%w: longer than %d characters", ErrInvalid, MaxSentenceLength)
+	}
+	s := Sentence{Raw: raw, Start: raw[0]}
+
+	body := raw[1:]
+	if i := strings.LastIndexByte(body, '*'); i >= 0 {
+		want, err := strconv.ParseUint(body[i+1:], 16, 8)
+		if err != nil || len(body[i+1:]) != 2 {
+			return Sentence{}, fmt.Errorf("%w: bad checksum field: %q", ErrInvalid, raw)
+		}
+		body = body[:i]
+		if got := Checksum(body); got != byte(want) {
+			return Sentence{}, fmt.Errorf("%w: %q: got %02X, want %02X", ErrChecksum, raw, got, want)
+		}
+		s.HasChecksum = true
+	}
+
+	fields := strings.Split(body, ",")
+	address := fields[0]
+	s.Fields = fields[1:]
+	switch {
+	case strings.HasPrefix(address, "P"):
+		s.Type = address
+	case len(address) == 5:
+		s.Talker = address[:2]
+		s.Type = address[2:]
+	default:
+		return Sentence{}, fmt.Errorf("%w: bad address field: %q", ErrInvalid, raw)
+	}
+	return s, nil
+}
+
+// Scanner reads sentences from a stream, splitting on sentence boundaries. Data before a start
+// delimiter, such as line noise or a partial sentence after connecting, is skipped.
+type Scanner struct {
+	scanner *bufio.Scanner
+	err     error
+	raw     string
+}
+
+// NewScanner returns a Scanner reading from r.
+func NewScanner(r io.Reader) *Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 128), MaxSentenceLength+2)
+	scanner.Split(splitSentences)
+	return &Scanner{scanner: scanner}
+}
+
+// splitSentences is a bufio.SplitFunc returning sentences, from a start delimiter up to, and
+// excluding, the line ending.
+func splitSentences(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.IndexAny(data, "$!")
+	if start < 0 {
+		// Nothing but noise so far.
+		return len(data), nil, nil
+	}
+	if end := bytes.IndexAny(data[start:], "\r\n"); end >= 0 {
+		return start + end + 1, data[start : start+end], nil
+	}
+	if len(data)-start > MaxSentenceLength {
+		// Skip past the start delimiter, to resynchronize on the next sentence.
+		return start + 1, nil, nil
+	}
+	if atEOF {
+		return len(data), data[start:], nil
+	}
+	return start, nil, nil
+}
+
+// Scan advances to the next line looking like a sentence, returning false at the end of the
+// stream or on a read error. Use Sentence to parse it.
+func (s *Scanner) Scan() bool {
+	if !s.scanner.Scan() {
+		s.err = s.scanner.Err()
+		return false
+	}
+	s.raw = s.scanner.Text()
+	return true
+}
+
+// Raw returns the last scanned line.
+func (s *Scanner) Raw() string {
+	return s.raw
+}
+
+// Sentence parses the last scanned line.
+func (s *Scanner) Sentence() (Sentence, error) {
+	return Parse(s.raw)
+}
+
+// Err returns the read error which stopped Scan, if any.
+func (s *Scanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,77 @@
+// Package nullmodem implements a software null modem: a pair of pseudo terminals linked to each
+// other, so that what is written to one is read from the other, as with two serial ports wired
+// with a null modem cable. It allows developing and testing against serial ports without hardware.
+package nullmodem
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// End is one end of the null modem.
+type End struct {
+	// ptm is the pseudo terminal master, which the null modem copies data through.
+	ptm *os.File
+	// pts is the pseudo terminal slave, the device programs open. It is kept open by the null
+	// modem, so that reading ptm does not fail while no program has it open.
+	pts *os.File
+}
+
+// Name returns the device name of the end, to be opened as a serial port.
+func (e *End) Name() string {
+	return e.pts.Name()
+}
+
+func (e *End) close() error {
+	return errors.Join(e.ptm.Close(), e.pts.Close())
+}
+
+// NullModem is a pair of pseudo terminals linked to each other.
+type NullModem struct {
+	A, B *End
+
+	closed atomic.Bool
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	errs   []error
+}
+
+// Open creates a null modem, copying data between its ends until closed.
+func Open() (*NullModem, error) {
+	a, err := openEnd()
+	if err != nil {
+		return nil, err
+	}
+	b, err := openEnd()
+	if err != nil {
+		return nil, errors.Join(err, a.close())
+	}
+	n := &NullModem{A: a, B: b}
+	n.wg.Add(2)
+	go n.copy(b.ptm, a.ptm)
+	go n.copy(a.ptm, b.ptm)
+	return n, nil
+}
+
+func (n *NullModem) copy(dst io.Writer, src io.Reader) {
+	defer n.wg.Done()
+	// Reading fails with EIO once closing, which is expected.
+	if _, err := io.Copy(dst, src); err != nil && !n.closed.Load() {
+		n.mu.Lock()
+		n.errs = append(n.errs, err)
+		n.mu.Unlock()
+	}
+}
+
+// Close closes both ends, returning any error copying data between them.
+func (n *NullModem) Close() error {
+	n.closed.Store(true)
+	err := errors.Join(n.A.close(), n.B.close())
+	n.wg.Wait()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return errors.Join(append(n.errs, err)...)
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+
+package nullmodem
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// openDevice opens the device of end, as programs using it as a serial port do.
+func openDevice(t *testing.T, end *End) *os.File {
+	t.Helper()
+	device, err := os.OpenFile(end.Name(), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.Close() })
+	return device
+}
+
+// transfer writes data to from, failing t unless it is read unchanged from to in time.
+func transfer(t *testing.T, from, to *os.File, data []byte) {
+	t.Helper()
+	if _, err := from.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := to.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(to, got); err != nil {
+		t.Fatalf("read %d of %d bytes: %v", len(bytes.TrimRight(got, "\x00")), len(data), err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("read %q, want %q", got, data)
+	}
+}
+
+func TestNullModem(t *testing.T) {
+	n, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := openDevice(t, n.A)
+	b := openDevice(t, n.B)
+
+	// Every byte value, including line endings and control characters, goes through unchanged.
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	transfer(t, a, b, all)
+	transfer(t, b, a, []byte("\r\nhello\x03\x04\x7f\r"))
+
+	if err := n.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
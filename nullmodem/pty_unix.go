@@ -0,0 +1,47 @@
+//go:build !windows
+
+package nullmodem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// pollable returns f as a file served by the runtime poller, so that closing it ends reads in
+// progress, closing f. pty.Open leaves the master blocking, which closing can not interrupt.
+func pollable(f *os.File) (*os.File, error) {
+	fd, err := unix.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, errors.Join(err, unix.Close(fd), f.Close())
+	}
+	file := os.NewFile(uintptr(fd), f.Name())
+	if err := f.Close(); err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+	return file, nil
+}
+
+// openEnd opens a pseudo terminal, in raw mode, so data goes through it unchanged, even to
+// programs which do not set it themselves.
+func openEnd() (*End, error) {
+	ptm, pts, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pseudo terminal: %w", err)
+	}
+	if ptm, err = pollable(ptm); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open pseudo terminal: %w", err), pts.Close())
+	}
+	end := &End{ptm: ptm, pts: pts}
+	if _, err := term.MakeRaw(int(pts.Fd())); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to set raw mode: %w", err), end.close())
+	}
+	return end, nil
+}
@@ -0,0 +1,9 @@
+package nullmodem
+
+import "errors"
+
+// openEnd fails, as Windows has no pseudo terminals which programs can open as serial ports: use a
+// virtual serial port driver, such as com0com, instead.
+func openEnd() (*End, error) {
+	return nil, errors.New("null modem is not supported on Windows, use a virtual serial port driver such as com0com instead")
+}
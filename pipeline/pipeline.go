@@ -0,0 +1,84 @@
+// Package pipeline chains transforms of the data flowing through a session, in each direction
+// between the client and the serial port, such as line ending translation, pacing, captures or
+// hex dumps. Transforms are middleware wrapping writers.
+package pipeline
+
+import (
+	"fmt"
+	"io"
+)
+
+// Direction is a direction data flows in.
+type Direction int
+
+const (
+	// From the client to the serial port.
+	ToPort Direction = iota
+	// From the serial port to the client.
+	ToClient
+)
+
+func (d Direction) String() string {
+	switch d {
+	case ToPort:
+		return "to-port"
+	case ToClient:
+		return "to-client"
+	default:
+		return fmt.Sprintf("Direction(%d)", int(d))
+	}
+}
+
+// Middleware transforms data: it wraps next, the writer data goes to after it, returning the
+// writer data is written to.
+type Middleware func(next io.Writer) io.Writer
+
+// Tee returns Middleware copying data to w, before passing it on unchanged, such as to capture or
+// trace it. Errors writing to w fail the write.
+func Tee(w io.Writer) Middleware {
+	return func(next io.Writer) io.Writer {
+		return &teeWriter{tee: w, next: next}
+	}
+}
+
+type teeWriter struct {
+	tee, next io.Writer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if _, err := t.tee.Write(p); err != nil {
+		return 0, err
+	}
+	return t.next.Write(p)
+}
+
+// Chain is middleware applied in order: data goes through the first one first.
+type Chain []Middleware
+
+// Writer returns w behind the chain.
+func (c Chain) Writer(w io.Writer) io.Writer {
+	for i := len(c) - 1; i >= 0; i-- {
+		w = c[i](w)
+	}
+	return w
+}
+
+// Pipeline holds the chain of each direction. The zero value is an empty pipeline.
+type Pipeline struct {
+	chains [2]Chain
+}
+
+// Use appends middleware to the chain of direction, after the middleware already used.
+func (p *Pipeline) Use(direction Direction, middleware ...Middleware) {
+	p.chains[direction] = append(p.chains[direction], middleware...)
+}
+
+// Chain returns a copy of the chain of direction.
+func (p *Pipeline) Chain(direction Direction) Chain {
+	return append(Chain(nil), p.chains[direction]...)
+}
+
+// Writer returns w behind the chain of direction.
+func (p *Pipeline) Writer(direction Direction, w io.Writer) io.Writer {
+	return p.chains[direction].Writer(w)
+}
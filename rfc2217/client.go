@@ -0,0 +1,132 @@
+package rfc2217
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+// ClientConn is the client side of a Telnet connection with Com Port Control Option support.
+// Reading from it returns data from the serial port, while Com Port Control Option responses are
+// discarded. Writes are escaped as required by Telnet.
+type ClientConn struct {
+	conn   io.ReadWriteCloser
+	reader *telnetReader
+
+	writeMu sync.Mutex
+
+	// Only accessed by the reading goroutine, after NewClientConn returns.
+	localOptions  map[byte]bool
+	remoteOptions map[byte]bool
+}
+
+// NewClientConn creates a new ClientConn for conn, negotiating binary transmission and the Com
+// Port Control Option with the server.
+func NewClientConn(conn io.ReadWriteCloser) (*ClientConn, error) {
+	c := &ClientConn{
+		conn:          conn,
+		localOptions:  map[byte]bool{optBinary: true, optSuppressGoAhead: true, optComPort: true},
+		remoteOptions: map[byte]bool{optBinary: true, optSuppressGoAhead: true},
+	}
+	c.reader = newTelnetReader(conn)
+	c.reader.onNegotiation = c.negotiate
+	c.reader.onSubnegotiation = func([]byte) error { return nil }
+	err := c.writeRaw([]byte{
+		iac, will, optBinary,
+		iac, do, optBinary,
+		iac, will, optSuppressGoAhead,
+		iac, do, optSuppressGoAhead,
+		iac, will, optComPort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *ClientConn) negotiate(verb, opt byte) error {
+	switch verb {
+	case will:
+		if opt != optBinary && opt != optSuppressGoAhead {
+			return c.writeRaw([]byte{iac, dont, opt})
+		}
+		if !c.remoteOptions[opt] {
+			c.remoteOptions[opt] = true
+			return c.writeRaw([]byte{iac, do, opt})
+		}
+	case wont:
+		if c.remoteOptions[opt] {
+			c.remoteOptions[opt] = false
+			return c.writeRaw([]byte{iac, dont, opt})
+		}
+	case do:
+		if opt != optBinary && opt != optSuppressGoAhead && opt != optComPort {
+			return c.writeRaw([]byte{iac, wont, opt})
+		}
+		if !c.localOptions[opt] {
+			c.localOptions[opt] = true
+			return c.writeRaw([]byte{iac, will, opt})
+		}
+	case dont:
+		if c.localOptions[opt] {
+			c.localOptions[opt] = false
+			return c.writeRaw([]byte{iac, wont, opt})
+		}
+	}
+	return nil
+}
+
+// Read reads data from the serial port, handling any Telnet commands in between.
+func (c *ClientConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *ClientConn) writeRaw(p []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(p)
+	return err
+}
+
+// Write sends data to the serial port.
+func (c *ClientConn) Write(p []byte) (int, error) {
+	if err := c.writeRaw(escape(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying connection.
+func (c *ClientConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *ClientConn) setControl(value byte) error {
+	return c.writeRaw(subnegotiation(cmdSetControl, []byte{value}))
+}
+
+// SetBaudRate sets the serial port baud rate.
+func (c *ClientConn) SetBaudRate(baudRate int) error {
+	return c.writeRaw(subnegotiation(cmdSetBaudRate, encodeMode(serial.Mode{BaudRate: baudRate}, cmdSetBaudRate)))
+}
+
+// SetDTR sets the serial port DTR line.
+func (c *ClientConn) SetDTR(dtr bool) error {
+	return c.setControl(boolControl(dtr, controlDTROn, controlDTROff))
+}
+
+// SetRTS sets the serial port RTS line.
+func (c *ClientConn) SetRTS(rts bool) error {
+	return c.setControl(boolControl(rts, controlRTSOn, controlRTSOff))
+}
+
+// Break sends a break for duration.
+func (c *ClientConn) Break(duration time.Duration) error {
+	if err := c.setControl(controlBreakOn); err != nil {
+		return err
+	}
+	time.Sleep(duration)
+	return c.setControl(controlBreakOff)
+}
@@ -0,0 +1,146 @@
+// Package rfc2217 implements the Telnet Com Port Control Option (RFC 2217), which allows a client
+// to change serial port settings (baud rate, data bits, parity, stop bits) and control lines
+// (break, DTR, RTS) over the same connection used for data.
+package rfc2217
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+// Telnet commands.
+const (
+	iac  byte = 255
+	dont byte = 254
+	do   byte = 253
+	wont byte = 252
+	will byte = 251
+	sb   byte = 250
+	se   byte = 240
+)
+
+// Telnet options.
+const (
+	optBinary          byte = 0
+	optSuppressGoAhead byte = 3
+	optComPort         byte = 44
+)
+
+// Com Port Control Option commands, as sent by the client. Server responses use the same value
+// plus serverOffset.
+const (
+	cmdSignature byte = iota
+	cmdSetBaudRate
+	cmdSetDataSize
+	cmdSetParity
+	cmdSetStopSize
+	cmdSetControl
+	cmdNotifyLineState
+	cmdNotifyModemState
+	cmdFlowControlSuspend
+	cmdFlowControlResume
+	cmdSetLineStateMask
+	cmdSetModemStateMask
+	cmdPurgeData
+)
+
+const serverOffset byte = 100
+
+// SET-CONTROL values.
+const (
+	controlRequestFlow        byte = 0
+	controlNoFlow             byte = 1
+	controlRequestBreak       byte = 4
+	controlBreakOn            byte = 5
+	controlBreakOff           byte = 6
+	controlRequestDTR         byte = 7
+	controlDTROn              byte = 8
+	controlDTROff             byte = 9
+	controlRequestRTS         byte = 10
+	controlRTSOn              byte = 11
+	controlRTSOff             byte = 12
+	controlRequestInboundFlow byte = 13
+	controlInboundNoFlow      byte = 14
+)
+
+// PURGE-DATA values.
+const (
+	purgeReceive  byte = 1
+	purgeTransmit byte = 2
+	purgeBoth     byte = 3
+)
+
+// NOTIFY-MODEMSTATE bits.
+const (
+	modemStateDeltaCTS byte = 1 << iota
+	modemStateDeltaDSR
+	modemStateTrailingEdgeRI
+	modemStateDeltaDCD
+	modemStateCTS
+	modemStateDSR
+	modemStateRI
+	modemStateDCD
+)
+
+// Maximum accepted subnegotiation length, longer ones are truncated.
+const maxSubnegotiationLen = 64
+
+var parityToWire = map[serial.Parity]byte{
+	serial.NoParity:    1,
+	serial.OddParity:   2,
+	serial.EvenParity:  3,
+	serial.MarkParity:  4,
+	serial.SpaceParity: 5,
+}
+
+var stopBitsToWire = map[serial.StopBits]byte{
+	serial.OneStopBit:           1,
+	serial.TwoStopBits:          2,
+	serial.OnePointFiveStopBits: 3,
+}
+
+// Port is the subset of serial port operations driven by Com Port Control Option commands. It is
+// satisfied by serial.Port.
+type Port interface {
+	SetMode(mode *serial.Mode) error
+	SetDTR(dtr bool) error
+	SetRTS(rts bool) error
+	Break(time.Duration) error
+	ResetInputBuffer() error
+	ResetOutputBuffer() error
+}
+
+// BreakSetter is implemented by ports able to hold a break until told to end it, which BREAK-ON
+// and BREAK-OFF then start and end. Other ports send a break of DefaultBreak on BREAK-ON.
+type BreakSetter interface {
+	// SetBreak starts or ends a break, failing with ErrBreakUnsupported when the port can not hold
+	// one.
+	SetBreak(on bool) error
+}
+
+// ErrBreakUnsupported is returned by SetBreak of ports which can only send breaks of a duration.
+var ErrBreakUnsupported = errors.New("break can not be held")
+
+// DefaultBreak is the duration of breaks sent on BREAK-ON to ports which can not hold a break.
+const DefaultBreak = 250 * time.Millisecond
+
+// escape doubles all IAC bytes in p, as required for data sent over Telnet.
+func escape(p []byte) []byte {
+	escaped := make([]byte, 0, len(p))
+	for _, b := range p {
+		escaped = append(escaped, b)
+		if b == iac {
+			escaped = append(escaped, iac)
+		}
+	}
+	return escaped
+}
+
+// subnegotiation returns the encoded Com Port Control Option subnegotiation for cmd and value.
+func subnegotiation(cmd byte, value []byte) []byte {
+	msg := []byte{iac, sb, optComPort, cmd}
+	msg = append(msg, escape(value)...)
+	return append(msg, iac, se)
+}
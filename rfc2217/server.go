@@ -0,0 +1,452 @@
+package rfc2217
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fornellas/slogxt/log"
+	"github.com/kotaira/go-serial"
+)
+
+// Signature sent to clients requesting the server signature.
+var Signature = "serialtcp"
+
+// How long a modem state notification may take to be written, before the client is given up on.
+const notifyTimeout = 5 * time.Second
+
+// ServerConn is the server side of a Telnet connection with Com Port Control Option support.
+// Reading from it returns data sent by the client, while Com Port Control Option commands are
+// applied to the serial port. Writes are escaped as required by Telnet.
+type ServerConn struct {
+	ctx    context.Context
+	conn   io.ReadWriteCloser
+	port   Port
+	reader *telnetReader
+
+	localOptions  map[byte]bool
+	remoteOptions map[byte]bool
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	mode      serial.Mode
+	dtr       bool
+	rts       bool
+	breakOn   bool
+	suspended bool
+	closed    bool
+	// Whether the client agreed to the Com Port Control Option, and so to notifications.
+	comPort bool
+	// Modem state changes the client is notified of.
+	modemStateMask byte
+}
+
+// NewServerConn creates a new ServerConn for conn, which controls port. mode must be the mode port
+// is currently set to.
+func NewServerConn(ctx context.Context, conn io.ReadWriteCloser, port Port, mode serial.Mode) *ServerConn {
+	c := &ServerConn{
+		ctx:           ctx,
+		conn:          conn,
+		port:          port,
+		localOptions:  map[byte]bool{},
+		remoteOptions: map[byte]bool{},
+		mode:          mode,
+		dtr:           true,
+		rts:           true,
+		// Default mask, as defined by RFC 2217.
+		modemStateMask: 0xff,
+	}
+	if mode.InitialStatusBits != nil {
+		c.dtr = mode.InitialStatusBits.DTR
+		c.rts = mode.InitialStatusBits.RTS
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.reader = newTelnetReader(conn)
+	c.reader.onNegotiation = c.negotiate
+	c.reader.onSubnegotiation = c.subnegotiate
+	return c
+}
+
+// Read reads data sent by the client, handling any Telnet commands in between.
+func (c *ServerConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *ServerConn) writeRaw(p []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(p)
+	return err
+}
+
+// writeRawTimeout is writeRaw, failing when the write takes longer than timeout, if the connection
+// supports write deadlines.
+func (c *ServerConn) writeRawTimeout(p []byte, timeout time.Duration) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if conn, ok := c.conn.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err == nil {
+			defer func() { _ = conn.SetWriteDeadline(time.Time{}) }()
+		}
+	}
+	_, err := c.conn.Write(p)
+	return err
+}
+
+// Write sends data to the client. It blocks while the client has requested flow control
+// suspension.
+func (c *ServerConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	for c.suspended && !c.closed {
+		c.cond.Wait()
+	}
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if err := c.writeRaw(escape(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying connection, unblocking any pending Write.
+func (c *ServerConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return c.conn.Close()
+}
+
+// modemState returns the NOTIFY-MODEMSTATE value for status, with deltas from previous, if known.
+func modemState(status, previous *serial.ModemStatusBits) byte {
+	var state byte
+	for _, line := range []struct {
+		on, was     bool
+		bit, change byte
+	}{
+		{status.CTS, previous != nil && previous.CTS, modemStateCTS, modemStateDeltaCTS},
+		{status.DSR, previous != nil && previous.DSR, modemStateDSR, modemStateDeltaDSR},
+		{status.RI, previous != nil && previous.RI, modemStateRI, 0},
+		{status.DCD, previous != nil && previous.DCD, modemStateDCD, modemStateDeltaDCD},
+	} {
+		if line.on {
+			state |= line.bit
+		}
+		if previous != nil && line.on != line.was {
+			state |= line.change
+		}
+	}
+	if previous != nil && previous.RI && !status.RI {
+		state |= modemStateTrailingEdgeRI
+	}
+	return state
+}
+
+// NotifyModemState notifies the client of the modem status lines, which changed from previous, if
+// known, as allowed by the modem state mask it set.
+func (c *ServerConn) NotifyModemState(status, previous *serial.ModemStatusBits) error {
+	c.mu.Lock()
+	enabled := c.comPort && !c.closed
+	mask := c.modemStateMask
+	c.mu.Unlock()
+	if !enabled {
+		return nil
+	}
+	state := modemState(status, previous) & mask
+	if state == 0 {
+		return nil
+	}
+	return c.writeRawTimeout(subnegotiation(cmdNotifyModemState+serverOffset, []byte{state}), notifyTimeout)
+}
+
+// Mode returns the current serial port mode.
+func (c *ServerConn) Mode() serial.Mode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mode
+}
+
+// setComPort records whether the client agreed to the Com Port Control Option, when opt is it.
+func (c *ServerConn) setComPort(opt byte, enabled bool) {
+	if opt != optComPort {
+		return
+	}
+	c.mu.Lock()
+	c.comPort = enabled
+	c.mu.Unlock()
+}
+
+func (c *ServerConn) negotiate(verb, opt byte) error {
+	switch verb {
+	case will:
+		if opt != optBinary && opt != optSuppressGoAhead && opt != optComPort {
+			return c.writeRaw([]byte{iac, dont, opt})
+		}
+		if !c.remoteOptions[opt] {
+			c.remoteOptions[opt] = true
+			c.setComPort(opt, true)
+			return c.writeRaw([]byte{iac, do, opt})
+		}
+	case wont:
+		if c.remoteOptions[opt] {
+			c.remoteOptions[opt] = false
+			c.setComPort(opt, false)
+			return c.writeRaw([]byte{iac, dont, opt})
+		}
+	case do:
+		if opt != optBinary && opt != optSuppressGoAhead {
+			return c.writeRaw([]byte{iac, wont, opt})
+		}
+		if !c.localOptions[opt] {
+			c.localOptions[opt] = true
+			return c.writeRaw([]byte{iac, will, opt})
+		}
+	case dont:
+		if c.localOptions[opt] {
+			c.localOptions[opt] = false
+			return c.writeRaw([]byte{iac, wont, opt})
+		}
+	}
+	return nil
+}
+
+func (c *ServerConn) subnegotiate(data []byte) error {
+	if len(data) < 2 || data[0] != optComPort {
+		return nil
+	}
+	cmd, value := data[1], data[2:]
+	response, err := c.command(cmd, value)
+	if err != nil {
+		logger := log.MustLogger(c.ctx)
+		logger.Error("Failed to process RFC 2217 command", "command", cmd, "error", err)
+	}
+	if response == nil {
+		return nil
+	}
+	return c.writeRaw(subnegotiation(cmd+serverOffset, response))
+}
+
+// command processes a Com Port Control Option command, returning the response value, or nil if no
+// response is to be sent.
+func (c *ServerConn) command(cmd byte, value []byte) ([]byte, error) {
+	switch cmd {
+	case cmdSignature:
+		if len(value) > 0 {
+			return nil, nil
+		}
+		return []byte(Signature), nil
+	case cmdSetBaudRate, cmdSetDataSize, cmdSetParity, cmdSetStopSize:
+		return c.setMode(cmd, value)
+	case cmdSetControl:
+		if len(value) != 1 {
+			return nil, fmt.Errorf("invalid SET-CONTROL value length: %d", len(value))
+		}
+		response, err := c.setControl(value[0])
+		return []byte{response}, err
+	case cmdFlowControlSuspend, cmdFlowControlResume:
+		c.mu.Lock()
+		c.suspended = cmd == cmdFlowControlSuspend
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		return []byte{}, nil
+	case cmdSetLineStateMask:
+		return value, nil
+	case cmdSetModemStateMask:
+		if len(value) != 1 {
+			return nil, fmt.Errorf("invalid SET-MODEMSTATE-MASK value length: %d", len(value))
+		}
+		c.mu.Lock()
+		c.modemStateMask = value[0]
+		c.mu.Unlock()
+		return value, nil
+	case cmdPurgeData:
+		if len(value) != 1 {
+			return nil, fmt.Errorf("invalid PURGE-DATA value length: %d", len(value))
+		}
+		return value, c.purge(value[0])
+	default:
+		return nil, nil
+	}
+}
+
+func (c *ServerConn) purge(value byte) error {
+	var err error
+	if value == purgeReceive || value == purgeBoth {
+		err = errors.Join(err, c.port.ResetInputBuffer())
+	}
+	if value == purgeTransmit || value == purgeBoth {
+		err = errors.Join(err, c.port.ResetOutputBuffer())
+	}
+	return err
+}
+
+// updateMode sets the mode field selected by cmd from value, returning whether value requests a
+// change (as opposed to a query).
+func updateMode(mode *serial.Mode, cmd byte, value []byte) (bool, error) {
+	length := 1
+	if cmd == cmdSetBaudRate {
+		length = 4
+	}
+	if len(value) != length {
+		return false, fmt.Errorf("invalid value length for command %d: %d", cmd, len(value))
+	}
+	if binary.BigEndian.Uint32(append(make([]byte, 4-length), value...)) == 0 {
+		return false, nil
+	}
+
+	switch cmd {
+	case cmdSetBaudRate:
+		mode.BaudRate = int(binary.BigEndian.Uint32(value))
+	case cmdSetDataSize:
+		mode.DataBits = int(value[0])
+	case cmdSetParity:
+		for parity, wire := range parityToWire {
+			if wire == value[0] {
+				mode.Parity = parity
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("invalid SET-PARITY value: %d", value[0])
+	case cmdSetStopSize:
+		for stopBits, wire := range stopBitsToWire {
+			if wire == value[0] {
+				mode.StopBits = stopBits
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("invalid SET-STOPSIZE value: %d", value[0])
+	}
+	return true, nil
+}
+
+// encodeMode returns the wire value of the mode field selected by cmd.
+func encodeMode(mode serial.Mode, cmd byte) []byte {
+	switch cmd {
+	case cmdSetBaudRate:
+		return binary.BigEndian.AppendUint32(nil, uint32(mode.BaudRate))
+	case cmdSetDataSize:
+		return []byte{byte(mode.DataBits)}
+	case cmdSetParity:
+		return []byte{parityToWire[mode.Parity]}
+	case cmdSetStopSize:
+		return []byte{stopBitsToWire[mode.StopBits]}
+	default:
+		panic("bug: invalid mode command")
+	}
+}
+
+func (c *ServerConn) setMode(cmd byte, value []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mode := c.mode
+	change, err := updateMode(&mode, cmd, value)
+	if err != nil || !change {
+		return encodeMode(c.mode, cmd), err
+	}
+
+	logger := log.MustLogger(c.ctx)
+	logger.Info(
+		"Changing serial port mode",
+		"baud-rate", mode.BaudRate,
+		"data-bits", mode.DataBits,
+		"parity", mode.Parity,
+		"stop-bits", mode.StopBits,
+	)
+	if err := c.port.SetMode(&mode); err != nil {
+		return encodeMode(c.mode, cmd), fmt.Errorf("failed to set mode: %w", err)
+	}
+	c.mode = mode
+	return encodeMode(c.mode, cmd), nil
+}
+
+// setBreak starts or ends a break, see BreakSetter, without holding c.mu while the port sends it.
+func (c *ServerConn) setBreak(on bool) (byte, error) {
+	c.mu.Lock()
+	if c.breakOn == on {
+		c.mu.Unlock()
+		return boolControl(on, controlBreakOn, controlBreakOff), nil
+	}
+	c.breakOn = on
+	c.mu.Unlock()
+
+	if err := c.sendBreak(on); err != nil {
+		c.mu.Lock()
+		c.breakOn = !on
+		c.mu.Unlock()
+		return boolControl(!on, controlBreakOn, controlBreakOff), fmt.Errorf("failed to send break: %w", err)
+	}
+	return boolControl(on, controlBreakOn, controlBreakOff), nil
+}
+
+// sendBreak starts or ends a break on the port or, for ports which can not hold one, sends a break
+// of DefaultBreak on start, which ends by itself.
+func (c *ServerConn) sendBreak(on bool) error {
+	if setter, ok := c.port.(BreakSetter); ok {
+		if err := setter.SetBreak(on); !errors.Is(err, ErrBreakUnsupported) {
+			return err
+		}
+	}
+	if !on {
+		return nil
+	}
+	return c.port.Break(DefaultBreak)
+}
+
+func boolControl(value bool, on, off byte) byte {
+	if value {
+		return on
+	}
+	return off
+}
+
+func (c *ServerConn) setControl(value byte) (byte, error) {
+	switch value {
+	case controlBreakOn, controlBreakOff:
+		return c.setBreak(value == controlBreakOn)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch value {
+	case controlRequestFlow, controlNoFlow:
+		return controlNoFlow, nil
+	case controlRequestBreak:
+		return boolControl(c.breakOn, controlBreakOn, controlBreakOff), nil
+	case controlRequestDTR:
+		return boolControl(c.dtr, controlDTROn, controlDTROff), nil
+	case controlDTROn, controlDTROff:
+		if err := c.port.SetDTR(value == controlDTROn); err != nil {
+			return boolControl(c.dtr, controlDTROn, controlDTROff), fmt.Errorf("failed to set DTR: %w", err)
+		}
+		c.dtr = value == controlDTROn
+		return value, nil
+	case controlRequestRTS:
+		return boolControl(c.rts, controlRTSOn, controlRTSOff), nil
+	case controlRTSOn, controlRTSOff:
+		if err := c.port.SetRTS(value == controlRTSOn); err != nil {
+			return boolControl(c.rts, controlRTSOn, controlRTSOff), fmt.Errorf("failed to set RTS: %w", err)
+		}
+		c.rts = value == controlRTSOn
+		return value, nil
+	case controlRequestInboundFlow, controlInboundNoFlow:
+		return controlInboundNoFlow, nil
+	default:
+		// Unsupported flow control settings.
+		if value > controlInboundNoFlow {
+			return controlInboundNoFlow, fmt.Errorf("unsupported SET-CONTROL value: %d", value)
+		}
+		return controlNoFlow, fmt.Errorf("unsupported SET-CONTROL value: %d", value)
+	}
+}
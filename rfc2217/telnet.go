@@ -0,0 +1,111 @@
+package rfc2217
+
+import (
+	"bufio"
+	"io"
+)
+
+type parserState int
+
+const (
+	stateData parserState = iota
+	stateIAC
+	stateNegotiation
+	stateSubnegotiation
+	stateSubnegotiationIAC
+)
+
+// telnetReader reads data from a Telnet stream, dispatching option negotiations and
+// subnegotiations to callbacks.
+type telnetReader struct {
+	reader *bufio.Reader
+	state  parserState
+	verb   byte
+	sbBuf  []byte
+	// Called for each received WILL, WONT, DO or DONT.
+	onNegotiation func(verb, opt byte) error
+	// Called for each received subnegotiation, with the unescaped content between IAC SB and
+	// IAC SE.
+	onSubnegotiation func(data []byte) error
+}
+
+func newTelnetReader(r io.Reader) *telnetReader {
+	return &telnetReader{
+		reader: bufio.NewReader(r),
+	}
+}
+
+// parse processes a byte read from the stream, returning it if it is data.
+func (t *telnetReader) parse(b byte) (byte, bool, error) {
+	switch t.state {
+	case stateData:
+		if b == iac {
+			t.state = stateIAC
+			return 0, false, nil
+		}
+		return b, true, nil
+	case stateIAC:
+		t.state = stateData
+		switch b {
+		case iac:
+			return b, true, nil
+		case will, wont, do, dont:
+			t.verb = b
+			t.state = stateNegotiation
+		case sb:
+			t.sbBuf = t.sbBuf[:0]
+			t.state = stateSubnegotiation
+		}
+		return 0, false, nil
+	case stateNegotiation:
+		t.state = stateData
+		return 0, false, t.onNegotiation(t.verb, b)
+	case stateSubnegotiation:
+		if b == iac {
+			t.state = stateSubnegotiationIAC
+		} else if len(t.sbBuf) < maxSubnegotiationLen {
+			t.sbBuf = append(t.sbBuf, b)
+		}
+		return 0, false, nil
+	case stateSubnegotiationIAC:
+		switch b {
+		case se:
+			t.state = stateData
+			return 0, false, t.onSubnegotiation(t.sbBuf)
+		case iac:
+			if len(t.sbBuf) < maxSubnegotiationLen {
+				t.sbBuf = append(t.sbBuf, b)
+			}
+			t.state = stateSubnegotiation
+		default:
+			t.state = stateData
+		}
+		return 0, false, nil
+	default:
+		panic("bug: invalid parser state")
+	}
+}
+
+// Read reads data bytes, processing any Telnet commands in between. It blocks until at least one
+// data byte is available.
+func (t *telnetReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && t.reader.Buffered() == 0 {
+			break
+		}
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		data, ok, err := t.parse(b)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			p[n] = data
+			n++
+		}
+	}
+	return n, nil
+}
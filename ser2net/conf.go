@@ -0,0 +1,106 @@
+package ser2net
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseConf parses ser2net.conf, as used by ser2net before version 4, with lines such as:
+//
+//	BANNER:name:text
+//	2000:telnet:600:/dev/ttyS0:9600 8DATABITS NONE 1STOPBIT name
+func ParseConf(data []byte) ([]Connection, error) {
+	banners := map[string]string{}
+	var connections []Connection
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if banner, ok := strings.CutPrefix(text, "BANNER:"); ok {
+			if name, banner, ok := strings.Cut(banner, ":"); ok {
+				banners[name] = banner
+			}
+			continue
+		}
+		fields := strings.SplitN(text, ":", 5)
+		if !isConfPort(fields[0]) {
+			// Other definitions, such as TRACEFILE: or SIGNATURE:.
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: invalid port line: %s", line, text)
+		}
+		c, err := parseConfLine(fmt.Sprintf("line %d", line), fields, banners)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		connections = append(connections, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+// isConfPort returns whether s is the port field of a port line: a port number, optionally
+// preceded by a host and a comma.
+func isConfPort(s string) bool {
+	_, port, _ := strings.Cut(s, ",")
+	if port == "" {
+		port = s
+	}
+	_, err := strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
+
+// parseConfLine parses the fields of a port line: port, state, timeout, device and options.
+func parseConfLine(name string, fields []string, banners map[string]string) (Connection, error) {
+	c := Connection{Name: name, Enabled: true, Device: fields[3]}
+
+	port := fields[0]
+	if host, p, ok := strings.Cut(port, ","); ok {
+		c.Address = host + ":" + p
+	} else {
+		c.Address = ":" + port
+	}
+
+	switch strings.ToLower(fields[1]) {
+	case "raw":
+	case "telnet":
+		c.Telnet = true
+	case "off":
+		c.Enabled = false
+	default:
+		c.Unsupported = append(c.Unsupported, "state "+fields[1])
+	}
+
+	if timeout := fields[2]; timeout != "0" {
+		c.Unsupported = append(c.Unsupported, "timeout "+timeout)
+	}
+
+	if len(fields) < 5 {
+		return c, nil
+	}
+	for _, option := range strings.Fields(fields[4]) {
+		if c.parseSerialOption(option) {
+			continue
+		}
+		switch {
+		case strings.EqualFold(option, "remctl"):
+			c.RFC2217 = true
+		case strings.EqualFold(option, "LOCAL"):
+		case banners[option] != "":
+			c.Banner = banners[option]
+		default:
+			c.Unsupported = append(c.Unsupported, option)
+		}
+	}
+	return c, nil
+}
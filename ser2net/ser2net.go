@@ -0,0 +1,214 @@
+// Package ser2net reads ser2net configuration files, both the YAML format of ser2net 4
+// (ser2net.yaml) and the line based format of earlier versions (ser2net.conf).
+package ser2net
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Connection is a port definition.
+type Connection struct {
+	// Name of the connection: its YAML anchor or key, or the line number for ser2net.conf.
+	Name    string
+	Enabled bool
+	// Address to listen on, as host:port, where host may be empty.
+	Address string
+	// Whether clients speak Telnet, and whether RFC 2217 serial port control is enabled.
+	Telnet  bool
+	RFC2217 bool
+	// Serial device path.
+	Device string
+	// Serial settings, zero or empty when not given.
+	BaudRate int
+	DataBits int
+	// none, odd, even, mark or space.
+	Parity string
+	// 1 or 2.
+	StopBits string
+	// Banner sent to clients on connect, with ser2net escapes (eg: \r, \n, \d) left as is.
+	Banner string
+	// Settings which have no obvious equivalent, as found in the file.
+	Unsupported []string
+}
+
+// Parse parses a ser2net configuration file, telling the format apart by its name and content.
+func Parse(name string, data []byte) ([]Connection, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	trimmed := bytes.TrimSpace(data)
+	if ext == ".yaml" || ext == ".yml" || bytes.HasPrefix(trimmed, []byte("%YAML")) || bytes.HasPrefix(trimmed, []byte("---")) {
+		return ParseYAML(data)
+	}
+	return ParseConf(data)
+}
+
+var parityNames = map[byte]string{
+	'n': "none",
+	'o': "odd",
+	'e': "even",
+	'm': "mark",
+	's': "space",
+}
+
+// serialSpec matches compact serial settings, such as 9600n81.
+var serialSpec = regexp.MustCompile(`^(\d+)([nNoOeEmMsS])([5-8])([12])$`)
+
+// parseSerialSpec sets serial settings from a compact spec, such as 9600n81, returning false when
+// s is not one.
+func (c *Connection) parseSerialSpec(s string) bool {
+	match := serialSpec.FindStringSubmatch(s)
+	if match == nil {
+		return false
+	}
+	c.BaudRate, _ = strconv.Atoi(match[1])
+	c.Parity = parityNames[strings.ToLower(match[2])[0]]
+	c.DataBits, _ = strconv.Atoi(match[3])
+	c.StopBits = match[4]
+	return true
+}
+
+// parseSerialOption sets a serial setting from a single option, as used in ser2net.conf and
+// accepted by ser2net 4 as well, such as 9600, 8DATABITS, EVEN or 1STOPBIT. It returns false for
+// unknown options.
+func (c *Connection) parseSerialOption(option string) bool {
+	if c.parseSerialSpec(option) {
+		return true
+	}
+	upper := strings.ToUpper(option)
+	if baudRate, err := strconv.Atoi(option); err == nil {
+		c.BaudRate = baudRate
+		return true
+	}
+	switch upper {
+	case "NONE", "ODD", "EVEN", "MARK", "SPACE":
+		c.Parity = strings.ToLower(upper)
+		return true
+	case "1STOPBIT":
+		c.StopBits = "1"
+		return true
+	case "2STOPBITS":
+		c.StopBits = "2"
+		return true
+	}
+	if bits, ok := strings.CutSuffix(upper, "DATABITS"); ok {
+		if dataBits, err := strconv.Atoi(bits); err == nil {
+			c.DataBits = dataBits
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated gensio string, trimming whitespace, which YAML folding of
+// multi-line values leaves behind.
+func splitList(s string) []string {
+	var fields []string
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// parseAccepter parses a gensio accepter, such as telnet(rfc2217),tcp,0.0.0.0,2000.
+func (c *Connection) parseAccepter(accepter string) error {
+	fields := splitList(accepter)
+	for len(fields) > 0 {
+		field := fields[0]
+		name, options, _ := strings.Cut(strings.TrimSuffix(field, ")"), "(")
+		switch strings.ToLower(name) {
+		case "telnet":
+			c.Telnet = true
+			for _, option := range strings.Split(options, ",") {
+				if option == "rfc2217" || option == "rfc2217=true" {
+					c.RFC2217 = true
+				}
+			}
+		case "tcp", "ipv4", "ipv6":
+		default:
+			return fmt.Errorf("unsupported accepter: %s", accepter)
+		}
+		fields = fields[1:]
+		if strings.EqualFold(name, "tcp") {
+			break
+		}
+	}
+	switch len(fields) {
+	case 1:
+		c.Address = ":" + fields[0]
+	case 2:
+		c.Address = fields[0] + ":" + fields[1]
+	default:
+		return fmt.Errorf("unsupported accepter: %s", accepter)
+	}
+	if _, err := strconv.ParseUint(fields[len(fields)-1], 10, 16); err != nil {
+		return fmt.Errorf("invalid accepter port: %s", accepter)
+	}
+	return nil
+}
+
+// parseConnector parses a gensio connector, such as serialdev,/dev/ttyS0,9600n81,local.
+func (c *Connection) parseConnector(connector string) error {
+	fields := splitList(connector)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "serialdev") {
+		return fmt.Errorf("unsupported connector: %s", connector)
+	}
+	c.Device = fields[1]
+	for _, option := range fields[2:] {
+		// Modem control lines are not monitored, as ser2net does with local.
+		if strings.EqualFold(option, "local") {
+			continue
+		}
+		if !c.parseSerialOption(option) {
+			c.Unsupported = append(c.Unsupported, option)
+		}
+	}
+	return nil
+}
+
+var bannerEscapes = map[byte]string{
+	'a':  "\a",
+	'b':  "\b",
+	'f':  "\f",
+	'n':  "\n",
+	'r':  "\r",
+	't':  "\t",
+	'v':  "\v",
+	'\\': "\\",
+	'?':  "?",
+	'\'': "'",
+	'"':  "\"",
+}
+
+// ExpandBanner returns the banner with ser2net escapes expanded, and escapes which can not be
+// expanded statically, such as the date (\D) or the serial port settings (\s), which are removed.
+func (c *Connection) ExpandBanner() (string, []string) {
+	var b strings.Builder
+	var unsupported []string
+	for i := 0; i < len(c.Banner); i++ {
+		if c.Banner[i] != '\\' || i+1 == len(c.Banner) {
+			b.WriteByte(c.Banner[i])
+			continue
+		}
+		i++
+		escape := c.Banner[i]
+		switch {
+		case bannerEscapes[escape] != "":
+			b.WriteString(bannerEscapes[escape])
+		case escape == 'd':
+			b.WriteString(c.Device)
+		case escape == 'N':
+			b.WriteString(c.Name)
+		case escape == 'p':
+			b.WriteString(c.Address[strings.LastIndex(c.Address, ":")+1:])
+		default:
+			unsupported = append(unsupported, `\`+string(escape))
+		}
+	}
+	return b.String(), unsupported
+}
@@ -0,0 +1,105 @@
+package ser2net
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// resolve follows YAML aliases, such as *banner.
+func resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// parseEnable parses the enable setting, which is on or off.
+func parseEnable(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "yes", "1":
+		return true, nil
+	case "off", "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid enable value: %s", value)
+}
+
+// parseYAMLConnection parses the mapping of a connection.
+func parseYAMLConnection(name string, node *yaml.Node) (Connection, error) {
+	c := Connection{Name: name, Enabled: true}
+	if node.Kind != yaml.MappingNode {
+		return c, fmt.Errorf("connection %s: not a mapping", name)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		value := resolve(node.Content[i+1])
+		var err error
+		switch key {
+		case "accepter":
+			err = c.parseAccepter(value.Value)
+		case "connector":
+			err = c.parseConnector(value.Value)
+		case "enable":
+			c.Enabled, err = parseEnable(value.Value)
+		case "options":
+			c.parseYAMLOptions(value)
+		default:
+			c.Unsupported = append(c.Unsupported, key+": "+value.Value)
+		}
+		if err != nil {
+			return c, fmt.Errorf("connection %s: %w", name, err)
+		}
+	}
+	if c.Address == "" || c.Device == "" {
+		return c, fmt.Errorf("connection %s: missing accepter or connector", name)
+	}
+	return c, nil
+}
+
+func (c *Connection) parseYAMLOptions(node *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		value := resolve(node.Content[i+1])
+		if key == "banner" {
+			c.Banner = value.Value
+			continue
+		}
+		c.Unsupported = append(c.Unsupported, key+": "+value.Value)
+	}
+}
+
+// ParseYAML parses ser2net.yaml, as used by ser2net 4. Repeated connection keys, which ser2net
+// accepts, are supported.
+func ParseYAML(data []byte) ([]Connection, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if len(document.Content) == 0 {
+		return nil, errors.New("empty configuration")
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("configuration is not a mapping")
+	}
+	var connections []Connection
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "connection" {
+			continue
+		}
+		node := root.Content[i+1]
+		name := node.Anchor
+		if name == "" {
+			name = fmt.Sprintf("line %d", node.Line)
+		}
+		connection, err := parseYAMLConnection(name, resolve(node))
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, connection)
+	}
+	return connections, nil
+}
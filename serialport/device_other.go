@@ -0,0 +1,20 @@
+//go:build !windows
+
+package serialport
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// NormalizeName returns name as it is, as only Windows has COM port names.
+func NormalizeName(name string) string {
+	return name
+}
+
+// isDeviceGone tells whether err is how reads and writes fail once the device is removed: ENXIO
+// on macOS and BSD, ENODEV, or EIO, as Linux ttys fail once hung up.
+func isDeviceGone(err error) bool {
+	return errors.Is(err, unix.ENODEV) || errors.Is(err, unix.ENXIO) || errors.Is(err, unix.EIO)
+}
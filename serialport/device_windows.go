@@ -0,0 +1,27 @@
+package serialport
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// comName matches COM port names as users give them: COM3, com10, COM10: or \\.\COM10.
+var comName = regexp.MustCompile(`(?i)^(?:\\\\\.\\)?(com[0-9]+):?$`)
+
+// NormalizeName returns COM port names in the device namespace, as \\.\COM10, which COM10 and
+// above only open with, and other names as they are.
+func NormalizeName(name string) string {
+	match := comName.FindStringSubmatch(name)
+	if match == nil {
+		return name
+	}
+	return `\\.\` + strings.ToUpper(match[1])
+}
+
+// isDeviceGone tells whether err is how reads and writes fail once a USB adapter is unplugged.
+func isDeviceGone(err error) bool {
+	return errors.Is(err, windows.ERROR_GEN_FAILURE) || errors.Is(err, windows.ERROR_DEVICE_REMOVED)
+}
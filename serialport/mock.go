@@ -0,0 +1,191 @@
+package serialport
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+func init() {
+	Register("mock", func(name string, mode *serial.Mode) (Port, error) {
+		if name != "loopback" {
+			return nil, fmt.Errorf("unknown mock serial port: %s", name)
+		}
+		return NewMock(mode), nil
+	})
+}
+
+// Mock is an in-memory serial port, for tests and development without hardware. What is written to
+// it is looped back, as with a loopback plug (TX jumped to RX), and its settings and control lines
+// are recorded, to be inspected. It is opened by name as mock:loopback.
+type Mock struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	buf         []byte
+	closed      bool
+	mode        serial.Mode
+	dtr, rts    bool
+	breaks      int
+	status      serial.ModemStatusBits
+	readTimeout time.Duration
+}
+
+// NewMock returns a new Mock set to mode.
+func NewMock(mode *serial.Mode) *Mock {
+	m := &Mock{mode: *mode, readTimeout: serial.NoTimeout}
+	if mode.InitialStatusBits != nil {
+		m.dtr = mode.InitialStatusBits.DTR
+		m.rts = mode.InitialStatusBits.RTS
+	}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// Receive makes p available to Read, as if received from the line.
+func (m *Mock) Receive(p []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buf = append(m.buf, p...)
+	m.cond.Broadcast()
+}
+
+func (m *Mock) Read(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deadline time.Time
+	if m.readTimeout != serial.NoTimeout {
+		deadline = time.Now().Add(m.readTimeout)
+		// sync.Cond has no timed wait.
+		timer := time.AfterFunc(m.readTimeout, func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.cond.Broadcast()
+		})
+		defer timer.Stop()
+	}
+	for len(m.buf) == 0 && !m.closed {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, nil
+		}
+		m.cond.Wait()
+	}
+	if m.closed {
+		// Closed by Close.
+		return 0, io.EOF
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+func (m *Mock) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, os.ErrClosed
+	}
+	m.buf = append(m.buf, p...)
+	m.cond.Broadcast()
+	return len(p), nil
+}
+
+func (m *Mock) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.cond.Broadcast()
+	return nil
+}
+
+func (m *Mock) SetMode(mode *serial.Mode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mode = *mode
+	return nil
+}
+
+// Mode returns the mode last set.
+func (m *Mock) Mode() serial.Mode {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mode
+}
+
+func (m *Mock) Drain() error { return nil }
+
+func (m *Mock) ResetInputBuffer() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buf = nil
+	return nil
+}
+
+func (m *Mock) ResetOutputBuffer() error { return nil }
+
+func (m *Mock) SetDTR(dtr bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dtr = dtr
+	return nil
+}
+
+// DTR returns the state of the DTR line.
+func (m *Mock) DTR() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dtr
+}
+
+func (m *Mock) SetRTS(rts bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rts = rts
+	return nil
+}
+
+// RTS returns the state of the RTS line.
+func (m *Mock) RTS() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rts
+}
+
+// SetModemStatusBits sets the state of the lines returned by GetModemStatusBits.
+func (m *Mock) SetModemStatusBits(status serial.ModemStatusBits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = status
+}
+
+func (m *Mock) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := m.status
+	return &status, nil
+}
+
+func (m *Mock) SetReadTimeout(t time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readTimeout = t
+	return nil
+}
+
+func (m *Mock) Break(duration time.Duration) error {
+	m.mu.Lock()
+	m.breaks++
+	m.mu.Unlock()
+	time.Sleep(duration)
+	return nil
+}
+
+// Breaks returns how many breaks were sent.
+func (m *Mock) Breaks() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.breaks
+}
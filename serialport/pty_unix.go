@@ -0,0 +1,44 @@
+//go:build !windows
+
+package serialport
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kotaira/go-serial"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	Register("pty", openPTY)
+}
+
+// openWithoutModemControl opens ports without modem control lines, such as pseudo terminals,
+// returning false for other ports.
+func openWithoutModemControl(name string, mode *serial.Mode) (Port, bool) {
+	if mode.InitialStatusBits == nil {
+		return nil, false
+	}
+	port, err := openPTY(name, mode)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := port.GetModemStatusBits(); !errors.Is(err, unix.ENOTTY) {
+		port.Close()
+		return nil, false
+	}
+	return port, true
+}
+
+// openPTY opens the pseudo terminal name, such as pts/3, relative to /dev like serial ports.
+// Pseudo terminals have no modem control lines, so mode.InitialStatusBits is ignored.
+func openPTY(name string, mode *serial.Mode) (Port, error) {
+	noModemControl := *mode
+	noModemControl.InitialStatusBits = nil
+	port, err := openTTY(name, &noModemControl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pseudo terminal: %w", err)
+	}
+	return port, nil
+}
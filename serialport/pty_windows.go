@@ -0,0 +1,9 @@
+package serialport
+
+import "github.com/kotaira/go-serial"
+
+// openWithoutModemControl returns false, as Windows has no pseudo terminals, and all of its serial
+// ports have modem control lines.
+func openWithoutModemControl(name string, mode *serial.Mode) (Port, bool) {
+	return nil, false
+}
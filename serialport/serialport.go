@@ -0,0 +1,112 @@
+// Package serialport abstracts serial ports, so that the server works with other backends than
+// local serial ports: pseudo terminals, an in-memory mock for tests, or exotic transports such as
+// USB CDC via a user space USB library, plugged in with Register.
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kotaira/go-serial"
+)
+
+// Port is a serial port. It has the same methods as serial.Port, so ports opened with go-serial
+// satisfy it.
+type Port interface {
+	io.ReadWriteCloser
+	// SetMode sets the baud rate, data bits, parity and stop bits.
+	SetMode(mode *serial.Mode) error
+	// Drain waits until all data written is transmitted.
+	Drain() error
+	// ResetInputBuffer discards data received and not read yet.
+	ResetInputBuffer() error
+	// ResetOutputBuffer discards data written and not transmitted yet.
+	ResetOutputBuffer() error
+	// SetDTR sets the DTR (Data Terminal Ready) line.
+	SetDTR(dtr bool) error
+	// SetRTS sets the RTS (Request To Send) line.
+	SetRTS(rts bool) error
+	// GetModemStatusBits returns the state of the CTS, DSR, RI and DCD lines.
+	GetModemStatusBits() (*serial.ModemStatusBits, error)
+	// SetReadTimeout sets how long Read waits for data, returning 0 bytes when it times out.
+	SetReadTimeout(t time.Duration) error
+	// Break sends a break for duration.
+	Break(duration time.Duration) error
+}
+
+// BreakSetter is implemented by ports able to hold a break until told to end it, such as local
+// serial ports and pseudo terminals, other than on Windows.
+type BreakSetter interface {
+	// SetBreak starts or ends a break.
+	SetBreak(on bool) error
+}
+
+// Descriptor is implemented by ports with a file descriptor to the device, such as local serial
+// ports and pseudo terminals, other than on Windows, for ioctls Port does not cover.
+type Descriptor interface {
+	// Fd returns the file descriptor, valid until the port is closed.
+	Fd() uintptr
+}
+
+// ErrDeviceGone is wrapped by errors of ports whose device went away, such as an unplugged USB
+// adapter, see DeviceGone.
+var ErrDeviceGone = errors.New("serial port device removed")
+
+// DeviceGone returns err wrapped with ErrDeviceGone if it is how the local serial port failed as
+// its device went away, or err as it is otherwise.
+func DeviceGone(err error) error {
+	if err == nil || !isDeviceGone(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrDeviceGone, err)
+}
+
+// Opener opens the port name, set to mode.
+type Opener func(name string, mode *serial.Mode) (Port, error)
+
+var (
+	openersMu sync.Mutex
+	openers   = map[string]Opener{}
+)
+
+// Register makes a backend available by name, to open ports named scheme:name with opener.
+func Register(scheme string, opener Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	if _, ok := openers[scheme]; ok {
+		panic(fmt.Sprintf("bug: serial port backend registered twice: %s", scheme))
+	}
+	openers[scheme] = opener
+}
+
+// Open opens the port name, set to mode. Names prefixed by a registered scheme, such as
+// mock:loopback, are opened by its backend, and other names are local serial ports, see
+// NormalizeName.
+func Open(name string, mode *serial.Mode) (Port, error) {
+	if scheme, rest, ok := strings.Cut(name, ":"); ok {
+		openersMu.Lock()
+		opener, ok := openers[scheme]
+		openersMu.Unlock()
+		if ok {
+			return opener(rest, mode)
+		}
+	}
+	return openSerial(NormalizeName(name), mode)
+}
+
+// openSerial opens the local serial port name, falling back to opening it as a
+// pseudo terminal, which go-serial fails to open when setting their initial DTR and RTS.
+func openSerial(name string, mode *serial.Mode) (Port, error) {
+	port, err := openTTY(name, mode)
+	if err != nil {
+		if port, ok := openWithoutModemControl(name, mode); ok {
+			return port, nil
+		}
+		return nil, err
+	}
+	return port, nil
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/kotaira/go-serial"
+	"golang.org/x/sys/unix"
+)
+
+// ttyPort is a serial port, or pseudo terminal, opened with go-serial, with a descriptor of its own
+// to the device, for the ioctls go-serial does not expose.
+type ttyPort struct {
+	serial.Port
+	control int
+	closed  atomic.Bool
+}
+
+// openTTY opens the device name, relative to /dev as go-serial does, with go-serial. The control
+// descriptor is opened first, as go-serial sets TIOCEXCL, which fails further opens.
+func openTTY(name string, mode *serial.Mode) (Port, error) {
+	control, controlErr := unix.Open(filepath.Join("/dev", name), unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	port, err := serial.Open(name, mode)
+	if err != nil {
+		if controlErr == nil {
+			unix.Close(control)
+		}
+		return nil, err
+	}
+	if controlErr != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open %s: %w", name, controlErr), port.Close())
+	}
+	return &ttyPort{Port: port, control: control}, nil
+}
+
+// SetBreak starts or ends a break with TIOCSBRK and TIOCCBRK.
+func (p *ttyPort) SetBreak(on bool) error {
+	request := uint(unix.TIOCCBRK)
+	if on {
+		request = unix.TIOCSBRK
+	}
+	return unix.IoctlSetInt(p.control, request, 0)
+}
+
+// Read reads as go-serial does, other than failing with EIO, as writes do, once the device hangs
+// up, such as when unplugged: Linux leaves it readable with nothing to read, which go-serial takes
+// as the port being closed.
+func (p *ttyPort) Read(b []byte) (int, error) {
+	n, err := p.Port.Read(b)
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) && portErr.Code() == serial.PortClosed && !p.closed.Load() {
+		return n, fmt.Errorf("%w: %w", err, unix.EIO)
+	}
+	return n, err
+}
+
+func (p *ttyPort) Fd() uintptr {
+	return uintptr(p.control)
+}
+
+func (p *ttyPort) Close() error {
+	p.closed.Store(true)
+	return errors.Join(p.Port.Close(), unix.Close(p.control))
+}
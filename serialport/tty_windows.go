@@ -0,0 +1,9 @@
+package serialport
+
+import "github.com/kotaira/go-serial"
+
+// openTTY opens the serial port name with go-serial. Breaks are only sent for a duration, as
+// go-serial does not expose the handle SetCommBreak needs.
+func openTTY(name string, mode *serial.Mode) (Port, error) {
+	return serial.Open(name, mode)
+}
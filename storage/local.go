@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files in a local directory.
+type Local string
+
+// Create creates a new file, only readable by the current user, failing if it already exists.
+func (l Local) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return os.OpenFile(filepath.Join(string(l), name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+}
+
+func (l Local) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(l), name))
+}
+
+func (l Local) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(string(l))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasPrefix(entry.Name(), prefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (l Local) String() string {
+	return string(l)
+}
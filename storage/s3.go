@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const s3Scheme = "s3://"
+
+// S3Config configures access to S3 compatible storage.
+type S3Config struct {
+	// Endpoint URL, such as https://minio.example.com:9000, for S3 compatible services. When
+	// empty, AWS S3 at Region is used.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Session token, for temporary credentials.
+	SessionToken string
+}
+
+// S3ConfigFromEnv returns the configuration from the standard AWS environment variables:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION (or AWS_DEFAULT_REGION)
+// and AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL).
+func S3ConfigFromEnv() S3Config {
+	config := S3Config{
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_S3"),
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return config
+}
+
+// parseS3Location parses s3://bucket[/prefix].
+func parseS3Location(location string) (string, string, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, s3Scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid S3 location, missing bucket: %s", location)
+	}
+	return bucket, prefix, nil
+}
+
+// S3 stores objects in an S3 compatible bucket, under a key prefix.
+type S3 struct {
+	config S3Config
+	bucket string
+	prefix string
+	// Base URL for the bucket, which object keys are appended to.
+	bucketURL *url.URL
+	client    *http.Client
+}
+
+// NewS3 returns storage for objects in bucket with keys under prefix, which is treated as a
+// directory.
+func NewS3(config S3Config, bucket, prefix string) (*S3, error) {
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("missing S3 credentials")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var bucketURL *url.URL
+	if config.Endpoint != "" {
+		// S3 compatible services commonly only support path style requests.
+		endpoint, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+		}
+		if endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint: %s", config.Endpoint)
+		}
+		bucketURL = &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host, Path: "/" + bucket + "/"}
+	} else if strings.Contains(bucket, ".") {
+		// Dots in virtual hosted bucket names break TLS certificate validation.
+		bucketURL = &url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%s.amazonaws.com", config.Region), Path: "/" + bucket + "/"}
+	} else {
+		bucketURL = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, config.Region), Path: "/"}
+	}
+
+	return &S3{
+		config:    config,
+		bucket:    bucket,
+		prefix:    prefix,
+		bucketURL: bucketURL,
+		client:    http.DefaultClient,
+	}, nil
+}
+
+func (s *S3) String() string {
+	return s3Scheme + s.bucket + "/" + s.prefix
+}
+
+// newRequest returns a request for key, or for the bucket when key is empty.
+func (s *S3) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *s.bucketURL
+	u.Path += key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = encodeQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+	return req, nil
+}
+
+// s3Error is the error response body.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do signs and sends req, returning an error for unsuccessful responses.
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, payloadHash, s.config.AccessKeyID, s.config.SecretAccessKey, s.config.Region, "s3", time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	err = fmt.Errorf("S3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	var body s3Error
+	if xml.NewDecoder(resp.Body).Decode(&body) == nil && body.Code != "" {
+		err = fmt.Errorf("%w: %s: %s", err, body.Code, body.Message)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		err = errors.Join(err, fs.ErrNotExist)
+	}
+	return nil, err
+}
+
+// s3Writer buffers an object to a temporary file, uploading it on Close, as the size must be
+// known upfront.
+type s3Writer struct {
+	ctx  context.Context
+	s3   *S3
+	key  string
+	file *os.File
+	hash hash.Hash
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+func (w *s3Writer) upload() error {
+	size, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// The client closes the body, while the file is closed by Close.
+	req, err := w.s3.newRequest(w.ctx, http.MethodPut, w.key, nil, io.NopCloser(w.file))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := w.s3.do(req, hex.EncodeToString(w.hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (w *s3Writer) Close() error {
+	err := w.upload()
+	err = errors.Join(err, w.file.Close(), os.Remove(w.file.Name()))
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", w.key, err)
+	}
+	return nil
+}
+
+// Create buffers the object to a temporary file, only readable by the current user, and uploads
+// it when the writer is closed. Existing objects are overwritten.
+func (s *S3) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	file, err := os.CreateTemp("", "serialtcp-s3-*")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{ctx: ctx, s3: s, key: s.prefix + name, file: file, hash: sha256.New()}, nil
+}
+
+func (s *S3) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, s.prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// listBucketResult is the ListObjectsV2 response body.
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+func (s *S3) listPage(ctx context.Context, prefix, continuationToken string) (result listBucketResult, err error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+	if continuationToken != "" {
+		query.Set("continuation-token", continuationToken)
+	}
+	req, err := s.newRequest(ctx, http.MethodGet, "", query, nil)
+	if err != nil {
+		return result, err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return result, err
+	}
+	defer func() { err = errors.Join(err, resp.Body.Close()) }()
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("failed to parse S3 list response: %w", err)
+	}
+	return result, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	var continuationToken string
+	for {
+		result, err := s.listPage(ctx, prefix, continuationToken)
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			names = append(names, strings.TrimPrefix(content.Key, s.prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an S3 compatible service serving a single bucket, path style, listing one object per
+// page, so that continuation is exercised.
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, bucket string) *httptest.Server {
+	server := httptest.NewServer(&fakeS3{t: t, bucket: bucket, objects: map[string][]byte{}})
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" Credential=AKIDEXAMPLE/") {
+		f.t.Errorf("%s %s: unsigned request", r.Method, r.URL)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.t.Error(err)
+			return
+		}
+		sum := sha256.Sum256(body)
+		if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+			f.t.Errorf("PUT %s: payload hash %s does not match body", key, got)
+		}
+		f.objects[key] = body
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r)
+	case r.Method == http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(body)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		f.t.Errorf("list-type: %q", query.Get("list-type"))
+	}
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var result listBucketResult
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+	if start < len(keys) {
+		result.Contents = append(result.Contents, struct {
+			Key string `xml:"Key"`
+		}{keys[start]})
+	}
+	if start+1 < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(start + 1)
+	}
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listBucketResult
+	}{listBucketResult: result})
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		s3Error
+	}{s3Error: s3Error{Code: code, Message: code}})
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeS3(t, "bucket")
+	s3, err := NewS3(S3Config{
+		Endpoint:        server.URL,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "bucket", "/captures/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s3.String(), "s3://bucket/captures/"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	objects := map[string]string{
+		"20261017T092341Z-pts_0-1.capture": "hello",
+		"20261017T092342Z-pts_0-2.capture": "",
+		"with space+plus$.log":             "world\n",
+	}
+	for name, data := range objects {
+		w, err := s3.Create(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range objects {
+		r, err := s3.Open(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: read %q, want %q", name, got, want)
+		}
+	}
+
+	names, err := s3.List(ctx, "2026")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20261017T092341Z-pts_0-1.capture", "20261017T092342Z-pts_0-2.capture"}; !slices.Equal(names, want) {
+		t.Errorf("List() = %q, want %q", names, want)
+	}
+
+	if _, err := s3.Open(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() of a missing object: %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		config   S3Config
+		bucket   string
+		wantURL  string
+		wantFail bool
+	}{
+		{name: "virtual hosted", config: S3Config{AccessKeyID: "a", SecretAccessKey: "s"}, bucket: "bucket", wantURL: "https://bucket.s3.us-east-1.amazonaws.com/"},
+		{name: "dotted bucket", config: S3Config{AccessKeyID: "a", SecretAccessKey: "s", Region: "eu-west-1"}, bucket: "my.bucket", wantURL: "https://s3.eu-west-1.amazonaws.com/my.bucket/"},
+		{name: "endpoint", config: S3Config{AccessKeyID: "a", SecretAccessKey: "s", Endpoint: "http://minio:9000"}, bucket: "bucket", wantURL: "http://minio:9000/bucket/"},
+		{name: "invalid endpoint", config: S3Config{AccessKeyID: "a", SecretAccessKey: "s", Endpoint: "minio"}, bucket: "bucket", wantFail: true},
+		{name: "missing credentials", bucket: "bucket", wantFail: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s3, err := NewS3(test.config, test.bucket, "")
+			if test.wantFail {
+				if err == nil {
+					t.Fatal("NewS3() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s3.bucketURL.String(); got != test.wantURL {
+				t.Errorf("bucket URL = %q, want %q", got, test.wantURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// Package storage stores named objects, such as capture files, either on the local filesystem or
+// on S3 compatible object storage, so recordings from many bridges can be centralized.
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Storage stores flat named objects.
+type Storage interface {
+	// Create creates a new object, to be written to the returned writer. The object is only
+	// guaranteed to be stored once the writer is successfully closed.
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+	// Open opens an existing object for reading. When it does not exist, the error wraps
+	// fs.ErrNotExist.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the sorted names of all objects starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// String describes where objects are stored.
+	String() string
+}
+
+// IsRemote returns whether location refers to remote storage, rather than a local directory.
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, s3Scheme)
+}
+
+// New returns the storage at location, which is either s3://bucket[/prefix] for S3 compatible
+// storage configured from the environment (see S3ConfigFromEnv) or a local directory.
+func New(location string) (Storage, error) {
+	if strings.HasPrefix(location, s3Scheme) {
+		bucket, prefix, err := parseS3Location(location)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3(S3ConfigFromEnv(), bucket, prefix)
+	}
+	return Local(location), nil
+}
@@ -0,0 +1,232 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var errBadPacket = errors.New("bad packet")
+
+// readPacket reads a packet, returning its header byte (SOH, STX or EOT), sequence number and data.
+func (s *session) readPacket(useCRC bool, timeout time.Duration) (byte, byte, []byte, error) {
+	header, err := s.readByte(timeout)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	size := blockSize
+	switch header {
+	case eot:
+		return eot, 0, nil, nil
+	case can:
+		if err := s.readCancel(); err != nil {
+			return 0, 0, nil, err
+		}
+		return 0, 0, nil, errBadPacket
+	case soh:
+	case stx:
+		size = blockSize1K
+	default:
+		return 0, 0, nil, errBadPacket
+	}
+
+	trailer := 1
+	if useCRC {
+		trailer = 2
+	}
+	packet := make([]byte, 2+size+trailer)
+	if err := s.read(packet, timeout); err != nil {
+		return 0, 0, nil, err
+	}
+	seq, data := packet[0], packet[2:2+size]
+	if packet[1] != ^seq {
+		return 0, 0, nil, errBadPacket
+	}
+	if useCRC {
+		if crc16(data) != uint16(packet[2+size])<<8|uint16(packet[3+size]) {
+			return 0, 0, nil, errBadPacket
+		}
+	} else if checksum(data) != packet[2+size] {
+		return 0, 0, nil, errBadPacket
+	}
+	return header, seq, data, nil
+}
+
+// recoverable tells whether the transfer can continue after err, by asking for a retransmission.
+func (s *session) recoverable(err error) (bool, error) {
+	if errors.Is(err, errBadPacket) {
+		return true, s.purge()
+	}
+	return isTimeout(err), nil
+}
+
+// receiveHeader requests and receives a YMODEM header block.
+func (s *session) receiveHeader() (File, error) {
+	for range maxRetries {
+		if err := s.write(crc); err != nil {
+			return File{}, err
+		}
+		header, seq, data, err := s.readPacket(true, startTimeout)
+		if err != nil {
+			ok, err2 := s.recoverable(err)
+			if !ok || err2 != nil {
+				return File{}, errors.Join(err, err2)
+			}
+			continue
+		}
+		if header == eot || seq != 0 {
+			if err := s.write(nak); err != nil {
+				return File{}, err
+			}
+			continue
+		}
+		if err := s.write(ack); err != nil {
+			return File{}, err
+		}
+		file := File{Size: -1}
+		fields := bytes.Split(data, []byte{0})
+		file.Name = string(fields[0])
+		if len(fields) > 1 {
+			if sizeStr, _, _ := bytes.Cut(fields[1], []byte{' '}); len(sizeStr) > 0 {
+				size, err := strconv.ParseInt(string(sizeStr), 10, 64)
+				if err != nil {
+					return File{}, fmt.Errorf("invalid file size: %w", err)
+				}
+				file.Size = size
+			}
+		}
+		return file, nil
+	}
+	return File{}, errors.New("timeout waiting for sender")
+}
+
+// dataWriter writes received blocks, holding the last one back until the end of the file is
+// known, so its padding can be removed.
+type dataWriter struct {
+	w       io.Writer
+	size    int64
+	written int64
+	pending []byte
+}
+
+func (d *dataWriter) flush() error {
+	data := d.pending
+	if d.size >= 0 {
+		data = data[:min(int64(len(data)), d.size-d.written)]
+	}
+	n, err := d.w.Write(data)
+	d.written += int64(n)
+	return err
+}
+
+func (d *dataWriter) Write(data []byte) (int, error) {
+	if err := d.flush(); err != nil {
+		return 0, err
+	}
+	d.pending = bytes.Clone(data)
+	return len(data), nil
+}
+
+func (d *dataWriter) Close() error {
+	if d.size < 0 {
+		d.pending = bytes.TrimRight(d.pending, string([]byte{sub}))
+	}
+	return d.flush()
+}
+
+// receiveData receives data blocks until the end of the file, writing them to w. If size is not
+// negative, data is truncated to it, otherwise padding is removed from the last block.
+func (s *session) receiveData(protocol Protocol, w io.Writer, size int64) error {
+	useCRC := true
+	request := byte(crc)
+	expected := byte(1)
+	started := false
+	writer := &dataWriter{w: w, size: size}
+
+	for retries := 0; retries < maxRetries; {
+		if err := s.write(request); err != nil {
+			return err
+		}
+		packetTimeout := timeout
+		if !started {
+			packetTimeout = startTimeout
+		}
+		header, seq, data, err := s.readPacket(useCRC, packetTimeout)
+		if err != nil {
+			ok, err2 := s.recoverable(err)
+			if !ok || err2 != nil {
+				return errors.Join(err, err2)
+			}
+			retries++
+			if started {
+				request = nak
+			} else if protocol == XMODEM && retries == maxRetries/2 {
+				// Fall back to checksums for old senders without CRC-16 support.
+				useCRC = false
+				request = nak
+			}
+			continue
+		}
+		started = true
+		retries = 0
+		request = ack
+
+		switch {
+		case header == eot:
+			if err := writer.Close(); err != nil {
+				return err
+			}
+			return s.write(ack)
+		case seq == expected-1:
+			// Retransmission of a block whose acknowledgement was lost.
+		case seq == expected:
+			if _, err := writer.Write(data); err != nil {
+				return err
+			}
+			expected++
+		default:
+			return fmt.Errorf("unexpected block %d, expected %d", seq, expected)
+		}
+	}
+	return errors.New("too many errors")
+}
+
+// Receive receives a file over conn, writing its contents to w. It requests the transfer to start,
+// so the sender must already be waiting.
+func Receive(ctx context.Context, conn Conn, protocol Protocol, w io.Writer) (file File, err error) {
+	s := &session{ctx: ctx, conn: conn}
+	defer func() {
+		if err != nil && !errors.Is(err, ErrCanceled) {
+			err = errors.Join(err, s.cancel())
+		}
+	}()
+
+	file.Size = -1
+	if protocol == YMODEM {
+		if file, err = s.receiveHeader(); err != nil {
+			return file, err
+		}
+		if file.Name == "" {
+			return file, errors.New("sender has no files to send")
+		}
+	}
+
+	if err := s.receiveData(protocol, w, file.Size); err != nil {
+		return file, err
+	}
+
+	if protocol == YMODEM {
+		end, err := s.receiveHeader()
+		if err != nil {
+			return file, err
+		}
+		if end.Name != "" {
+			return file, fmt.Errorf("batches with more than one file are not supported: %s", end.Name)
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,186 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// waitStart waits for the receiver to request the transfer to start, returning whether it
+// requested CRC-16.
+func (s *session) waitStart() (bool, error) {
+	for retries := 0; retries < maxRetries; {
+		b, err := s.readByte(timeout)
+		if err != nil {
+			if isTimeout(err) {
+				retries++
+				continue
+			}
+			return false, err
+		}
+		switch b {
+		case crc, nak:
+			// Receivers repeat the request until the transfer starts, discard the stale ones.
+			if err := s.purge(); err != nil {
+				return false, err
+			}
+			return b == crc, nil
+		case can:
+			if err := s.readCancel(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, errors.New("timeout waiting for receiver")
+}
+
+// sendBlock sends a block, padding data to the block size, and waits for it to be acknowledged.
+func (s *session) sendBlock(seq byte, data []byte, useCRC bool) error {
+	header := byte(soh)
+	size := blockSize
+	if len(data) > blockSize {
+		header = stx
+		size = blockSize1K
+	}
+	packet := make([]byte, 0, 3+size+2)
+	packet = append(packet, header, seq, ^seq)
+	packet = append(packet, data...)
+	packet = append(packet, bytes.Repeat([]byte{sub}, size-len(data))...)
+	if useCRC {
+		sum := crc16(packet[3:])
+		packet = append(packet, byte(sum>>8), byte(sum))
+	} else {
+		packet = append(packet, checksum(packet[3:]))
+	}
+
+	for range maxRetries {
+		if _, err := s.conn.Write(packet); err != nil {
+			return err
+		}
+		b, err := s.readByte(timeout)
+		if err != nil {
+			if isTimeout(err) {
+				continue
+			}
+			return err
+		}
+		switch b {
+		case ack:
+			return nil
+		case can:
+			if err := s.readCancel(); err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("block %d not acknowledged", seq)
+}
+
+// sendEOT signals the end of the file, and waits for it to be acknowledged.
+func (s *session) sendEOT() error {
+	for range maxRetries {
+		if err := s.write(eot); err != nil {
+			return err
+		}
+		b, err := s.readByte(timeout)
+		if err != nil {
+			if isTimeout(err) {
+				continue
+			}
+			return err
+		}
+		switch b {
+		case ack:
+			return nil
+		case can:
+			if err := s.readCancel(); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.New("end of transmission not acknowledged")
+}
+
+// sendHeader sends the YMODEM header block for a file. An empty name ends the batch.
+func (s *session) sendHeader(name string, size int64) error {
+	header := make([]byte, blockSize)
+	if name != "" {
+		info := name + "\x00" + strconv.FormatInt(size, 10)
+		if len(info) > len(header) {
+			return fmt.Errorf("file name too long: %s", name)
+		}
+		copy(header, info)
+	}
+	return s.sendBlock(0, header, true)
+}
+
+func (s *session) sendData(protocol Protocol, r io.Reader, useCRC bool) error {
+	size := blockSize
+	if protocol != XMODEM {
+		size = blockSize1K
+	}
+	buf := make([]byte, size)
+	for seq := byte(1); ; seq++ {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 && err == io.EOF {
+			return nil
+		}
+		last := err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if err := s.sendBlock(seq, buf[:n], useCRC); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// Send sends the contents of r over conn, waiting for the receiver to start the transfer. name
+// and size are only used by YMODEM.
+func Send(ctx context.Context, conn Conn, protocol Protocol, name string, r io.Reader, size int64) (err error) {
+	s := &session{ctx: ctx, conn: conn}
+	defer func() {
+		if err != nil && !errors.Is(err, ErrCanceled) {
+			err = errors.Join(err, s.cancel())
+		}
+	}()
+
+	useCRC, err := s.waitStart()
+	if err != nil {
+		return err
+	}
+	if protocol == YMODEM {
+		if !useCRC {
+			return errors.New("receiver does not support YMODEM")
+		}
+		if err := s.sendHeader(name, size); err != nil {
+			return err
+		}
+		if useCRC, err = s.waitStart(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.sendData(protocol, r, useCRC); err != nil {
+		return err
+	}
+	if err := s.sendEOT(); err != nil {
+		return err
+	}
+
+	if protocol == YMODEM {
+		if _, err := s.waitStart(); err != nil {
+			return err
+		}
+		if err := s.sendHeader("", 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
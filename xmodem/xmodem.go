@@ -0,0 +1,197 @@
+// Package xmodem implements the XMODEM, XMODEM-1K and YMODEM file transfer protocols, as commonly
+// spoken by device bootloaders over serial lines.
+package xmodem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Protocol is a file transfer protocol variant.
+type Protocol int
+
+const (
+	// XMODEM transfers 128 byte blocks, checked by CRC-16 or, with old receivers, by an arithmetic
+	// checksum.
+	XMODEM Protocol = iota
+	// XMODEM1K transfers 1024 byte blocks checked by CRC-16.
+	XMODEM1K
+	// YMODEM is XMODEM-1K preceded by a header block carrying the file name and size, which
+	// allows the receiver to drop the padding of the last block.
+	YMODEM
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case XMODEM:
+		return "xmodem"
+	case XMODEM1K:
+		return "xmodem-1k"
+	case YMODEM:
+		return "ymodem"
+	default:
+		return fmt.Sprintf("Protocol(%d)", int(p))
+	}
+}
+
+// ParseProtocol parses a protocol name, as returned by Protocol.String.
+func ParseProtocol(s string) (Protocol, error) {
+	for _, p := range []Protocol{XMODEM, XMODEM1K, YMODEM} {
+		if strings.EqualFold(s, p.String()) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid protocol: %s", s)
+}
+
+// Control characters.
+const (
+	soh = 0x01
+	stx = 0x02
+	eot = 0x04
+	ack = 0x06
+	nak = 0x15
+	can = 0x18
+	crc = 'C'
+	sub = 0x1a
+)
+
+// Block sizes.
+const (
+	blockSize   = 128
+	blockSize1K = 1024
+)
+
+// How many times a block is retried before giving up.
+const maxRetries = 10
+
+// How long to wait for a response.
+const timeout = 10 * time.Second
+
+// How long the receiver waits for the transfer to start before asking again.
+const startTimeout = 3 * time.Second
+
+// How long to wait for the line to go quiet when discarding stale data.
+const purgeTimeout = 500 * time.Millisecond
+
+// ErrCanceled is returned when the remote end cancels the transfer.
+var ErrCanceled = errors.New("transfer canceled by remote")
+
+// Conn is the connection the transfer happens over, usually a net.Conn.
+type Conn interface {
+	io.ReadWriter
+	SetReadDeadline(t time.Time) error
+}
+
+// File describes a transferred file.
+type File struct {
+	// Name of the file, only known with YMODEM.
+	Name string
+	// Size of the file, or -1 if unknown.
+	Size int64
+}
+
+type session struct {
+	ctx  context.Context
+	conn Conn
+}
+
+func (s *session) setDeadline(timeout time.Duration) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := s.ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	return s.conn.SetReadDeadline(deadline)
+}
+
+func (s *session) read(p []byte, timeout time.Duration) error {
+	if err := s.setDeadline(timeout); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(s.conn, p); err != nil {
+		if s.ctx.Err() != nil {
+			return s.ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *session) readByte(timeout time.Duration) (byte, error) {
+	var b [1]byte
+	err := s.read(b[:], timeout)
+	return b[0], err
+}
+
+// readCancel reads the second CAN of a cancel request, which the first CAN was just read.
+func (s *session) readCancel() error {
+	b, err := s.readByte(timeout)
+	if err != nil {
+		return err
+	}
+	if b == can {
+		return ErrCanceled
+	}
+	return nil
+}
+
+func (s *session) write(b ...byte) error {
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// purge discards data until the line goes quiet.
+func (s *session) purge() error {
+	var b [256]byte
+	for {
+		if err := s.setDeadline(purgeTimeout); err != nil {
+			return err
+		}
+		if _, err := s.conn.Read(b[:]); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// cancel aborts the transfer on the remote end.
+func (s *session) cancel() error {
+	return s.write(can, can, can)
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}